@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
 
 	"github.com/cloudflare/cloudflare-go"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/gofiber/fiber/v2/utils"
 )
 
 // APICredentials struct holds the Cloudflare API credentials
@@ -20,6 +25,17 @@ const (
 	KeyAPIValid       = "apiValid"
 )
 
+// credentialCheckTTL is how long header credentials accepted by Cloudflare are trusted
+// before SessionEmail checks them again
+const credentialCheckTTL = 5 * time.Minute
+
+// verifiedCredentials holds the expiry of header credentials accepted by Cloudflare, by
+// credentialKey, so SessionEmail does not look up the user on every request
+var verifiedCredentials = struct {
+	sync.Mutex
+	until map[string]time.Time
+}{until: make(map[string]time.Time)}
+
 // LogoutHandler handles user logout by clearing the session
 func LogoutHandler(store *session.Store) fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -112,8 +128,29 @@ func ValidateAPIHandler(store *session.Store) fiber.Handler {
 	}
 }
 
-// GetAPIClient retrieves a Cloudflare API client using credentials from the session
+// headerCredentials returns Cloudflare credentials sent in the X-Auth-Email and X-Auth-Key
+// headers, which lets scripts and scheduled jobs call the API without a browser session
+func headerCredentials(c *fiber.Ctx) (string, string, bool) {
+	// Header values point into the request buffer, which fiber reuses after the request;
+	// the credentials are kept by audit entries, background jobs and caches
+	email := utils.CopyString(c.Get("X-Auth-Email"))
+	apiKey := utils.CopyString(c.Get("X-Auth-Key"))
+	return email, apiKey, email != "" && apiKey != ""
+}
+
+// credentialKey identifies a pair of credentials without keeping the API key itself
+func credentialKey(email, apiKey string) string {
+	sum := sha256.Sum256([]byte(email + "\x00" + apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetAPIClient retrieves a Cloudflare API client using credentials from the session, or from
+// the X-Auth-Email and X-Auth-Key headers
 func GetAPIClient(c *fiber.Ctx, store *session.Store) (*cloudflare.API, error) {
+	if email, apiKey, ok := headerCredentials(c); ok {
+		return cloudflare.New(apiKey, email)
+	}
+
 	sess, err := store.Get(c)
 	if err != nil {
 		return nil, err
@@ -144,3 +181,95 @@ func GetAPIClient(c *fiber.Ctx, store *session.Store) (*cloudflare.API, error) {
 	// Create and return API client
 	return cloudflare.New(apiKeyStr, emailStr)
 }
+
+// SessionEmail returns the email of the logged in user, used to attribute changes. Header
+// credentials are checked against Cloudflare since no session vouches for them.
+func SessionEmail(c *fiber.Ctx, store *session.Store) (string, error) {
+	if email, apiKey, ok := headerCredentials(c); ok {
+		key := credentialKey(email, apiKey)
+		now := time.Now()
+
+		verifiedCredentials.Lock()
+		until, known := verifiedCredentials.until[key]
+		verifiedCredentials.Unlock()
+		if known && now.Before(until) {
+			return email, nil
+		}
+
+		api, err := cloudflare.New(apiKey, email)
+		if err != nil {
+			return "", err
+		}
+		if _, err := api.UserDetails(context.Background()); err != nil {
+			return "", fiber.NewError(fiber.StatusUnauthorized, "Invalid API credentials")
+		}
+
+		verifiedCredentials.Lock()
+		for k, expiry := range verifiedCredentials.until {
+			if !now.Before(expiry) {
+				delete(verifiedCredentials.until, k)
+			}
+		}
+		verifiedCredentials.until[key] = now.Add(credentialCheckTTL)
+		verifiedCredentials.Unlock()
+		return email, nil
+	}
+
+	sess, err := store.Get(c)
+	if err != nil {
+		return "", err
+	}
+
+	valid := sess.Get(KeyAPIValid)
+	if valid == nil || !valid.(bool) {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "API credentials not found or invalid")
+	}
+
+	email, ok := sess.Get("apiEmail").(string)
+	if !ok {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "API credentials not found")
+	}
+	return email, nil
+}
+
+// zoneAccess is the set of zones a caller's credentials can read. The application keeps
+// zone data of everyone using it, such as the audit log and deleted records, and callers
+// only see the data of their own zones.
+type zoneAccess struct {
+	ids   map[string]bool
+	names map[string]bool
+}
+
+// callerZones lists the zones the credentials of api can access
+func callerZones(api *cloudflare.API) (zoneAccess, error) {
+	zones, err := listZones(api)
+	if err != nil {
+		return zoneAccess{}, err
+	}
+	access := zoneAccess{ids: make(map[string]bool, len(zones)), names: make(map[string]bool, len(zones))}
+	for _, zone := range zones {
+		access.ids[zone.ID] = true
+		access.names[auditZoneName(zone.Name)] = true
+	}
+	return access, nil
+}
+
+// allows reports whether data stored for a zone belongs to one of the caller's zones. Data
+// without a zone ID, kept when the zone could not be looked up, is matched by name.
+func (a zoneAccess) allows(zone, zoneID string) bool {
+	if zoneID != "" {
+		return a.ids[zoneID]
+	}
+	return a.names[auditZoneName(zone)]
+}
+
+// zoneIDForCaller looks up the ID of a zone with the caller's credentials. Stored data is
+// only returned when its zone ID matches, so the data of a zone that another account owns,
+// or that was deleted and added again, stays hidden.
+func zoneIDForCaller(api *cloudflare.API, zone string) (string, error) {
+	zoneID, err := api.ZoneIDByName(zone)
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusNotFound, "Zone not found")
+	}
+	return zoneID, nil
+}
@@ -0,0 +1,556 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+
+	"hijicloudflareDNS/validator"
+)
+
+// Conflict modes for applying records to a zone that already has records with the same
+// name and type
+const (
+	ConflictSkip      = "skip"      // Leave the existing records alone
+	ConflictOverwrite = "overwrite" // Replace the existing records
+	ConflictFail      = "fail"      // Make no changes to a zone that has conflicts
+)
+
+// Record change actions
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionDelete    = "delete"
+	ActionUnchanged = "unchanged"
+	ActionSkip      = "skip"
+	ActionConflict  = "conflict"
+	ActionInvalid   = "invalid"
+)
+
+// RecordChange describes a change made, or planned in a dry run, to a single record
+type RecordChange struct {
+	Action   string   `json:"action"`
+	Type     string   `json:"type"`
+	Name     string   `json:"name"`
+	Content  string   `json:"content"`
+	Proxied  bool     `json:"proxied"`
+	Previous string   `json:"previous,omitempty"` // Content of the existing record
+	RecordID string   `json:"record_id,omitempty"`
+	Success  bool     `json:"success"`
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Label identifies the record of a change in messages
+func (c RecordChange) Label() string {
+	if c.Type == "" {
+		return c.Content
+	}
+	return fmt.Sprintf("%s record %s", c.Type, c.Name)
+}
+
+// ZoneApplyResult reports what applying a set of records changed in one zone
+type ZoneApplyResult struct {
+	Domain      string         `json:"domain"`
+	UnicodeName string         `json:"unicode_domain,omitempty"`
+	ZoneID      string         `json:"zone_id,omitempty"`
+	Success     bool           `json:"success"`
+	DryRun      bool           `json:"dry_run"`
+	Message     string         `json:"message"`
+	Error       string         `json:"error,omitempty"`
+	Created     int            `json:"created"`
+	Updated     int            `json:"updated"`
+	Deleted     int            `json:"deleted"`
+	Unchanged   int            `json:"unchanged"`
+	Skipped     int            `json:"skipped"`
+	Failed      int            `json:"failed"`
+	Changes     []RecordChange `json:"changes"`
+}
+
+// desiredRecord is a record line resolved for a zone
+type desiredRecord struct {
+	Type    string
+	Name    string
+	Content string
+	Proxied bool
+	Payload RecordPayload
+}
+
+// plannedChange is a change together with the records it applies to
+type plannedChange struct {
+	RecordChange
+	desired  *desiredRecord
+	existing *cloudflare.DNSRecord
+}
+
+// isValidConflictMode reports whether mode is one of the conflict modes
+func isValidConflictMode(mode string) bool {
+	return mode == ConflictSkip || mode == ConflictOverwrite || mode == ConflictFail
+}
+
+// resolveRecordLines parses TYPE|NAME|CONTENT|PROXIED|COMMENT|TAGS lines for a zone, with the
+// proxy status decided by the policy of the account of api. Lines that cannot be parsed are
+// returned as invalid changes.
+func resolveRecordLines(api *cloudflare.API, lines []string, zone string, policy *ProxyPolicy) ([]desiredRecord, []RecordChange) {
+	desired := []desiredRecord{}
+	invalid := []RecordChange{}
+
+	for _, text := range lines {
+		line, err := ParseRecordLine(text)
+		if err != nil {
+			invalid = append(invalid, RecordChange{Action: ActionInvalid, Content: text, Error: err.Error()})
+			continue
+		}
+
+		recordName, err := QualifyName(line.Name, zone)
+		if err != nil {
+			invalid = append(invalid, RecordChange{Action: ActionInvalid, Type: line.Type, Name: line.Name, Content: line.Content, Error: err.Error()})
+			continue
+		}
+		recordContent, err := qualifyContent(line.Type, line.Content, zone)
+		if err != nil {
+			invalid = append(invalid, RecordChange{Action: ActionInvalid, Type: line.Type, Name: recordName, Content: line.Content, Error: err.Error()})
+			continue
+		}
+		payload, err := buildTypedRecord(line.Type, recordName, recordContent, nil, nil)
+		if err != nil {
+			invalid = append(invalid, RecordChange{Action: ActionInvalid, Type: line.Type, Name: recordName, Content: recordContent, Error: err.Error()})
+			continue
+		}
+		proxied, err := policy.Resolve(api, zone, line.Type, recordName, recordContent, line.Proxied)
+		if err != nil {
+			invalid = append(invalid, RecordChange{Action: ActionInvalid, Type: line.Type, Name: recordName, Content: recordContent, Error: err.Error()})
+			continue
+		}
+		payload.Comment = line.Comment
+		payload.Tags = line.Tags
+
+		desired = append(desired, desiredRecord{
+			Type:    line.Type,
+			Name:    recordName,
+			Content: recordContent,
+			Proxied: proxied,
+			Payload: payload,
+		})
+	}
+	return desired, invalid
+}
+
+// normalizeContent returns a canonical form of record content for comparisons: TXT content
+// is unquoted, other content is lower cased with hostname trailing dots and extra spaces removed
+func normalizeContent(recordType, content string) string {
+	content = strings.TrimSpace(content)
+	if recordType == "TXT" {
+		return unquote(content)
+	}
+
+	fields := strings.Fields(content)
+	for i, field := range fields {
+		fields[i] = strings.TrimSuffix(strings.ToLower(field), ".")
+	}
+	return strings.Join(fields, " ")
+}
+
+// sameContent reports whether a live record has the desired content
+func sameContent(d desiredRecord, record cloudflare.DNSRecord) bool {
+	return normalizeContent(d.Type, d.Content) == normalizeContent(record.Type, FormatRecordContent(record))
+}
+
+// needsUpdate reports whether a live record with the desired content differs in its proxy
+// status, or in the comment, tags and TTL when the desired record sets them
+func needsUpdate(d desiredRecord, record cloudflare.DNSRecord) bool {
+	if validator.IsProxiableType(d.Type) && d.Proxied != (record.Proxied != nil && *record.Proxied) {
+		return true
+	}
+	if d.Payload.Comment != "" && d.Payload.Comment != record.Comment {
+		return true
+	}
+	if len(d.Payload.Tags) > 0 && !sameTags(d.Payload.Tags, record.Tags) {
+		return true
+	}
+	if d.Payload.TTL > 0 && d.Payload.TTL != record.TTL {
+		return true
+	}
+	return false
+}
+
+// sameTags compares two tag lists ignoring order and case
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	normalized := func(tags []string) []string {
+		out := make([]string, len(tags))
+		for i, tag := range tags {
+			out[i] = strings.ToLower(tag)
+		}
+		sort.Strings(out)
+		return out
+	}
+	na, nb := normalized(a), normalized(b)
+	for i := range na {
+		if na[i] != nb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// recordKey identifies the set of records sharing a name and type
+func recordKey(name, recordType string) string {
+	return strings.ToLower(name) + "|" + recordType
+}
+
+// planRecords works out the changes that bring the desired records into the zone. Records are
+// compared per name and type: desired records missing from the zone are created, matching
+// records are left alone or updated, and a name and type that already holds other records
+// is a conflict handled according to mode. Every create and update is validated against
+// the zone as it will look after the changes.
+func planRecords(zone string, desired []desiredRecord, live []cloudflare.DNSRecord, mode string) []plannedChange {
+	plan := planGroups(desired, live, mode)
+	validatePlan(zone, plan, live)
+	return plan
+}
+
+// planGroups plans the changes per name and type without validating them
+func planGroups(desired []desiredRecord, live []cloudflare.DNSRecord, mode string) []plannedChange {
+	liveByKey := map[string][]cloudflare.DNSRecord{}
+	for _, record := range live {
+		key := recordKey(record.Name, record.Type)
+		liveByKey[key] = append(liveByKey[key], record)
+	}
+
+	// Group the desired records by name and type, keeping their order
+	keys := []string{}
+	groups := map[string][]int{}
+	for i, d := range desired {
+		key := recordKey(d.Name, d.Type)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	plan := []plannedChange{}
+	for _, key := range keys {
+		existing := liveByKey[key]
+		matched := make([]bool, len(existing))
+		group := []plannedChange{}
+		conflict := false
+
+		for _, i := range groups[key] {
+			d := &desired[i]
+			change := plannedChange{
+				RecordChange: RecordChange{Type: d.Type, Name: d.Name, Content: d.Content, Proxied: d.Proxied},
+				desired:      d,
+			}
+
+			change.Action = ActionCreate
+			for j := range existing {
+				if matched[j] || !sameContent(*d, existing[j]) {
+					continue
+				}
+				matched[j] = true
+				change.existing = &existing[j]
+				change.RecordID = existing[j].ID
+				change.Previous = FormatRecordContent(existing[j])
+				change.Action = ActionUnchanged
+				if needsUpdate(*d, existing[j]) {
+					change.Action = ActionUpdate
+					conflict = true
+				}
+				break
+			}
+			group = append(group, change)
+		}
+
+		// Existing records the desired set does not account for
+		for j := range existing {
+			if matched[j] {
+				continue
+			}
+			conflict = true
+			if mode == ConflictOverwrite {
+				group = append(group, deleteChange(&existing[j]))
+			}
+		}
+
+		if conflict && mode != ConflictOverwrite {
+			action := ActionSkip
+			if mode == ConflictFail {
+				action = ActionConflict
+			}
+			for i := range group {
+				if group[i].Action == ActionCreate || group[i].Action == ActionUpdate {
+					group[i].Action = action
+					if group[i].Previous == "" {
+						group[i].Previous = joinRecordContents(existing)
+					}
+				}
+			}
+		}
+		plan = append(plan, group...)
+	}
+
+	// A CNAME cannot share its name with other records, so overwriting replaces the records
+	// of other types at that name as well
+	if mode == ConflictOverwrite {
+		plan = append(plan, cnameReplacements(desired, live, plan)...)
+	}
+	return plan
+}
+
+// deleteChange plans the removal of a live record
+func deleteChange(record *cloudflare.DNSRecord) plannedChange {
+	content := FormatRecordContent(*record)
+	return plannedChange{
+		RecordChange: RecordChange{
+			Action:   ActionDelete,
+			Type:     record.Type,
+			Name:     record.Name,
+			Content:  content,
+			Proxied:  record.Proxied != nil && *record.Proxied,
+			Previous: content,
+			RecordID: record.ID,
+		},
+		existing: record,
+	}
+}
+
+// cnameReplacements returns deletes for live records that conflict with a desired record
+// because one of them is a CNAME at the same name
+func cnameReplacements(desired []desiredRecord, live []cloudflare.DNSRecord, plan []plannedChange) []plannedChange {
+	planned := map[string]bool{}
+	for _, change := range plan {
+		if change.RecordID != "" {
+			planned[change.RecordID] = true
+		}
+	}
+
+	deletes := []plannedChange{}
+	for _, d := range desired {
+		for j := range live {
+			record := &live[j]
+			if planned[record.ID] || !strings.EqualFold(record.Name, d.Name) || record.Type == d.Type {
+				continue
+			}
+			if d.Type != "CNAME" && record.Type != "CNAME" {
+				continue
+			}
+			planned[record.ID] = true
+			deletes = append(deletes, deleteChange(record))
+		}
+	}
+	return deletes
+}
+
+// validatePlan checks every create and update against the zone as it will look once the
+// plan is applied, marking the ones that fail as invalid
+func validatePlan(zone string, plan []plannedChange, live []cloudflare.DNSRecord) {
+	removed := map[string]bool{}
+	for _, change := range plan {
+		if change.Action == ActionDelete || change.Action == ActionUpdate {
+			removed[change.RecordID] = true
+		}
+	}
+
+	projected := []validator.Record{}
+	for _, record := range live {
+		if !removed[record.ID] {
+			projected = append(projected, toValidatorRecord(record))
+		}
+	}
+
+	for i := range plan {
+		change := &plan[i]
+		if change.Action != ActionCreate && change.Action != ActionUpdate {
+			continue
+		}
+
+		candidate := validator.Record{ID: change.RecordID, Type: change.Type, Name: change.Name, Content: change.Content, Proxied: change.Proxied}
+		result := validator.Validate(zone, candidate, projected)
+		if !result.Valid() {
+			change.Action = ActionInvalid
+			change.Error = result.Messages()
+			continue
+		}
+		change.Warnings = result.WarningMessages()
+		projected = append(projected, candidate)
+	}
+}
+
+// joinRecordContents lists the contents of records for reporting a conflict
+func joinRecordContents(records []cloudflare.DNSRecord) string {
+	contents := make([]string, 0, len(records))
+	for _, record := range records {
+		contents = append(contents, FormatRecordContent(record))
+	}
+	return strings.Join(contents, ", ")
+}
+
+// executePlan applies the planned deletes, updates and creates in that order, so records
+// being replaced are out of the way before their replacements are written
+func executePlan(api *cloudflare.API, zoneID string, plan []plannedChange) {
+	ctx := context.Background()
+	rc := cloudflare.ZoneIdentifier(zoneID)
+
+	for _, action := range []string{ActionDelete, ActionUpdate, ActionCreate} {
+		for i := range plan {
+			change := &plan[i]
+			if change.Action != action {
+				continue
+			}
+
+			var err error
+			switch action {
+			case ActionDelete:
+				err = api.DeleteDNSRecord(ctx, rc, change.RecordID)
+			case ActionUpdate:
+				// Keep the existing comment, tags and TTL unless the desired record sets them
+				payload := change.desired.Payload
+				if payload.Comment == "" {
+					payload.Comment = change.existing.Comment
+				}
+				if len(payload.Tags) == 0 {
+					payload.Tags = change.existing.Tags
+				}
+				if payload.TTL == 0 {
+					payload.TTL = change.existing.TTL
+				}
+				_, err = api.UpdateDNSRecord(ctx, rc, payload.updateParams(change.RecordID, change.Type, change.Name, proxiedFor(change.Type, change.Proxied)))
+			case ActionCreate:
+				var created cloudflare.DNSRecord
+				created, err = api.CreateDNSRecord(ctx, rc, change.desired.Payload.createParams(change.Type, change.Name, proxiedFor(change.Type, change.Proxied)))
+				change.RecordID = created.ID
+			}
+
+			if err != nil {
+				change.Error = err.Error()
+			} else {
+				change.Success = true
+			}
+		}
+	}
+}
+
+// ApplyRecordsToZone brings record lines into an existing zone, resolving conflicts with
+// existing records according to mode and proxying records according to policy. A snapshot
+// is taken for reason before records are changed. With dryRun the planned changes are
+// reported without being made.
+func ApplyRecordsToZone(api *cloudflare.API, policy *ProxyPolicy, snapshots *SnapshotStore, ac *auditContext, zoneID, zone string, lines []string, mode string, dryRun bool, reason string) ZoneApplyResult {
+	result := ZoneApplyResult{
+		Domain:  zone,
+		ZoneID:  zoneID,
+		DryRun:  dryRun,
+		Changes: []RecordChange{},
+	}
+	if unicode := DisplayName(zone); unicode != zone {
+		result.UnicodeName = unicode
+	}
+
+	live, _, err := api.ListDNSRecords(context.Background(), cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{})
+	if err != nil {
+		result.Error = err.Error()
+		result.Message = fmt.Sprintf("Failed to fetch existing records: %s", err.Error())
+		return result
+	}
+
+	desired, invalid := resolveRecordLines(api, lines, zone, policy)
+	plan := planRecords(zone, desired, live, mode)
+	if !dryRun && !planBlocked(plan, invalid, mode) && planChanges(plan) {
+		if err := snapshotBefore(snapshots, api, zoneID, zone, ac, reason); err != nil {
+			result.Error = err.Error()
+			result.Message = fmt.Sprintf("Failed to snapshot the zone, no changes made: %s", err.Error())
+			return result
+		}
+	}
+	applyPlan(api, &result, plan, invalid, mode)
+	return result
+}
+
+// planBlocked reports whether fail mode leaves a zone untouched because of a single
+// conflict or invalid record
+func planBlocked(plan []plannedChange, invalid []RecordChange, mode string) bool {
+	if mode != ConflictFail {
+		return false
+	}
+	if len(invalid) > 0 {
+		return true
+	}
+	for _, change := range plan {
+		if change.Action == ActionConflict || change.Action == ActionInvalid {
+			return true
+		}
+	}
+	return false
+}
+
+// planChanges reports whether a plan creates, updates or deletes any record
+func planChanges(plan []plannedChange) bool {
+	for _, change := range plan {
+		switch change.Action {
+		case ActionCreate, ActionUpdate, ActionDelete:
+			return true
+		}
+	}
+	return false
+}
+
+// applyPlan executes a plan on the zone of result, unless it is a dry run, and summarizes it.
+// In fail mode a single conflict or invalid record leaves the zone untouched.
+func applyPlan(api *cloudflare.API, result *ZoneApplyResult, plan []plannedChange, invalid []RecordChange, mode string) {
+	blocked := planBlocked(plan, invalid, mode)
+	if !result.DryRun && !blocked {
+		executePlan(api, result.ZoneID, plan)
+	}
+
+	summarizePlan(result, plan, invalid, blocked)
+}
+
+// summarizePlan fills a result with the outcome of an executed (or, for dry runs and blocked
+// zones, unexecuted) plan and counts the changes
+func summarizePlan(result *ZoneApplyResult, plan []plannedChange, invalid []RecordChange, blocked bool) {
+	for _, change := range plan {
+		if result.DryRun || blocked {
+			change.Success = change.Action != ActionInvalid && change.Action != ActionConflict
+		} else if change.Action == ActionUnchanged || change.Action == ActionSkip {
+			change.Success = true
+		}
+		result.Changes = append(result.Changes, change.RecordChange)
+	}
+	result.Changes = append(result.Changes, invalid...)
+
+	for _, change := range result.Changes {
+		switch {
+		case !change.Success:
+			result.Failed++
+		case change.Action == ActionCreate:
+			result.Created++
+		case change.Action == ActionUpdate:
+			result.Updated++
+		case change.Action == ActionDelete:
+			result.Deleted++
+		case change.Action == ActionUnchanged:
+			result.Unchanged++
+		case change.Action == ActionSkip:
+			result.Skipped++
+		}
+	}
+
+	summary := fmt.Sprintf("%d created, %d updated, %d deleted, %d unchanged, %d skipped, %d failed",
+		result.Created, result.Updated, result.Deleted, result.Unchanged, result.Skipped, result.Failed)
+	switch {
+	case blocked:
+		result.Error = "the zone has conflicting or invalid records"
+		result.Message = "No changes made: " + result.Error
+	case result.DryRun:
+		result.Success = result.Failed == 0
+		result.Message = "Dry run: " + summary
+	default:
+		result.Success = result.Failed == 0
+		result.Message = summary
+	}
+}
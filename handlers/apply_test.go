@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+func TestPlanGroups(t *testing.T) {
+	proxied, direct := true, false
+	live := []cloudflare.DNSRecord{
+		{ID: "a1", Type: "A", Name: "example.com", Content: "203.0.113.10", Proxied: &proxied},
+		{ID: "a2", Type: "A", Name: "example.com", Content: "203.0.113.11", Proxied: &proxied},
+		{ID: "w1", Type: "A", Name: "www.example.com", Content: "203.0.113.10", Proxied: &direct},
+		{ID: "t1", Type: "TXT", Name: "www.example.com", Content: "v=spf1 -all"},
+		{ID: "c1", Type: "CNAME", Name: "blog.example.com", Content: "example.com.", Proxied: &proxied},
+	}
+	record := func(recordType, name, content string, proxied bool) desiredRecord {
+		return desiredRecord{Type: recordType, Name: name, Content: content, Proxied: proxied}
+	}
+
+	tests := []struct {
+		name    string
+		desired []desiredRecord
+		mode    string
+		want    []string // Action, record ID and content of each planned change
+	}{
+		{
+			name:    "create",
+			desired: []desiredRecord{record("AAAA", "example.com", "2001:db8::1", true)},
+			mode:    ConflictSkip,
+			want:    []string{"create  2001:db8::1"},
+		},
+		{
+			name: "unchanged ignoring case and trailing dot",
+			desired: []desiredRecord{
+				record("A", "EXAMPLE.com", "203.0.113.10", true), record("A", "example.com", "203.0.113.11", true),
+				record("CNAME", "blog.example.com", "Example.com", true),
+			},
+			mode: ConflictFail,
+			want: []string{"unchanged a1 203.0.113.10", "unchanged a2 203.0.113.11", "unchanged c1 Example.com"},
+		},
+		{
+			name:    "proxy change is skipped",
+			desired: []desiredRecord{record("A", "www.example.com", "203.0.113.10", true)},
+			mode:    ConflictSkip,
+			want:    []string{"skip w1 203.0.113.10"},
+		},
+		{
+			name:    "proxy change is updated when overwriting",
+			desired: []desiredRecord{record("A", "www.example.com", "203.0.113.10", true)},
+			mode:    ConflictOverwrite,
+			want:    []string{"update w1 203.0.113.10"},
+		},
+		{
+			name:    "extra record is a conflict",
+			desired: []desiredRecord{record("A", "example.com", "203.0.113.10", true), record("A", "example.com", "203.0.113.12", true)},
+			mode:    ConflictFail,
+			want:    []string{"unchanged a1 203.0.113.10", "conflict  203.0.113.12"},
+		},
+		{
+			name:    "overwrite deletes records not in the set",
+			desired: []desiredRecord{record("A", "example.com", "203.0.113.12", true)},
+			mode:    ConflictOverwrite,
+			want:    []string{"create  203.0.113.12", "delete a1 203.0.113.10", "delete a2 203.0.113.11"},
+		},
+		{
+			name:    "CNAME replaces other types when overwriting",
+			desired: []desiredRecord{record("CNAME", "www.example.com", "example.com", true)},
+			mode:    ConflictOverwrite,
+			want:    []string{"create  example.com", "delete w1 203.0.113.10", "delete t1 v=spf1 -all"},
+		},
+		{
+			name:    "record replaces a CNAME when overwriting",
+			desired: []desiredRecord{record("A", "blog.example.com", "203.0.113.20", false)},
+			mode:    ConflictOverwrite,
+			want:    []string{"create  203.0.113.20", "delete c1 example.com."},
+		},
+		{
+			name:    "CNAME replacement needs overwrite",
+			desired: []desiredRecord{record("CNAME", "www.example.com", "example.com", true)},
+			mode:    ConflictSkip,
+			want:    []string{"create  example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planGroups(tt.desired, live, tt.mode)
+			got := make([]string, len(plan))
+			for i, change := range plan {
+				got[i] = change.Action + " " + change.RecordID + " " + change.Content
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("plan = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
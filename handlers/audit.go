@@ -0,0 +1,561 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// Audited actions
+const (
+	AuditRecordCreate    = "record.create"
+	AuditRecordUpdate    = "record.update"
+	AuditRecordDelete    = "record.delete"
+	AuditRecordUndo      = "record.undo"
+	AuditRecordCopy      = "record.copy"
+	AuditRecordReplace   = "record.replace"
+	AuditZoneAdd         = "zone.add"
+	AuditZoneClone       = "zone.clone"
+	AuditZoneDelete      = "zone.delete"
+	AuditZonePause       = "zone.pause"
+	AuditZoneUnpause     = "zone.unpause"
+	AuditZoneDevMode     = "zone.dev_mode"
+	AuditZoneSettings    = "zone.settings"
+	AuditZoneDNSSEC      = "zone.dnssec"
+	AuditTemplateApply   = "template.apply"
+	AuditSnapshotRestore = "snapshot.restore"
+)
+
+// Sources of audited changes
+const (
+	SourceUI   = "ui"   // The web interface, authenticated by the session
+	SourceAPI  = "api"  // Scripts using the X-Auth-Email and X-Auth-Key headers
+	SourceBulk = "bulk" // Bulk jobs changing many records or zones at once
+)
+
+// AuditRecord is the state of a DNS record before or after a change
+type AuditRecord struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Content string   `json:"content"`
+	Proxied bool     `json:"proxied"`
+	TTL     int      `json:"ttl,omitempty"`
+	Comment string   `json:"comment,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// AuditEntry is a single change made through the application
+type AuditEntry struct {
+	ID        string       `json:"id"`
+	Timestamp time.Time    `json:"timestamp"`
+	Actor     string       `json:"actor"`
+	Source    string       `json:"source"`
+	RequestID string       `json:"request_id,omitempty"`
+	Action    string       `json:"action"`
+	Zone      string       `json:"zone"`
+	ZoneID    string       `json:"zone_id,omitempty"`
+	RecordID  string       `json:"record_id,omitempty"`
+	Before    *AuditRecord `json:"before,omitempty"`
+	After     *AuditRecord `json:"after,omitempty"`
+	Success   bool         `json:"success"`
+	Error     string       `json:"error,omitempty"`
+	Detail    string       `json:"detail,omitempty"`
+}
+
+// AuditLog is an append-only log of changes, stored as one JSON object per line in
+// audit.jsonl in the data directory. Entries are never modified or removed. Since the log
+// grows without bound it is not kept in memory; every search reads it from disk.
+type AuditLog struct {
+	mu   sync.RWMutex
+	path string
+}
+
+// NewAuditLog opens the audit log in dataDir, failing when the existing log cannot be read
+func NewAuditLog(dataDir string) (*AuditLog, error) {
+	l := &AuditLog{path: filepath.Join(dataDir, "audit.jsonl")}
+	if err := l.scan(func(AuditEntry) {}); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// scan calls fn for every entry of the log, oldest first. The caller must hold the lock.
+func (l *AuditLog) scan(fn func(AuditEntry)) error {
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", l.path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		// A line torn by a crash during a write is skipped rather than failing the read
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			fn(entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// Append adds entries to the end of the log
+func (l *AuditLog) Append(entries ...AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var buf []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// AuditQuery filters the audit log. Empty fields match everything.
+type AuditQuery struct {
+	Text   string    // Matched against actor, zone, record names and contents, request ID and detail
+	Zone   string    // Zone name
+	Actor  string    // Actor email
+	Action string    // One of the audited actions
+	Source string    // One of the sources
+	Since  time.Time // Entries at or after this time
+	Until  time.Time // Entries before this time
+
+	caller string      // Email of the caller, whose own entries are always shown
+	access *zoneAccess // Zones the caller can access; nil matches every zone
+}
+
+// matches reports whether an entry satisfies the query
+func (q AuditQuery) matches(e AuditEntry) bool {
+	if q.access != nil && !q.access.allows(e.Zone, e.ZoneID) && !strings.EqualFold(e.Actor, q.caller) {
+		return false
+	}
+	if q.Zone != "" && !strings.EqualFold(e.Zone, q.Zone) {
+		return false
+	}
+	if q.Actor != "" && !strings.EqualFold(e.Actor, q.Actor) {
+		return false
+	}
+	if q.Action != "" && e.Action != q.Action {
+		return false
+	}
+	if q.Source != "" && e.Source != q.Source {
+		return false
+	}
+	if !q.Since.IsZero() && e.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Timestamp.Before(q.Until) {
+		return false
+	}
+	if q.Text == "" {
+		return true
+	}
+
+	fields := []string{e.Actor, e.Zone, DisplayName(e.Zone), e.RecordID, e.RequestID, e.Detail, e.Error}
+	for _, r := range []*AuditRecord{e.Before, e.After} {
+		if r != nil {
+			fields = append(fields, r.Type, r.Name, DisplayName(r.Name), r.Content, r.Comment)
+		}
+	}
+	text := strings.ToLower(q.Text)
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// Search returns the entries matching the query, newest first, along with the total number
+// of matches. A limit of 0 returns every match.
+func (l *AuditLog) Search(q AuditQuery, offset, limit int) ([]AuditEntry, int, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	// The log is read oldest first, so only the newest offset+limit matches are kept
+	var window []AuditEntry
+	total := 0
+	err := l.scan(func(e AuditEntry) {
+		if !q.matches(e) {
+			return
+		}
+		total++
+		window = append(window, e)
+		if limit > 0 && len(window) > offset+limit {
+			window = window[1:]
+		}
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	matches := []AuditEntry{}
+	for i := len(window) - 1 - offset; i >= 0 && (limit == 0 || len(matches) < limit); i-- {
+		matches = append(matches, window[i])
+	}
+	return matches, total, nil
+}
+
+// auditRecordFrom captures the state of a Cloudflare record
+func auditRecordFrom(record cloudflare.DNSRecord) *AuditRecord {
+	return &AuditRecord{
+		Type:    record.Type,
+		Name:    record.Name,
+		Content: FormatRecordContent(record),
+		Proxied: record.Proxied != nil && *record.Proxied,
+		TTL:     record.TTL,
+		Comment: record.Comment,
+		Tags:    record.Tags,
+	}
+}
+
+// auditZoneName returns the canonical name of a zone for the audit log, falling back to the
+// name as given when it cannot be normalized
+func auditZoneName(zone string) string {
+	if ascii, err := NormalizeZone(zone); err == nil {
+		return ascii
+	}
+	return zone
+}
+
+// auditContext attributes the changes of one request
+type auditContext struct {
+	audit     *AuditLog
+	actor     string
+	source    string
+	requestID string
+}
+
+// newAuditContext identifies who is making the changes of a request and how. Bulk jobs are
+// marked as such; other requests come from the UI or, with header credentials, the API.
+// The actor is the email confirmed by the session or by Cloudflare, so a header naming
+// someone else is not recorded as them.
+func newAuditContext(c *fiber.Ctx, store *session.Store, audit *AuditLog, bulk bool) *auditContext {
+	ac := &auditContext{audit: audit, source: SourceUI}
+	if _, _, ok := headerCredentials(c); ok {
+		ac.source = SourceAPI
+	}
+	if email, err := SessionEmail(c, store); err == nil {
+		ac.actor = email
+	}
+	if bulk {
+		ac.source = SourceBulk
+	}
+	// The request ID can come from the X-Request-ID header, whose value points into the
+	// request buffer; background jobs record entries after the request has returned
+	requestID, _ := c.Locals("requestid").(string)
+	ac.requestID = utils.CopyString(requestID)
+	return ac
+}
+
+// record appends entries to the audit log, filling in the attribution. Failures to write the
+// log are reported on the server console but never fail the change itself.
+func (ac *auditContext) record(entries ...AuditEntry) {
+	if ac == nil || ac.audit == nil {
+		return
+	}
+	now := time.Now().UTC()
+	for i := range entries {
+		entries[i].ID = newID()
+		entries[i].Timestamp = now
+		entries[i].Actor = ac.actor
+		entries[i].Source = ac.source
+		entries[i].RequestID = ac.requestID
+	}
+	if err := ac.audit.Append(entries...); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// errorString returns the message of err, or an empty string when err is nil
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// recordChange logs a single record change
+func (ac *auditContext) recordChange(action, zone, zoneID, recordID string, before, after *AuditRecord, err error) {
+	entry := AuditEntry{
+		Action:   action,
+		Zone:     zone,
+		ZoneID:   zoneID,
+		RecordID: recordID,
+		Before:   before,
+		After:    after,
+		Success:  err == nil,
+		Error:    errorString(err),
+	}
+	ac.record(entry)
+}
+
+// recordApply logs the record changes made while applying records to a zone, followed by a
+// summary entry with the given action unless it is empty. Dry runs are not logged.
+func (ac *auditContext) recordApply(result ZoneApplyResult, action, detail string) {
+	if result.DryRun {
+		return
+	}
+
+	entries := []AuditEntry{}
+	// A result with an error made no changes at all
+	if result.Error == "" {
+		for _, change := range result.Changes {
+			entry := AuditEntry{
+				Zone:     result.Domain,
+				ZoneID:   result.ZoneID,
+				RecordID: change.RecordID,
+				Success:  change.Success,
+				Error:    change.Error,
+				Detail:   detail,
+			}
+			state := &AuditRecord{Type: change.Type, Name: change.Name, Content: change.Content, Proxied: change.Proxied}
+			switch change.Action {
+			case ActionCreate:
+				entry.Action, entry.After = AuditRecordCreate, state
+			case ActionUpdate:
+				entry.Action, entry.After = AuditRecordUpdate, state
+				entry.Before = &AuditRecord{Type: change.Type, Name: change.Name, Content: change.Previous}
+			case ActionDelete:
+				entry.Action, entry.Before = AuditRecordDelete, state
+			default:
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	if action != "" {
+		entries = append(entries, AuditEntry{
+			Action:  action,
+			Zone:    result.Domain,
+			ZoneID:  result.ZoneID,
+			Success: result.Success,
+			Error:   result.Error,
+			Detail:  fmt.Sprintf("%s: %s", detail, result.Message),
+		})
+	}
+	ac.record(entries...)
+}
+
+// parseAuditQuery reads the audit filters from the query string
+func parseAuditQuery(c *fiber.Ctx) (AuditQuery, error) {
+	q := AuditQuery{
+		Text:   strings.TrimSpace(c.Query("q")),
+		Actor:  strings.TrimSpace(c.Query("actor")),
+		Action: strings.TrimSpace(c.Query("action")),
+		Source: strings.TrimSpace(c.Query("source")),
+	}
+	if zone := strings.TrimSpace(c.Query("zone")); zone != "" {
+		ascii, err := NormalizeZone(zone)
+		if err != nil {
+			return q, err
+		}
+		q.Zone = ascii
+	}
+	for key, target := range map[string]*time.Time{"from": &q.Since, "to": &q.Until} {
+		value := strings.TrimSpace(c.Query(key))
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			// Plain dates cover the whole day
+			if t, err = time.Parse("2006-01-02", value); err != nil {
+				return q, fmt.Errorf("invalid %s time %q, expected RFC 3339 or YYYY-MM-DD", key, value)
+			}
+			if key == "to" {
+				t = t.AddDate(0, 0, 1)
+			}
+		}
+		*target = t
+	}
+	return q, nil
+}
+
+// AuditLogHandler searches the audit log, newest first
+func AuditLogHandler(store *session.Store, audit *AuditLog) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+		caller, err := SessionEmail(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		q, err := parseAuditQuery(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		// Only the changes to the caller's zones, and the caller's own changes, are shown
+		access, err := callerZones(api)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch domains",
+				"error":   err.Error(),
+			})
+		}
+		q.caller, q.access = caller, &access
+
+		offset, _ := strconv.Atoi(c.Query("offset", "0"))
+		limit, _ := strconv.Atoi(c.Query("limit", "50"))
+		if offset < 0 {
+			offset = 0
+		}
+		if limit < 1 || limit > 500 {
+			limit = 50
+		}
+
+		entries, total, err := audit.Search(q, offset, limit)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to read audit log",
+				"error":   err.Error(),
+			})
+		}
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    entries,
+			"total":   total,
+			"offset":  offset,
+			"limit":   limit,
+		})
+	}
+}
+
+// ExportAuditLogHandler downloads the entries matching the filters as JSON
+func ExportAuditLogHandler(store *session.Store, audit *AuditLog) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+		caller, err := SessionEmail(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		q, err := parseAuditQuery(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		// Only the changes to the caller's zones, and the caller's own changes, are shown
+		access, err := callerZones(api)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch domains",
+				"error":   err.Error(),
+			})
+		}
+		q.caller, q.access = caller, &access
+
+		entries, _, err := audit.Search(q, 0, 0)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to read audit log",
+				"error":   err.Error(),
+			})
+		}
+		body, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to export audit log",
+				"error":   err.Error(),
+			})
+		}
+
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		c.Attachment(fmt.Sprintf("audit-%s.json", time.Now().UTC().Format("20060102-150405")))
+		return c.Send(body)
+	}
+}
+
+// RenderAuditPageHandler renders the audit log page
+func RenderAuditPageHandler(store *session.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sess, err := store.Get(c)
+		if err != nil {
+			return c.Redirect("/")
+		}
+
+		valid := sess.Get(KeyAPIValid)
+		if valid == nil || !valid.(bool) {
+			return c.Redirect("/")
+		}
+
+		email, _ := sess.Get("apiEmail").(string)
+		return c.Render("audit", fiber.Map{
+			"Email": email,
+		})
+	}
+}
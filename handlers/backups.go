@@ -0,0 +1,700 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+// DefaultBackupKeep is the number of backups kept per zone when BACKUP_KEEP is not set
+const DefaultBackupKeep = 30
+
+// What started a backup run
+const (
+	BackupTriggerSchedule = "schedule"
+	BackupTriggerManual   = "manual"
+)
+
+// backupTimeFormat names the backup files of a zone in directory mode
+const backupTimeFormat = "20060102T150405Z"
+
+// ErrBackupRunning is returned when a backup is requested while another one is running
+var ErrBackupRunning = errors.New("a backup is already running")
+
+// ErrBackupCredentials is returned when a backup is requested without configured credentials
+var ErrBackupCredentials = errors.New("backups need CLOUDFLARE_EMAIL and CLOUDFLARE_API_KEY")
+
+// BackupConfig controls where, how often and how long zones are backed up
+type BackupConfig struct {
+	Dir      string        // Directory the backups are written to
+	Interval time.Duration // Time between scheduled backups, zero disables the schedule
+	Keep     int           // Backups kept per zone in directory mode, zero keeps all
+	MaxAge   time.Duration // Backups older than this are removed in directory mode, zero keeps all
+	Git      bool          // Keep one file per zone and commit every run to a git repository in Dir
+	Email    string        // Credentials used by scheduled and manual backups
+	APIKey   string
+}
+
+// BackupConfigFromEnv reads the backup configuration from the BACKUP_* environment
+// variables. Scheduled backups use CLOUDFLARE_EMAIL and CLOUDFLARE_API_KEY since no
+// browser session is available to them.
+func BackupConfigFromEnv(dataDir string) (BackupConfig, error) {
+	config := BackupConfig{
+		Dir:    os.Getenv("BACKUP_DIR"),
+		Keep:   DefaultBackupKeep,
+		Email:  os.Getenv("CLOUDFLARE_EMAIL"),
+		APIKey: os.Getenv("CLOUDFLARE_API_KEY"),
+	}
+	if config.Dir == "" {
+		config.Dir = filepath.Join(dataDir, "backups")
+	}
+
+	if value := os.Getenv("BACKUP_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < time.Minute {
+			return config, fmt.Errorf("invalid BACKUP_INTERVAL %q: use a duration of at least 1m such as 24h", value)
+		}
+		config.Interval = interval
+	}
+	if value := os.Getenv("BACKUP_KEEP"); value != "" {
+		keep, err := strconv.Atoi(value)
+		if err != nil || keep < 0 {
+			return config, fmt.Errorf("invalid BACKUP_KEEP %q: use a number of backups, or 0 to keep all", value)
+		}
+		config.Keep = keep
+	}
+	if value := os.Getenv("BACKUP_MAX_AGE"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge < 0 {
+			return config, fmt.Errorf("invalid BACKUP_MAX_AGE %q: use a duration such as 720h", value)
+		}
+		config.MaxAge = maxAge
+	}
+	if value := os.Getenv("BACKUP_GIT"); value != "" {
+		git, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid BACKUP_GIT %q: use true or false", value)
+		}
+		config.Git = git
+	}
+	return config, nil
+}
+
+// ZoneBackup is the JSON form of a zone backup, written next to the BIND export
+type ZoneBackup struct {
+	Zone        string           `json:"zone"`
+	ZoneID      string           `json:"zone_id"`
+	ExportedAt  string           `json:"exported_at,omitempty"`
+	RecordCount int              `json:"record_count"`
+	Records     []SnapshotRecord `json:"records"`
+}
+
+// BackupZoneStatus is the backup state of a single zone
+type BackupZoneStatus struct {
+	Zone        string     `json:"zone"`
+	ZoneID      string     `json:"zone_id"`
+	LastAttempt time.Time  `json:"last_attempt"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	RecordCount int        `json:"record_count"`
+	Files       []string   `json:"files,omitempty"` // Relative to the backup directory
+	Error       string     `json:"error,omitempty"`
+}
+
+// BackupRun summarizes a backup of all zones
+type BackupRun struct {
+	Trigger    string    `json:"trigger"`
+	Actor      string    `json:"actor,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Zones      int       `json:"zones"`
+	Failed     int       `json:"failed"`
+	Commit     string    `json:"commit,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// backupState is persisted in backups.json in the data directory
+type backupState struct {
+	LastRun *BackupRun                   `json:"last_run,omitempty"`
+	Zones   map[string]*BackupZoneStatus `json:"zones"`
+}
+
+// BackupStatus is the configuration and state shown on the backups page
+type BackupStatus struct {
+	Dir       string             `json:"dir"`
+	Interval  string             `json:"interval,omitempty"`
+	Scheduled bool               `json:"scheduled"`
+	Keep      int                `json:"keep"`
+	MaxAge    string             `json:"max_age,omitempty"`
+	Git       bool               `json:"git"`
+	Running   bool               `json:"running"`
+	NextRun   *time.Time         `json:"next_run,omitempty"`
+	LastRun   *BackupRun         `json:"last_run,omitempty"`
+	Zones     []BackupZoneStatus `json:"zones"`
+	Owner     bool               `json:"owner"` // The caller is the account backups run with
+}
+
+// forCaller limits the status to what a caller may see. Only the account backups run with
+// sees the backup directory and the outcome of the whole last run; others see its timing,
+// who started it when it was them, and their own zones.
+func (s BackupStatus) forCaller(caller, owner string, access zoneAccess) BackupStatus {
+	zones := make([]BackupZoneStatus, 0, len(s.Zones))
+	for _, zone := range s.Zones {
+		if access.allows(zone.Zone, zone.ZoneID) {
+			zones = append(zones, zone)
+		}
+	}
+	s.Zones = zones
+
+	s.Owner = owner != "" && strings.EqualFold(caller, owner)
+	if s.Owner {
+		return s
+	}
+	s.Dir = ""
+	if s.LastRun != nil {
+		run := BackupRun{Trigger: s.LastRun.Trigger, StartedAt: s.LastRun.StartedAt, FinishedAt: s.LastRun.FinishedAt}
+		if strings.EqualFold(s.LastRun.Actor, caller) {
+			run.Actor = s.LastRun.Actor
+		}
+		s.LastRun = &run
+	}
+	return s
+}
+
+// BackupManager exports every zone as BIND and JSON files, on a schedule or on request.
+//
+// In directory mode each run writes <zone>/<time>.zone and <zone>/<time>.json and old
+// backups are removed by count and age. In git mode each run overwrites <zone>.zone and
+// <zone>.json and commits them, so the history is kept by git instead.
+type BackupManager struct {
+	mu        sync.Mutex
+	config    BackupConfig
+	path      string
+	state     backupState
+	running   bool
+	scheduled bool
+	nextRun   time.Time
+	zoneLocks map[string]*sync.Mutex // Serialize writes of the files of each zone
+	gitMu     sync.Mutex             // Serializes commits to the backup repository
+}
+
+// NewBackupManager loads the backup state from dataDir
+func NewBackupManager(dataDir string, config BackupConfig) (*BackupManager, error) {
+	m := &BackupManager{
+		config:    config,
+		path:      filepath.Join(dataDir, "backups.json"),
+		state:     backupState{Zones: map[string]*BackupZoneStatus{}},
+		zoneLocks: map[string]*sync.Mutex{},
+	}
+	if err := readJSONFile(m.path, &m.state); err != nil {
+		return nil, fmt.Errorf("failed to load backup status %s: %w", m.path, err)
+	}
+	if m.state.Zones == nil {
+		m.state.Zones = map[string]*BackupZoneStatus{}
+	}
+	return m, nil
+}
+
+// Start runs scheduled backups in the background. Nothing is scheduled without an interval
+// or without credentials. A backup that is overdue, for example after a restart, runs right away.
+func (m *BackupManager) Start() {
+	if m.config.Interval <= 0 {
+		return
+	}
+	if m.config.Email == "" || m.config.APIKey == "" {
+		log.Printf("Scheduled backups disabled: CLOUDFLARE_EMAIL and CLOUDFLARE_API_KEY are required")
+		return
+	}
+
+	m.mu.Lock()
+	next := time.Now()
+	if m.state.LastRun != nil {
+		if due := m.state.LastRun.StartedAt.Add(m.config.Interval); due.After(next) {
+			next = due
+		}
+	}
+	m.scheduled = true
+	m.nextRun = next
+	m.mu.Unlock()
+
+	log.Printf("Scheduled backups every %s to %s, next at %s", m.config.Interval, m.config.Dir, next.Format(time.RFC3339))
+	go func() {
+		for {
+			time.Sleep(time.Until(next))
+			next = time.Now().Add(m.config.Interval)
+			m.mu.Lock()
+			m.nextRun = next
+			m.mu.Unlock()
+
+			if _, err := m.Run(BackupTriggerSchedule, m.config.Email); err != nil {
+				log.Printf("Scheduled backup skipped: %v", err)
+			}
+		}
+	}()
+}
+
+// begin marks a backup as running
+func (m *BackupManager) begin() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running {
+		return ErrBackupRunning
+	}
+	m.running = true
+	return nil
+}
+
+// client returns an API client with the configured backup credentials. Backups always use
+// them, so the backup directory only ever holds the zones of that account.
+func (m *BackupManager) client() (*cloudflare.API, error) {
+	if m.config.Email == "" || m.config.APIKey == "" {
+		return nil, ErrBackupCredentials
+	}
+	return cloudflare.New(m.config.APIKey, m.config.Email)
+}
+
+// Run backs up every zone the configured credentials can access and waits for it to finish
+func (m *BackupManager) Run(trigger, actor string) (BackupRun, error) {
+	api, err := m.client()
+	if err != nil {
+		return BackupRun{}, err
+	}
+	if err := m.begin(); err != nil {
+		return BackupRun{}, err
+	}
+	return m.run(api, trigger, actor), nil
+}
+
+// RunInBackground starts a backup of every zone without waiting for it
+func (m *BackupManager) RunInBackground(trigger, actor string) error {
+	api, err := m.client()
+	if err != nil {
+		return err
+	}
+	if err := m.begin(); err != nil {
+		return err
+	}
+	go m.run(api, trigger, actor)
+	return nil
+}
+
+// run performs a backup started with begin
+func (m *BackupManager) run(api *cloudflare.API, trigger, actor string) BackupRun {
+	defer func() {
+		m.mu.Lock()
+		m.running = false
+		m.mu.Unlock()
+	}()
+
+	run := BackupRun{
+		Trigger:   trigger,
+		Actor:     actor,
+		StartedAt: time.Now().UTC(),
+	}
+
+	zones, err := api.ListZones(context.Background())
+	if err != nil {
+		run.Error = fmt.Sprintf("Failed to list zones: %s", err.Error())
+	} else if err := os.MkdirAll(m.config.Dir, 0o755); err != nil {
+		run.Error = fmt.Sprintf("Failed to create backup directory: %s", err.Error())
+	} else {
+		for _, zone := range zones {
+			status := m.backupZone(api, zone, run.StartedAt)
+			run.Zones++
+			if status.Error != "" {
+				run.Failed++
+				log.Printf("Backup of %s failed: %s", zone.Name, status.Error)
+			}
+			m.mu.Lock()
+			m.state.Zones[zone.Name] = &status
+			m.mu.Unlock()
+		}
+
+		if m.config.Git {
+			message := fmt.Sprintf("Backup of %d zones", run.Zones)
+			if run.Failed > 0 {
+				message += fmt.Sprintf(" (%d failed)", run.Failed)
+			}
+			commit, err := m.commit(message)
+			if err != nil {
+				run.Error = fmt.Sprintf("Failed to commit backup: %s", err.Error())
+			}
+			run.Commit = commit
+		}
+	}
+	run.FinishedAt = time.Now().UTC()
+
+	m.mu.Lock()
+	m.state.LastRun = &run
+	if err := writeJSONFile(m.path, m.state); err != nil {
+		log.Printf("Failed to save backup status: %v", err)
+	}
+	m.mu.Unlock()
+
+	if run.Error != "" {
+		log.Printf("Backup (%s) failed: %s", trigger, run.Error)
+	} else {
+		log.Printf("Backup (%s) of %d zones finished with %d failures", trigger, run.Zones, run.Failed)
+	}
+	return run
+}
+
+// ExportZone backs up a single zone right away, such as before it is deleted, and returns
+// the written files. In git mode only those files are committed, with message. An export can
+// run during a backup of all zones; writing the same zone waits for the other to finish.
+func (m *BackupManager) ExportZone(api *cloudflare.API, zone cloudflare.Zone, message string) ([]string, error) {
+	if err := os.MkdirAll(m.config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	status := m.backupZone(api, zone, time.Now().UTC())
+	if status.Error != "" {
+		return nil, errors.New(status.Error)
+	}
+
+	m.mu.Lock()
+	m.state.Zones[zone.Name] = &status
+	if err := writeJSONFile(m.path, m.state); err != nil {
+		log.Printf("Failed to save backup status: %v", err)
+	}
+	m.mu.Unlock()
+
+	if m.config.Git {
+		if _, err := m.commit(message, status.Files...); err != nil {
+			return nil, fmt.Errorf("failed to commit export: %w", err)
+		}
+	}
+	return status.Files, nil
+}
+
+// backupZone writes the backup files of a zone and returns its updated status. The last
+// success of a zone is kept when the new attempt fails.
+func (m *BackupManager) backupZone(api *cloudflare.API, zone cloudflare.Zone, at time.Time) BackupZoneStatus {
+	m.mu.Lock()
+	lock, ok := m.zoneLocks[zone.Name]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.zoneLocks[zone.Name] = lock
+	}
+	m.mu.Unlock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	m.mu.Lock()
+	status := BackupZoneStatus{Zone: zone.Name}
+	if previous, ok := m.state.Zones[zone.Name]; ok {
+		status = *previous
+	}
+	m.mu.Unlock()
+
+	status.ZoneID = zone.ID
+	status.LastAttempt = at
+	files, count, err := m.writeZoneBackup(api, zone, at)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	status.Error = ""
+	status.LastSuccess = &at
+	status.RecordCount = count
+	status.Files = files
+	return status
+}
+
+// writeZoneBackup exports a zone as BIND and JSON files, returning their paths relative to
+// the backup directory
+func (m *BackupManager) writeZoneBackup(api *cloudflare.API, zone cloudflare.Zone, at time.Time) ([]string, int, error) {
+	if zone.Name == "" || strings.ContainsAny(zone.Name, `/\`) || strings.HasPrefix(zone.Name, ".") {
+		return nil, 0, fmt.Errorf("invalid zone name %q", zone.Name)
+	}
+
+	rc := cloudflare.ZoneIdentifier(zone.ID)
+	live, _, err := api.ListDNSRecords(context.Background(), rc, cloudflare.ListDNSRecordsParams{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch records: %w", err)
+	}
+	bind, err := api.ExportDNSRecords(context.Background(), rc, cloudflare.ExportDNSRecordsParams{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to export BIND file: %w", err)
+	}
+
+	// Records are sorted so that unchanged zones produce identical files
+	records := snapshotRecords(live)
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		if records[i].Type != records[j].Type {
+			return records[i].Type < records[j].Type
+		}
+		return records[i].Content < records[j].Content
+	})
+	backup := ZoneBackup{
+		Zone:        zone.Name,
+		ZoneID:      zone.ID,
+		RecordCount: len(records),
+		Records:     records,
+	}
+
+	base := zone.Name
+	if m.config.Git {
+		// The export time would make every run a change, git already records it
+		bind = stripExportTime(bind)
+	} else {
+		base = filepath.Join(zone.Name, at.Format(backupTimeFormat))
+		backup.ExportedAt = at.Format(time.RFC3339)
+	}
+
+	if err := writeJSONFile(filepath.Join(m.config.Dir, base+".json"), backup); err != nil {
+		return nil, 0, fmt.Errorf("failed to write JSON backup: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(m.config.Dir, base+".zone"), []byte(bind), 0o600); err != nil {
+		return nil, 0, fmt.Errorf("failed to write BIND backup: %w", err)
+	}
+	if !m.config.Git {
+		m.pruneZone(filepath.Join(m.config.Dir, zone.Name), at)
+	}
+	return []string{base + ".zone", base + ".json"}, len(records), nil
+}
+
+// stripExportTime removes the export time comment from a BIND export
+func stripExportTime(bind string) string {
+	var out strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(bind))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, ";; Exported:") {
+			continue
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.String()
+}
+
+// pruneZone removes the backups of a zone beyond the retention count or age. The newest
+// backup is always kept.
+func (m *BackupManager) pruneZone(dir string, now time.Time) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	stamps := map[string]time.Time{}
+	for _, entry := range entries {
+		stem := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".json"), ".zone")
+		if t, err := time.Parse(backupTimeFormat, stem); err == nil {
+			stamps[stem] = t
+		}
+	}
+	ordered := make([]string, 0, len(stamps))
+	for stem := range stamps {
+		ordered = append(ordered, stem)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ordered)))
+
+	for i, stem := range ordered[min(1, len(ordered)):] {
+		tooMany := m.config.Keep > 0 && i+1 >= m.config.Keep
+		tooOld := m.config.MaxAge > 0 && now.Sub(stamps[stem]) > m.config.MaxAge
+		if tooMany || tooOld {
+			os.Remove(filepath.Join(dir, stem+".json"))
+			os.Remove(filepath.Join(dir, stem+".zone"))
+		}
+	}
+}
+
+// commit commits changes in the backup directory, one commit at a time
+func (m *BackupManager) commit(message string, paths ...string) (string, error) {
+	m.gitMu.Lock()
+	defer m.gitMu.Unlock()
+	return commitBackup(m.config.Dir, message, paths...)
+}
+
+// commitBackup commits the changes to paths in the backup directory, or all changes when no
+// paths are given, creating the repository when needed. It returns the short hash of the
+// commit, or "" when nothing changed.
+func commitBackup(dir, message string, paths ...string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if _, err := runGit(dir, "init", "-q"); err != nil {
+			return "", err
+		}
+	}
+	pathspec := append([]string{"--"}, paths...)
+	if _, err := runGit(dir, append([]string{"add", "-A"}, pathspec...)...); err != nil {
+		return "", err
+	}
+	changes, err := runGit(dir, append([]string{"status", "--porcelain"}, pathspec...)...)
+	if err != nil {
+		return "", err
+	}
+	if changes == "" {
+		return "", nil
+	}
+
+	// Fall back to a fixed identity when none is configured for the repository
+	args := []string{}
+	if _, err := runGit(dir, "config", "user.email"); err != nil {
+		args = append(args, "-c", "user.name=Cloudflare DNS Manager", "-c", "user.email=dns-manager@localhost")
+	}
+	args = append(append(args, "commit", "-q", "-m", message), pathspec...)
+	if _, err := runGit(dir, args...); err != nil {
+		return "", err
+	}
+	return runGit(dir, "rev-parse", "--short", "HEAD")
+}
+
+// runGit runs a git command in dir and returns its trimmed output
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Status returns the backup configuration and the state of every zone, by zone name
+func (m *BackupManager) Status() BackupStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := BackupStatus{
+		Dir:       m.config.Dir,
+		Scheduled: m.scheduled,
+		Keep:      m.config.Keep,
+		Git:       m.config.Git,
+		Running:   m.running,
+		LastRun:   m.state.LastRun,
+		Zones:     make([]BackupZoneStatus, 0, len(m.state.Zones)),
+	}
+	if m.config.Interval > 0 {
+		status.Interval = m.config.Interval.String()
+	}
+	if m.config.MaxAge > 0 {
+		status.MaxAge = m.config.MaxAge.String()
+	}
+	if m.scheduled {
+		next := m.nextRun
+		status.NextRun = &next
+	}
+	for _, zone := range m.state.Zones {
+		status.Zones = append(status.Zones, *zone)
+	}
+	sort.Slice(status.Zones, func(i, j int) bool {
+		return status.Zones[i].Zone < status.Zones[j].Zone
+	})
+	return status
+}
+
+// BackupStatusHandler returns the backup configuration and the last backup of every zone
+func BackupStatusHandler(store *session.Store, backups *BackupManager) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+		caller, err := SessionEmail(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		access, err := callerZones(api)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch domains",
+				"error":   err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    backups.Status().forCaller(caller, backups.config.Email, access),
+		})
+	}
+}
+
+// RunBackupHandler starts a backup of every zone the configured backup credentials can access
+func RunBackupHandler(store *session.Store, backups *BackupManager) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		actor, err := SessionEmail(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		if err := backups.RunInBackground(BackupTriggerManual, actor); err != nil {
+			if errors.Is(err, ErrBackupCredentials) {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"success": false,
+					"message": "Backups are not configured: set CLOUDFLARE_EMAIL and CLOUDFLARE_API_KEY",
+				})
+			}
+			if errors.Is(err, ErrBackupRunning) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"success": false,
+					"message": "A backup is already running",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to start backup",
+				"error":   err.Error(),
+			})
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"success": true,
+			"message": "Backup started",
+		})
+	}
+}
+
+// RenderBackupsPageHandler renders the backup status page
+func RenderBackupsPageHandler(store *session.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sess, err := store.Get(c)
+		if err != nil {
+			return c.Redirect("/")
+		}
+
+		valid := sess.Get(KeyAPIValid)
+		if valid == nil || !valid.(bool) {
+			return c.Redirect("/")
+		}
+
+		email, _ := sess.Get("apiEmail").(string)
+		return c.Render("backups", fiber.Map{
+			"Email": email,
+		})
+	}
+}
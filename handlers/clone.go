@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+// CloneZoneRequest is the body for cloning the records of a zone onto other zones
+type CloneZoneRequest struct {
+	Source      string `json:"source"`
+	Targets     string `json:"targets"`      // Newline-separated domain names
+	Mode        string `json:"mode"`         // skip (default), overwrite or fail
+	CreateZones bool   `json:"create_zones"` // Add targets that are not in the account yet
+	DryRun      bool   `json:"dryRun"`       // Report the changes without making them
+}
+
+// cloneRecords translates the records of the source zone for a target zone
+func cloneRecords(records []cloudflare.DNSRecord, source, target string) ([]desiredRecord, []RecordChange) {
+	rw := newZoneRewriter(source, target)
+	desired := []desiredRecord{}
+	invalid := []RecordChange{}
+	for _, record := range records {
+		d, err := translateRecord(record, rw)
+		if err != nil {
+			invalid = append(invalid, RecordChange{Action: ActionInvalid, Type: record.Type, Name: record.Name, Content: FormatRecordContent(record), Error: err.Error()})
+			continue
+		}
+		desired = append(desired, d)
+	}
+	return desired, invalid
+}
+
+// cloneToZone applies the records of the source zone to a target zone, adding the target
+// to the account first when it does not exist and req.CreateZones is set
+func cloneToZone(api *cloudflare.API, source string, records []cloudflare.DNSRecord, target string, req *CloneZoneRequest, ac *auditContext, snapshots *SnapshotStore) ZoneApplyResult {
+	result := ZoneApplyResult{
+		Domain:  target,
+		DryRun:  req.DryRun,
+		Changes: []RecordChange{},
+	}
+	if unicode := DisplayName(target); unicode != target {
+		result.UnicodeName = unicode
+	}
+	failed := func(message string, err error) ZoneApplyResult {
+		result.Error = err.Error()
+		result.Message = fmt.Sprintf("%s: %s", message, err.Error())
+		return result
+	}
+
+	if target == source {
+		return failed("Cannot clone", fmt.Errorf("%s is the source zone", target))
+	}
+
+	live := []cloudflare.DNSRecord{}
+	created := false
+	zoneID, err := api.ZoneIDByName(target)
+	switch {
+	case err != nil && !req.CreateZones:
+		return failed("Domain not found", err)
+	case err != nil && req.DryRun:
+		created = true
+	case err != nil:
+		zone, err := api.CreateZone(context.Background(), target, false, cloudflare.Account{}, "full")
+		ac.record(AuditEntry{Action: AuditZoneAdd, Zone: target, ZoneID: zone.ID, Success: err == nil, Error: errorString(err), Detail: "Clone of " + source})
+		if err != nil {
+			return failed("Failed to add domain", err)
+		}
+		zoneID = zone.ID
+		created = true
+	default:
+		live, _, err = api.ListDNSRecords(context.Background(), cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{})
+		if err != nil {
+			return failed("Failed to fetch existing records", err)
+		}
+		if !req.DryRun {
+			if err := snapshotBefore(snapshots, api, zoneID, target, ac, "Before cloning "+source); err != nil {
+				return failed("Failed to snapshot the zone, no changes made", err)
+			}
+		}
+	}
+	result.ZoneID = zoneID
+
+	desired, invalid := cloneRecords(records, source, target)
+	applyPlan(api, &result, planRecords(target, desired, live, req.Mode), invalid, req.Mode)
+	if created {
+		verb := "Domain added"
+		if req.DryRun {
+			verb = "Domain will be added"
+		}
+		result.Message = fmt.Sprintf("%s. %s", verb, result.Message)
+	}
+	return result
+}
+
+// CloneZoneHandler clones every record of a source zone onto one or many target zones,
+// rewriting names and self-referencing content to each target origin
+func CloneZoneHandler(store *session.Store, audit *AuditLog, snapshots *SnapshotStore, cache *SearchCache) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req := new(CloneZoneRequest)
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request format",
+				"error":   err.Error(),
+			})
+		}
+		if req.Mode == "" {
+			req.Mode = ConflictSkip
+		}
+		if !isValidConflictMode(req.Mode) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": fmt.Sprintf("Invalid conflict mode %q, expected skip, overwrite or fail", req.Mode),
+			})
+		}
+
+		source, _, records, err := listZoneRecords(api, req.Source)
+		if err != nil {
+			return zoneDiffError(c, err)
+		}
+
+		targets, invalid := parseDomainsList(req.Targets)
+		if len(targets) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "No valid target domains provided",
+				"results": invalid,
+			})
+		}
+
+		results := make([]ZoneApplyResult, 0, len(targets)+len(invalid))
+		for _, r := range invalid {
+			results = append(results, ZoneApplyResult{Domain: r.Domain, Message: r.Message, Error: r.Error, Changes: []RecordChange{}})
+		}
+
+		ac := newAuditContext(c, store, audit, true)
+		successCount := 0
+		for _, target := range targets {
+			result := cloneToZone(api, source, records, target, req, ac, snapshots)
+			ac.recordApply(result, AuditZoneClone, fmt.Sprintf("Clone of %s (%s mode)", source, req.Mode))
+			cache.Invalidate(result.ZoneID)
+			results = append(results, result)
+			if result.Success {
+				successCount++
+			}
+		}
+
+		verb := "Cloned"
+		if req.DryRun {
+			verb = "Previewed clone of"
+		}
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": fmt.Sprintf("%s %s onto %d out of %d domains", verb, source, successCount, len(results)),
+			"results": results,
+		})
+	}
+}
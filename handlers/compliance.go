@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+// Kinds of drift between a zone and its assigned template
+const (
+	DriftMissing = "missing" // In the template but not in the zone
+	DriftExtra   = "extra"   // In the zone at a name and type the template manages, but not in the template
+	DriftChanged = "changed" // In both, with different content or settings
+	DriftInvalid = "invalid" // The template record cannot be applied to the zone
+)
+
+// RecordDrift is a single difference between a zone and its template
+type RecordDrift struct {
+	Kind     string `json:"kind"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// ZoneCompliance is the compliance report of one zone against its assigned template
+type ZoneCompliance struct {
+	Domain       string        `json:"domain"`
+	UnicodeName  string        `json:"unicode_domain,omitempty"`
+	ZoneID       string        `json:"zone_id,omitempty"`
+	TemplateID   string        `json:"template_id"`
+	TemplateName string        `json:"template_name,omitempty"`
+	Compliant    bool          `json:"compliant"`
+	Error        string        `json:"error,omitempty"`
+	Missing      int           `json:"missing"`
+	Extra        int           `json:"extra"`
+	Changed      int           `json:"changed"`
+	Invalid      int           `json:"invalid"`
+	Drift        []RecordDrift `json:"drift"`
+	CheckedAt    time.Time     `json:"checked_at"`
+}
+
+// CheckZoneCompliance compares the live records of a zone with its assigned template. The
+// comparison is the plan an overwrite would make: creates are missing records, deletes are
+// extra records, and a create paired with a delete at the same name and type, or an update,
+// is a changed record.
+func CheckZoneCompliance(api *cloudflare.API, templates *TemplateStore, policy *ProxyPolicy, assignment TemplateAssignment) ZoneCompliance {
+	report := ZoneCompliance{
+		Domain:     assignment.Zone,
+		TemplateID: assignment.TemplateID,
+		Drift:      []RecordDrift{},
+		CheckedAt:  time.Now().UTC(),
+	}
+	if unicode := DisplayName(assignment.Zone); unicode != assignment.Zone {
+		report.UnicodeName = unicode
+	}
+
+	t, ok := templates.Get(assignment.TemplateID)
+	if !ok {
+		report.Error = "the assigned template no longer exists"
+		return report
+	}
+	report.TemplateName = t.Name
+
+	zoneID, err := api.ZoneIDByName(assignment.Zone)
+	if err != nil {
+		report.Error = fmt.Sprintf("domain not found: %s", err.Error())
+		return report
+	}
+	report.ZoneID = zoneID
+
+	lines, err := RenderTemplate(t, assignment.Zone, assignment.Variables)
+	if err != nil {
+		report.Error = fmt.Sprintf("failed to render template: %s", err.Error())
+		return report
+	}
+
+	live, _, err := api.ListDNSRecords(context.Background(), cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{})
+	if err != nil {
+		report.Error = fmt.Sprintf("failed to fetch records: %s", err.Error())
+		return report
+	}
+
+	desired, invalid := resolveRecordLines(api, lines, assignment.Zone, policy)
+	for _, change := range invalid {
+		report.Drift = append(report.Drift, RecordDrift{Kind: DriftInvalid, Type: change.Type, Name: change.Name, Expected: change.Content, Detail: change.Error})
+	}
+	report.Drift = append(report.Drift, driftFromPlan(planRecords(assignment.Zone, desired, live, ConflictOverwrite))...)
+
+	for _, drift := range report.Drift {
+		switch drift.Kind {
+		case DriftMissing:
+			report.Missing++
+		case DriftExtra:
+			report.Extra++
+		case DriftChanged:
+			report.Changed++
+		case DriftInvalid:
+			report.Invalid++
+		}
+	}
+	report.Compliant = len(report.Drift) == 0
+	return report
+}
+
+// driftFromPlan turns an overwrite plan into drift entries, pairing the creates and deletes
+// of each name and type into changed records
+func driftFromPlan(plan []plannedChange) []RecordDrift {
+	keys := []string{}
+	creates := map[string][]plannedChange{}
+	deletes := map[string][]plannedChange{}
+	drift := []RecordDrift{}
+
+	for _, change := range plan {
+		key := recordKey(change.Name, change.Type)
+		switch change.Action {
+		case ActionCreate:
+			if len(creates[key]) == 0 && len(deletes[key]) == 0 {
+				keys = append(keys, key)
+			}
+			creates[key] = append(creates[key], change)
+		case ActionDelete:
+			if len(creates[key]) == 0 && len(deletes[key]) == 0 {
+				keys = append(keys, key)
+			}
+			deletes[key] = append(deletes[key], change)
+		case ActionUpdate:
+			drift = append(drift, RecordDrift{
+				Kind:     DriftChanged,
+				Type:     change.Type,
+				Name:     change.Name,
+				Expected: change.Content,
+				Actual:   change.Previous,
+				Detail:   updateDetail(change),
+			})
+		case ActionInvalid:
+			drift = append(drift, RecordDrift{Kind: DriftInvalid, Type: change.Type, Name: change.Name, Expected: change.Content, Detail: change.Error})
+		}
+	}
+
+	for _, key := range keys {
+		c, d := creates[key], deletes[key]
+		for len(c) > 0 && len(d) > 0 {
+			drift = append(drift, RecordDrift{Kind: DriftChanged, Type: c[0].Type, Name: c[0].Name, Expected: c[0].Content, Actual: d[0].Content})
+			c, d = c[1:], d[1:]
+		}
+		for _, change := range c {
+			drift = append(drift, RecordDrift{Kind: DriftMissing, Type: change.Type, Name: change.Name, Expected: change.Content})
+		}
+		for _, change := range d {
+			drift = append(drift, RecordDrift{Kind: DriftExtra, Type: change.Type, Name: change.Name, Actual: change.Content})
+		}
+	}
+	return drift
+}
+
+// updateDetail describes what differs for a record that only needs an update
+func updateDetail(change plannedChange) string {
+	if change.existing == nil || change.desired == nil {
+		return ""
+	}
+	actualProxied := change.existing.Proxied != nil && *change.existing.Proxied
+	if actualProxied != change.Proxied {
+		return fmt.Sprintf("proxied is %t, template expects %t", actualProxied, change.Proxied)
+	}
+	if change.desired.Payload.Comment != "" && change.desired.Payload.Comment != change.existing.Comment {
+		return fmt.Sprintf("comment is %q, template expects %q", change.existing.Comment, change.desired.Payload.Comment)
+	}
+	return fmt.Sprintf("tags are %v, template expects %v", change.existing.Tags, change.desired.Payload.Tags)
+}
+
+// ComplianceReportHandler checks every zone with an assigned template, or only the zone in
+// the domain query parameter. With failOnDrift=true the response status is 409 when any
+// zone has drifted, so scheduled jobs can fail on it.
+func ComplianceReportHandler(store *session.Store, templates *TemplateStore, policy *ProxyPolicy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		// Assignments cover the zones of everyone using the application; only the caller's
+		// zones are checked
+		access, err := callerZones(api)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch domains",
+				"error":   err.Error(),
+			})
+		}
+		assignments := []TemplateAssignment{}
+		for _, assignment := range templates.Assignments() {
+			if access.allows(assignment.Zone, "") {
+				assignments = append(assignments, assignment)
+			}
+		}
+		if domain := c.Query("domain"); domain != "" {
+			zone, err := NormalizeZone(domain)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": err.Error(),
+				})
+			}
+			assignment, ok := templates.Assignment(zone)
+			if !ok || !access.allows(zone, "") {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"success": false,
+					"message": "Zone has no template assigned",
+				})
+			}
+			assignments = []TemplateAssignment{assignment}
+		}
+
+		reports := make([]ZoneCompliance, 0, len(assignments))
+		compliant := 0
+		for _, assignment := range assignments {
+			report := CheckZoneCompliance(api, templates, policy, assignment)
+			if report.Compliant {
+				compliant++
+			}
+			reports = append(reports, report)
+		}
+
+		status := fiber.StatusOK
+		if c.QueryBool("failOnDrift") && compliant < len(reports) {
+			status = fiber.StatusConflict
+		}
+
+		return c.Status(status).JSON(fiber.Map{
+			"success":   true,
+			"message":   fmt.Sprintf("%d of %d zones comply with their template", compliant, len(reports)),
+			"compliant": compliant == len(reports),
+			"results":   reports,
+		})
+	}
+}
+
+// RemediateZoneRequest is the body for remediating a zone
+type RemediateZoneRequest struct {
+	DryRun bool `json:"dryRun"`
+}
+
+// RemediateZoneHandler brings a zone back in line with its assigned template by applying
+// the template with the stored variable values in overwrite mode
+func RemediateZoneHandler(store *session.Store, templates *TemplateStore, policy *ProxyPolicy, audit *AuditLog, snapshots *SnapshotStore, cache *SearchCache) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		zone, err := NormalizeZone(c.Params("domain"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		req := new(RemediateZoneRequest)
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(req); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": "Invalid request format",
+					"error":   err.Error(),
+				})
+			}
+		}
+
+		if _, err := zoneIDForCaller(api, zone); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+		assignment, ok := templates.Assignment(zone)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Zone has no template assigned",
+			})
+		}
+		t, ok := templates.Get(assignment.TemplateID)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "The assigned template no longer exists",
+			})
+		}
+
+		ac := newAuditContext(c, store, audit, false)
+		result := applyTemplateToDomain(api, policy, snapshots, ac, t, zone, &ApplyTemplateRequest{
+			Variables: assignment.Variables,
+			Mode:      ConflictOverwrite,
+			DryRun:    req.DryRun,
+		}, "Before remediating with template "+t.Name)
+		ac.recordApply(result, AuditTemplateApply, fmt.Sprintf("Remediation with template %s", t.Name))
+		if !req.DryRun {
+			cache.Invalidate(result.ZoneID)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": result.Success,
+			"message": result.Message,
+			"results": []ZoneApplyResult{result},
+		})
+	}
+}
+
+// AssignTemplateRequest is the body for assigning a template to a zone
+type AssignTemplateRequest struct {
+	Template  string            `json:"template"`
+	Variables map[string]string `json:"variables"`
+}
+
+// AssignTemplateHandler assigns a template to a zone without changing its records, so the
+// compliance report checks zones that were set up by hand
+func AssignTemplateHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+		actor, err := SessionEmail(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		zone, err := NormalizeZone(c.Params("domain"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+		if _, err := zoneIDForCaller(api, zone); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		req := new(AssignTemplateRequest)
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request format",
+				"error":   err.Error(),
+			})
+		}
+
+		t, ok := templates.Get(req.Template)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Template not found",
+			})
+		}
+		if _, err := resolveVariables(t.Variables, zone, req.Variables); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid template variables",
+				"error":   err.Error(),
+			})
+		}
+
+		if err := templates.Assign(zone, t.ID, req.Variables, actor); err != nil {
+			return templateStoreError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": fmt.Sprintf("Template %s assigned to %s", t.Name, zone),
+		})
+	}
+}
+
+// UnassignTemplateHandler removes the template assignment of a zone
+func UnassignTemplateHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+		if _, err := SessionEmail(c, store); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		zone, err := NormalizeZone(c.Params("domain"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+		if _, err := zoneIDForCaller(api, zone); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		if err := templates.Unassign(zone); err != nil {
+			return templateStoreError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": fmt.Sprintf("Template assignment removed from %s", zone),
+		})
+	}
+}
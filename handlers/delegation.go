@@ -0,0 +1,567 @@
+package handlers
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultDelegationResolver is the recursive resolver used to find the parent nameservers
+// of a zone
+const DefaultDelegationResolver = "1.1.1.1:53"
+
+// DefaultParentNameserverPort is the port the nameservers of parent zones are queried on
+const DefaultParentNameserverPort = "53"
+
+// delegationTimeout bounds each DNS query of a delegation check
+const delegationTimeout = 5 * time.Second
+
+// delegationWorkers is the number of zones checked at the same time
+const delegationWorkers = 4
+
+// Delegation statuses, comparing the nameservers at the parent with the ones Cloudflare assigned
+const (
+	DelegationDelegated    = "delegated"     // The parent lists exactly the assigned nameservers
+	DelegationPartial      = "partial"       // The parent lists some of the assigned nameservers
+	DelegationNotDelegated = "not_delegated" // The parent lists none of them, or the zone is not registered
+	DelegationError        = "error"         // The parent could not be queried
+)
+
+// DelegationResolverFromEnv reads the resolver from DELEGATION_RESOLVER as host or host:port,
+// defaulting to port 53
+func DelegationResolverFromEnv() (string, error) {
+	value := strings.TrimSpace(os.Getenv("DELEGATION_RESOLVER"))
+	if value == "" {
+		return DefaultDelegationResolver, nil
+	}
+	if _, _, err := net.SplitHostPort(value); err != nil {
+		value = net.JoinHostPort(strings.Trim(value, "[]"), "53")
+	}
+	host, _, err := net.SplitHostPort(value)
+	if err != nil || host == "" {
+		return "", fmt.Errorf("invalid DELEGATION_RESOLVER %q, expected host or host:port", value)
+	}
+	return value, nil
+}
+
+// ParentNameserverPortFromEnv reads the port the nameservers of parent zones are queried on
+// from DELEGATION_PARENT_PORT, defaulting to 53. Another port lets a local DNS stub answer
+// the parent queries as well.
+func ParentNameserverPortFromEnv() (string, error) {
+	value := strings.TrimSpace(os.Getenv("DELEGATION_PARENT_PORT"))
+	if value == "" {
+		return DefaultParentNameserverPort, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return "", fmt.Errorf("invalid DELEGATION_PARENT_PORT %q, expected a port number", value)
+	}
+	return value, nil
+}
+
+// DelegationCheck is the outcome of checking the delegation of one zone
+type DelegationCheck struct {
+	Zone            string    `json:"zone"`
+	ZoneID          string    `json:"zone_id"`
+	ZoneStatus      string    `json:"zone_status"` // Cloudflare status of the zone when checked
+	Status          string    `json:"status"`
+	ParentNS        []string  `json:"parent_ns"`   // Nameservers the parent zone delegates to
+	AssignedNS      []string  `json:"assigned_ns"` // Nameservers Cloudflare assigned
+	Missing         []string  `json:"missing"`     // Assigned but not at the parent
+	Extra           []string  `json:"extra"`       // At the parent but not assigned
+	Error           string    `json:"error,omitempty"`
+	ActivationCheck bool      `json:"activation_check"` // Cloudflare was asked to check the zone again
+	ActivationError string    `json:"activation_error,omitempty"`
+	CheckedAt       time.Time `json:"checked_at"`
+}
+
+// DelegationChecker verifies that pending zones are delegated to their Cloudflare nameservers
+// and keeps the last check of each zone in a JSON file in the data directory
+type DelegationChecker struct {
+	mu         sync.RWMutex
+	path       string
+	resolver   string
+	parentPort string
+	timeout    time.Duration
+	checks     map[string]DelegationCheck
+}
+
+// NewDelegationChecker loads the last checks from dataDir. The parent nameservers are found
+// through resolver and queried on parentPort.
+func NewDelegationChecker(dataDir, resolver, parentPort string) (*DelegationChecker, error) {
+	d := &DelegationChecker{
+		path:       filepath.Join(dataDir, "delegation.json"),
+		resolver:   resolver,
+		parentPort: parentPort,
+		timeout:    delegationTimeout,
+		checks:     make(map[string]DelegationCheck),
+	}
+
+	var checks []DelegationCheck
+	if err := readJSONFile(d.path, &checks); err != nil {
+		return nil, fmt.Errorf("failed to load delegation checks from %s: %w", d.path, err)
+	}
+	for _, check := range checks {
+		d.checks[check.Zone] = check
+	}
+	return d, nil
+}
+
+// Last returns the last check of a zone
+func (d *DelegationChecker) Last(zone string) (DelegationCheck, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	check, ok := d.checks[zone]
+	return check, ok
+}
+
+// Check compares the nameservers of a zone at its parent with the ones Cloudflare assigned,
+// and asks Cloudflare to check a pending zone again once it is fully delegated
+func (d *DelegationChecker) Check(api *cloudflare.API, zone cloudflare.Zone) DelegationCheck {
+	check := d.check(api, zone)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.checks[check.Zone] = check
+	if err := d.save(); err != nil {
+		log.Printf("Failed to save delegation checks: %v", err)
+	}
+	return check
+}
+
+// CheckPending checks every pending zone of the account
+func (d *DelegationChecker) CheckPending(api *cloudflare.API) ([]DelegationCheck, error) {
+	zones, err := api.ListZones(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []cloudflare.Zone{}
+	for _, zone := range zones {
+		if zone.Status == "pending" {
+			pending = append(pending, zone)
+		}
+	}
+
+	checks := make([]DelegationCheck, len(pending))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < delegationWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				checks[i] = d.check(api, pending[i])
+			}
+		}()
+	}
+	for i := range pending {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, check := range checks {
+		d.checks[check.Zone] = check
+	}
+	if err := d.save(); err != nil {
+		log.Printf("Failed to save delegation checks: %v", err)
+	}
+	return checks, nil
+}
+
+// check performs a delegation check without storing it
+func (d *DelegationChecker) check(api *cloudflare.API, zone cloudflare.Zone) DelegationCheck {
+	check := DelegationCheck{
+		Zone:       zone.Name,
+		ZoneID:     zone.ID,
+		ZoneStatus: zone.Status,
+		AssignedNS: normalizeNameservers(zone.NameServers),
+		CheckedAt:  time.Now().UTC(),
+	}
+
+	parent, err := d.ParentNameservers(zone.Name)
+	if err != nil {
+		check.Status = DelegationError
+		check.Error = err.Error()
+		return check
+	}
+	check.ParentNS = parent
+	check.Status, check.Missing, check.Extra = compareNameservers(check.AssignedNS, parent)
+
+	if check.Status == DelegationDelegated && zone.Status == "pending" {
+		check.ActivationCheck = true
+		if _, err := api.ZoneActivationCheck(context.Background(), zone.ID); err != nil {
+			check.ActivationError = err.Error()
+		}
+	}
+	return check
+}
+
+// ParentNameservers asks the nameservers of the parent zone which nameservers zone is
+// delegated to. A zone the parent does not know has no nameservers.
+func (d *DelegationChecker) ParentNameservers(zone string) ([]string, error) {
+	resp, err := d.queryParent(zone, dnsmessage.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+	// A referral lists the delegation in the authority section; a parent that also serves
+	// the zone answers it directly
+	return normalizeNameservers(append(nsRecords(resp.Answers, zone), nsRecords(resp.Authorities, zone)...)), nil
+}
+
+// queryParent sends a query about zone to the nameservers of its parent zone, without
+// recursion, and returns the first answer. A zone the parent does not know gives an
+// empty answer.
+func (d *DelegationChecker) queryParent(zone string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	parentZone, servers, err := d.findParent(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, server := range servers {
+		addrs, err := d.lookupAddrs(server)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, addr := range addrs {
+			resp, err := d.exchange(net.JoinHostPort(addr, d.parentPort), zone, qtype, false)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if resp.RCode == dnsmessage.RCodeNameError {
+				return &dnsmessage.Message{Header: resp.Header}, nil
+			}
+			if resp.RCode != dnsmessage.RCodeSuccess {
+				lastErr = fmt.Errorf("%s answered %s for %s", server, resp.RCode, zone)
+				continue
+			}
+			return resp, nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no address found for the nameservers of %s", parentZone)
+	}
+	return nil, fmt.Errorf("failed to query the nameservers of %s: %w", parentZone, lastErr)
+}
+
+// findParent walks up from zone to the closest enclosing zone and returns its nameservers
+func (d *DelegationChecker) findParent(zone string) (string, []string, error) {
+	labels := strings.Split(strings.TrimSuffix(zone, "."), ".")
+	for i := 1; i < len(labels); i++ {
+		parent := strings.Join(labels[i:], ".")
+		resp, err := d.exchange(d.resolver, parent, dnsmessage.TypeNS, true)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to look up the nameservers of %s: %w", parent, err)
+		}
+		if servers := nsRecords(resp.Answers, parent); len(servers) > 0 {
+			return parent, normalizeNameservers(servers), nil
+		}
+	}
+	return "", nil, fmt.Errorf("no parent zone found for %s", zone)
+}
+
+// lookupAddrs resolves the IPv4 addresses of a nameserver, falling back to IPv6
+func (d *DelegationChecker) lookupAddrs(host string) ([]string, error) {
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		resp, err := d.exchange(d.resolver, host, qtype, true)
+		if err != nil {
+			return nil, err
+		}
+		addrs := []string{}
+		for _, rr := range resp.Answers {
+			switch body := rr.Body.(type) {
+			case *dnsmessage.AResource:
+				addrs = append(addrs, net.IP(body.A[:]).String())
+			case *dnsmessage.AAAAResource:
+				addrs = append(addrs, net.IP(body.AAAA[:]).String())
+			}
+		}
+		if len(addrs) > 0 {
+			return addrs, nil
+		}
+	}
+	return nil, fmt.Errorf("no address found for %s", host)
+}
+
+// exchange sends a single query over UDP and waits for the matching response. A truncated
+// response, such as a long NS or DS set, is asked for again over TCP.
+func (d *DelegationChecker) exchange(server, name string, qtype dnsmessage.Type, recursive bool) (*dnsmessage.Message, error) {
+	qname, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+	id := uint16(rand.Uint32())
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: recursive},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.exchangeUDP(server, packed, id)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Truncated {
+		return d.exchangeTCP(server, packed, id)
+	}
+	return resp, nil
+}
+
+// exchangeUDP sends a packed query over UDP and waits for the response with the same ID
+func (d *DelegationChecker) exchangeUDP(server string, packed []byte, id uint16) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout("udp", server, d.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(d.timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		var resp dnsmessage.Message
+		if err := resp.Unpack(buf[:n]); err != nil || resp.ID != id || !resp.Response {
+			continue // Not the answer to this query
+		}
+		return &resp, nil
+	}
+}
+
+// exchangeTCP sends a packed query over TCP, where each message is preceded by its length
+func (d *DelegationChecker) exchangeTCP(server string, packed []byte, id uint16) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout("tcp", server, d.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(d.timeout)); err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, 2+len(packed))
+	binary.BigEndian.PutUint16(msg, uint16(len(packed)))
+	copy(msg[2:], packed)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf); err != nil {
+		return nil, fmt.Errorf("invalid TCP response from %s: %w", server, err)
+	}
+	if resp.ID != id || !resp.Response {
+		return nil, fmt.Errorf("unexpected TCP response from %s", server)
+	}
+	return &resp, nil
+}
+
+// nsRecords returns the nameservers of the NS records for name
+func nsRecords(records []dnsmessage.Resource, name string) []string {
+	servers := []string{}
+	for _, rr := range records {
+		body, ok := rr.Body.(*dnsmessage.NSResource)
+		if ok && strings.EqualFold(strings.TrimSuffix(rr.Header.Name.String(), "."), strings.TrimSuffix(name, ".")) {
+			servers = append(servers, body.NS.String())
+		}
+	}
+	return servers
+}
+
+// normalizeNameservers lowercases, strips the trailing dot, sorts and deduplicates names
+func normalizeNameservers(servers []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, server := range servers {
+		server = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(server), "."))
+		if server != "" && !seen[server] {
+			seen[server] = true
+			normalized = append(normalized, server)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// compareNameservers compares the assigned nameservers with the ones at the parent
+func compareNameservers(assigned, parent []string) (string, []string, []string) {
+	inParent := map[string]bool{}
+	for _, server := range parent {
+		inParent[server] = true
+	}
+	isAssigned := map[string]bool{}
+	missing := []string{}
+	for _, server := range assigned {
+		isAssigned[server] = true
+		if !inParent[server] {
+			missing = append(missing, server)
+		}
+	}
+	extra := []string{}
+	for _, server := range parent {
+		if !isAssigned[server] {
+			extra = append(extra, server)
+		}
+	}
+
+	switch {
+	case len(assigned) > 0 && len(missing) == 0 && len(extra) == 0:
+		return DelegationDelegated, missing, extra
+	case len(missing) < len(assigned):
+		return DelegationPartial, missing, extra
+	default:
+		return DelegationNotDelegated, missing, extra
+	}
+}
+
+// save writes the checks to disk. The caller must hold the lock.
+func (d *DelegationChecker) save() error {
+	checks := make([]DelegationCheck, 0, len(d.checks))
+	for _, check := range d.checks {
+		checks = append(checks, check)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Zone < checks[j].Zone })
+
+	if err := writeJSONFile(d.path, checks); err != nil {
+		return fmt.Errorf("failed to save delegation checks to %s: %w", d.path, err)
+	}
+	return nil
+}
+
+// CheckDelegationHandler checks the delegation of the zone in the URL
+func CheckDelegationHandler(store *session.Store, delegation *DelegationChecker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		domain := auditZoneName(c.Params("domain"))
+		zoneID, err := api.ZoneIDByName(domain)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Domain not found",
+				"error":   err.Error(),
+			})
+		}
+		zone, err := api.ZoneDetails(context.Background(), zoneID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch domain",
+				"error":   err.Error(),
+			})
+		}
+
+		check := delegation.Check(api, zone)
+		return c.JSON(fiber.Map{
+			"success": check.Status != DelegationError,
+			"message": delegationMessage(check),
+			"error":   check.Error,
+			"data":    check,
+		})
+	}
+}
+
+// CheckPendingDelegationsHandler checks the delegation of every pending zone
+func CheckPendingDelegationsHandler(store *session.Store, delegation *DelegationChecker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		checks, err := delegation.CheckPending(api)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch domains",
+				"error":   err.Error(),
+			})
+		}
+
+		delegated := 0
+		for _, check := range checks {
+			if check.Status == DelegationDelegated {
+				delegated++
+			}
+		}
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": fmt.Sprintf("%d of %d pending domains are delegated to Cloudflare", delegated, len(checks)),
+			"results": checks,
+		})
+	}
+}
+
+// delegationMessage describes a check for notifications
+func delegationMessage(check DelegationCheck) string {
+	switch check.Status {
+	case DelegationDelegated:
+		if check.ActivationError != "" {
+			return "Delegated to Cloudflare, but the activation check failed: " + check.ActivationError
+		}
+		if check.ActivationCheck {
+			return "Delegated to Cloudflare, activation check requested"
+		}
+		return "Delegated to Cloudflare"
+	case DelegationPartial:
+		return "Partly delegated, missing at the registrar: " + strings.Join(check.Missing, ", ")
+	case DelegationNotDelegated:
+		if len(check.ParentNS) == 0 {
+			return "Not delegated, the parent zone has no nameservers for this domain"
+		}
+		return "Not delegated, the registrar lists " + strings.Join(check.ParentNS, ", ")
+	}
+	return "Delegation check failed: " + check.Error
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsStub answers delegation queries on one port over UDP and TCP. It acts as the resolver,
+// which knows the nameserver of the com zone, and as that nameserver, which refers zones to
+// their delegated nameservers and holds their DS records.
+type dnsStub struct {
+	addr        string
+	port        string
+	delegations map[string][]string // Zone to delegated nameservers
+	ds          map[string][][]byte // Zone to DS record data
+	truncate    map[string]bool     // Zones answered with a truncated UDP response
+}
+
+// newDNSStub starts a stub on a local port, stopped when the test ends
+func newDNSStub(t *testing.T) *dnsStub {
+	t.Helper()
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen on UDP: %v", err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		t.Skipf("TCP port of the UDP stub is in use: %v", err)
+	}
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+
+	_, port, _ := net.SplitHostPort(udp.LocalAddr().String())
+	s := &dnsStub{
+		addr:        udp.LocalAddr().String(),
+		port:        port,
+		delegations: map[string][]string{},
+		ds:          map[string][][]byte{},
+		truncate:    map[string]bool{},
+	}
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, from, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := s.respond(buf[:n], true); resp != nil {
+				udp.WriteTo(resp, from)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				resp := s.respond(query, false)
+				out := make([]byte, 2+len(resp))
+				binary.BigEndian.PutUint16(out, uint16(len(resp)))
+				copy(out[2:], resp)
+				conn.Write(out)
+			}()
+		}
+	}()
+	return s
+}
+
+// checker returns a delegation checker that sends every query to the stub
+func (s *dnsStub) checker(t *testing.T) *DelegationChecker {
+	t.Helper()
+	d, err := NewDelegationChecker(t.TempDir(), s.addr, s.port)
+	if err != nil {
+		t.Fatalf("NewDelegationChecker: %v", err)
+	}
+	d.timeout = 2 * time.Second
+	return d
+}
+
+// respond builds the packed response to a packed query
+func (s *dnsStub) respond(packed []byte, udp bool) []byte {
+	var query dnsmessage.Message
+	if err := query.Unpack(packed); err != nil || len(query.Questions) != 1 {
+		return nil
+	}
+	q := query.Questions[0]
+	name := strings.TrimSuffix(strings.ToLower(q.Name.String()), ".")
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionDesired: query.RecursionDesired},
+		Questions: query.Questions,
+	}
+	header := func(rrType dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: q.Name, Type: rrType, Class: dnsmessage.ClassINET, TTL: 300}
+	}
+	nsResource := func(server string) dnsmessage.Resource {
+		return dnsmessage.Resource{Header: header(dnsmessage.TypeNS), Body: &dnsmessage.NSResource{NS: dnsmessage.MustNewName(server + ".")}}
+	}
+
+	switch {
+	case udp && s.truncate[name]:
+		resp.Truncated = true
+	case q.Type == dnsmessage.TypeNS && name == "com":
+		resp.Answers = append(resp.Answers, nsResource("ns.parent.test"))
+	case q.Type == dnsmessage.TypeA && name == "ns.parent.test":
+		resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: header(dnsmessage.TypeA), Body: &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}}})
+	case q.Type == dnsmessage.TypeNS && s.delegations[name] != nil:
+		for _, server := range s.delegations[name] {
+			resp.Authorities = append(resp.Authorities, nsResource(server))
+		}
+	case q.Type == typeDS && s.ds[name] != nil:
+		for _, data := range s.ds[name] {
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: header(typeDS), Body: &dnsmessage.UnknownResource{Type: typeDS, Data: data}})
+		}
+	case s.delegations[name] == nil:
+		resp.RCode = dnsmessage.RCodeNameError
+	}
+
+	out, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func TestDelegationCheck(t *testing.T) {
+	stub := newDNSStub(t)
+	stub.delegations["delegated.com"] = []string{"ns2.cloudflare.com", "NS1.Cloudflare.com"}
+	stub.delegations["partial.com"] = []string{"ns1.cloudflare.com", "ns1.registrar.net"}
+	stub.delegations["elsewhere.com"] = []string{"ns1.registrar.net", "ns2.registrar.net"}
+	d := stub.checker(t)
+
+	assigned := []string{"ns1.cloudflare.com", "ns2.cloudflare.com"}
+	tests := []struct {
+		zone    string
+		status  string
+		missing []string
+		extra   []string
+	}{
+		{"delegated.com", DelegationDelegated, nil, nil},
+		{"partial.com", DelegationPartial, []string{"ns2.cloudflare.com"}, []string{"ns1.registrar.net"}},
+		{"elsewhere.com", DelegationNotDelegated, assigned, []string{"ns1.registrar.net", "ns2.registrar.net"}},
+		{"unregistered.com", DelegationNotDelegated, assigned, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.zone, func(t *testing.T) {
+			// Active zones are not sent for an activation check, so no API client is needed
+			check := d.check(nil, cloudflare.Zone{ID: "id", Name: tt.zone, Status: "active", NameServers: assigned})
+			if check.Error != "" {
+				t.Fatalf("check failed: %s", check.Error)
+			}
+			if check.Status != tt.status {
+				t.Errorf("status = %s, want %s (parent %v)", check.Status, tt.status, check.ParentNS)
+			}
+			if strings.Join(check.Missing, ",") != strings.Join(tt.missing, ",") {
+				t.Errorf("missing = %v, want %v", check.Missing, tt.missing)
+			}
+			if strings.Join(check.Extra, ",") != strings.Join(tt.extra, ",") {
+				t.Errorf("extra = %v, want %v", check.Extra, tt.extra)
+			}
+		})
+	}
+}
+
+func TestParentNameserversOverTCP(t *testing.T) {
+	stub := newDNSStub(t)
+	stub.delegations["large.com"] = []string{"ns1.cloudflare.com", "ns2.cloudflare.com"}
+	stub.truncate["large.com"] = true
+	d := stub.checker(t)
+
+	parent, err := d.ParentNameservers("large.com")
+	if err != nil {
+		t.Fatalf("ParentNameservers: %v", err)
+	}
+	if strings.Join(parent, ",") != "ns1.cloudflare.com,ns2.cloudflare.com" {
+		t.Errorf("parent nameservers = %v", parent)
+	}
+}
+
+func TestParentDS(t *testing.T) {
+	stub := newDNSStub(t)
+	stub.delegations["signed.com"] = []string{"ns1.cloudflare.com"}
+	stub.delegations["unsigned.com"] = []string{"ns1.cloudflare.com"}
+	stub.ds["signed.com"] = [][]byte{
+		{0x09, 0x43, 13, 2, 0xab, 0xcd, 0xef},
+		{0x00, 0x01, 8, 1, 0x01},
+		{0x00, 0x02, 8}, // Too short to be a DS record
+	}
+	d := stub.checker(t)
+
+	records, err := d.ParentDS("signed.com")
+	if err != nil {
+		t.Fatalf("ParentDS: %v", err)
+	}
+	want := []DSRecord{
+		{KeyTag: 1, Algorithm: 8, DigestType: 1, Digest: "01"},
+		{KeyTag: 2371, Algorithm: 13, DigestType: 2, Digest: "ABCDEF"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("records = %v, want %v", records, want)
+	}
+	for i := range want {
+		if records[i] != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, records[i], want[i])
+		}
+	}
+
+	records, err = d.ParentDS("unsigned.com")
+	if err != nil || len(records) != 0 {
+		t.Errorf("unsigned zone: records %v, error %v", records, err)
+	}
+}
+
+func TestParentNameserverPortFromEnv(t *testing.T) {
+	tests := map[string]string{"": DefaultParentNameserverPort, "5353": "5353", " 53 ": "53"}
+	for value, want := range tests {
+		t.Setenv("DELEGATION_PARENT_PORT", value)
+		if got, err := ParentNameserverPortFromEnv(); err != nil || got != want {
+			t.Errorf("DELEGATION_PARENT_PORT=%q: got %q, %v, want %q", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"0", "65536", "dns"} {
+		t.Setenv("DELEGATION_PARENT_PORT", value)
+		if _, err := ParentNameserverPortFromEnv(); err == nil {
+			t.Errorf("DELEGATION_PARENT_PORT=%q was accepted", value)
+		}
+	}
+}
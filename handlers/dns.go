@@ -8,16 +8,22 @@ import (
 	"github.com/cloudflare/cloudflare-go"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/session"
+
+	"hijicloudflareDNS/validator"
 )
 
 // DNSRecord represents a DNS record in a simplified format
 type DNSRecord struct {
-	ID      string `json:"id"`
-	Type    string `json:"type"`
-	Name    string `json:"name"`
-	Content string `json:"content"`
-	TTL     int    `json:"ttl"`
-	Proxied bool   `json:"proxied"`
+	ID       string      `json:"id"`
+	Type     string      `json:"type"`
+	Name     string      `json:"name"`
+	Content  string      `json:"content"`
+	TTL      int         `json:"ttl"`
+	Proxied  bool        `json:"proxied"`
+	Priority *uint16     `json:"priority,omitempty"` // MX and URI priority
+	Data     interface{} `json:"data,omitempty"`     // Structured fields for SRV, CAA, URI, SSHFP, TLSA, HTTPS and SVCB
+	Comment  string      `json:"comment"`            // Free-form note, e.g. record owner or purpose
+	Tags     []string    `json:"tags"`               // Tags in "name" or "name:value" form
 }
 
 // DNSRecordInput represents the user input format for DNS records
@@ -65,9 +71,11 @@ func GetDNSRecordsHandler(store *session.Store) fiber.Handler {
 
 		// Parse pagination parameters
 		page := c.QueryInt("page", 1)
-		perPage := c.QueryInt("per_page", 20) // Default 20 records per page
-		search := c.Query("search", "")       // Search query
-		recordType := c.Query("type", "")     // Record type filter
+		perPage := c.QueryInt("per_page", 20)   // Default 20 records per page
+		search := c.Query("search", "")         // Search query
+		recordType := c.Query("type", "")       // Record type filter
+		tagFilter := c.Query("tag", "")         // Tag filter, matches "name" or "name:value"
+		commentFilter := c.Query("comment", "") // Comment filter (partial match)
 
 		// Limit per_page to reasonable values
 		if perPage > 100 {
@@ -109,23 +117,45 @@ func GetDNSRecordsHandler(store *session.Store) fiber.Handler {
 			}
 
 			allDNSRecords = append(allDNSRecords, DNSRecord{
-				ID:      record.ID,
-				Type:    record.Type,
-				Name:    record.Name,
-				Content: record.Content,
-				TTL:     record.TTL,
-				Proxied: proxiedValue,
+				ID:       record.ID,
+				Type:     record.Type,
+				Name:     record.Name,
+				Content:  FormatRecordContent(record),
+				TTL:      record.TTL,
+				Proxied:  proxiedValue,
+				Priority: record.Priority,
+				Data:     record.Data,
+				Comment:  record.Comment,
+				Tags:     record.Tags,
 			})
 		}
 
+		// Apply tag and comment filters client-side
+		if tagFilter != "" || commentFilter != "" {
+			filteredRecords := []DNSRecord{}
+			commentLower := strings.ToLower(commentFilter)
+			for _, record := range allDNSRecords {
+				if tagFilter != "" && !recordHasTag(record.Tags, tagFilter) {
+					continue
+				}
+				if commentFilter != "" && !strings.Contains(strings.ToLower(record.Comment), commentLower) {
+					continue
+				}
+				filteredRecords = append(filteredRecords, record)
+			}
+			allDNSRecords = filteredRecords
+		}
+
 		// Apply search filter client-side if provided (similar to domains.go implementation)
 		if search != "" {
 			filteredRecords := []DNSRecord{}
 			searchLower := strings.ToLower(search)
 			for _, record := range allDNSRecords {
-				// Search in name and content fields for partial matches
+				// Search in name, content, comment and tag fields for partial matches
 				if strings.Contains(strings.ToLower(record.Name), searchLower) ||
-					strings.Contains(strings.ToLower(record.Content), searchLower) {
+					strings.Contains(strings.ToLower(record.Content), searchLower) ||
+					strings.Contains(strings.ToLower(record.Comment), searchLower) ||
+					strings.Contains(strings.ToLower(strings.Join(record.Tags, " ")), searchLower) {
 					filteredRecords = append(filteredRecords, record)
 				}
 			}
@@ -169,6 +199,66 @@ func GetDNSRecordsHandler(store *session.Store) fiber.Handler {
 	}
 }
 
+// LintDNSRecordsHandler runs the validator over every existing record of a domain
+func LintDNSRecordsHandler(store *session.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		domainName := c.Params("domain")
+		if domainName == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Domain name is required",
+			})
+		}
+
+		// Get API client from session
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		// Use the canonical ASCII form of the zone, which the record names are in
+		zoneName, err := NormalizeZone(domainName)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		// Get zone ID
+		zoneID, err := api.ZoneIDByName(zoneName)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Domain not found",
+				"error":   err.Error(),
+			})
+		}
+
+		records, err := listValidatorRecords(api, zoneID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch DNS records",
+				"error":   err.Error(),
+			})
+		}
+
+		results := validator.ValidateZone(zoneName, records)
+
+		return c.JSON(fiber.Map{
+			"success":       true,
+			"message":       fmt.Sprintf("Found issues in %d of %d records", len(results), len(records)),
+			"results":       results,
+			"records_count": len(records),
+		})
+	}
+}
+
 // RenderDNSPageHandler renders the DNS management page for a domain
 func RenderDNSPageHandler(store *session.Store) fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -203,7 +293,7 @@ func RenderDNSPageHandler(store *session.Store) fiber.Handler {
 }
 
 // EditDNSRecordHandler handles editing an existing DNS record
-func EditDNSRecordHandler(store *session.Store) fiber.Handler {
+func EditDNSRecordHandler(store *session.Store, policy *ProxyPolicy, audit *AuditLog, cache *SearchCache) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		domainName := c.Params("domain")
 		recordID := c.Params("id")
@@ -217,10 +307,14 @@ func EditDNSRecordHandler(store *session.Store) fiber.Handler {
 
 		// Parse the request body
 		type EditRecordRequest struct {
-			Type    string `json:"type"`
-			Name    string `json:"name"`
-			Content string `json:"content"`
-			Proxied bool   `json:"proxied"`
+			Type     string                 `json:"type"`
+			Name     string                 `json:"name"`
+			Content  string                 `json:"content"`
+			Proxied  *bool                  `json:"proxied"`  // Omit to keep the current proxy status
+			Priority *uint16                `json:"priority"` // Optional priority for MX records
+			Data     map[string]interface{} `json:"data"`     // Optional structured fields for data-bearing types
+			Comment  *string                `json:"comment"`  // Omit to keep the current comment
+			Tags     []string               `json:"tags"`     // Omit to keep the current tags
 		}
 
 		req := new(EditRecordRequest)
@@ -252,29 +346,40 @@ func EditDNSRecordHandler(store *session.Store) fiber.Handler {
 			})
 		}
 
-		// Prepare record data
-		recordName := req.Name
-		if recordName == "@" {
-			recordName = domainName
-		} else if !strings.Contains(recordName, domainName) {
-			recordName = recordName + "." + domainName
+		// Qualify the record name relative to the zone (handles @, trailing dots and IDNs)
+		zoneName, err := NormalizeZone(domainName)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+		recordName, err := QualifyName(req.Name, zoneName)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
 		}
 
-		// Handle @ symbol in CONTENT field
-		recordContent := req.Content
-		if recordContent == "@" {
-			recordContent = domainName
+		// Handle @ symbol and hostname targets in CONTENT field
+		recordContent, err := qualifyContent(req.Type, req.Content, zoneName)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
 		}
 
 		// For A records where CONTENT is @, we need to look up the IP of the root domain
-		if req.Type == "A" && recordContent == domainName {
+		if req.Type == "A" && recordContent == zoneName {
 			// Get the A records for the root domain
 			rootRecords, _, err := api.ListDNSRecords(
 				context.Background(),
 				cloudflare.ZoneIdentifier(zoneID),
 				cloudflare.ListDNSRecordsParams{
 					Type: "A",
-					Name: domainName,
+					Name: zoneName,
 				},
 			)
 			if err != nil {
@@ -297,19 +402,82 @@ func EditDNSRecordHandler(store *session.Store) fiber.Handler {
 			recordContent = rootRecords[0].Content
 		}
 
-		proxied := req.Proxied
+		// Convert the content into the typed fields Cloudflare expects
+		payload, err := buildTypedRecord(req.Type, recordName, recordContent, req.Priority, req.Data)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
 
-		// Update record
-		params := cloudflare.UpdateDNSRecordParams{
-			ID:      recordID,
+		// Validate the content that is sent, which includes the structured fields and priority
+		recordContent = payload.formatContent(req.Type)
+
+		// Fetch the current record for the audit log and to keep the current comment, tags
+		// and proxy status unless the request replaces them
+		current, err := api.GetDNSRecord(context.Background(), cloudflare.ZoneIdentifier(zoneID), recordID)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "DNS record not found",
+				"error":   err.Error(),
+			})
+		}
+
+		// Keep the current proxy status when the request does not say, as long as the edited
+		// record can still be proxied
+		proxied := current.Proxied != nil && *current.Proxied && CheckProxiable(req.Type, recordName, recordContent) == nil
+		if req.Proxied != nil {
+			if proxied, err = policy.Resolve(api, zoneName, req.Type, recordName, recordContent, req.Proxied); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": err.Error(),
+				})
+			}
+		}
+
+		// Validate the record against the rest of the zone before writing
+		validation, err := validateRecord(api, zoneID, zoneName, validator.Record{
 			Type:    req.Type,
 			Name:    recordName,
 			Content: recordContent,
-			Proxied: &proxied,
-			TTL:     1, // Auto TTL
+			Proxied: proxied,
+		}, recordID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch existing records for validation",
+				"error":   err.Error(),
+			})
+		}
+		if !validation.Valid() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success":    false,
+				"message":    "Validation failed: " + validation.Messages(),
+				"validation": validation,
+			})
 		}
 
+		payload.Comment = current.Comment
+		payload.Tags = current.Tags
+		if req.Comment != nil {
+			payload.Comment = *req.Comment
+		}
+		if req.Tags != nil {
+			payload.Tags = req.Tags
+		}
+
+		// Update record
+		params := payload.updateParams(recordID, req.Type, recordName, proxiedFor(req.Type, proxied))
+
 		record, err := api.UpdateDNSRecord(context.Background(), cloudflare.ZoneIdentifier(zoneID), params)
+		var after *AuditRecord
+		if err == nil {
+			after = auditRecordFrom(record)
+		}
+		newAuditContext(c, store, audit, false).recordChange(AuditRecordUpdate, zoneName, zoneID, recordID, auditRecordFrom(current), after, err)
+		cache.Invalidate(zoneID)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"success": false,
@@ -319,15 +487,16 @@ func EditDNSRecordHandler(store *session.Store) fiber.Handler {
 		}
 
 		return c.JSON(fiber.Map{
-			"success": true,
-			"message": fmt.Sprintf("Updated %s record: %s", req.Type, recordName),
-			"record":  record,
+			"success":  true,
+			"message":  fmt.Sprintf("Updated %s record: %s", req.Type, recordName),
+			"record":   record,
+			"warnings": validation.Warnings,
 		})
 	}
 }
 
 // BulkDeleteDNSRecordsHandler handles bulk deletion of DNS records
-func BulkDeleteDNSRecordsHandler(store *session.Store) fiber.Handler {
+func BulkDeleteDNSRecordsHandler(store *session.Store, audit *AuditLog, snapshots *SnapshotStore, undo *UndoStore, cache *SearchCache) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		domainName := c.Params("domain")
 		if domainName == "" {
@@ -376,12 +545,42 @@ func BulkDeleteDNSRecordsHandler(store *session.Store) fiber.Handler {
 			})
 		}
 
+		// Capture the records before they are deleted for the audit log
+		zoneName := auditZoneName(domainName)
+		existing := map[string]cloudflare.DNSRecord{}
+		if records, _, err := api.ListDNSRecords(context.Background(), cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{}); err == nil {
+			for _, record := range records {
+				existing[record.ID] = record
+			}
+		}
+		ac := newAuditContext(c, store, audit, true)
+
+		// Snapshot the zone so the deletion can be restored
+		if err := snapshotBefore(snapshots, api, zoneID, zoneName, ac, fmt.Sprintf("Before deleting %d records", len(req.RecordIDs))); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to snapshot the zone, no records deleted",
+				"error":   err.Error(),
+			})
+		}
+
 		// Delete records
 		results := make([]map[string]interface{}, 0, len(req.RecordIDs))
 		successCount := 0
+		deleted := []cloudflare.DNSRecord{}
 
 		for _, recordID := range req.RecordIDs {
 			err := api.DeleteDNSRecord(context.Background(), cloudflare.ZoneIdentifier(zoneID), recordID)
+			if record, ok := existing[recordID]; ok || err == nil {
+				var before *AuditRecord
+				if ok {
+					before = auditRecordFrom(record)
+					if err == nil {
+						deleted = append(deleted, record)
+					}
+				}
+				ac.recordChange(AuditRecordDelete, zoneName, zoneID, recordID, before, nil, err)
+			}
 			if err != nil {
 				// Check if error is "record doesn't exist" - treat as success since it's already gone
 				errorStr := err.Error()
@@ -408,18 +607,22 @@ func BulkDeleteDNSRecordsHandler(store *session.Store) fiber.Handler {
 			}
 		}
 
-		return c.JSON(fiber.Map{
+		cache.Invalidate(zoneID)
+
+		response := fiber.Map{
 			"success":       successCount > 0,
 			"message":       fmt.Sprintf("Deleted %d of %d records", successCount, len(req.RecordIDs)),
 			"results":       results,
 			"success_count": successCount,
 			"total_count":   len(req.RecordIDs),
-		})
+		}
+		captureDeleted(undo, zoneName, zoneID, ac.actor, deleted, response)
+		return c.JSON(response)
 	}
 }
 
 // DeleteDNSRecordHandler handles deleting a DNS record
-func DeleteDNSRecordHandler(store *session.Store) fiber.Handler {
+func DeleteDNSRecordHandler(store *session.Store, audit *AuditLog, undo *UndoStore, cache *SearchCache) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		domainName := c.Params("domain")
 		recordID := c.Params("id")
@@ -451,8 +654,16 @@ func DeleteDNSRecordHandler(store *session.Store) fiber.Handler {
 			})
 		}
 
-		// Delete the record
+		// Capture the record for the audit log and undo, then delete it
+		var before *AuditRecord
+		current, currentErr := api.GetDNSRecord(context.Background(), cloudflare.ZoneIdentifier(zoneID), recordID)
+		if currentErr == nil {
+			before = auditRecordFrom(current)
+		}
 		err = api.DeleteDNSRecord(context.Background(), cloudflare.ZoneIdentifier(zoneID), recordID)
+		ac := newAuditContext(c, store, audit, false)
+		ac.recordChange(AuditRecordDelete, auditZoneName(domainName), zoneID, recordID, before, nil, err)
+		cache.Invalidate(zoneID)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"success": false,
@@ -461,15 +672,19 @@ func DeleteDNSRecordHandler(store *session.Store) fiber.Handler {
 			})
 		}
 
-		return c.JSON(fiber.Map{
+		response := fiber.Map{
 			"success": true,
 			"message": "DNS record deleted successfully",
-		})
+		}
+		if currentErr == nil {
+			captureDeleted(undo, auditZoneName(domainName), zoneID, ac.actor, []cloudflare.DNSRecord{current}, response)
+		}
+		return c.JSON(response)
 	}
 }
 
 // UpdateDNSRecordsHandler handles batch updating of DNS records
-func UpdateDNSRecordsHandler(store *session.Store) fiber.Handler {
+func UpdateDNSRecordsHandler(store *session.Store, policy *ProxyPolicy, audit *AuditLog, snapshots *SnapshotStore, cache *SearchCache) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		domainName := c.Params("domain")
 		if domainName == "" {
@@ -509,6 +724,36 @@ func UpdateDNSRecordsHandler(store *session.Store) fiber.Handler {
 			})
 		}
 
+		// Use the canonical ASCII form of the zone for name handling
+		zoneName, err := NormalizeZone(domainName)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		// Fetch the current records so every line can be validated before it is written
+		zoneRecords, err := listValidatorRecords(api, zoneID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch existing records for validation",
+				"error":   err.Error(),
+			})
+		}
+
+		ac := newAuditContext(c, store, audit, true)
+
+		// Snapshot the zone so the batch can be restored
+		if err := snapshotBefore(snapshots, api, zoneID, zoneName, ac, "Before batch record update"); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to snapshot the zone, no records changed",
+				"error":   err.Error(),
+			})
+		}
+
 		// Process records
 		lines := strings.Split(input.Records, "\n")
 		results := make([]map[string]interface{}, 0, len(lines))
@@ -519,82 +764,51 @@ func UpdateDNSRecordsHandler(store *session.Store) fiber.Handler {
 				continue
 			}
 
-			// Parse line: TYPE|NAME|CONTENT|PROXIED (PROXIED is optional, defaults to true)
-			parts := strings.Split(line, "|")
-			if len(parts) < 3 || len(parts) > 4 {
+			// Parse line: TYPE|NAME|CONTENT|PROXIED|COMMENT|TAGS, the same format templates use
+			parsed, err := ParseRecordLine(line)
+			if err != nil {
 				results = append(results, map[string]interface{}{
 					"success": false,
 					"line":    line,
-					"message": "Invalid format, expected TYPE|NAME|CONTENT or TYPE|NAME|CONTENT|PROXIED",
+					"message": err.Error(),
 				})
 				continue
 			}
+			recordType := parsed.Type
+			recordComment := parsed.Comment
+			recordTags := parsed.Tags
 
-			recordType := strings.TrimSpace(parts[0])
-			recordName := strings.TrimSpace(parts[1])
-			recordContent := strings.TrimSpace(parts[2])
-
-			// Parse proxied value (default to true if not specified)
-			proxiedStr := "true"
-			if len(parts) == 4 {
-				proxiedStr = strings.TrimSpace(parts[3])
-			}
-
-			// Validate record type
-			validTypes := []string{"A", "AAAA", "CNAME", "MX", "TXT", "NS", "SRV", "CAA", "PTR"}
-			isValidType := false
-			for _, validType := range validTypes {
-				if recordType == validType {
-					isValidType = true
-					break
-				}
-			}
-
-			if !isValidType {
+			// Qualify the record name relative to the zone (handles @, trailing dots and IDNs)
+			recordName, err := QualifyName(parsed.Name, zoneName)
+			if err != nil {
 				results = append(results, map[string]interface{}{
 					"success": false,
 					"line":    line,
-					"message": fmt.Sprintf("Invalid record type: %s. Supported types: A, AAAA, CNAME, MX, TXT, NS, SRV, CAA, PTR", recordType),
+					"message": err.Error(),
 				})
 				continue
 			}
 
-			// Add special handling for MX records, which require priority
-			if recordType == "MX" {
-				// Content format for MX should be "priority content" like "10 mail.example.com"
-				if !strings.Contains(recordContent, " ") {
-					results = append(results, map[string]interface{}{
-						"success": false,
-						"line":    line,
-						"message": "MX record content must include priority (e.g., '10 mail.example.com')",
-					})
-					continue
-				}
-			}
-
-			// Handle @ symbol for root domain in NAME field
-			if recordName == "@" {
-				recordName = domainName
-			} else if !strings.Contains(recordName, domainName) {
-				// If not already FQDN, append the domain name
-				recordName = recordName + "." + domainName
-			}
-
-			// Handle @ symbol in CONTENT field
-			if recordContent == "@" {
-				// If content is @, it means the root domain
-				recordContent = domainName
+			// Handle @ symbol and hostname targets in CONTENT field
+			recordContent, err := qualifyContent(recordType, parsed.Content, zoneName)
+			if err != nil {
+				results = append(results, map[string]interface{}{
+					"success": false,
+					"line":    line,
+					"message": err.Error(),
+				})
+				continue
 			}
 
 			// For A records where CONTENT is @, we need to look up the IP of the root domain
-			if recordType == "A" && recordContent == domainName {
+			if recordType == "A" && recordContent == zoneName {
 				// Get the A records for the root domain
 				rootRecords, _, err := api.ListDNSRecords(
 					context.Background(),
 					cloudflare.ZoneIdentifier(zoneID),
 					cloudflare.ListDNSRecordsParams{
 						Type: "A",
-						Name: domainName,
+						Name: zoneName,
 					},
 				)
 				if err != nil {
@@ -621,17 +835,40 @@ func UpdateDNSRecordsHandler(store *session.Store) fiber.Handler {
 				recordContent = rootRecords[0].Content
 			}
 
-			// Parse the proxied value
-			proxied := false
-			if proxiedStr == "true" || proxiedStr == "1" || proxiedStr == "yes" {
-				proxied = true
-			} else if proxiedStr == "false" || proxiedStr == "0" || proxiedStr == "no" {
-				proxied = false
-			} else {
+			// Leave the proxy status to the proxy policy when the line does not say
+			proxied, err := policy.Resolve(api, zoneName, recordType, recordName, recordContent, parsed.Proxied)
+			if err != nil {
 				results = append(results, map[string]interface{}{
 					"success": false,
 					"line":    line,
-					"message": "Invalid proxied value. Use 'true' or 'false'",
+					"message": err.Error(),
+				})
+				continue
+			}
+
+			// Convert the content into the typed fields Cloudflare expects
+			payload, err := buildTypedRecord(recordType, recordName, recordContent, nil, nil)
+			if err != nil {
+				results = append(results, map[string]interface{}{
+					"success": false,
+					"line":    line,
+					"message": err.Error(),
+				})
+				continue
+			}
+			payload.Comment = recordComment
+			payload.Tags = recordTags
+
+			// Validate against the zone, ignoring the records this line replaces
+			candidate := validator.Record{Type: recordType, Name: recordName, Content: recordContent, Proxied: proxied}
+			remaining := validator.ExcludeNameType(zoneRecords, recordName, recordType)
+			validation := validator.Validate(zoneName, candidate, remaining)
+			if !validation.Valid() {
+				results = append(results, map[string]interface{}{
+					"success":    false,
+					"line":       line,
+					"message":    "Validation failed: " + validation.Messages(),
+					"validation": validation,
 				})
 				continue
 			}
@@ -661,6 +898,7 @@ func UpdateDNSRecordsHandler(store *session.Store) fiber.Handler {
 				deletedCount := 0
 				for _, existingRecord := range existingRecords {
 					err = api.DeleteDNSRecord(context.Background(), cloudflare.ZoneIdentifier(zoneID), existingRecord.ID)
+					ac.recordChange(AuditRecordDelete, zoneName, zoneID, existingRecord.ID, auditRecordFrom(existingRecord), nil, err)
 					if err != nil {
 						// Log the error but continue with other deletions
 						results = append(results, map[string]interface{}{
@@ -681,15 +919,14 @@ func UpdateDNSRecordsHandler(store *session.Store) fiber.Handler {
 			}
 
 			// Create the new record
-			recordParams := cloudflare.CreateDNSRecordParams{
-				Type:    recordType,
-				Name:    recordName,
-				Content: recordContent,
-				TTL:     1, // Auto TTL
-				Proxied: &proxied,
-			}
+			recordParams := payload.createParams(recordType, recordName, proxiedFor(recordType, proxied))
 
 			response, err := api.CreateDNSRecord(context.Background(), cloudflare.ZoneIdentifier(zoneID), recordParams)
+			var after *AuditRecord
+			if err == nil {
+				after = auditRecordFrom(response)
+			}
+			ac.recordChange(AuditRecordCreate, zoneName, zoneID, response.ID, nil, after, err)
 			if err != nil {
 				results = append(results, map[string]interface{}{
 					"success": false,
@@ -700,6 +937,10 @@ func UpdateDNSRecordsHandler(store *session.Store) fiber.Handler {
 				continue
 			}
 
+			// Track the new record so later lines are validated against it
+			candidate.ID = response.ID
+			zoneRecords = append(remaining, candidate)
+
 			// Determine appropriate message based on whether we replaced existing records
 			var message string
 			if len(existingRecords) > 0 {
@@ -720,15 +961,20 @@ func UpdateDNSRecordsHandler(store *session.Store) fiber.Handler {
 				"created":        len(existingRecords) == 0,
 				"replaced":       len(existingRecords) > 0,
 				"replaced_count": len(existingRecords),
+				"warnings":       validation.WarningMessages(),
 				"record": map[string]interface{}{
 					"type":    recordType,
 					"name":    recordName,
 					"content": recordContent,
 					"proxied": proxied,
+					"comment": recordComment,
+					"tags":    recordTags,
 				},
 			})
 		}
 
+		cache.Invalidate(zoneID)
+
 		// Count successful operations
 		successCount := 0
 		for _, result := range results {
@@ -763,7 +1009,7 @@ func UpdateDNSRecordsHandler(store *session.Store) fiber.Handler {
 }
 
 // CreateDNSRecordHandler handles creating a single DNS record
-func CreateDNSRecordHandler(store *session.Store) fiber.Handler {
+func CreateDNSRecordHandler(store *session.Store, policy *ProxyPolicy, audit *AuditLog, cache *SearchCache) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		domainName := c.Params("domain")
 		if domainName == "" {
@@ -775,10 +1021,14 @@ func CreateDNSRecordHandler(store *session.Store) fiber.Handler {
 
 		// Parse the request body
 		type CreateRecordRequest struct {
-			Type    string `json:"type"`
-			Name    string `json:"name"`
-			Content string `json:"content"`
-			Proxied bool   `json:"proxied"`
+			Type     string                 `json:"type"`
+			Name     string                 `json:"name"`
+			Content  string                 `json:"content"`
+			Proxied  *bool                  `json:"proxied"`  // Omit to use the proxy policy
+			Priority *uint16                `json:"priority"` // Optional priority for MX records
+			Data     map[string]interface{} `json:"data"`     // Optional structured fields for data-bearing types
+			Comment  string                 `json:"comment"`
+			Tags     []string               `json:"tags"`
 		}
 
 		req := new(CreateRecordRequest)
@@ -810,29 +1060,40 @@ func CreateDNSRecordHandler(store *session.Store) fiber.Handler {
 			})
 		}
 
-		// Prepare record data
-		recordName := req.Name
-		if recordName == "@" {
-			recordName = domainName
-		} else if !strings.Contains(recordName, domainName) {
-			recordName = recordName + "." + domainName
+		// Qualify the record name relative to the zone (handles @, trailing dots and IDNs)
+		zoneName, err := NormalizeZone(domainName)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+		recordName, err := QualifyName(req.Name, zoneName)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
 		}
 
-		// Handle @ symbol in CONTENT field
-		recordContent := req.Content
-		if recordContent == "@" {
-			recordContent = domainName
+		// Handle @ symbol and hostname targets in CONTENT field
+		recordContent, err := qualifyContent(req.Type, req.Content, zoneName)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
 		}
 
 		// For A records where CONTENT is @, we need to look up the IP of the root domain
-		if req.Type == "A" && recordContent == domainName {
+		if req.Type == "A" && recordContent == zoneName {
 			// Get the A records for the root domain
 			rootRecords, _, err := api.ListDNSRecords(
 				context.Background(),
 				cloudflare.ZoneIdentifier(zoneID),
 				cloudflare.ListDNSRecordsParams{
 					Type: "A",
-					Name: domainName,
+					Name: zoneName,
 				},
 			)
 			if err != nil {
@@ -855,18 +1116,63 @@ func CreateDNSRecordHandler(store *session.Store) fiber.Handler {
 			recordContent = rootRecords[0].Content
 		}
 
-		proxied := req.Proxied
+		// Convert the content into the typed fields Cloudflare expects
+		payload, err := buildTypedRecord(req.Type, recordName, recordContent, req.Priority, req.Data)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		// Validate the content that is sent, which includes the structured fields and priority
+		recordContent = payload.formatContent(req.Type)
 
-		// Create record
-		params := cloudflare.CreateDNSRecordParams{
+		payload.Comment = req.Comment
+		payload.Tags = req.Tags
+
+		// The proxy policy decides when the request does not say, and refuses records that
+		// cannot be proxied
+		proxied, err := policy.Resolve(api, zoneName, req.Type, recordName, recordContent, req.Proxied)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		// Validate the record against the rest of the zone before writing
+		validation, err := validateRecord(api, zoneID, zoneName, validator.Record{
 			Type:    req.Type,
 			Name:    recordName,
 			Content: recordContent,
-			Proxied: &proxied,
-			TTL:     1, // Auto TTL
+			Proxied: proxied,
+		}, "")
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch existing records for validation",
+				"error":   err.Error(),
+			})
+		}
+		if !validation.Valid() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success":    false,
+				"message":    "Validation failed: " + validation.Messages(),
+				"validation": validation,
+			})
 		}
 
+		// Create record
+		params := payload.createParams(req.Type, recordName, proxiedFor(req.Type, proxied))
+
 		record, err := api.CreateDNSRecord(context.Background(), cloudflare.ZoneIdentifier(zoneID), params)
+		var after *AuditRecord
+		if err == nil {
+			after = auditRecordFrom(record)
+		}
+		newAuditContext(c, store, audit, false).recordChange(AuditRecordCreate, zoneName, zoneID, record.ID, nil, after, err)
+		cache.Invalidate(zoneID)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"success": false,
@@ -882,9 +1188,12 @@ func CreateDNSRecordHandler(store *session.Store) fiber.Handler {
 				"id":      record.ID,
 				"type":    record.Type,
 				"name":    record.Name,
-				"content": record.Content,
+				"content": FormatRecordContent(record),
 				"proxied": record.Proxied != nil && *record.Proxied,
+				"comment": record.Comment,
+				"tags":    record.Tags,
 			},
+			"warnings": validation.Warnings,
 		})
 	}
 }
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// typeDS is the DS record type, which dnsmessage does not define
+const typeDS = dnsmessage.Type(43)
+
+// DNSSEC statuses reported by Cloudflare
+const (
+	DNSSECActive          = "active"           // Cloudflare signs the zone and the DS was seen at the parent
+	DNSSECPending         = "pending"          // Cloudflare signs the zone and waits for the DS at the parent
+	DNSSECDisabled        = "disabled"         // The zone is not signed
+	DNSSECPendingDisabled = "pending-disabled" // Signing stops once the DS is removed at the parent
+	DNSSECError           = "error"
+)
+
+// DNSSEC problems, comparing the status at Cloudflare with the DS records at the parent
+const (
+	DNSSECProblemMissingDS  = "missing_ds"  // Enabled at Cloudflare but the parent has no DS
+	DNSSECProblemMismatchDS = "mismatch_ds" // The parent has DS records, none of them for the Cloudflare key
+	DNSSECProblemStaleDS    = "stale_ds"    // Disabled at Cloudflare but the parent still has a DS, resolvers fail to validate the zone
+)
+
+// DSRecord is a delegation signer record, as given to the registrar
+type DSRecord struct {
+	KeyTag     int    `json:"key_tag"`
+	Algorithm  int    `json:"algorithm"`
+	DigestType int    `json:"digest_type"`
+	Digest     string `json:"digest"` // Uppercase hex
+}
+
+// DNSSECStatus is the DNSSEC status of a zone at Cloudflare, with the DS records found at
+// the parent zone
+type DNSSECStatus struct {
+	Zone        string     `json:"zone"`
+	ZoneID      string     `json:"zone_id"`
+	Status      string     `json:"status"`
+	DS          string     `json:"ds"` // Full DS record in zone file format
+	KeyTag      int        `json:"key_tag"`
+	Algorithm   string     `json:"algorithm"`
+	DigestType  string     `json:"digest_type"`
+	Digest      string     `json:"digest"`
+	Flags       int        `json:"flags"`
+	PublicKey   string     `json:"public_key"`
+	ModifiedOn  string     `json:"modified_on,omitempty"`
+	ParentDS    []DSRecord `json:"parent_ds"`
+	DSAtParent  bool       `json:"ds_at_parent"` // The parent has the DS record of the Cloudflare key
+	Problem     string     `json:"problem,omitempty"`
+	ParentError string     `json:"parent_error,omitempty"`
+}
+
+// Enabled reports whether Cloudflare signs the zone
+func (s DNSSECStatus) Enabled() bool {
+	return s.Status == DNSSECActive || s.Status == DNSSECPending
+}
+
+// ParentDS asks the nameservers of the parent zone for the DS records of zone. An unsigned
+// delegation, or a zone the parent does not know, has no DS records.
+func (d *DelegationChecker) ParentDS(zone string) ([]DSRecord, error) {
+	resp, err := d.queryParent(zone, typeDS)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []DSRecord{}
+	for _, rr := range resp.Answers {
+		body, ok := rr.Body.(*dnsmessage.UnknownResource)
+		if !ok || rr.Header.Type != typeDS || len(body.Data) < 5 ||
+			!strings.EqualFold(strings.TrimSuffix(rr.Header.Name.String(), "."), strings.TrimSuffix(zone, ".")) {
+			continue
+		}
+		records = append(records, DSRecord{
+			KeyTag:     int(binary.BigEndian.Uint16(body.Data[0:2])),
+			Algorithm:  int(body.Data[2]),
+			DigestType: int(body.Data[3]),
+			Digest:     strings.ToUpper(hex.EncodeToString(body.Data[4:])),
+		})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].KeyTag < records[j].KeyTag })
+	return records, nil
+}
+
+// dnssecStatus fetches the DNSSEC status of a zone and compares it with the DS records at
+// the parent. Only Cloudflare errors are returned; a failed parent query is kept in the status.
+func dnssecStatus(api *cloudflare.API, delegation *DelegationChecker, zone, zoneID string) (DNSSECStatus, error) {
+	dnssec, err := api.ZoneDNSSECSetting(context.Background(), zoneID)
+	if err != nil {
+		return DNSSECStatus{Zone: zone, ZoneID: zoneID}, err
+	}
+
+	status := DNSSECStatus{
+		Zone:       zone,
+		ZoneID:     zoneID,
+		Status:     dnssec.Status,
+		DS:         dnssec.DS,
+		KeyTag:     dnssec.KeyTag,
+		Algorithm:  dnssec.Algorithm,
+		DigestType: dnssec.DigestType,
+		Digest:     strings.ToUpper(dnssec.Digest),
+		Flags:      dnssec.Flags,
+		PublicKey:  dnssec.PublicKey,
+	}
+	if !dnssec.ModifiedOn.IsZero() {
+		status.ModifiedOn = dnssec.ModifiedOn.UTC().Format("2006-01-02T15:04:05Z")
+	}
+
+	status.ParentDS, err = delegation.ParentDS(zone)
+	if err != nil {
+		status.ParentError = err.Error()
+		return status, nil
+	}
+	for _, ds := range status.ParentDS {
+		if ds.KeyTag == status.KeyTag && strconv.Itoa(ds.DigestType) == status.DigestType && ds.Digest == status.Digest {
+			status.DSAtParent = true
+		}
+	}
+
+	switch {
+	case status.Enabled() && len(status.ParentDS) == 0:
+		status.Problem = DNSSECProblemMissingDS
+	case status.Enabled() && !status.DSAtParent:
+		status.Problem = DNSSECProblemMismatchDS
+	case status.Status == DNSSECDisabled && len(status.ParentDS) > 0:
+		status.Problem = DNSSECProblemStaleDS
+	}
+	return status, nil
+}
+
+// dnssecMessage describes a DNSSEC status for notifications
+func dnssecMessage(status DNSSECStatus) string {
+	switch status.Problem {
+	case DNSSECProblemMissingDS:
+		return "DNSSEC is enabled but the parent zone has no DS record, add it at the registrar"
+	case DNSSECProblemMismatchDS:
+		return "DNSSEC is enabled but the DS record at the parent zone does not match, replace it at the registrar"
+	case DNSSECProblemStaleDS:
+		return "DNSSEC is disabled but the parent zone still has a DS record, remove it at the registrar"
+	}
+	if status.ParentError != "" {
+		return "DNSSEC is " + status.Status + ", the parent zone could not be checked: " + status.ParentError
+	}
+	switch status.Status {
+	case DNSSECActive:
+		return "DNSSEC is active and the DS record is at the parent zone"
+	case DNSSECPending:
+		return "DNSSEC is pending, the DS record is at the parent zone and waits for Cloudflare to see it"
+	case DNSSECPendingDisabled:
+		return "DNSSEC is being disabled, remove the DS record at the registrar"
+	case DNSSECDisabled:
+		return "DNSSEC is disabled"
+	}
+	return "DNSSEC status is " + status.Status
+}
+
+// GetDNSSECHandler returns the DNSSEC status and DS record of the zone in the URL
+func GetDNSSECHandler(store *session.Store, delegation *DelegationChecker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		domain := auditZoneName(c.Params("domain"))
+		zoneID, err := api.ZoneIDByName(domain)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Domain not found",
+				"error":   err.Error(),
+			})
+		}
+
+		status, err := dnssecStatus(api, delegation, domain, zoneID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch DNSSEC status",
+				"error":   err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": dnssecMessage(status),
+			"data":    status,
+		})
+	}
+}
+
+// DNSSECControlHandler enables or disables DNSSEC on the zone in the URL
+func DNSSECControlHandler(store *session.Store, audit *AuditLog, delegation *DelegationChecker, enable bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		domain := auditZoneName(c.Params("domain"))
+		zoneID, err := api.ZoneIDByName(domain)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Domain not found",
+				"error":   err.Error(),
+			})
+		}
+
+		value, detail := DNSSECDisabled, "DNSSEC disabled"
+		if enable {
+			value, detail = DNSSECActive, "DNSSEC enabled"
+		}
+		_, err = api.UpdateZoneDNSSEC(context.Background(), zoneID, cloudflare.ZoneDNSSECUpdateOptions{Status: value})
+		newAuditContext(c, store, audit, false).record(AuditEntry{
+			Action:  AuditZoneDNSSEC,
+			Zone:    domain,
+			ZoneID:  zoneID,
+			Success: err == nil,
+			Error:   errorString(err),
+			Detail:  detail,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"success": false,
+				"message": "Cloudflare rejected the change",
+				"error":   err.Error(),
+			})
+		}
+
+		status, err := dnssecStatus(api, delegation, domain, zoneID)
+		if err != nil {
+			return c.JSON(fiber.Map{
+				"success": true,
+				"message": detail + ", but the new status could not be fetched",
+				"error":   err.Error(),
+			})
+		}
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": detail + ". " + dnssecMessage(status),
+			"data":    status,
+		})
+	}
+}
+
+// DNSSECReportHandler checks the DNSSEC status of every zone against its parent and lists
+// the zones that need action at the registrar first
+func DNSSECReportHandler(store *session.Store, delegation *DelegationChecker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		zones, err := api.ListZones(context.Background())
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch domains",
+				"error":   err.Error(),
+			})
+		}
+
+		results := make([]DNSSECStatus, len(zones))
+		errs := make([]string, len(zones))
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < delegationWorkers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					status, err := dnssecStatus(api, delegation, zones[i].Name, zones[i].ID)
+					if err != nil {
+						status.Status = DNSSECError
+						errs[i] = err.Error()
+					}
+					results[i] = status
+				}
+			}()
+		}
+		for i := range zones {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+
+		type reportEntry struct {
+			DNSSECStatus
+			UnicodeName string `json:"unicode_name"`
+			Message     string `json:"message"`
+			Error       string `json:"error,omitempty"`
+		}
+		report := make([]reportEntry, len(results))
+		problems, enabled := 0, 0
+		for i, status := range results {
+			message := dnssecMessage(status)
+			if errs[i] != "" {
+				message = "Failed to fetch DNSSEC status"
+			}
+			report[i] = reportEntry{DNSSECStatus: status, UnicodeName: DisplayName(status.Zone), Message: message, Error: errs[i]}
+			if status.Problem != "" {
+				problems++
+			}
+			if status.Enabled() {
+				enabled++
+			}
+		}
+		sort.SliceStable(report, func(i, j int) bool {
+			a, b := report[i], report[j]
+			if (a.Problem != "") != (b.Problem != "") {
+				return a.Problem != ""
+			}
+			return a.Zone < b.Zone
+		})
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": fmt.Sprintf("DNSSEC is enabled on %d of %d domains, %d need action at the registrar", enabled, len(zones), problems),
+			"results": report,
+		})
+	}
+}
@@ -8,18 +8,34 @@ import (
 	"github.com/cloudflare/cloudflare-go"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/session"
+
+	"hijicloudflareDNS/validator"
 )
 
 // Domain represents a Cloudflare domain
 type Domain struct {
-	ID        string `json:"id"`
-	Name      string `json:"name"`
-	Status    string `json:"status"`
-	CreatedOn string `json:"created_on"`
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`         // ASCII (punycode) form used by Cloudflare
+	UnicodeName string           `json:"unicode_name"` // Unicode form for display, same as Name for ASCII domains
+	Status      string           `json:"status"`
+	CreatedOn   string           `json:"created_on"`
+	ActivatedOn string           `json:"activated_on"`     // Empty until the zone is active
+	Paused      bool             `json:"paused"`           // Cloudflare is paused and traffic goes to the origin
+	DevMode     int              `json:"development_mode"` // Seconds of development mode left, 0 when off
+	Type        string           `json:"type"`             // full, partial or secondary
+	Plan        string           `json:"plan"`
+	AccountID   string           `json:"account_id"`
+	AccountName string           `json:"account_name"`
+	NameServers []string         `json:"name_servers"`          // Nameservers Cloudflare assigned
+	OriginalNS  []string         `json:"original_name_servers"` // Nameservers before the move to Cloudflare
+	RecordCount *int             `json:"record_count"`          // Null when not counted
+	Delegation  *DelegationCheck `json:"delegation,omitempty"`  // Last delegation check
 }
 
-// DomainsHandler handles fetching domains from Cloudflare with pagination
-func DomainsHandler(store *session.Store) fiber.Handler {
+// DomainsHandler handles fetching domains from Cloudflare with filtering, sorting and
+// pagination, along with the last delegation check of each domain. Record counts come from
+// the search cache; records=false leaves them out.
+func DomainsHandler(store *session.Store, delegation *DelegationChecker, cache *SearchCache) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get API client from session
 		api, err := GetAPIClient(c, store)
@@ -31,10 +47,17 @@ func DomainsHandler(store *session.Store) fiber.Handler {
 			})
 		}
 
+		query, err := ParseDomainQuery(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
 		// Parse pagination parameters
 		page := c.QueryInt("page", 1)
 		perPage := c.QueryInt("per_page", 20) // Default 20 domains per page to match Cloudflare
-		search := c.Query("search", "")       // Search query
 
 		// Limit per_page to reasonable values
 		if perPage > 100 {
@@ -48,7 +71,7 @@ func DomainsHandler(store *session.Store) fiber.Handler {
 		}
 
 		// Get zones (domains) from Cloudflare
-		zones, err := api.ListZones(context.Background())
+		zones, err := listZones(api)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"success": false,
@@ -57,20 +80,28 @@ func DomainsHandler(store *session.Store) fiber.Handler {
 			})
 		}
 
-		// Apply search filter if provided
-		if search != "" {
-			filteredZones := []cloudflare.Zone{}
-			searchLower := strings.ToLower(search)
-			for _, zone := range zones {
-				if strings.Contains(strings.ToLower(zone.Name), searchLower) {
-					filteredZones = append(filteredZones, zone)
+		// Apply the filters, counting the records of every matching zone only when the
+		// record count is filtered or sorted on
+		domains := []Domain{}
+		for _, zone := range zones {
+			if query.Matches(zone) {
+				domains = append(domains, domainFromZone(zone))
+			}
+		}
+		if query.countsRecords() {
+			countDomainRecords(api, cache, domains)
+			counted := []Domain{}
+			for _, domain := range domains {
+				if query.MatchesRecordCount(domain) {
+					counted = append(counted, domain)
 				}
 			}
-			zones = filteredZones
+			domains = counted
 		}
+		sortDomains(domains, query.Sort, query.Desc)
 
 		// Calculate pagination
-		totalCount := len(zones)
+		totalCount := len(domains)
 		totalPages := (totalCount + perPage - 1) / perPage
 
 		// Apply pagination
@@ -78,27 +109,22 @@ func DomainsHandler(store *session.Store) fiber.Handler {
 		endIndex := startIndex + perPage
 
 		if startIndex > totalCount {
-			zones = []cloudflare.Zone{}
+			domains = []Domain{}
 		} else {
 			if endIndex > totalCount {
 				endIndex = totalCount
 			}
-			zones = zones[startIndex:endIndex]
+			domains = domains[startIndex:endIndex]
 		}
 
-		// Convert zones to Domain objects
-		domains := make([]Domain, len(zones))
-		for i, zone := range zones {
-			createdOn := ""
-			if !zone.CreatedOn.IsZero() {
-				createdOn = zone.CreatedOn.Format("2006-01-02T15:04:05Z")
-			}
-
-			domains[i] = Domain{
-				ID:        zone.ID,
-				Name:      zone.Name,
-				Status:    zone.Status,
-				CreatedOn: createdOn,
+		// Without a record count filter or sort, records are only counted when asked, and only
+		// for the zones on this page
+		if query.Records && !query.countsRecords() {
+			countDomainRecords(api, cache, domains)
+		}
+		for i := range domains {
+			if check, ok := delegation.Last(domains[i].Name); ok {
+				domains[i].Delegation = &check
 			}
 		}
 
@@ -106,6 +132,7 @@ func DomainsHandler(store *session.Store) fiber.Handler {
 		return c.JSON(fiber.Map{
 			"success": true,
 			"data":    domains,
+			"filters": domainFilterOptions(zones),
 			"pagination": fiber.Map{
 				"page":        page,
 				"per_page":    perPage,
@@ -145,9 +172,10 @@ func RenderDomainsPageHandler(store *session.Store) fiber.Handler {
 
 // AddDomainsRequest represents the request for adding multiple domains
 type AddDomainsRequest struct {
-	Domains         string   `json:"domains"`         // Newline-separated domain names
-	Template        string   `json:"template"`        // Template ID
-	TemplateRecords []string `json:"templateRecords"` // DNS records from template
+	Domains   string            `json:"domains"`   // Newline-separated domain names
+	Template  string            `json:"template"`  // ID of a template in the template library
+	Variables map[string]string `json:"variables"` // Values for the template variables
+	Profile   string            `json:"profile"`   // ID of a settings profile applied to each new zone
 }
 
 // AddDomainsResponse represents the response for domain addition results
@@ -159,19 +187,23 @@ type AddDomainsResponse struct {
 
 // DomainAddResult represents the result of adding a single domain
 type DomainAddResult struct {
-	Domain       string   `json:"domain"`
-	Success      bool     `json:"success"`
-	Message      string   `json:"message"`
-	Error        string   `json:"error,omitempty"`
-	Nameservers  []string `json:"nameservers,omitempty"`
-	ZoneID       string   `json:"zone_id,omitempty"`
-	DNSRecords   int      `json:"dns_records,omitempty"`   // Number of DNS records added
-	DNSErrors    []string `json:"dns_errors,omitempty"`    // DNS record creation errors
-	TemplateName string   `json:"template_name,omitempty"` // Template used
+	Domain       string          `json:"domain"`                   // ASCII (punycode) form
+	UnicodeName  string          `json:"unicode_domain,omitempty"` // Unicode form when it differs from Domain
+	Success      bool            `json:"success"`
+	Message      string          `json:"message"`
+	Error        string          `json:"error,omitempty"`
+	Nameservers  []string        `json:"nameservers,omitempty"`
+	ZoneID       string          `json:"zone_id,omitempty"`
+	DNSRecords   int             `json:"dns_records,omitempty"`   // Number of DNS records added
+	DNSErrors    []string        `json:"dns_errors,omitempty"`    // DNS record creation errors
+	DNSWarnings  []string        `json:"dns_warnings,omitempty"`  // DNS record validation warnings
+	TemplateName string          `json:"template_name,omitempty"` // Template used
+	ProfileName  string          `json:"profile_name,omitempty"`  // Settings profile used
+	Settings     []SettingChange `json:"settings,omitempty"`      // Outcome of each setting of the profile
 }
 
 // AddDomainsHandler handles adding multiple domains to Cloudflare
-func AddDomainsHandler(store *session.Store) fiber.Handler {
+func AddDomainsHandler(store *session.Store, templates *TemplateStore, profiles *ProfileStore, policy *ProxyPolicy, audit *AuditLog) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get API client from session
 		api, err := GetAPIClient(c, store)
@@ -193,21 +225,62 @@ func AddDomainsHandler(store *session.Store) fiber.Handler {
 			})
 		}
 
+		// Resolve the template server-side and check its variables before any zone is created
+		var template *DNSTemplate
+		if req.Template != "" {
+			t, ok := templates.Get(req.Template)
+			if !ok {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": fmt.Sprintf("Template not found: %s", req.Template),
+				})
+			}
+			if _, err := resolveVariables(t.Variables, templatePreviewZone, req.Variables); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": "Invalid template variables",
+					"error":   err.Error(),
+				})
+			}
+			template = &t
+		}
+
+		var profile *SettingsProfile
+		if req.Profile != "" {
+			p, ok := profiles.Get(req.Profile)
+			if !ok {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": fmt.Sprintf("Settings profile not found: %s", req.Profile),
+				})
+			}
+			profile = &p
+		}
+
 		// Parse domains from the request
-		domains := parseDomainsList(req.Domains)
+		domains, invalid := parseDomainsList(req.Domains)
 		if len(domains) == 0 {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"success": false,
 				"message": "No valid domains provided",
+				"results": invalid,
 			})
 		}
 
-		// Process each domain
-		results := make([]DomainAddResult, 0, len(domains))
+		// Process each domain, reporting invalid entries first
+		results := make([]DomainAddResult, 0, len(domains)+len(invalid))
+		results = append(results, invalid...)
 		successCount := 0
 
+		actor, _ := SessionEmail(c, store)
+		ac := newAuditContext(c, store, audit, false)
 		for _, domain := range domains {
-			result := addSingleDomain(api, domain, req.TemplateRecords, req.Template)
+			result := addSingleDomain(api, policy, domain, template, req.Variables, profile, ac)
+			if result.Success && template != nil {
+				if err := templates.Assign(domain, template.ID, req.Variables, actor); err != nil {
+					result.DNSErrors = append(result.DNSErrors, fmt.Sprintf("Failed to record template assignment: %s", err.Error()))
+				}
+			}
 			results = append(results, result)
 			if result.Success {
 				successCount++
@@ -215,7 +288,7 @@ func AddDomainsHandler(store *session.Store) fiber.Handler {
 		}
 
 		// Return results
-		message := fmt.Sprintf("Successfully added %d out of %d domains", successCount, len(domains))
+		message := fmt.Sprintf("Successfully added %d out of %d domains", successCount, len(domains)+len(invalid))
 
 		return c.JSON(AddDomainsResponse{
 			Success: true,
@@ -225,40 +298,63 @@ func AddDomainsHandler(store *session.Store) fiber.Handler {
 	}
 }
 
-// parseDomainsList parses the domains string into a slice of domain names
-func parseDomainsList(domainsText string) []string {
+// parseDomainsList parses the domains string into a slice of ASCII domain names, converting
+// Unicode domains to A-labels. Lines that fail validation are returned as failed results.
+func parseDomainsList(domainsText string) ([]string, []DomainAddResult) {
 	lines := strings.Split(domainsText, "\n")
 	domains := make([]string, 0)
+	invalid := make([]DomainAddResult, 0)
 
 	for _, line := range lines {
 		domain := strings.TrimSpace(line)
-		if domain != "" && isValidDomain(domain) {
-			domains = append(domains, domain)
+		if domain == "" {
+			continue
 		}
-	}
 
-	return domains
-}
+		ascii, err := NormalizeDomain(domain)
+		if err != nil {
+			invalid = append(invalid, DomainAddResult{
+				Domain:  domain,
+				Success: false,
+				Message: "Invalid domain name",
+				Error:   err.Error(),
+			})
+			continue
+		}
+		domains = append(domains, ascii)
+	}
 
-// isValidDomain performs basic domain validation
-func isValidDomain(domain string) bool {
-	// Basic validation - domain should contain at least one dot and be at least 3 characters
-	return len(domain) >= 3 && strings.Contains(domain, ".") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+	return domains, invalid
 }
 
-// addSingleDomain adds a single domain to Cloudflare and returns the result
-func addSingleDomain(api *cloudflare.API, domain string, templateRecords []string, templateName string) DomainAddResult {
+// addSingleDomain adds a single domain to Cloudflare, configures it with the settings profile
+// and populates it with the template records, and returns the result
+func addSingleDomain(api *cloudflare.API, policy *ProxyPolicy, domain string, template *DNSTemplate, variables map[string]string, profile *SettingsProfile, ac *auditContext) DomainAddResult {
 	result := DomainAddResult{
 		Domain:  domain,
 		Success: false,
 	}
+	if unicode := DisplayName(domain); unicode != domain {
+		result.UnicodeName = unicode
+	}
+
+	// Render the template for this zone before creating it
+	var templateRecords []string
+	if template != nil {
+		result.TemplateName = template.Name
 
-	if templateName != "" {
-		result.TemplateName = templateName
+		records, err := RenderTemplate(*template, domain, variables)
+		if err != nil {
+			result.Error = err.Error()
+			result.Message = fmt.Sprintf("Failed to render template %s: %s", template.Name, err.Error())
+			return result
+		}
+		templateRecords = records
 	}
 
 	// Create zone in Cloudflare
 	zone, err := api.CreateZone(context.Background(), domain, false, cloudflare.Account{}, "full")
+	ac.record(AuditEntry{Action: AuditZoneAdd, Zone: domain, ZoneID: zone.ID, Success: err == nil, Error: errorString(err), Detail: result.TemplateName})
 	if err != nil {
 		result.Error = err.Error()
 		result.Message = fmt.Sprintf("Failed to add domain: %s", err.Error())
@@ -277,87 +373,61 @@ func addSingleDomain(api *cloudflare.API, domain string, templateRecords []strin
 	result.Success = true
 	result.ZoneID = zone.ID
 	result.Nameservers = zoneDetails.NameServers
+	result.Message = "Domain added successfully"
+
+	// Configure the zone with the settings profile before any record is added
+	if profile != nil {
+		result.ProfileName = profile.Name
+		result.Settings = ApplyZoneSettings(api, zone.ID, domain, profile.Settings, ac, "Profile "+profile.Name)
+
+		failed := 0
+		for _, change := range result.Settings {
+			if !change.Success {
+				failed++
+			}
+		}
+		if failed > 0 {
+			result.Message += fmt.Sprintf(", %d of %d settings failed", failed, len(result.Settings))
+		} else {
+			result.Message += fmt.Sprintf(", %d settings applied", len(result.Settings))
+		}
+	}
 
 	// Add DNS records from template if provided
 	if len(templateRecords) > 0 {
-		dnsRecordsAdded, dnsErrors := addDNSRecordsFromTemplate(api, zone.ID, domain, templateRecords)
+		dnsRecordsAdded, dnsErrors, dnsWarnings := addDNSRecordsFromTemplate(api, policy, zone.ID, domain, templateRecords, ac, "Template "+template.Name)
 		result.DNSRecords = dnsRecordsAdded
 		result.DNSErrors = dnsErrors
+		result.DNSWarnings = dnsWarnings
 
 		if len(dnsErrors) > 0 {
-			result.Message = fmt.Sprintf("Domain added successfully with %d DNS records (%d failed)", dnsRecordsAdded, len(dnsErrors))
+			result.Message += fmt.Sprintf(", %d DNS records added (%d failed)", dnsRecordsAdded, len(dnsErrors))
 		} else {
-			result.Message = fmt.Sprintf("Domain added successfully with %d DNS records", dnsRecordsAdded)
+			result.Message += fmt.Sprintf(", %d DNS records added", dnsRecordsAdded)
 		}
-	} else {
-		result.Message = "Domain added successfully"
 	}
 
 	return result
 }
 
 // addDNSRecordsFromTemplate adds DNS records from template to a zone
-func addDNSRecordsFromTemplate(api *cloudflare.API, zoneID, domain string, templateRecords []string) (int, []string) {
-	recordsAdded := 0
-	errors := []string{}
-
-	for _, recordLine := range templateRecords {
-		parts := strings.Split(recordLine, "|")
-		if len(parts) < 3 || len(parts) > 4 {
-			errors = append(errors, fmt.Sprintf("Invalid record format: %s (expected TYPE|NAME|CONTENT or TYPE|NAME|CONTENT|PROXIED)", recordLine))
-			continue
-		}
-
-		recordType := strings.TrimSpace(parts[0])
-		recordName := strings.TrimSpace(parts[1])
-		recordContent := strings.TrimSpace(parts[2])
-
-		// Parse proxied setting (default to true for A and CNAME, false for others)
-		proxied := false
-		if len(parts) == 4 {
-			proxiedStr := strings.TrimSpace(strings.ToLower(parts[3]))
-			proxied = proxiedStr == "true" || proxiedStr == "1"
-		} else {
-			// Default proxied behavior
-			if recordType == "A" || recordType == "AAAA" || recordType == "CNAME" {
-				proxied = true
-			}
-		}
-
-		// Convert @ to domain for name
-		if recordName == "@" {
-			recordName = domain
-		} else if !strings.Contains(recordName, ".") {
-			recordName = recordName + "." + domain
-		}
-
-		// Convert @ to domain for content (for CNAME records)
-		if recordContent == "@" {
-			recordContent = domain
-		}
-
-		// Create DNS record params
-		params := cloudflare.CreateDNSRecordParams{
-			Type:    recordType,
-			Name:    recordName,
-			Content: recordContent,
-			TTL:     1, // Auto TTL
-		}
-
-		// Set proxied for supported record types
-		if recordType == "A" || recordType == "AAAA" || recordType == "CNAME" {
-			params.Proxied = &proxied
-		}
+func addDNSRecordsFromTemplate(api *cloudflare.API, policy *ProxyPolicy, zoneID, domain string, templateRecords []string, ac *auditContext, detail string) (int, []string, []string) {
+	// The zone was just added, so there is nothing to snapshot
+	result := ApplyRecordsToZone(api, policy, nil, ac, zoneID, domain, templateRecords, ConflictSkip, false, "")
+	ac.recordApply(result, AuditTemplateApply, detail)
+	if result.Error != "" {
+		return 0, []string{result.Message}, []string{}
+	}
 
-		_, err := api.CreateDNSRecord(context.Background(), cloudflare.ZoneIdentifier(zoneID), params)
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("Failed to create %s record for %s: %s", recordType, recordName, err.Error()))
-		} else {
-			recordsAdded++
+	errors := []string{}
+	warnings := []string{}
+	for _, change := range result.Changes {
+		if !change.Success {
+			errors = append(errors, fmt.Sprintf("Failed to create %s: %s", change.Label(), change.Error))
 		}
+		warnings = append(warnings, change.Warnings...)
 	}
-
-	return recordsAdded, errors
+	return result.Created, errors, warnings
 }
 
 // BulkDNSRequest represents the request for bulk DNS record addition
@@ -374,16 +444,18 @@ type BulkDNSResponse struct {
 
 // BulkDNSResult represents the result of adding DNS records to a single domain
 type BulkDNSResult struct {
-	Domain       string   `json:"domain"`
-	Success      bool     `json:"success"`
-	Message      string   `json:"message"`
-	Error        string   `json:"error,omitempty"`
-	RecordsAdded int      `json:"records_added"`
-	RecordErrors []string `json:"record_errors,omitempty"`
+	Domain         string   `json:"domain"`
+	UnicodeName    string   `json:"unicode_domain,omitempty"`
+	Success        bool     `json:"success"`
+	Message        string   `json:"message"`
+	Error          string   `json:"error,omitempty"`
+	RecordsAdded   int      `json:"records_added"`
+	RecordErrors   []string `json:"record_errors,omitempty"`
+	RecordWarnings []string `json:"record_warnings,omitempty"`
 }
 
 // BulkDNSHandler handles adding DNS records to multiple domains
-func BulkDNSHandler(store *session.Store) fiber.Handler {
+func BulkDNSHandler(store *session.Store, policy *ProxyPolicy, audit *AuditLog, snapshots *SnapshotStore, cache *SearchCache) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get API client from session
 		api, err := GetAPIClient(c, store)
@@ -405,12 +477,13 @@ func BulkDNSHandler(store *session.Store) fiber.Handler {
 			})
 		}
 
-		// Parse DNS records from the request
-		dnsRecords := parseBulkDNSRecords(req.Records)
+		// Parse DNS records from the request, reporting the lines that cannot be used
+		dnsRecords, invalid := parseBulkDNSRecords(req.Records)
 		if len(dnsRecords) == 0 {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"success": false,
 				"message": "No valid DNS records provided",
+				"results": invalid,
 			})
 		}
 
@@ -418,12 +491,14 @@ func BulkDNSHandler(store *session.Store) fiber.Handler {
 		domainRecords := groupRecordsByDomain(dnsRecords)
 
 		// Process each domain
-		results := make([]BulkDNSResult, 0, len(domainRecords))
+		results := make([]BulkDNSResult, 0, len(domainRecords)+len(invalid))
+		results = append(results, invalid...)
 		successCount := 0
 		totalRecordsAdded := 0
 
+		ac := newAuditContext(c, store, audit, true)
 		for domain, records := range domainRecords {
-			result := addBulkDNSRecordsToDomain(api, domain, records)
+			result := addBulkDNSRecordsToDomain(api, policy, domain, records, ac, snapshots, cache)
 			results = append(results, result)
 			if result.Success {
 				successCount++
@@ -448,22 +523,39 @@ type DNSRecordBulk struct {
 	Name    string
 	Content string
 	Domain  string
+	Comment string
+	Tags    []string
 }
 
-// parseBulkDNSRecords parses the DNS records string into a slice of DNSRecordBulk
-func parseBulkDNSRecords(recordsText string) []DNSRecordBulk {
+// parseBulkDNSRecords parses the DNS records string into a slice of DNSRecordBulk. Lines
+// that cannot be parsed, or whose domain is invalid, are returned as failed results.
+func parseBulkDNSRecords(recordsText string) ([]DNSRecordBulk, []BulkDNSResult) {
 	lines := strings.Split(recordsText, "\n")
 	records := make([]DNSRecordBulk, 0)
+	invalid := make([]BulkDNSResult, 0)
 
-	for _, line := range lines {
+	for i, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" {
 			continue
 		}
+		skip := func(domain, reason string) {
+			if domain == "" {
+				domain = line
+			}
+			invalid = append(invalid, BulkDNSResult{
+				Domain:  domain,
+				Success: false,
+				Message: fmt.Sprintf("Line %d skipped: %s", i+1, reason),
+				Error:   reason,
+			})
+		}
 
+		// Format: TYPE|NAME|CONTENT|DOMAIN with optional |COMMENT|TAGS
 		parts := strings.Split(line, "|")
-		if len(parts) != 4 {
-			continue // Skip invalid format
+		if len(parts) < 4 || len(parts) > 6 {
+			skip("", "invalid format, expected TYPE|NAME|CONTENT|DOMAIN or TYPE|NAME|CONTENT|DOMAIN|COMMENT|TAGS")
+			continue
 		}
 
 		record := DNSRecordBulk{
@@ -472,14 +564,28 @@ func parseBulkDNSRecords(recordsText string) []DNSRecordBulk {
 			Content: strings.TrimSpace(parts[2]),
 			Domain:  strings.TrimSpace(parts[3]),
 		}
+		if len(parts) >= 5 {
+			record.Comment = strings.TrimSpace(parts[4])
+		}
+		if len(parts) == 6 {
+			record.Tags = ParseTags(parts[5])
+		}
 
-		// Basic validation
-		if record.Type != "" && record.Name != "" && record.Content != "" && record.Domain != "" && isValidDomain(record.Domain) {
-			records = append(records, record)
+		// Basic validation, converting Unicode domains to their ASCII form
+		if record.Type == "" || record.Name == "" || record.Content == "" || record.Domain == "" {
+			skip(record.Domain, "TYPE, NAME, CONTENT and DOMAIN are required")
+			continue
 		}
+		ascii, err := NormalizeDomain(record.Domain)
+		if err != nil {
+			skip(record.Domain, "invalid domain name: "+err.Error())
+			continue
+		}
+		record.Domain = ascii
+		records = append(records, record)
 	}
 
-	return records
+	return records, invalid
 }
 
 // groupRecordsByDomain groups DNS records by domain
@@ -497,11 +603,14 @@ func groupRecordsByDomain(records []DNSRecordBulk) map[string][]DNSRecordBulk {
 }
 
 // addBulkDNSRecordsToDomain adds DNS records to a specific domain
-func addBulkDNSRecordsToDomain(api *cloudflare.API, domain string, records []DNSRecordBulk) BulkDNSResult {
+func addBulkDNSRecordsToDomain(api *cloudflare.API, policy *ProxyPolicy, domain string, records []DNSRecordBulk, ac *auditContext, snapshots *SnapshotStore, cache *SearchCache) BulkDNSResult {
 	result := BulkDNSResult{
 		Domain:  domain,
 		Success: false,
 	}
+	if unicode := DisplayName(domain); unicode != domain {
+		result.UnicodeName = unicode
+	}
 
 	// Get zone ID for the domain
 	zoneID, err := api.ZoneIDByName(domain)
@@ -510,54 +619,85 @@ func addBulkDNSRecordsToDomain(api *cloudflare.API, domain string, records []DNS
 		result.Message = fmt.Sprintf("Failed to find domain: %s", err.Error())
 		return result
 	}
+	defer cache.Invalidate(zoneID)
+
+	// Snapshot the zone so the bulk addition can be restored
+	if err := snapshotBefore(snapshots, api, zoneID, domain, ac, "Before bulk DNS addition"); err != nil {
+		result.Error = err.Error()
+		result.Message = fmt.Sprintf("Failed to snapshot the zone, no records added: %s", err.Error())
+		return result
+	}
+
+	// Validate each record against what is already in the zone
+	zoneRecords, err := listValidatorRecords(api, zoneID)
+	if err != nil {
+		result.Error = err.Error()
+		result.Message = fmt.Sprintf("Failed to fetch existing records: %s", err.Error())
+		return result
+	}
 
 	recordsAdded := 0
 	errors := []string{}
+	warnings := []string{}
 
 	for _, record := range records {
-		// Parse proxied setting (default to true for A and CNAME, false for others)
-		proxied := false
-		if record.Type == "A" || record.Type == "AAAA" || record.Type == "CNAME" {
-			proxied = true
+		// Qualify the name and content relative to the zone (handles @, trailing dots and IDNs)
+		recordName, err := QualifyName(record.Name, domain)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Invalid %s record name %s: %s", record.Type, record.Name, err.Error()))
+			continue
 		}
-
-		// Convert @ to domain for name
-		recordName := record.Name
-		if recordName == "@" {
-			recordName = domain
-		} else if !strings.Contains(recordName, ".") {
-			recordName = recordName + "." + domain
+		recordContent, err := qualifyContent(record.Type, record.Content, domain)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Invalid %s record for %s: %s", record.Type, recordName, err.Error()))
+			continue
 		}
 
-		// Convert @ to domain for content (for CNAME records)
-		recordContent := record.Content
-		if recordContent == "@" {
-			recordContent = domain
+		// Convert the content into the typed fields Cloudflare expects
+		payload, err := buildTypedRecord(record.Type, recordName, recordContent, nil, nil)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Invalid %s record for %s: %s", record.Type, recordName, err.Error()))
+			continue
 		}
+		payload.Comment = record.Comment
+		payload.Tags = record.Tags
 
-		// Create DNS record params
-		params := cloudflare.CreateDNSRecordParams{
-			Type:    record.Type,
-			Name:    recordName,
-			Content: recordContent,
-			TTL:     1, // Auto TTL
+		// Records say nothing about proxying, so the proxy policy decides
+		proxied, err := policy.Resolve(api, domain, record.Type, recordName, recordContent, nil)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Invalid %s record for %s: %s", record.Type, recordName, err.Error()))
+			continue
 		}
 
-		// Set proxied for supported record types
-		if record.Type == "A" || record.Type == "AAAA" || record.Type == "CNAME" {
-			params.Proxied = &proxied
+		candidate := validator.Record{Type: record.Type, Name: recordName, Content: recordContent, Proxied: proxied}
+		validation := validator.Validate(domain, candidate, zoneRecords)
+		if !validation.Valid() {
+			errors = append(errors, fmt.Sprintf("Invalid %s record for %s: %s", record.Type, recordName, validation.Messages()))
+			continue
 		}
+		warnings = append(warnings, validation.WarningMessages()...)
+
+		// Create DNS record params, setting proxied only for supported record types
+		params := payload.createParams(record.Type, recordName, proxiedFor(record.Type, proxied))
 
-		_, err := api.CreateDNSRecord(context.Background(), cloudflare.ZoneIdentifier(zoneID), params)
+		created, err := api.CreateDNSRecord(context.Background(), cloudflare.ZoneIdentifier(zoneID), params)
+		var after *AuditRecord
+		if err == nil {
+			after = auditRecordFrom(created)
+		}
+		ac.recordChange(AuditRecordCreate, domain, zoneID, created.ID, nil, after, err)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("Failed to create %s record for %s: %s", record.Type, recordName, err.Error()))
 		} else {
 			recordsAdded++
+			candidate.ID = created.ID
+			zoneRecords = append(zoneRecords, candidate)
 		}
 	}
 
 	result.RecordsAdded = recordsAdded
 	result.RecordErrors = errors
+	result.RecordWarnings = warnings
 
 	if recordsAdded > 0 {
 		result.Success = true
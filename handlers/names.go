@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// recordNameProfile converts record names to their ASCII (punycode) form. STD3 rules are
+// relaxed so that underscore labels (_dmarc, _sip._tcp) and the * wildcard label pass.
+var recordNameProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+	idna.VerifyDNSLength(false),
+	idna.BidiRule(),
+)
+
+// domainNameProfile validates zone names for registration per UTS #46 (non-transitional)
+// with the IDNA2008 label checks: hyphen placement, joiners, bidi rules and DNS lengths
+var domainNameProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(true),
+	idna.ValidateLabels(true),
+	idna.CheckHyphens(true),
+	idna.CheckJoiners(true),
+	idna.VerifyDNSLength(true),
+	idna.BidiRule(),
+)
+
+// NormalizeDomain validates a domain entered by the user (in Unicode or ASCII form) and
+// returns its ASCII (A-label) form as sent to Cloudflare
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	if domain == "" {
+		return "", fmt.Errorf("domain is empty")
+	}
+
+	ascii, err := domainNameProfile.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("invalid domain %q: %s", domain, err.Error())
+	}
+	if !strings.Contains(ascii, ".") {
+		return "", fmt.Errorf("invalid domain %q: a registrable domain needs at least two labels", domain)
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// NormalizeZone returns the canonical form of a zone name: ASCII (punycode), lower case
+// and without a trailing dot
+func NormalizeZone(zone string) (string, error) {
+	zone = strings.TrimSuffix(strings.TrimSpace(zone), ".")
+	if zone == "" {
+		return "", fmt.Errorf("zone name is empty")
+	}
+
+	ascii, err := recordNameProfile.ToASCII(zone)
+	if err != nil {
+		return "", fmt.Errorf("invalid zone name %q: %s", zone, err.Error())
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// QualifyName turns a user supplied record name into the fully qualified name Cloudflare
+// expects, relative to the zone:
+//
+//	@ or empty          -> zone apex
+//	www                 -> www.example.com (relative names get the zone appended)
+//	www.example.com     -> www.example.com (names already inside the zone are kept)
+//	www.example.com.    -> www.example.com (trailing dot marks an absolute name)
+//	*.dev               -> *.dev.example.com
+//	bücher              -> xn--bcher-kva.example.com
+//
+// Absolute names outside of the zone are rejected. Names such as "myexample.com" or
+// "example.com.evil" are not inside example.com and are therefore treated as relative.
+func QualifyName(name, zone string) (string, error) {
+	zone, err := NormalizeZone(zone)
+	if err != nil {
+		return "", err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || name == "@" {
+		return zone, nil
+	}
+
+	absolute := strings.HasSuffix(name, ".")
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || strings.HasPrefix(name, ".") || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid record name %q: empty label", name)
+	}
+
+	ascii, err := recordNameProfile.ToASCII(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid record name %q: %s", name, err.Error())
+	}
+	ascii = strings.ToLower(ascii)
+
+	inZone := ascii == zone || strings.HasSuffix(ascii, "."+zone)
+	if absolute {
+		if !inZone {
+			return "", fmt.Errorf("record name %s. is outside of zone %s", ascii, zone)
+		}
+		return ascii, nil
+	}
+	if inZone {
+		return ascii, nil
+	}
+	return ascii + "." + zone, nil
+}
+
+// QualifyTarget resolves hostname content such as a CNAME, MX or NS target: @ becomes the
+// zone apex, a trailing dot is dropped and internationalized names are converted to ASCII.
+// Targets are not made relative to the zone because they commonly point elsewhere.
+func QualifyTarget(target, zone string) (string, error) {
+	target = strings.TrimSpace(target)
+	if target == "@" {
+		return NormalizeZone(zone)
+	}
+
+	ascii, err := recordNameProfile.ToASCII(strings.TrimSuffix(target, "."))
+	if err != nil {
+		return "", fmt.Errorf("invalid target %q: %s", target, err.Error())
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// qualifyContent resolves @ in record content to the zone apex and qualifies the hostname
+// in the content of CNAME, NS, PTR, MX, SRV, HTTPS and SVCB records. A "." target, such as
+// a null MX or an HTTPS record served by its owner name, is left as is.
+func qualifyContent(recordType, content, zone string) (string, error) {
+	content = strings.TrimSpace(content)
+	switch {
+	case content == "@":
+		return NormalizeZone(zone)
+	case recordType == "CNAME" || recordType == "NS" || recordType == "PTR":
+		return QualifyTarget(content, zone)
+	}
+
+	fields := strings.Fields(content)
+	i := hostField(recordType, fields)
+	if i < 0 || fields[i] == "." {
+		return content, nil
+	}
+	target, err := QualifyTarget(fields[i], zone)
+	if err != nil {
+		return "", err
+	}
+	if target == fields[i] {
+		return content, nil
+	}
+	fields[i] = target
+	return strings.Join(fields, " "), nil
+}
+
+// hostField returns the index of the hostname in the content fields of a record type, or -1
+func hostField(recordType string, fields []string) int {
+	switch {
+	case (recordType == "CNAME" || recordType == "NS" || recordType == "PTR") && len(fields) == 1:
+		return 0
+	case recordType == "MX" && len(fields) == 2:
+		return 1
+	case recordType == "SRV" && len(fields) == 4:
+		return 3
+	case (recordType == "HTTPS" || recordType == "SVCB") && len(fields) >= 2:
+		return 1
+	}
+	return -1
+}
+
+// RelativeName returns the name relative to the zone, with @ for the apex. Names outside
+// of the zone are returned fully qualified with a trailing dot.
+func RelativeName(name, zone string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+
+	if name == zone {
+		return "@"
+	}
+	if strings.HasSuffix(name, "."+zone) {
+		return strings.TrimSuffix(name, "."+zone)
+	}
+	return name + "."
+}
+
+// DisplayName converts an ASCII (punycode) name to its Unicode form for display,
+// falling back to the ASCII form when it cannot be converted
+func DisplayName(name string) string {
+	unicode, err := recordNameProfile.ToUnicode(name)
+	if err != nil {
+		return name
+	}
+	return unicode
+}
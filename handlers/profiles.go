@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+// DefaultProfileID is the ID of the profile seeded into an empty profile library
+const DefaultProfileID = "strict-https"
+
+// SettingsProfile is a named set of zone settings, such as strict SSL with TLS 1.2 or newer
+// and HSTS, that can be applied to zones when they are added or later on
+type SettingsProfile struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Settings    ZoneSettingsValues `json:"settings"`
+	CreatedAt   time.Time          `json:"created_at"`
+	CreatedBy   string             `json:"created_by"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+	UpdatedBy   string             `json:"updated_by"`
+}
+
+// ProfileStore keeps the settings profiles in a JSON file in the data directory
+type ProfileStore struct {
+	mu       sync.RWMutex
+	path     string
+	profiles map[string]SettingsProfile
+}
+
+// NewProfileStore loads the settings profiles from dataDir, seeding a strict HTTPS profile
+// when the file does not exist yet
+func NewProfileStore(dataDir string) (*ProfileStore, error) {
+	s := &ProfileStore{
+		path:     filepath.Join(dataDir, "settings_profiles.json"),
+		profiles: make(map[string]SettingsProfile),
+	}
+
+	var profiles []SettingsProfile
+	if err := readJSONFile(s.path, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to load settings profiles from %s: %w", s.path, err)
+	}
+	for _, p := range profiles {
+		s.profiles[p.ID] = p
+	}
+
+	// A missing file leaves profiles nil; an emptied library is kept empty
+	if profiles == nil {
+		on := true
+		now := time.Now().UTC()
+		s.profiles[DefaultProfileID] = SettingsProfile{
+			ID:          DefaultProfileID,
+			Name:        "Strict HTTPS",
+			Description: "Full (strict) SSL, TLS 1.2 or newer, HTTPS only and HSTS for 6 months",
+			Settings: ZoneSettingsValues{
+				SSL:                    "strict",
+				MinTLSVersion:          "1.2",
+				AlwaysUseHTTPS:         &on,
+				AutomaticHTTPSRewrites: &on,
+				HSTS:                   &HSTSSettings{Enabled: true, MaxAge: 15552000, NoSniff: true},
+			},
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// List returns all profiles sorted by name
+func (s *ProfileStore) List() []SettingsProfile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	profiles := make([]SettingsProfile, 0, len(s.profiles))
+	for _, p := range s.profiles {
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return strings.ToLower(profiles[i].Name) < strings.ToLower(profiles[j].Name)
+	})
+	return profiles
+}
+
+// Get returns the profile with the given ID
+func (s *ProfileStore) Get(id string) (SettingsProfile, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.profiles[id]
+	return p, ok
+}
+
+// Create adds a new profile on behalf of actor
+func (s *ProfileStore) Create(p SettingsProfile, actor string) (SettingsProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p.ID = newID()
+	now := time.Now().UTC()
+	p.CreatedAt, p.CreatedBy = now, actor
+	p.UpdatedAt, p.UpdatedBy = now, actor
+	s.profiles[p.ID] = p
+
+	if err := s.save(); err != nil {
+		delete(s.profiles, p.ID)
+		return SettingsProfile{}, err
+	}
+	return p, nil
+}
+
+// Update replaces the name, description and settings of an existing profile
+func (s *ProfileStore) Update(id string, p SettingsProfile, actor string) (SettingsProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.profiles[id]
+	if !ok {
+		return SettingsProfile{}, fiber.NewError(fiber.StatusNotFound, "Profile not found")
+	}
+
+	updated := previous
+	updated.Name = p.Name
+	updated.Description = p.Description
+	updated.Settings = p.Settings
+	updated.UpdatedAt, updated.UpdatedBy = time.Now().UTC(), actor
+	s.profiles[id] = updated
+
+	if err := s.save(); err != nil {
+		s.profiles[id] = previous
+		return SettingsProfile{}, err
+	}
+	return updated, nil
+}
+
+// Delete removes a profile
+func (s *ProfileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.profiles[id]
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Profile not found")
+	}
+	delete(s.profiles, id)
+
+	if err := s.save(); err != nil {
+		s.profiles[id] = previous
+		return err
+	}
+	return nil
+}
+
+// save writes the profiles to disk. The caller must hold the lock.
+func (s *ProfileStore) save() error {
+	profiles := make([]SettingsProfile, 0, len(s.profiles))
+	for _, p := range s.profiles {
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].ID < profiles[j].ID })
+
+	if err := writeJSONFile(s.path, profiles); err != nil {
+		return fmt.Errorf("failed to save settings profiles to %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// ProfileRequest is the body for creating or updating a settings profile
+type ProfileRequest struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Settings    ZoneSettingsValues `json:"settings"`
+}
+
+// parseProfileRequest reads and checks a profile request
+func parseProfileRequest(c *fiber.Ctx) (*ProfileRequest, error) {
+	req := new(ProfileRequest)
+	if err := c.BodyParser(req); err != nil {
+		return nil, fmt.Errorf("invalid request format: %w", err)
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+
+	if req.Name == "" {
+		return nil, fmt.Errorf("profile name is required")
+	}
+	if req.Settings.IsEmpty() {
+		return nil, fmt.Errorf("a profile needs at least one setting")
+	}
+	if err := req.Settings.Validate(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// ListProfilesHandler returns the settings profiles
+func ListProfilesHandler(store *session.Store, profiles *ProfileStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := SessionEmail(c, store); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    profiles.List(),
+		})
+	}
+}
+
+// CreateProfileHandler validates and stores a new settings profile
+func CreateProfileHandler(store *session.Store, profiles *ProfileStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		actor, err := SessionEmail(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req, err := parseProfileRequest(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		p, err := profiles.Create(SettingsProfile{Name: req.Name, Description: req.Description, Settings: req.Settings}, actor)
+		if err != nil {
+			return profileStoreError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": fmt.Sprintf("Profile %s created", p.Name),
+			"data":    p,
+		})
+	}
+}
+
+// UpdateProfileHandler validates and replaces an existing settings profile
+func UpdateProfileHandler(store *session.Store, profiles *ProfileStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		actor, err := SessionEmail(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req, err := parseProfileRequest(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		p, err := profiles.Update(c.Params("id"), SettingsProfile{Name: req.Name, Description: req.Description, Settings: req.Settings}, actor)
+		if err != nil {
+			return profileStoreError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": fmt.Sprintf("Profile %s updated", p.Name),
+			"data":    p,
+		})
+	}
+}
+
+// DeleteProfileHandler removes a settings profile
+func DeleteProfileHandler(store *session.Store, profiles *ProfileStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := SessionEmail(c, store); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		if err := profiles.Delete(c.Params("id")); err != nil {
+			return profileStoreError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": "Profile deleted",
+		})
+	}
+}
+
+// profileStoreError turns a profile store error into a JSON response
+func profileStoreError(c *fiber.Ctx, err error) error {
+	if fe, ok := err.(*fiber.Error); ok {
+		return c.Status(fe.Code).JSON(fiber.Map{
+			"success": false,
+			"message": fe.Message,
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"message": "Failed to save profile",
+		"error":   err.Error(),
+	})
+}
@@ -0,0 +1,548 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+
+	"hijicloudflareDNS/validator"
+)
+
+// ProxyPolicyConfig holds the proxy defaults per record type for an account and for its
+// individual zones. Only the types Cloudflare can proxy have defaults.
+type ProxyPolicyConfig struct {
+	Defaults map[string]bool            `json:"defaults"` // Record type to proxied
+	Zones    map[string]map[string]bool `json:"zones"`    // Zone to record type to proxied, overriding Defaults
+}
+
+// builtinProxyDefaults proxies every type that can be proxied. They apply to accounts that
+// have not changed their defaults.
+var builtinProxyDefaults = map[string]bool{"A": true, "AAAA": true, "CNAME": true}
+
+// builtinProxyPolicy holds no account defaults, so every account gets the built-in ones. It
+// applies when no policy is given, such as when templates are checked without a zone.
+var builtinProxyPolicy = &ProxyPolicy{accounts: map[string]ProxyPolicyConfig{}}
+
+// ProxyPolicy decides whether records are proxied through Cloudflare: the default when a
+// record does not say, and the records that can never be proxied. Each account, identified
+// by the email of its API credentials, has its own defaults, kept in a JSON file in the data
+// directory. A nil policy applies the built-in defaults.
+type ProxyPolicy struct {
+	mu       sync.RWMutex
+	path     string
+	accounts map[string]ProxyPolicyConfig // Account email to its defaults
+}
+
+// NewProxyPolicy loads the proxy defaults from dataDir, starting without account defaults
+// when the file does not exist yet
+func NewProxyPolicy(dataDir string) (*ProxyPolicy, error) {
+	p := &ProxyPolicy{path: filepath.Join(dataDir, "proxy_policy.json")}
+	if err := readJSONFile(p.path, &p.accounts); err != nil {
+		return nil, fmt.Errorf("failed to load proxy policy from %s: %w", p.path, err)
+	}
+	if p.accounts == nil {
+		p.accounts = map[string]ProxyPolicyConfig{}
+	}
+	return p, nil
+}
+
+// proxyAccount returns the key of the account whose defaults apply to an API client
+func proxyAccount(api *cloudflare.API) string {
+	if api == nil {
+		return ""
+	}
+	return strings.ToLower(api.APIEmail)
+}
+
+// Config returns a copy of the proxy defaults of the account of an API client
+func (p *ProxyPolicy) Config(api *cloudflare.API) ProxyPolicyConfig {
+	if p == nil {
+		p = builtinProxyPolicy
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	account, ok := p.accounts[proxyAccount(api)]
+	if !ok || account.Defaults == nil {
+		account.Defaults = builtinProxyDefaults
+	}
+	config := ProxyPolicyConfig{Defaults: copyProxyDefaults(account.Defaults), Zones: map[string]map[string]bool{}}
+	for zone, defaults := range account.Zones {
+		config.Zones[zone] = copyProxyDefaults(defaults)
+	}
+	return config
+}
+
+// Default reports whether records of a type in a zone are proxied when they do not say.
+// A zone default wins over the account default; types that cannot be proxied never are.
+func (p *ProxyPolicy) Default(api *cloudflare.API, zone, recordType string) bool {
+	if p == nil {
+		p = builtinProxyPolicy
+	}
+	if !validator.IsProxiableType(recordType) {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	account, ok := p.accounts[proxyAccount(api)]
+	if proxied, found := account.Zones[strings.ToLower(zone)][recordType]; found {
+		return proxied
+	}
+	if !ok || account.Defaults == nil {
+		return builtinProxyDefaults[recordType]
+	}
+	return account.Defaults[recordType]
+}
+
+// Resolve returns the proxy status of a record in a zone of the account of an API client.
+// When requested is nil the default applies, except for records that cannot be proxied,
+// which stay DNS only. Asking to proxy such a record is an error.
+func (p *ProxyPolicy) Resolve(api *cloudflare.API, zone, recordType, name, content string, requested *bool) (bool, error) {
+	if requested == nil {
+		return p.Default(api, zone, recordType) && CheckProxiable(recordType, name, content) == nil, nil
+	}
+	if !*requested {
+		return false, nil
+	}
+	if err := CheckProxiable(recordType, name, content); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetDefaults replaces the proxy defaults of the account of an API client
+func (p *ProxyPolicy) SetDefaults(api *cloudflare.API, defaults map[string]bool) error {
+	if err := validateProxyDefaults(defaults); err != nil {
+		return err
+	}
+
+	return p.update(api, func(account *ProxyPolicyConfig) {
+		account.Defaults = copyProxyDefaults(defaults)
+	})
+}
+
+// SetZoneDefaults replaces the proxy defaults of a zone of the account of an API client.
+// Empty defaults make the zone use the account defaults again.
+func (p *ProxyPolicy) SetZoneDefaults(api *cloudflare.API, zone string, defaults map[string]bool) error {
+	if err := validateProxyDefaults(defaults); err != nil {
+		return err
+	}
+
+	return p.update(api, func(account *ProxyPolicyConfig) {
+		if len(defaults) == 0 {
+			delete(account.Zones, zone)
+		} else {
+			account.Zones[zone] = copyProxyDefaults(defaults)
+		}
+	})
+}
+
+// update changes a copy of the defaults of the account of an API client and saves it,
+// keeping the previous defaults when saving fails
+func (p *ProxyPolicy) update(api *cloudflare.API, change func(account *ProxyPolicyConfig)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := proxyAccount(api)
+	previous, existed := p.accounts[key]
+	account := ProxyPolicyConfig{Defaults: previous.Defaults, Zones: map[string]map[string]bool{}}
+	for zone, defaults := range previous.Zones {
+		account.Zones[zone] = defaults
+	}
+	change(&account)
+
+	p.accounts[key] = account
+	if err := p.save(); err != nil {
+		if existed {
+			p.accounts[key] = previous
+		} else {
+			delete(p.accounts, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// save writes the proxy defaults to disk. The caller must hold the lock.
+func (p *ProxyPolicy) save() error {
+	if err := writeJSONFile(p.path, p.accounts); err != nil {
+		return fmt.Errorf("failed to save proxy policy to %s: %w", p.path, err)
+	}
+	return nil
+}
+
+// validateProxyDefaults checks that defaults only name types Cloudflare can proxy
+func validateProxyDefaults(defaults map[string]bool) error {
+	for recordType := range defaults {
+		if !validator.IsProxiableType(recordType) {
+			return fmt.Errorf("%s records cannot be proxied, only A, AAAA and CNAME records have a proxy default", recordType)
+		}
+	}
+	return nil
+}
+
+// copyProxyDefaults copies a map of proxy defaults
+func copyProxyDefaults(defaults map[string]bool) map[string]bool {
+	copied := make(map[string]bool, len(defaults))
+	for recordType, proxied := range defaults {
+		copied[recordType] = proxied
+	}
+	return copied
+}
+
+// CheckProxiable returns why a record cannot be proxied, or nil when it can: only A, AAAA
+// and CNAME records are proxied, not wildcards, and not addresses Cloudflare cannot reach
+func CheckProxiable(recordType, name, content string) error {
+	if !validator.IsProxiableType(recordType) {
+		return fmt.Errorf("%s records cannot be proxied through Cloudflare", recordType)
+	}
+	if name == "*" || strings.HasPrefix(name, "*.") {
+		return fmt.Errorf("wildcard record %s cannot be proxied", name)
+	}
+	if recordType == "A" || recordType == "AAAA" {
+		if ip := net.ParseIP(strings.TrimSpace(content)); ip != nil && validator.IsNonRoutable(ip) {
+			return fmt.Errorf("%s record %s points to non-routable address %s and cannot be proxied", recordType, name, content)
+		}
+	}
+	return nil
+}
+
+// planProxyChanges plans turning the proxy on or off for the records with the given IDs, or
+// for every record that can be proxied when ids is empty. Selected records that cannot be
+// proxied are skipped with the reason; unknown IDs are returned as invalid changes.
+func planProxyChanges(records []cloudflare.DNSRecord, ids []string, proxied bool) ([]plannedChange, []RecordChange) {
+	selected := map[string]bool{}
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	plan := []plannedChange{}
+	for i := range records {
+		record := &records[i]
+		if len(ids) > 0 && !selected[record.ID] {
+			continue
+		}
+		delete(selected, record.ID)
+
+		content := FormatRecordContent(*record)
+		change := plannedChange{
+			RecordChange: RecordChange{Action: ActionUpdate, Type: record.Type, Name: record.Name, Content: content, Proxied: proxied, RecordID: record.ID},
+			existing:     record,
+		}
+
+		current := record.Proxied != nil && *record.Proxied
+		switch {
+		case !validator.IsProxiableType(record.Type) && len(ids) == 0:
+			continue // Whole zones only list the records that can be proxied
+		case current == proxied:
+			change.Action = ActionUnchanged
+		case proxied:
+			if err := CheckProxiable(record.Type, record.Name, content); err != nil {
+				change.Action = ActionSkip
+				change.Warnings = []string{err.Error()}
+			}
+		}
+
+		if change.Action == ActionUpdate {
+			payload, err := buildTypedRecord(record.Type, record.Name, content, nil, nil)
+			if err != nil {
+				change.Action = ActionInvalid
+				change.Error = err.Error()
+			} else {
+				payload.TTL = record.TTL
+				change.desired = &desiredRecord{Type: record.Type, Name: record.Name, Content: content, Proxied: proxied, Payload: payload}
+			}
+		}
+		plan = append(plan, change)
+	}
+
+	invalid := []RecordChange{}
+	for id := range selected {
+		invalid = append(invalid, RecordChange{Action: ActionInvalid, RecordID: id, Content: id, Error: "record not found"})
+	}
+	sort.Slice(invalid, func(i, j int) bool { return invalid[i].RecordID < invalid[j].RecordID })
+	return plan, invalid
+}
+
+// setZoneProxy turns the proxy on or off for records of a zone, after taking a snapshot so
+// the change can be restored. Each changed record is recorded in the audit log.
+func setZoneProxy(api *cloudflare.API, snapshots *SnapshotStore, domain string, ids []string, proxied, dryRun bool, ac *auditContext) ZoneApplyResult {
+	result := ZoneApplyResult{Domain: domain, DryRun: dryRun, Changes: []RecordChange{}}
+	if unicode := DisplayName(domain); unicode != domain {
+		result.UnicodeName = unicode
+	}
+	failed := func(message string, err error) ZoneApplyResult {
+		result.Error = err.Error()
+		result.Message = fmt.Sprintf("%s: %s", message, err.Error())
+		return result
+	}
+
+	zoneID, err := api.ZoneIDByName(domain)
+	if err != nil {
+		return failed("Domain not found", err)
+	}
+	result.ZoneID = zoneID
+
+	records, _, err := api.ListDNSRecords(context.Background(), cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{})
+	if err != nil {
+		return failed("Failed to fetch existing records", err)
+	}
+	plan, invalid := planProxyChanges(records, ids, proxied)
+
+	updates := 0
+	for _, change := range plan {
+		if change.Action == ActionUpdate {
+			updates++
+		}
+	}
+	if !dryRun && updates > 0 {
+		state := "off"
+		if proxied {
+			state = "on"
+		}
+		if err := snapshotBefore(snapshots, api, zoneID, domain, ac, fmt.Sprintf("Before turning the proxy %s for %d records", state, updates)); err != nil {
+			return failed("Failed to snapshot the zone, no records changed", err)
+		}
+	}
+
+	applyPlan(api, &result, plan, invalid, ConflictSkip)
+	if !dryRun {
+		for _, change := range plan {
+			if change.Action != ActionUpdate {
+				continue
+			}
+			after := auditRecordFrom(*change.existing)
+			after.Proxied = proxied
+			var err error
+			if change.Error != "" {
+				err = errors.New(change.Error)
+			}
+			ac.recordChange(AuditRecordUpdate, domain, zoneID, change.RecordID, auditRecordFrom(*change.existing), after, err)
+		}
+	}
+	return result
+}
+
+// ProxyRecordsRequest is the body for turning the proxy on or off for records of one zone
+type ProxyRecordsRequest struct {
+	RecordIDs []string `json:"record_ids"` // Leave empty for every record of the zone
+	Proxied   bool     `json:"proxied"`
+	DryRun    bool     `json:"dryRun"`
+}
+
+// BulkProxyRequest is the body for turning the proxy on or off for every record of many zones
+type BulkProxyRequest struct {
+	Domains string `json:"domains"` // Newline-separated domain names
+	Proxied bool   `json:"proxied"`
+	DryRun  bool   `json:"dryRun"`
+}
+
+// ProxyRecordsHandler turns the proxy on or off for the selected records of the zone in the
+// URL, or for all of its records
+func ProxyRecordsHandler(store *session.Store, audit *AuditLog, snapshots *SnapshotStore, cache *SearchCache) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req := new(ProxyRecordsRequest)
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request format",
+				"error":   err.Error(),
+			})
+		}
+
+		domain, err := NormalizeZone(c.Params("domain"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		result := setZoneProxy(api, snapshots, domain, req.RecordIDs, req.Proxied, req.DryRun, newAuditContext(c, store, audit, true))
+		cache.Invalidate(result.ZoneID)
+		return c.JSON(fiber.Map{
+			"success": result.Success,
+			"message": result.Message,
+			"error":   result.Error,
+			"results": []ZoneApplyResult{result},
+		})
+	}
+}
+
+// BulkProxyHandler turns the proxy on or off for every record that can be proxied in many zones
+func BulkProxyHandler(store *session.Store, audit *AuditLog, snapshots *SnapshotStore, cache *SearchCache) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req := new(BulkProxyRequest)
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request format",
+				"error":   err.Error(),
+			})
+		}
+
+		domains, invalid := parseDomainsList(req.Domains)
+		if len(domains) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "No valid domains provided",
+				"results": invalid,
+			})
+		}
+
+		results := make([]ZoneApplyResult, 0, len(domains)+len(invalid))
+		for _, r := range invalid {
+			results = append(results, ZoneApplyResult{Domain: r.Domain, Message: r.Message, Error: r.Error, Changes: []RecordChange{}})
+		}
+
+		ac := newAuditContext(c, store, audit, true)
+		successCount := 0
+		for _, domain := range domains {
+			result := setZoneProxy(api, snapshots, domain, nil, req.Proxied, req.DryRun, ac)
+			cache.Invalidate(result.ZoneID)
+			if result.Success {
+				successCount++
+			}
+			results = append(results, result)
+		}
+
+		state := "off"
+		if req.Proxied {
+			state = "on"
+		}
+		verb := "Turned the proxy " + state
+		if req.DryRun {
+			verb = "Previewed turning the proxy " + state
+		}
+		return c.JSON(fiber.Map{
+			"success": successCount > 0,
+			"message": fmt.Sprintf("%s on %d out of %d domains", verb, successCount, len(results)),
+			"results": results,
+		})
+	}
+}
+
+// ProxyDefaultsRequest is the body for changing proxy defaults
+type ProxyDefaultsRequest struct {
+	Defaults map[string]bool `json:"defaults"`
+}
+
+// GetProxyPolicyHandler returns the account and zone proxy defaults of the caller
+func GetProxyPolicyHandler(store *session.Store, policy *ProxyPolicy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    policy.Config(api),
+		})
+	}
+}
+
+// UpdateProxyDefaultsHandler replaces the caller's account proxy defaults, or those of the
+// zone in the URL when there is one and the caller can reach it
+func UpdateProxyDefaultsHandler(store *session.Store, policy *ProxyPolicy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req := new(ProxyDefaultsRequest)
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request format",
+				"error":   err.Error(),
+			})
+		}
+		if err := validateProxyDefaults(req.Defaults); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		message := "Account proxy defaults saved"
+		if c.Params("domain") == "" {
+			if err := policy.SetDefaults(api, req.Defaults); err != nil {
+				return proxyPolicyError(c, err)
+			}
+		} else {
+			zone, err := NormalizeZone(c.Params("domain"))
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": err.Error(),
+				})
+			}
+			if _, err := zoneIDForCaller(api, zone); err != nil {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"success": false,
+					"message": err.Error(),
+				})
+			}
+			if err := policy.SetZoneDefaults(api, zone, req.Defaults); err != nil {
+				return proxyPolicyError(c, err)
+			}
+			message = "Proxy defaults of " + zone + " saved"
+			if len(req.Defaults) == 0 {
+				message = zone + " uses the account proxy defaults again"
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": message,
+			"data":    policy.Config(api),
+		})
+	}
+}
+
+// proxyPolicyError turns a failure to save the proxy defaults into a JSON response
+func proxyPolicyError(c *fiber.Ctx, err error) error {
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"message": "Failed to save proxy defaults",
+		"error":   err.Error(),
+	})
+}
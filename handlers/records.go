@@ -0,0 +1,526 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+
+	"hijicloudflareDNS/validator"
+)
+
+// SupportedRecordTypes lists the DNS record types accepted by the handlers
+var SupportedRecordTypes = []string{
+	"A", "AAAA", "CNAME", "MX", "TXT", "NS", "SRV", "CAA", "PTR",
+	"URI", "SSHFP", "TLSA", "HTTPS", "SVCB",
+}
+
+// SRVData holds the structured fields of an SRV record
+type SRVData struct {
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+	Port     uint16 `json:"port"`
+	Target   string `json:"target"`
+}
+
+// CAAData holds the structured fields of a CAA record
+type CAAData struct {
+	Flags uint8  `json:"flags"`
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+// URIData holds the structured fields of a URI record (priority is sent separately)
+type URIData struct {
+	Weight uint16 `json:"weight"`
+	Target string `json:"target"`
+}
+
+// SSHFPData holds the structured fields of an SSHFP record
+type SSHFPData struct {
+	Algorithm   uint8  `json:"algorithm"`
+	Type        uint8  `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// TLSAData holds the structured fields of a TLSA record
+type TLSAData struct {
+	Usage        uint8  `json:"usage"`
+	Selector     uint8  `json:"selector"`
+	MatchingType uint8  `json:"matching_type"`
+	Certificate  string `json:"certificate"`
+}
+
+// SVCBData holds the structured fields of an HTTPS or SVCB record
+type SVCBData struct {
+	Priority uint16 `json:"priority"`
+	Target   string `json:"target"`
+	Value    string `json:"value"`
+}
+
+// RecordPayload holds the wire fields Cloudflare expects for a single record
+type RecordPayload struct {
+	Content  string
+	Data     interface{}
+	Priority *uint16
+	Comment  string
+	Tags     []string
+	TTL      int // Zero for automatic TTL
+}
+
+// isSupportedRecordType reports whether the record type can be managed by the app
+func isSupportedRecordType(recordType string) bool {
+	for _, supported := range SupportedRecordTypes {
+		if recordType == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// isDataRecordType reports whether the record type is sent to Cloudflare as structured data
+func isDataRecordType(recordType string) bool {
+	switch recordType {
+	case "SRV", "CAA", "URI", "SSHFP", "TLSA", "HTTPS", "SVCB":
+		return true
+	}
+	return false
+}
+
+// ParseRecordContent converts the textual (BIND style) content of a record into the
+// fields Cloudflare expects for its type, validating each field along the way.
+//
+// Formats per type:
+//
+//	MX    PRIORITY TARGET                     10 mail.example.com
+//	SRV   PRIORITY WEIGHT PORT TARGET         10 5 5060 sip.example.com
+//	CAA   FLAGS TAG VALUE                     0 issue letsencrypt.org
+//	URI   PRIORITY WEIGHT TARGET              10 1 https://example.com/
+//	SSHFP ALGORITHM TYPE FINGERPRINT          4 2 123456789abcdef...
+//	TLSA  USAGE SELECTOR MATCHING CERTIFICATE 3 1 1 0123456789abcdef...
+//	HTTPS PRIORITY TARGET [PARAMS]            1 . alpn="h2,h3"
+//
+// All other types keep their content untouched.
+func ParseRecordContent(recordType, content string) (RecordPayload, error) {
+	content = strings.TrimSpace(content)
+	fields := strings.Fields(content)
+
+	switch recordType {
+	case "MX":
+		if len(fields) != 2 {
+			return RecordPayload{}, fmt.Errorf("MX record content must include priority (e.g., '10 mail.example.com')")
+		}
+		priority, err := parseUint16("MX priority", fields[0])
+		if err != nil {
+			return RecordPayload{}, err
+		}
+		return RecordPayload{Content: fields[1], Priority: &priority}, nil
+
+	case "SRV":
+		if len(fields) != 4 {
+			return RecordPayload{}, fmt.Errorf("SRV record content must be 'PRIORITY WEIGHT PORT TARGET' (e.g., '10 5 5060 sip.example.com')")
+		}
+		priority, err := parseUint16("SRV priority", fields[0])
+		if err != nil {
+			return RecordPayload{}, err
+		}
+		weight, err := parseUint16("SRV weight", fields[1])
+		if err != nil {
+			return RecordPayload{}, err
+		}
+		port, err := parseUint16("SRV port", fields[2])
+		if err != nil {
+			return RecordPayload{}, err
+		}
+		return RecordPayload{Data: SRVData{Priority: priority, Weight: weight, Port: port, Target: fields[3]}}, nil
+
+	case "CAA":
+		if len(fields) < 3 {
+			return RecordPayload{}, fmt.Errorf("CAA record content must be 'FLAGS TAG VALUE' (e.g., '0 issue letsencrypt.org')")
+		}
+		flags, err := parseUint8("CAA flags", fields[0])
+		if err != nil {
+			return RecordPayload{}, err
+		}
+		tag := strings.ToLower(fields[1])
+		switch tag {
+		case "issue", "issuewild", "iodef", "issuemail", "issuevmc":
+		default:
+			return RecordPayload{}, fmt.Errorf("invalid CAA tag: %s. Supported tags: issue, issuewild, iodef, issuemail, issuevmc", fields[1])
+		}
+		value := unquote(strings.Join(fields[2:], " "))
+		return RecordPayload{Data: CAAData{Flags: flags, Tag: tag, Value: value}}, nil
+
+	case "URI":
+		if len(fields) != 3 {
+			return RecordPayload{}, fmt.Errorf("URI record content must be 'PRIORITY WEIGHT TARGET' (e.g., '10 1 https://example.com/')")
+		}
+		priority, err := parseUint16("URI priority", fields[0])
+		if err != nil {
+			return RecordPayload{}, err
+		}
+		weight, err := parseUint16("URI weight", fields[1])
+		if err != nil {
+			return RecordPayload{}, err
+		}
+		return RecordPayload{Data: URIData{Weight: weight, Target: unquote(fields[2])}, Priority: &priority}, nil
+
+	case "SSHFP":
+		if len(fields) != 3 {
+			return RecordPayload{}, fmt.Errorf("SSHFP record content must be 'ALGORITHM TYPE FINGERPRINT'")
+		}
+		algorithm, err := parseUint8("SSHFP algorithm", fields[0])
+		if err != nil {
+			return RecordPayload{}, err
+		}
+		fpType, err := parseUint8("SSHFP type", fields[1])
+		if err != nil {
+			return RecordPayload{}, err
+		}
+		if err := checkHex("SSHFP fingerprint", fields[2]); err != nil {
+			return RecordPayload{}, err
+		}
+		return RecordPayload{Data: SSHFPData{Algorithm: algorithm, Type: fpType, Fingerprint: fields[2]}}, nil
+
+	case "TLSA":
+		if len(fields) != 4 {
+			return RecordPayload{}, fmt.Errorf("TLSA record content must be 'USAGE SELECTOR MATCHING_TYPE CERTIFICATE'")
+		}
+		usage, err := parseUint8("TLSA usage", fields[0])
+		if err != nil || usage > 3 {
+			return RecordPayload{}, fmt.Errorf("TLSA usage must be between 0 and 3")
+		}
+		selector, err := parseUint8("TLSA selector", fields[1])
+		if err != nil || selector > 1 {
+			return RecordPayload{}, fmt.Errorf("TLSA selector must be 0 or 1")
+		}
+		matchingType, err := parseUint8("TLSA matching type", fields[2])
+		if err != nil || matchingType > 2 {
+			return RecordPayload{}, fmt.Errorf("TLSA matching type must be between 0 and 2")
+		}
+		if err := checkHex("TLSA certificate", fields[3]); err != nil {
+			return RecordPayload{}, err
+		}
+		return RecordPayload{Data: TLSAData{Usage: usage, Selector: selector, MatchingType: matchingType, Certificate: fields[3]}}, nil
+
+	case "HTTPS", "SVCB":
+		if len(fields) < 2 {
+			return RecordPayload{}, fmt.Errorf("%s record content must be 'PRIORITY TARGET [PARAMS]' (e.g., '1 . alpn=\"h2\"')", recordType)
+		}
+		priority, err := parseUint16(recordType+" priority", fields[0])
+		if err != nil {
+			return RecordPayload{}, err
+		}
+		return RecordPayload{Data: SVCBData{Priority: priority, Target: fields[1], Value: strings.Join(fields[2:], " ")}}, nil
+	}
+
+	return RecordPayload{Content: content}, nil
+}
+
+// BuildRecordPayload resolves the payload for a record from either its textual content
+// or, when provided, an explicit priority and structured data map from a JSON request.
+func BuildRecordPayload(recordType, content string, priority *uint16, data map[string]interface{}) (RecordPayload, error) {
+	if len(data) > 0 && isDataRecordType(recordType) {
+		content = formatRecordData(recordType, data, priority)
+	} else if priority != nil && recordType == "MX" && len(strings.Fields(content)) == 1 {
+		content = fmt.Sprintf("%d %s", *priority, content)
+	}
+	return ParseRecordContent(recordType, content)
+}
+
+// validateSRVName checks that an SRV record name starts with the _service._proto labels
+func validateSRVName(recordName string) error {
+	labels := strings.Split(recordName, ".")
+	if len(labels) < 2 || !strings.HasPrefix(labels[0], "_") || len(labels[0]) < 2 {
+		return fmt.Errorf("SRV record name must start with _service._proto (e.g., '_sip._tcp')")
+	}
+	switch strings.ToLower(labels[1]) {
+	case "_tcp", "_udp", "_tls", "_sctp":
+		return nil
+	}
+	return fmt.Errorf("SRV record protocol must be one of _tcp, _udp, _tls or _sctp, got '%s'", labels[1])
+}
+
+// buildTypedRecord validates the record name for its type and builds the payload
+func buildTypedRecord(recordType, recordName, content string, priority *uint16, data map[string]interface{}) (RecordPayload, error) {
+	if recordType == "SRV" {
+		if err := validateSRVName(recordName); err != nil {
+			return RecordPayload{}, err
+		}
+	}
+	return BuildRecordPayload(recordType, content, priority, data)
+}
+
+// proxiedFor returns the proxied flag to send for a record type, or nil when the
+// type cannot be proxied by Cloudflare and the field must be omitted
+func proxiedFor(recordType string, proxied bool) *bool {
+	if recordType == "A" || recordType == "AAAA" || recordType == "CNAME" {
+		return &proxied
+	}
+	return nil
+}
+
+// formatContent renders the payload in the textual record format, as FormatRecordContent
+// would render the record once Cloudflare stores it
+func (p RecordPayload) formatContent(recordType string) string {
+	record := cloudflare.DNSRecord{Type: recordType, Content: p.Content, Priority: p.Priority}
+	if p.Data != nil {
+		var data map[string]interface{}
+		if raw, err := json.Marshal(p.Data); err == nil && json.Unmarshal(raw, &data) == nil {
+			record.Data = data
+		}
+	}
+	return FormatRecordContent(record)
+}
+
+// ttl returns the TTL to send, 1 meaning automatic
+func (p RecordPayload) ttl() int {
+	if p.TTL > 0 {
+		return p.TTL
+	}
+	return 1
+}
+
+// createParams builds the Cloudflare create parameters for the payload
+func (p RecordPayload) createParams(recordType, recordName string, proxied *bool) cloudflare.CreateDNSRecordParams {
+	return cloudflare.CreateDNSRecordParams{
+		Type:     recordType,
+		Name:     recordName,
+		Content:  p.Content,
+		Data:     p.Data,
+		Priority: p.Priority,
+		Proxied:  proxied,
+		TTL:      p.ttl(),
+		Comment:  p.Comment,
+		Tags:     p.Tags,
+	}
+}
+
+// updateParams builds the Cloudflare update parameters for the payload
+func (p RecordPayload) updateParams(recordID, recordType, recordName string, proxied *bool) cloudflare.UpdateDNSRecordParams {
+	// Tags are always sent on update, so an empty list clears them rather than sending null
+	tags := p.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	comment := p.Comment
+
+	return cloudflare.UpdateDNSRecordParams{
+		ID:       recordID,
+		Type:     recordType,
+		Name:     recordName,
+		Content:  p.Content,
+		Data:     p.Data,
+		Priority: p.Priority,
+		Proxied:  proxied,
+		TTL:      p.ttl(),
+		Comment:  &comment,
+		Tags:     tags,
+	}
+}
+
+// RecordLine is a record written in the TYPE|NAME|CONTENT|PROXIED|COMMENT|TAGS text format
+// used by templates and the bulk editors
+type RecordLine struct {
+	Type    string
+	Name    string
+	Content string
+	Proxied *bool // nil when PROXIED is left out, so the proxy policy decides
+	Comment string
+	Tags    []string
+}
+
+// ParseRecordLine parses a TYPE|NAME|CONTENT|PROXIED|COMMENT|TAGS line. PROXIED, COMMENT and
+// TAGS are optional; a missing PROXIED is resolved with the proxy policy of the zone.
+func ParseRecordLine(line string) (RecordLine, error) {
+	parts := strings.Split(line, "|")
+	if len(parts) < 3 || len(parts) > 6 {
+		return RecordLine{}, fmt.Errorf("invalid record format: %s (expected TYPE|NAME|CONTENT, TYPE|NAME|CONTENT|PROXIED or TYPE|NAME|CONTENT|PROXIED|COMMENT|TAGS)", line)
+	}
+
+	record := RecordLine{
+		Type:    strings.TrimSpace(parts[0]),
+		Name:    strings.TrimSpace(parts[1]),
+		Content: strings.TrimSpace(parts[2]),
+		Tags:    []string{},
+	}
+	if !isSupportedRecordType(record.Type) {
+		return RecordLine{}, fmt.Errorf("invalid record type: %s. Supported types: %s", record.Type, strings.Join(SupportedRecordTypes, ", "))
+	}
+
+	if len(parts) >= 4 && strings.TrimSpace(parts[3]) != "" {
+		proxied, err := parseProxied(parts[3])
+		if err != nil {
+			return RecordLine{}, err
+		}
+		record.Proxied = &proxied
+	}
+	if len(parts) >= 5 {
+		record.Comment = strings.TrimSpace(parts[4])
+	}
+	if len(parts) == 6 {
+		record.Tags = ParseTags(parts[5])
+	}
+	return record, nil
+}
+
+// parseProxied reads the PROXIED field of a record line
+func parseProxied(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "1", "yes":
+		return true, nil
+	case "false", "0", "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid proxied value %q, use true or false", strings.TrimSpace(value))
+}
+
+// ParseTags splits a comma-separated tag list into individual tags, dropping blanks
+func ParseTags(tagsText string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(tagsText, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// recordHasTag reports whether a tag list contains the tag, matching either the full
+// "name:value" form or only the tag name
+func recordHasTag(tags []string, tag string) bool {
+	tag = strings.ToLower(tag)
+	for _, t := range tags {
+		t = strings.ToLower(t)
+		if t == tag || strings.SplitN(t, ":", 2)[0] == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatRecordContent renders a Cloudflare record back into the textual format accepted
+// by ParseRecordContent, so that records can be displayed, edited and exported losslessly.
+func FormatRecordContent(record cloudflare.DNSRecord) string {
+	if data, ok := record.Data.(map[string]interface{}); ok && isDataRecordType(record.Type) {
+		return formatRecordData(record.Type, data, record.Priority)
+	}
+	if record.Type == "MX" && record.Priority != nil {
+		return fmt.Sprintf("%d %s", *record.Priority, record.Content)
+	}
+	return record.Content
+}
+
+// formatRecordData renders a structured data map into the textual record format
+func formatRecordData(recordType string, data map[string]interface{}, priority *uint16) string {
+	switch recordType {
+	case "SRV":
+		return fmt.Sprintf("%s %s %s %s", dataField(data, "priority"), dataField(data, "weight"), dataField(data, "port"), dataField(data, "target"))
+	case "CAA":
+		return fmt.Sprintf("%s %s %s", dataField(data, "flags"), dataField(data, "tag"), dataField(data, "value"))
+	case "URI":
+		p := "0"
+		if priority != nil {
+			p = strconv.Itoa(int(*priority))
+		}
+		return fmt.Sprintf("%s %s %s", p, dataField(data, "weight"), dataField(data, "target"))
+	case "SSHFP":
+		return fmt.Sprintf("%s %s %s", dataField(data, "algorithm"), dataField(data, "type"), dataField(data, "fingerprint"))
+	case "TLSA":
+		return fmt.Sprintf("%s %s %s %s", dataField(data, "usage"), dataField(data, "selector"), dataField(data, "matching_type"), dataField(data, "certificate"))
+	case "HTTPS", "SVCB":
+		return strings.TrimSpace(fmt.Sprintf("%s %s %s", dataField(data, "priority"), dataField(data, "target"), dataField(data, "value")))
+	}
+	return ""
+}
+
+// dataField renders a single value from a structured data map as text
+func dataField(data map[string]interface{}, key string) string {
+	switch v := data[key].(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parseUint16 parses a numeric record field in the 0-65535 range
+func parseUint16(field, value string) (uint16, error) {
+	n, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number between 0 and 65535, got '%s'", field, value)
+	}
+	return uint16(n), nil
+}
+
+// parseUint8 parses a numeric record field in the 0-255 range
+func parseUint8(field, value string) (uint8, error) {
+	n, err := strconv.ParseUint(value, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number between 0 and 255, got '%s'", field, value)
+	}
+	return uint8(n), nil
+}
+
+// checkHex verifies that a record field is a hexadecimal string
+func checkHex(field, value string) error {
+	if _, err := hex.DecodeString(value); err != nil {
+		return fmt.Errorf("%s must be a hexadecimal string", field)
+	}
+	return nil
+}
+
+// unquote strips a single pair of surrounding double quotes
+func unquote(value string) string {
+	if len(value) >= 2 && strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// toValidatorRecord converts a Cloudflare record into the validator's format
+func toValidatorRecord(record cloudflare.DNSRecord) validator.Record {
+	return validator.Record{
+		ID:      record.ID,
+		Type:    record.Type,
+		Name:    record.Name,
+		Content: FormatRecordContent(record),
+		Proxied: record.Proxied != nil && *record.Proxied,
+	}
+}
+
+// listValidatorRecords fetches every record of a zone in the validator's format
+func listValidatorRecords(api *cloudflare.API, zoneID string) ([]validator.Record, error) {
+	records, _, err := api.ListDNSRecords(context.Background(), cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{})
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make([]validator.Record, 0, len(records))
+	for _, record := range records {
+		existing = append(existing, toValidatorRecord(record))
+	}
+	return existing, nil
+}
+
+// validateRecord runs the validator for a single write against the live records of the
+// zone, leaving out the record with excludeID when it is being edited in place
+func validateRecord(api *cloudflare.API, zoneID, zone string, record validator.Record, excludeID string) (validator.Result, error) {
+	existing, err := listValidatorRecords(api, zoneID)
+	if err != nil {
+		return validator.Result{}, err
+	}
+	if excludeID != "" {
+		existing = validator.ExcludeID(existing, excludeID)
+	}
+	return validator.Validate(zone, record, existing), nil
+}
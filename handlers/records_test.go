@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRecordContent(t *testing.T) {
+	tests := []struct {
+		recordType string
+		content    string
+		want       string // Content rendered back from the payload
+		err        string // Part of the expected error, if any
+	}{
+		{"A", " 203.0.113.10 ", "203.0.113.10", ""},
+		{"TXT", "v=spf1 -all", "v=spf1 -all", ""},
+		{"MX", "10 mail.example.com", "10 mail.example.com", ""},
+		{"MX", "mail.example.com", "", "must include priority"},
+		{"MX", "70000 mail.example.com", "", "MX priority must be a number"},
+		{"SRV", "10 5 5060 sip.example.com", "10 5 5060 sip.example.com", ""},
+		{"SRV", "10 5 sip.example.com", "", "PRIORITY WEIGHT PORT TARGET"},
+		{"SRV", "10 5 port sip.example.com", "", "SRV port must be a number"},
+		{"CAA", `0 ISSUE "letsencrypt.org"`, "0 issue letsencrypt.org", ""},
+		{"CAA", "0 iodef mailto:security@example.com", "0 iodef mailto:security@example.com", ""},
+		{"CAA", "0 policy letsencrypt.org", "", "invalid CAA tag"},
+		{"CAA", "256 issue letsencrypt.org", "", "CAA flags must be a number"},
+		{"URI", "10 1 https://example.com/", "10 1 https://example.com/", ""},
+		{"SSHFP", "4 2 0123456789abcdef", "4 2 0123456789abcdef", ""},
+		{"SSHFP", "4 2 not-hex", "", "SSHFP fingerprint"},
+		{"TLSA", "3 1 1 abcdef", "3 1 1 abcdef", ""},
+		{"TLSA", "4 1 1 abcdef", "", "TLSA usage"},
+		{"TLSA", "3 2 1 abcdef", "", "TLSA selector"},
+		{"TLSA", "3 1 3 abcdef", "", "TLSA matching type"},
+		{"HTTPS", `1 . alpn="h2,h3"`, `1 . alpn="h2,h3"`, ""},
+		{"SVCB", "0 svc.example.com", "0 svc.example.com", ""},
+		{"HTTPS", "1", "", "PRIORITY TARGET [PARAMS]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.recordType+" "+tt.content, func(t *testing.T) {
+			payload, err := ParseRecordContent(tt.recordType, tt.content)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := payload.formatContent(tt.recordType); got != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildTypedRecord(t *testing.T) {
+	priority := uint16(20)
+	tests := []struct {
+		name       string
+		recordType string
+		recordName string
+		content    string
+		priority   *uint16
+		data       map[string]interface{}
+		want       string
+		err        string
+	}{
+		{"MX with separate priority", "MX", "example.com", "mail.example.com", &priority, nil, "20 mail.example.com", ""},
+		{"MX priority in content wins", "MX", "example.com", "10 mail.example.com", &priority, nil, "10 mail.example.com", ""},
+		{"SRV from data", "SRV", "_sip._tcp.example.com", "", nil,
+			map[string]interface{}{"priority": float64(10), "weight": float64(5), "port": float64(5060), "target": "sip.example.com"},
+			"10 5 5060 sip.example.com", ""},
+		{"CAA from data", "CAA", "example.com", "", nil,
+			map[string]interface{}{"flags": float64(0), "tag": "issue", "value": "letsencrypt.org"},
+			"0 issue letsencrypt.org", ""},
+		{"URI from data with priority", "URI", "_http._tcp.example.com", "", &priority,
+			map[string]interface{}{"weight": float64(1), "target": "https://example.com/"},
+			"20 1 https://example.com/", ""},
+		{"SRV without service label", "SRV", "sip.example.com", "10 5 5060 sip.example.com", nil, nil, "", "_service._proto"},
+		{"SRV with unknown protocol", "SRV", "_sip._quic.example.com", "10 5 5060 sip.example.com", nil, nil, "", "protocol must be one of"},
+		{"data ignored for A", "A", "www.example.com", "203.0.113.10", nil, map[string]interface{}{"target": "x"}, "203.0.113.10", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := buildTypedRecord(tt.recordType, tt.recordName, tt.content, tt.priority, tt.data)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := payload.formatContent(tt.recordType); got != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,528 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// Ways of matching record content in a find and replace
+const (
+	ReplaceExact = "exact" // Literal text
+	ReplaceRegex = "regex" // Regular expression, the replacement may use $1 style groups
+	ReplaceCIDR  = "cidr"  // A and AAAA addresses in a range, swapped to another address or range
+)
+
+// Find and replace job states
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+)
+
+// DefaultReplaceRateLimit is the Cloudflare requests per second made by find and replace jobs
+// when REPLACE_RATE_LIMIT is not set, leaving headroom in the 4 per second API limit
+const DefaultReplaceRateLimit = 2.0
+
+// maxReplaceJobs is the number of finished jobs kept for status requests
+const maxReplaceJobs = 20
+
+// ReplaceRateLimitFromEnv reads the requests per second of find and replace jobs from
+// REPLACE_RATE_LIMIT
+func ReplaceRateLimitFromEnv() (float64, error) {
+	value := os.Getenv("REPLACE_RATE_LIMIT")
+	if value == "" {
+		return DefaultReplaceRateLimit, nil
+	}
+	rps, err := strconv.ParseFloat(value, 64)
+	if err != nil || rps <= 0 || rps > 4 {
+		return 0, fmt.Errorf("invalid REPLACE_RATE_LIMIT %q: use requests per second above 0 and up to 4", value)
+	}
+	return rps, nil
+}
+
+// ReplaceRequest is the body for finding and replacing record content across zones
+type ReplaceRequest struct {
+	Zones   string `json:"zones"`   // Newline-separated domain names
+	Mode    string `json:"mode"`    // exact (default), regex or cidr
+	Find    string `json:"find"`    // Text, regular expression, or CIDR range or IP address
+	Replace string `json:"replace"` // Replacement text, or IP address or CIDR range of the same size
+	Type    string `json:"type"`    // Only change records of this type
+}
+
+// replacer rewrites record content according to a find and replace request
+type replacer struct {
+	mode        string
+	find        string
+	replace     string
+	recordType  string
+	pattern     *regexp.Regexp
+	from        *net.IPNet
+	to          *net.IPNet
+	description string
+}
+
+// newReplacer checks a find and replace request and prepares it for matching
+func newReplacer(req ReplaceRequest) (*replacer, error) {
+	r := &replacer{
+		mode:       req.Mode,
+		find:       req.Find,
+		replace:    req.Replace,
+		recordType: strings.ToUpper(strings.TrimSpace(req.Type)),
+	}
+	if r.mode == "" {
+		r.mode = ReplaceExact
+	}
+	if r.find == "" {
+		return nil, fmt.Errorf("enter the content to find")
+	}
+
+	switch r.mode {
+	case ReplaceExact:
+	case ReplaceRegex:
+		pattern, err := regexp.Compile(r.find)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %s", err.Error())
+		}
+		r.pattern = pattern
+	case ReplaceCIDR:
+		from, err := parseCIDR(strings.TrimSpace(r.find))
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseCIDR(strings.TrimSpace(r.replace))
+		if err != nil {
+			return nil, err
+		}
+		fromOnes, fromBits := from.Mask.Size()
+		toOnes, toBits := to.Mask.Size()
+		if fromBits != toBits {
+			return nil, fmt.Errorf("cannot swap %s for %s: the address families differ", from, to)
+		}
+		if toOnes != toBits && toOnes != fromOnes {
+			return nil, fmt.Errorf("cannot swap %s for %s: use a single address or a range of the same size", from, to)
+		}
+		r.from, r.to = from, to
+	default:
+		return nil, fmt.Errorf("invalid mode %q, expected exact, regex or cidr", r.mode)
+	}
+
+	r.description = fmt.Sprintf("Replace %q with %q (%s mode)", r.find, r.replace, r.mode)
+	if r.recordType != "" {
+		r.description += " in " + r.recordType + " records"
+	}
+	return r, nil
+}
+
+// swapIP moves an address from one range to the same host in another range, or to the
+// single address of to
+func swapIP(ip net.IP, from, to *net.IPNet) net.IP {
+	ones, bits := to.Mask.Size()
+	if ones == bits {
+		return to.IP
+	}
+	if v4 := ip.To4(); v4 != nil && bits == 32 {
+		ip = v4
+	}
+	swapped := make(net.IP, len(ip))
+	for i := range ip {
+		swapped[i] = to.IP[i]&to.Mask[i] | ip[i]&^from.Mask[i]
+	}
+	return swapped
+}
+
+// apply returns the new content of a record and whether it changed
+func (r *replacer) apply(recordType, content string) (string, bool) {
+	if r.recordType != "" && recordType != r.recordType {
+		return content, false
+	}
+
+	var replaced string
+	switch r.mode {
+	case ReplaceRegex:
+		replaced = r.pattern.ReplaceAllString(content, r.replace)
+	case ReplaceCIDR:
+		if recordType != "A" && recordType != "AAAA" {
+			return content, false
+		}
+		ip := net.ParseIP(content)
+		if ip == nil || !r.from.Contains(ip) {
+			return content, false
+		}
+		replaced = swapIP(ip, r.from, r.to).String()
+	default:
+		replaced = strings.ReplaceAll(content, r.find, r.replace)
+	}
+	return replaced, replaced != content
+}
+
+// planReplace plans an update for every record of a zone whose content the replacement
+// changes, keeping its name, TTL, proxy status, comment and tags. The updates are validated
+// against the rest of the zone.
+func planReplace(zone string, live []cloudflare.DNSRecord, r *replacer) ([]plannedChange, []RecordChange) {
+	plan := []plannedChange{}
+	invalid := []RecordChange{}
+	for i := range live {
+		record := &live[i]
+		previous := FormatRecordContent(*record)
+		content, changed := r.apply(record.Type, previous)
+		if !changed {
+			continue
+		}
+
+		proxied := record.Proxied != nil && *record.Proxied
+		change := RecordChange{Action: ActionUpdate, Type: record.Type, Name: record.Name, Content: content, Proxied: proxied, Previous: previous, RecordID: record.ID}
+		payload, err := buildTypedRecord(record.Type, record.Name, content, nil, nil)
+		if err != nil {
+			change.Action = ActionInvalid
+			change.Error = err.Error()
+			invalid = append(invalid, change)
+			continue
+		}
+		payload.Comment = record.Comment
+		payload.Tags = record.Tags
+		payload.TTL = record.TTL
+
+		desired := &desiredRecord{Type: record.Type, Name: record.Name, Content: content, Proxied: proxied, Payload: payload}
+		plan = append(plan, plannedChange{RecordChange: change, desired: desired, existing: record})
+	}
+	validatePlan(zone, plan, live)
+	return plan, invalid
+}
+
+// replaceInZone previews or applies a find and replace on one zone. Before changing anything
+// the zone is snapshotted so the replace can be rolled back.
+func replaceInZone(api *cloudflare.API, domain string, r *replacer, dryRun bool, ac *auditContext, snapshots *SnapshotStore) ZoneApplyResult {
+	result := ZoneApplyResult{
+		Domain:  domain,
+		DryRun:  dryRun,
+		Changes: []RecordChange{},
+	}
+	if unicode := DisplayName(domain); unicode != domain {
+		result.UnicodeName = unicode
+	}
+	failed := func(message string, err error) ZoneApplyResult {
+		result.Error = err.Error()
+		result.Message = fmt.Sprintf("%s: %s", message, err.Error())
+		return result
+	}
+
+	zoneID, err := api.ZoneIDByName(domain)
+	if err != nil {
+		return failed("Domain not found", err)
+	}
+	result.ZoneID = zoneID
+
+	live, _, err := api.ListDNSRecords(context.Background(), cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{})
+	if err != nil {
+		return failed("Failed to fetch existing records", err)
+	}
+
+	plan, invalid := planReplace(domain, live, r)
+	if len(plan) == 0 && len(invalid) == 0 {
+		result.Success = true
+		result.Message = "No matching records"
+		return result
+	}
+
+	if !dryRun {
+		if err := snapshotBefore(snapshots, api, zoneID, domain, ac, "Before find and replace"); err != nil {
+			return failed("Failed to snapshot the zone, no changes made", err)
+		}
+	}
+	applyPlan(api, &result, plan, invalid, ConflictSkip)
+	return result
+}
+
+// ReplaceJob is a find and replace running in the background
+type ReplaceJob struct {
+	ID          string            `json:"id"`
+	Status      string            `json:"status"`
+	Actor       string            `json:"actor"`
+	Description string            `json:"description"`
+	Zones       []string          `json:"zones"`
+	Done        int               `json:"done"` // Zones processed so far
+	Updated     int               `json:"updated"`
+	Failed      int               `json:"failed"`
+	CreatedAt   time.Time         `json:"created_at"`
+	StartedAt   *time.Time        `json:"started_at,omitempty"`
+	FinishedAt  *time.Time        `json:"finished_at,omitempty"`
+	Results     []ZoneApplyResult `json:"results"`
+
+	owner string // credentialKey of the submitter, the only one who can read the job
+}
+
+// replaceTask is a queued job with what it needs to run
+type replaceTask struct {
+	job      *ReplaceJob
+	email    string
+	apiKey   string
+	replacer *replacer
+	ac       *auditContext
+}
+
+// ReplaceJobs runs find and replace jobs one at a time in the background, with their own
+// Cloudflare rate limit so a large replace does not starve interactive use
+type ReplaceJobs struct {
+	mu        sync.Mutex
+	rateLimit float64
+	snapshots *SnapshotStore
+	cache     *SearchCache
+	jobs      []*ReplaceJob
+	queue     chan replaceTask
+}
+
+// NewReplaceJobs starts the job runner
+func NewReplaceJobs(snapshots *SnapshotStore, cache *SearchCache, rateLimit float64) *ReplaceJobs {
+	if rateLimit <= 0 {
+		rateLimit = DefaultReplaceRateLimit
+	}
+	m := &ReplaceJobs{
+		rateLimit: rateLimit,
+		snapshots: snapshots,
+		cache:     cache,
+		jobs:      []*ReplaceJob{},
+		queue:     make(chan replaceTask, maxReplaceJobs),
+	}
+	go func() {
+		for task := range m.queue {
+			m.run(task)
+		}
+	}()
+	return m
+}
+
+// Submit queues a find and replace on the zones with the credentials of api
+func (m *ReplaceJobs) Submit(api *cloudflare.API, zones []string, r *replacer, ac *auditContext) (ReplaceJob, error) {
+	// The credentials are used after the request has finished, so they must not share its memory
+	email, apiKey := utils.CopyString(api.APIEmail), utils.CopyString(api.APIKey)
+	job := &ReplaceJob{
+		ID:          newID(),
+		Status:      JobQueued,
+		Actor:       ac.actor,
+		Description: r.description,
+		Zones:       zones,
+		CreatedAt:   time.Now().UTC(),
+		Results:     []ZoneApplyResult{},
+		owner:       credentialKey(email, apiKey),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	case m.queue <- replaceTask{job: job, email: email, apiKey: apiKey, replacer: r, ac: ac}:
+	default:
+		return ReplaceJob{}, fiber.NewError(fiber.StatusTooManyRequests, "Too many find and replace jobs are queued, try again later")
+	}
+
+	m.jobs = append(m.jobs, job)
+	m.prune()
+	return m.snapshot(job), nil
+}
+
+// prune drops the oldest finished jobs beyond maxReplaceJobs. The caller must hold the lock.
+func (m *ReplaceJobs) prune() {
+	for len(m.jobs) > maxReplaceJobs && m.jobs[0].Status == JobDone {
+		m.jobs = m.jobs[1:]
+	}
+}
+
+// snapshot copies a job so it can be read without the lock. The caller must hold the lock.
+func (m *ReplaceJobs) snapshot(job *ReplaceJob) ReplaceJob {
+	copied := *job
+	copied.Results = append([]ZoneApplyResult{}, job.Results...)
+	return copied
+}
+
+// Get returns a job by ID when it was submitted with the credentials of api
+func (m *ReplaceJobs) Get(api *cloudflare.API, id string) (ReplaceJob, bool) {
+	owner := credentialKey(api.APIEmail, api.APIKey)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, job := range m.jobs {
+		if job.ID == id && job.owner == owner {
+			return m.snapshot(job), true
+		}
+	}
+	return ReplaceJob{}, false
+}
+
+// run processes the zones of a job one after the other
+func (m *ReplaceJobs) run(task replaceTask) {
+	job := task.job
+	started := time.Now().UTC()
+	m.mu.Lock()
+	job.Status = JobRunning
+	job.StartedAt = &started
+	m.mu.Unlock()
+
+	api, err := cloudflare.New(task.apiKey, task.email, cloudflare.UsingRateLimit(m.rateLimit))
+	for _, zone := range job.Zones {
+		var result ZoneApplyResult
+		if err != nil {
+			result = ZoneApplyResult{Domain: zone, Error: err.Error(), Message: "API client error: " + err.Error(), Changes: []RecordChange{}}
+		} else {
+			result = replaceInZone(api, zone, task.replacer, false, task.ac, m.snapshots)
+			task.ac.recordApply(result, AuditRecordReplace, task.replacer.description)
+			m.cache.Invalidate(result.ZoneID)
+		}
+
+		m.mu.Lock()
+		job.Results = append(job.Results, result)
+		job.Done++
+		job.Updated += result.Updated
+		job.Failed += result.Failed
+		if result.Error != "" {
+			job.Failed++
+		}
+		m.mu.Unlock()
+	}
+
+	finished := time.Now().UTC()
+	m.mu.Lock()
+	job.Status = JobDone
+	job.FinishedAt = &finished
+	m.prune()
+	m.mu.Unlock()
+	log.Printf("Find and replace %s finished: %d records updated, %d failures in %d zones", job.ID, job.Updated, job.Failed, len(job.Zones))
+}
+
+// parseReplaceRequest reads and checks a find and replace request, returning the zones and
+// the prepared replacer
+func parseReplaceRequest(c *fiber.Ctx) ([]string, *replacer, error) {
+	req := new(ReplaceRequest)
+	if err := c.BodyParser(req); err != nil {
+		return nil, nil, fmt.Errorf("invalid request format: %s", err.Error())
+	}
+
+	r, err := newReplacer(*req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	zones, invalid := parseDomainsList(req.Zones)
+	if len(invalid) > 0 {
+		return nil, nil, fmt.Errorf("%s", invalid[0].Error)
+	}
+	if len(zones) == 0 {
+		return nil, nil, fmt.Errorf("select one or more zones")
+	}
+	return zones, r, nil
+}
+
+// PreviewReplaceHandler lists every record a find and replace would change, without changing it
+func PreviewReplaceHandler(store *session.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		zones, r, err := parseReplaceRequest(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		results := make([]ZoneApplyResult, 0, len(zones))
+		affected := 0
+		for _, zone := range zones {
+			result := replaceInZone(api, zone, r, true, nil, nil)
+			affected += result.Updated + result.Failed
+			results = append(results, result)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": fmt.Sprintf("%d records in %d zones match", affected, len(zones)),
+			"results": results,
+		})
+	}
+}
+
+// StartReplaceHandler queues a find and replace as a background job and returns its ID
+func StartReplaceHandler(store *session.Store, audit *AuditLog, jobs *ReplaceJobs) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		zones, r, err := parseReplaceRequest(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		job, err := jobs.Submit(api, zones, r, newAuditContext(c, store, audit, true))
+		if err != nil {
+			status := fiber.StatusInternalServerError
+			if fe, ok := err.(*fiber.Error); ok {
+				status = fe.Code
+			}
+			return c.Status(status).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"success": true,
+			"message": fmt.Sprintf("Find and replace queued for %d zones", len(zones)),
+			"data":    job,
+		})
+	}
+}
+
+// ReplaceJobHandler returns the progress and results of a find and replace job
+func ReplaceJobHandler(store *session.Store, jobs *ReplaceJobs) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		job, ok := jobs.Get(api, c.Params("id"))
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Job not found",
+			})
+		}
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    job,
+		})
+	}
+}
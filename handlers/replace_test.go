@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewReplacer(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        ReplaceRequest
+		recordType string
+		content    string
+		want       string // New content, or the content unchanged
+		err        string
+	}{
+		{"exact", ReplaceRequest{Find: "old.example.com", Replace: "new.example.com"}, "CNAME", "old.example.com", "new.example.com", ""},
+		{"exact other type", ReplaceRequest{Find: "old", Replace: "new", Type: "txt"}, "CNAME", "old.example.com", "old.example.com", ""},
+		{"regex", ReplaceRequest{Mode: ReplaceRegex, Find: `^(\w+)\.old\.`, Replace: "$1.new."}, "CNAME", "www.old.example.com", "www.new.example.com", ""},
+		{"invalid regex", ReplaceRequest{Mode: ReplaceRegex, Find: "(", Replace: "x"}, "", "", "", "invalid regular expression"},
+		{"range to range", ReplaceRequest{Mode: ReplaceCIDR, Find: "203.0.113.0/24", Replace: "198.51.100.0/24"}, "A", "203.0.113.42", "198.51.100.42", ""},
+		{"range to address", ReplaceRequest{Mode: ReplaceCIDR, Find: "203.0.113.0/24", Replace: "198.51.100.7"}, "A", "203.0.113.42", "198.51.100.7", ""},
+		{"address to address", ReplaceRequest{Mode: ReplaceCIDR, Find: "203.0.113.1", Replace: "198.51.100.1"}, "A", "203.0.113.1", "198.51.100.1", ""},
+		{"IPv6 range", ReplaceRequest{Mode: ReplaceCIDR, Find: "2001:db8:1::/48", Replace: "2001:db8:2::/48"}, "AAAA", "2001:db8:1::10", "2001:db8:2::10", ""},
+		{"address outside range", ReplaceRequest{Mode: ReplaceCIDR, Find: "203.0.113.0/24", Replace: "198.51.100.0/24"}, "A", "192.0.2.1", "192.0.2.1", ""},
+		{"range ignores other types", ReplaceRequest{Mode: ReplaceCIDR, Find: "203.0.113.0/24", Replace: "198.51.100.0/24"}, "TXT", "203.0.113.42", "203.0.113.42", ""},
+		{"ranges of different sizes", ReplaceRequest{Mode: ReplaceCIDR, Find: "203.0.113.0/24", Replace: "198.51.100.0/25"}, "", "", "", "same size"},
+		{"address to range", ReplaceRequest{Mode: ReplaceCIDR, Find: "203.0.113.1", Replace: "198.51.100.0/24"}, "", "", "", "same size"},
+		{"address families differ", ReplaceRequest{Mode: ReplaceCIDR, Find: "203.0.113.0/24", Replace: "2001:db8::1"}, "", "", "", "address families differ"},
+		{"invalid range", ReplaceRequest{Mode: ReplaceCIDR, Find: "203.0.113.0/33", Replace: "198.51.100.1"}, "", "", "", "invalid CIDR range"},
+		{"missing find", ReplaceRequest{Replace: "x"}, "", "", "", "content to find"},
+		{"unknown mode", ReplaceRequest{Mode: "glob", Find: "x"}, "", "", "", "invalid mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newReplacer(tt.req)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, changed := r.apply(tt.recordType, tt.content)
+			if got != tt.want || changed != (tt.want != tt.content) {
+				t.Errorf("apply = %q, %v, want %q", got, changed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+// DefaultSearchCacheTTL is how long zone lists and records are reused by searches when
+// SEARCH_CACHE_TTL is not set
+const DefaultSearchCacheTTL = 5 * time.Minute
+
+// maxSearchResults caps the matches returned by one search
+const maxSearchResults = 500
+
+// searchWorkers is the number of zones fetched at the same time during a search
+const searchWorkers = 4
+
+// SearchCacheTTLFromEnv reads the search cache lifetime from SEARCH_CACHE_TTL, such as 5m.
+// 0 disables the cache.
+func SearchCacheTTLFromEnv() (time.Duration, error) {
+	value := os.Getenv("SEARCH_CACHE_TTL")
+	if value == "" {
+		return DefaultSearchCacheTTL, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid SEARCH_CACHE_TTL %q: use a duration such as 5m, or 0 to disable", value)
+	}
+	return ttl, nil
+}
+
+// cachedRecords are the records of one zone as fetched at a point in time
+type cachedRecords struct {
+	records   []cloudflare.DNSRecord
+	fetchedAt time.Time
+}
+
+// searchAccount is the cached zone list and records of one Cloudflare account
+type searchAccount struct {
+	zones     []cloudflare.Zone
+	fetchedAt time.Time
+	records   map[string]cachedRecords // By zone ID
+}
+
+// SearchCache keeps zone lists and records in memory per account, so searching every zone
+// again within the TTL does not refetch them from Cloudflare. Accounts are keyed by the
+// full credentials, so only the same email and API key are served from the cache.
+type SearchCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	accounts map[string]*searchAccount // By credentialKey
+}
+
+// NewSearchCache creates an empty cache
+func NewSearchCache(ttl time.Duration) *SearchCache {
+	return &SearchCache{
+		ttl:      ttl,
+		accounts: map[string]*searchAccount{},
+	}
+}
+
+// account returns the cache of the credentials of api, creating it if needed. The caller
+// must hold the lock.
+func (s *SearchCache) account(api *cloudflare.API) *searchAccount {
+	key := credentialKey(api.APIEmail, api.APIKey)
+	account, ok := s.accounts[key]
+	if !ok {
+		account = &searchAccount{records: map[string]cachedRecords{}}
+		s.accounts[key] = account
+	}
+	return account
+}
+
+// fresh reports whether something fetched at t can still be used
+func (s *SearchCache) fresh(t time.Time) bool {
+	return !t.IsZero() && time.Since(t) < s.ttl
+}
+
+// Zones returns the zones of the account, from the cache unless it is stale or refresh is set
+func (s *SearchCache) Zones(api *cloudflare.API, refresh bool) ([]cloudflare.Zone, error) {
+	s.mu.Lock()
+	account := s.account(api)
+	if !refresh && s.fresh(account.fetchedAt) {
+		zones := account.zones
+		s.mu.Unlock()
+		return zones, nil
+	}
+	s.mu.Unlock()
+
+	zones, err := api.ListZones(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	account.zones = zones
+	account.fetchedAt = time.Now()
+	s.mu.Unlock()
+	return zones, nil
+}
+
+// Records returns the records of a zone and when they were fetched, from the cache unless
+// it is stale or refresh is set
+func (s *SearchCache) Records(api *cloudflare.API, zoneID string, refresh bool) ([]cloudflare.DNSRecord, time.Time, error) {
+	s.mu.Lock()
+	account := s.account(api)
+	if cached, ok := account.records[zoneID]; ok && !refresh && s.fresh(cached.fetchedAt) {
+		s.mu.Unlock()
+		return cached.records, cached.fetchedAt, nil
+	}
+	s.mu.Unlock()
+
+	records, _, err := api.ListDNSRecords(context.Background(), cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	account.records[zoneID] = cachedRecords{records: records, fetchedAt: now}
+	s.mu.Unlock()
+	return records, now, nil
+}
+
+// Invalidate drops the cached records of a zone after it was changed, for every account
+// that can access it. A nil cache does nothing.
+func (s *SearchCache) Invalidate(zoneID string) {
+	if s == nil || zoneID == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, account := range s.accounts {
+		delete(account.records, zoneID)
+	}
+}
+
+// SearchQuery holds the criteria of a cross-zone search. All criteria that are set must match.
+type SearchQuery struct {
+	Text    string     // Partial match on name or content
+	Name    string     // Partial match on name
+	Content string     // Partial match on content
+	Type    string     // Exact record type
+	Zone    string     // Only search zones whose name contains this
+	CIDR    *net.IPNet // A and AAAA records with an address in this range
+}
+
+// ParseSearchQuery reads a search from the q, name, content, type, zone and cidr query
+// parameters. A bare IP address is accepted as a single-address CIDR.
+func ParseSearchQuery(c *fiber.Ctx) (SearchQuery, error) {
+	query := SearchQuery{
+		Text:    strings.ToLower(strings.TrimSpace(c.Query("q"))),
+		Name:    strings.ToLower(strings.TrimSpace(c.Query("name"))),
+		Content: strings.ToLower(strings.TrimSpace(c.Query("content"))),
+		Type:    strings.ToUpper(strings.TrimSpace(c.Query("type"))),
+		Zone:    strings.ToLower(strings.TrimSpace(c.Query("zone"))),
+	}
+
+	if value := strings.TrimSpace(c.Query("cidr")); value != "" {
+		cidr, err := parseCIDR(value)
+		if err != nil {
+			return query, err
+		}
+		query.CIDR = cidr
+	}
+
+	if query.Text == "" && query.Name == "" && query.Content == "" && query.Type == "" && query.CIDR == nil {
+		return query, fmt.Errorf("enter a search term, name, content, type or CIDR range")
+	}
+	return query, nil
+}
+
+// parseCIDR parses a CIDR range, or a single IP address as a /32 or /128
+func parseCIDR(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid CIDR range %q", value)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, cidr, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR range %q", value)
+	}
+	return cidr, nil
+}
+
+// MatchesZone reports whether a zone is searched at all
+func (q SearchQuery) MatchesZone(zone string) bool {
+	return q.Zone == "" || strings.Contains(zone, q.Zone) || strings.Contains(strings.ToLower(DisplayName(zone)), q.Zone)
+}
+
+// Matches reports whether a record meets every criterion of the search
+func (q SearchQuery) Matches(record cloudflare.DNSRecord) bool {
+	if q.Type != "" && record.Type != q.Type {
+		return false
+	}
+
+	name := strings.ToLower(record.Name)
+	content := strings.ToLower(FormatRecordContent(record))
+	if q.Text != "" && !strings.Contains(name, q.Text) && !strings.Contains(content, q.Text) {
+		return false
+	}
+	if q.Name != "" && !strings.Contains(name, q.Name) {
+		return false
+	}
+	if q.Content != "" && !strings.Contains(content, q.Content) {
+		return false
+	}
+
+	if q.CIDR != nil {
+		if record.Type != "A" && record.Type != "AAAA" {
+			return false
+		}
+		ip := net.ParseIP(record.Content)
+		if ip == nil || !q.CIDR.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchResult is a record that matched a search, with the zone it belongs to
+type SearchResult struct {
+	Zone        string    `json:"zone"`
+	UnicodeZone string    `json:"unicode_zone,omitempty"`
+	ZoneID      string    `json:"zone_id"`
+	Record      DNSRecord `json:"record"`
+	EditURL     string    `json:"edit_url"`
+}
+
+// SearchZoneError is a zone whose records could not be fetched during a search
+type SearchZoneError struct {
+	Zone  string `json:"zone"`
+	Error string `json:"error"`
+}
+
+// SearchOutcome is the result of searching every zone of an account
+type SearchOutcome struct {
+	Results      []SearchResult    `json:"results"`
+	Errors       []SearchZoneError `json:"errors"`
+	ZonesScanned int               `json:"zones_scanned"`
+	Truncated    bool              `json:"truncated"`   // More than maxSearchResults matched
+	OldestData   *time.Time        `json:"oldest_data"` // Fetch time of the oldest cached records used
+}
+
+// editURL links to the DNS page of a zone with the edit dialog of a record opened
+func editURL(zone string, record cloudflare.DNSRecord) string {
+	params := url.Values{}
+	params.Set("edit", record.ID)
+	params.Set("search", record.Name)
+	return "/dns/" + url.PathEscape(zone) + "?" + params.Encode()
+}
+
+// searchZone returns the records of one zone that match the search
+func searchZone(query SearchQuery, zone cloudflare.Zone, records []cloudflare.DNSRecord) []SearchResult {
+	results := []SearchResult{}
+	for _, record := range records {
+		if !query.Matches(record) {
+			continue
+		}
+		proxied := false
+		if record.Proxied != nil {
+			proxied = *record.Proxied
+		}
+		result := SearchResult{
+			Zone:   zone.Name,
+			ZoneID: zone.ID,
+			Record: DNSRecord{
+				ID:       record.ID,
+				Type:     record.Type,
+				Name:     record.Name,
+				Content:  FormatRecordContent(record),
+				TTL:      record.TTL,
+				Proxied:  proxied,
+				Priority: record.Priority,
+				Comment:  record.Comment,
+				Tags:     record.Tags,
+			},
+			EditURL: editURL(zone.Name, record),
+		}
+		if unicode := DisplayName(zone.Name); unicode != zone.Name {
+			result.UnicodeZone = unicode
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// SearchZones scans the records of every zone of the account for the search, fetching a
+// few zones at a time. Zones that fail are reported and the others are still searched.
+func SearchZones(api *cloudflare.API, cache *SearchCache, query SearchQuery, refresh bool) (SearchOutcome, error) {
+	zones, err := cache.Zones(api, refresh)
+	if err != nil {
+		return SearchOutcome{}, err
+	}
+
+	selected := []cloudflare.Zone{}
+	for _, zone := range zones {
+		if query.MatchesZone(zone.Name) {
+			selected = append(selected, zone)
+		}
+	}
+
+	type zoneMatches struct {
+		results   []SearchResult
+		fetchedAt time.Time
+		err       error
+	}
+	found := make([]zoneMatches, len(selected))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < searchWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				records, fetchedAt, err := cache.Records(api, selected[i].ID, refresh)
+				if err != nil {
+					found[i].err = err
+					continue
+				}
+				found[i] = zoneMatches{results: searchZone(query, selected[i], records), fetchedAt: fetchedAt}
+			}
+		}()
+	}
+	for i := range selected {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	outcome := SearchOutcome{
+		Results:      []SearchResult{},
+		Errors:       []SearchZoneError{},
+		ZonesScanned: len(selected),
+	}
+	for i, matches := range found {
+		if matches.err != nil {
+			outcome.Errors = append(outcome.Errors, SearchZoneError{Zone: selected[i].Name, Error: matches.err.Error()})
+			continue
+		}
+		if outcome.OldestData == nil || matches.fetchedAt.Before(*outcome.OldestData) {
+			fetchedAt := matches.fetchedAt.UTC()
+			outcome.OldestData = &fetchedAt
+		}
+		outcome.Results = append(outcome.Results, matches.results...)
+	}
+
+	sort.SliceStable(outcome.Results, func(i, j int) bool {
+		a, b := outcome.Results[i], outcome.Results[j]
+		if a.Zone != b.Zone {
+			return a.Zone < b.Zone
+		}
+		if a.Record.Name != b.Record.Name {
+			return a.Record.Name < b.Record.Name
+		}
+		return a.Record.Type < b.Record.Type
+	})
+	if len(outcome.Results) > maxSearchResults {
+		outcome.Results = outcome.Results[:maxSearchResults]
+		outcome.Truncated = true
+	}
+	return outcome, nil
+}
+
+// SearchRecordsHandler searches the records of every zone by name, content, type or CIDR
+// range. Zone lists and records are cached; refresh=true fetches them again.
+func SearchRecordsHandler(store *session.Store, cache *SearchCache) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		query, err := ParseSearchQuery(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		outcome, err := SearchZones(api, cache, query, c.QueryBool("refresh"))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch domains",
+				"error":   err.Error(),
+			})
+		}
+
+		message := fmt.Sprintf("Found %d records in %d zones", len(outcome.Results), outcome.ZonesScanned)
+		if outcome.Truncated {
+			message = fmt.Sprintf("Showing the first %d matches in %d zones, narrow the search to see the rest", maxSearchResults, outcome.ZonesScanned)
+		}
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": message,
+			"data":    outcome,
+		})
+	}
+}
+
+// RenderSearchPageHandler renders the cross-zone search page
+func RenderSearchPageHandler(store *session.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sess, err := store.Get(c)
+		if err != nil {
+			return c.Redirect("/")
+		}
+
+		valid := sess.Get(KeyAPIValid)
+		if valid == nil || !valid.(bool) {
+			return c.Redirect("/")
+		}
+
+		email, _ := sess.Get("apiEmail").(string)
+		return c.Render("search", fiber.Map{
+			"Email": email,
+		})
+	}
+}
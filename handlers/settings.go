@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+// Cloudflare IDs of the managed zone settings
+const (
+	SettingSSL                    = "ssl"
+	SettingAlwaysUseHTTPS         = "always_use_https"
+	SettingMinTLSVersion          = "min_tls_version"
+	SettingSecurityHeader         = "security_header" // Holds HSTS
+	SettingAutomaticHTTPSRewrites = "automatic_https_rewrites"
+	SettingIPv6                   = "ipv6"
+	SettingBrotli                 = "brotli"
+)
+
+// HSTSSettings is the HTTP Strict Transport Security header of a zone
+type HSTSSettings struct {
+	Enabled           bool `json:"enabled"`
+	MaxAge            int  `json:"max_age"` // Seconds
+	IncludeSubdomains bool `json:"include_subdomains"`
+	Preload           bool `json:"preload"`
+	NoSniff           bool `json:"nosniff"`
+}
+
+// ZoneSettingsValues holds the managed settings of a zone. Unset fields are left unchanged
+// when the values are applied.
+type ZoneSettingsValues struct {
+	SSL                    string        `json:"ssl,omitempty"` // off, flexible, full or strict
+	AlwaysUseHTTPS         *bool         `json:"always_use_https,omitempty"`
+	MinTLSVersion          string        `json:"min_tls_version,omitempty"` // 1.0, 1.1, 1.2 or 1.3
+	HSTS                   *HSTSSettings `json:"hsts,omitempty"`
+	AutomaticHTTPSRewrites *bool         `json:"automatic_https_rewrites,omitempty"`
+	IPv6                   *bool         `json:"ipv6,omitempty"`
+	Brotli                 *bool         `json:"brotli,omitempty"`
+}
+
+// Validate checks the values that are set
+func (v ZoneSettingsValues) Validate() error {
+	switch v.SSL {
+	case "", "off", "flexible", "full", "strict":
+	default:
+		return fmt.Errorf("invalid SSL mode %q, expected off, flexible, full or strict", v.SSL)
+	}
+	switch v.MinTLSVersion {
+	case "", "1.0", "1.1", "1.2", "1.3":
+	default:
+		return fmt.Errorf("invalid minimum TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", v.MinTLSVersion)
+	}
+	if v.HSTS != nil && (v.HSTS.MaxAge < 0 || v.HSTS.MaxAge > 31536000) {
+		return fmt.Errorf("invalid HSTS max age %d, expected 0 to 31536000 seconds", v.HSTS.MaxAge)
+	}
+	if v.HSTS != nil && v.HSTS.Preload && (!v.HSTS.IncludeSubdomains || v.HSTS.MaxAge < 31536000) {
+		return fmt.Errorf("HSTS preload needs subdomains included and a max age of 31536000 seconds")
+	}
+	return nil
+}
+
+// IsEmpty reports whether no setting is set
+func (v ZoneSettingsValues) IsEmpty() bool {
+	return v.SSL == "" && v.AlwaysUseHTTPS == nil && v.MinTLSVersion == "" && v.HSTS == nil &&
+		v.AutomaticHTTPSRewrites == nil && v.IPv6 == nil && v.Brotli == nil
+}
+
+// onOff converts a switch to the value Cloudflare uses
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
+// settingUpdate is a single setting to write
+type settingUpdate struct {
+	id      string
+	value   interface{}
+	display string
+}
+
+// updates lists the settings that are set, in a fixed order
+func (v ZoneSettingsValues) updates() []settingUpdate {
+	updates := []settingUpdate{}
+	if v.SSL != "" {
+		updates = append(updates, settingUpdate{SettingSSL, v.SSL, v.SSL})
+	}
+	if v.MinTLSVersion != "" {
+		updates = append(updates, settingUpdate{SettingMinTLSVersion, v.MinTLSVersion, v.MinTLSVersion})
+	}
+	if v.AlwaysUseHTTPS != nil {
+		updates = append(updates, settingUpdate{SettingAlwaysUseHTTPS, onOff(*v.AlwaysUseHTTPS), onOff(*v.AlwaysUseHTTPS)})
+	}
+	if v.AutomaticHTTPSRewrites != nil {
+		value := onOff(*v.AutomaticHTTPSRewrites)
+		updates = append(updates, settingUpdate{SettingAutomaticHTTPSRewrites, value, value})
+	}
+	if v.HSTS != nil {
+		display := "off"
+		if v.HSTS.Enabled {
+			display = "max-age=" + strconv.Itoa(v.HSTS.MaxAge)
+			if v.HSTS.IncludeSubdomains {
+				display += "; includeSubDomains"
+			}
+			if v.HSTS.Preload {
+				display += "; preload"
+			}
+		}
+		value := map[string]interface{}{"strict_transport_security": v.HSTS}
+		updates = append(updates, settingUpdate{SettingSecurityHeader, value, display})
+	}
+	if v.IPv6 != nil {
+		updates = append(updates, settingUpdate{SettingIPv6, onOff(*v.IPv6), onOff(*v.IPv6)})
+	}
+	if v.Brotli != nil {
+		updates = append(updates, settingUpdate{SettingBrotli, onOff(*v.Brotli), onOff(*v.Brotli)})
+	}
+	return updates
+}
+
+// settingsFromCloudflare reads the managed settings from the full list of zone settings
+func settingsFromCloudflare(settings []cloudflare.ZoneSetting) ZoneSettingsValues {
+	values := ZoneSettingsValues{}
+	isOn := func(value interface{}) *bool {
+		on := value == "on"
+		return &on
+	}
+	for _, setting := range settings {
+		switch setting.ID {
+		case SettingSSL:
+			values.SSL, _ = setting.Value.(string)
+		case SettingMinTLSVersion:
+			values.MinTLSVersion, _ = setting.Value.(string)
+		case SettingAlwaysUseHTTPS:
+			values.AlwaysUseHTTPS = isOn(setting.Value)
+		case SettingAutomaticHTTPSRewrites:
+			values.AutomaticHTTPSRewrites = isOn(setting.Value)
+		case SettingIPv6:
+			values.IPv6 = isOn(setting.Value)
+		case SettingBrotli:
+			values.Brotli = isOn(setting.Value)
+		case SettingSecurityHeader:
+			values.HSTS = &HSTSSettings{}
+			header, _ := setting.Value.(map[string]interface{})
+			hsts, _ := header["strict_transport_security"].(map[string]interface{})
+			values.HSTS.Enabled, _ = hsts["enabled"].(bool)
+			values.HSTS.IncludeSubdomains, _ = hsts["include_subdomains"].(bool)
+			values.HSTS.Preload, _ = hsts["preload"].(bool)
+			values.HSTS.NoSniff, _ = hsts["nosniff"].(bool)
+			if maxAge, ok := hsts["max_age"].(float64); ok {
+				values.HSTS.MaxAge = int(maxAge)
+			}
+		}
+	}
+	return values
+}
+
+// GetZoneSettings reads the managed settings of a zone
+func GetZoneSettings(api *cloudflare.API, zoneID string) (ZoneSettingsValues, error) {
+	response, err := api.ZoneSettings(context.Background(), zoneID)
+	if err != nil {
+		return ZoneSettingsValues{}, err
+	}
+	return settingsFromCloudflare(response.Result), nil
+}
+
+// SettingChange is the outcome of writing one setting
+type SettingChange struct {
+	Setting string `json:"setting"`
+	Value   string `json:"value"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ApplyZoneSettings writes every setting that is set, one at a time so each reports its own
+// success, and logs them in the audit log
+func ApplyZoneSettings(api *cloudflare.API, zoneID, zone string, values ZoneSettingsValues, ac *auditContext, detail string) []SettingChange {
+	changes := []SettingChange{}
+	for _, update := range values.updates() {
+		_, err := api.UpdateZoneSetting(context.Background(), cloudflare.ZoneIdentifier(zoneID), cloudflare.UpdateZoneSettingParams{Name: update.id, Value: update.value})
+		change := SettingChange{Setting: update.id, Value: update.display, Success: err == nil, Error: errorString(err)}
+		changes = append(changes, change)
+
+		entryDetail := fmt.Sprintf("%s = %s", update.id, update.display)
+		if detail != "" {
+			entryDetail += " (" + detail + ")"
+		}
+		ac.record(AuditEntry{Action: AuditZoneSettings, Zone: zone, ZoneID: zoneID, Success: change.Success, Error: change.Error, Detail: entryDetail})
+	}
+	return changes
+}
+
+// ZoneSettingsResult is the outcome of applying settings to one zone
+type ZoneSettingsResult struct {
+	Domain      string          `json:"domain"`
+	UnicodeName string          `json:"unicode_domain,omitempty"`
+	ZoneID      string          `json:"zone_id,omitempty"`
+	Success     bool            `json:"success"`
+	Message     string          `json:"message"`
+	Error       string          `json:"error,omitempty"`
+	Settings    []SettingChange `json:"settings"`
+}
+
+// applySettingsToDomain looks up a zone and applies settings to it
+func applySettingsToDomain(api *cloudflare.API, domain string, values ZoneSettingsValues, ac *auditContext, detail string) ZoneSettingsResult {
+	result := ZoneSettingsResult{Domain: domain, Settings: []SettingChange{}}
+	if unicode := DisplayName(domain); unicode != domain {
+		result.UnicodeName = unicode
+	}
+
+	zoneID, err := api.ZoneIDByName(domain)
+	if err != nil {
+		result.Error = err.Error()
+		result.Message = "Domain not found: " + err.Error()
+		return result
+	}
+	result.ZoneID = zoneID
+
+	result.Settings = ApplyZoneSettings(api, zoneID, domain, values, ac, detail)
+	failed := 0
+	for _, change := range result.Settings {
+		if !change.Success {
+			failed++
+		}
+	}
+	result.Success = failed == 0
+	result.Message = fmt.Sprintf("%d of %d settings applied", len(result.Settings)-failed, len(result.Settings))
+	return result
+}
+
+// GetZoneSettingsHandler returns the managed settings of a zone
+func GetZoneSettingsHandler(store *session.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		domain := auditZoneName(c.Params("domain"))
+		zoneID, err := api.ZoneIDByName(domain)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Domain not found",
+				"error":   err.Error(),
+			})
+		}
+
+		values, err := GetZoneSettings(api, zoneID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to fetch zone settings",
+				"error":   err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    values,
+		})
+	}
+}
+
+// UpdateZoneSettingsHandler applies the settings in the body to a zone
+func UpdateZoneSettingsHandler(store *session.Store, audit *AuditLog) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		values := ZoneSettingsValues{}
+		if err := c.BodyParser(&values); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request format",
+				"error":   err.Error(),
+			})
+		}
+		if err := values.Validate(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		result := applySettingsToDomain(api, auditZoneName(c.Params("domain")), values, newAuditContext(c, store, audit, false), "")
+		return c.JSON(fiber.Map{
+			"success": result.Success,
+			"message": result.Message,
+			"data":    result,
+		})
+	}
+}
+
+// ApplySettingsRequest is the body for applying settings to many zones
+type ApplySettingsRequest struct {
+	Domains  string             `json:"domains"` // Newline-separated domain names
+	Settings ZoneSettingsValues `json:"settings"`
+	Profile  string             `json:"profile"` // ID of a settings profile, used instead of Settings
+}
+
+// ApplySettingsHandler applies the same settings, or a settings profile, to many zones
+func ApplySettingsHandler(store *session.Store, profiles *ProfileStore, audit *AuditLog) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req := new(ApplySettingsRequest)
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request format",
+				"error":   err.Error(),
+			})
+		}
+		detail := ""
+		if req.Profile != "" {
+			profile, ok := profiles.Get(req.Profile)
+			if !ok {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": fmt.Sprintf("Settings profile not found: %s", req.Profile),
+				})
+			}
+			req.Settings = profile.Settings
+			detail = "Profile " + profile.Name
+		}
+		if err := req.Settings.Validate(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+		if req.Settings.IsEmpty() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Choose at least one setting to apply",
+			})
+		}
+
+		domains, invalid := parseDomainsList(req.Domains)
+		if len(domains) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "No valid domains provided",
+				"results": invalid,
+			})
+		}
+
+		results := make([]ZoneSettingsResult, 0, len(domains)+len(invalid))
+		for _, r := range invalid {
+			results = append(results, ZoneSettingsResult{Domain: r.Domain, Message: r.Message, Error: r.Error, Settings: []SettingChange{}})
+		}
+
+		ac := newAuditContext(c, store, audit, true)
+		successCount := 0
+		for _, domain := range domains {
+			result := applySettingsToDomain(api, domain, req.Settings, ac, detail)
+			if result.Success {
+				successCount++
+			}
+			results = append(results, result)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": successCount > 0,
+			"message": fmt.Sprintf("Settings applied to %d out of %d domains", successCount, len(results)),
+			"results": results,
+		})
+	}
+}
+
+// RenderSettingsPageHandler renders the zone settings page of a domain
+func RenderSettingsPageHandler(store *session.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sess, err := store.Get(c)
+		if err != nil {
+			return c.Redirect("/")
+		}
+
+		valid := sess.Get(KeyAPIValid)
+		if valid == nil || !valid.(bool) {
+			return c.Redirect("/")
+		}
+
+		email, _ := sess.Get("apiEmail").(string)
+		return c.Render("settings", fiber.Map{
+			"Domain": auditZoneName(c.Params("domain")),
+			"Email":  email,
+		})
+	}
+}
@@ -0,0 +1,532 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+// DefaultSnapshotRetention is the number of snapshots kept per zone; older ones are removed
+// when a new snapshot is taken
+const DefaultSnapshotRetention = 50
+
+var snapshotIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// SnapshotRecord is a record as it was when a snapshot was taken
+type SnapshotRecord struct {
+	ID      string   `json:"id"`
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Content string   `json:"content"`
+	Proxied bool     `json:"proxied"`
+	TTL     int      `json:"ttl,omitempty"`
+	Comment string   `json:"comment,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// ZoneSnapshot is the full record set of a zone at a point in time
+type ZoneSnapshot struct {
+	ID          string           `json:"id"`
+	Zone        string           `json:"zone"`
+	ZoneID      string           `json:"zone_id"`
+	CreatedAt   time.Time        `json:"created_at"`
+	CreatedBy   string           `json:"created_by"`
+	Reason      string           `json:"reason"`
+	RecordCount int              `json:"record_count"`
+	Records     []SnapshotRecord `json:"records,omitempty"`
+}
+
+// SnapshotStore keeps zone snapshots as one JSON file per snapshot in snapshots/<zone>/ in
+// the data directory
+type SnapshotStore struct {
+	mu        sync.Mutex
+	dir       string
+	retention int
+}
+
+// NewSnapshotStore creates a snapshot store in dataDir keeping up to retention snapshots per zone
+func NewSnapshotStore(dataDir string, retention int) *SnapshotStore {
+	if retention < 1 {
+		retention = DefaultSnapshotRetention
+	}
+	return &SnapshotStore{dir: filepath.Join(dataDir, "snapshots"), retention: retention}
+}
+
+// zoneDir returns the directory holding the snapshots of a zone
+func (s *SnapshotStore) zoneDir(zone string) (string, error) {
+	zone, err := NormalizeZone(zone)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(zone, `/\`) || strings.HasPrefix(zone, ".") {
+		return "", fmt.Errorf("invalid zone name %q", zone)
+	}
+	return filepath.Join(s.dir, zone), nil
+}
+
+// Take records the current records of a zone
+func (s *SnapshotStore) Take(api *cloudflare.API, zoneID, zone, actor, reason string) (ZoneSnapshot, error) {
+	dir, err := s.zoneDir(zone)
+	if err != nil {
+		return ZoneSnapshot{}, err
+	}
+
+	live, _, err := api.ListDNSRecords(context.Background(), cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{})
+	if err != nil {
+		return ZoneSnapshot{}, fmt.Errorf("failed to fetch records: %w", err)
+	}
+
+	snapshot := ZoneSnapshot{
+		ID:          newID(),
+		Zone:        filepath.Base(dir),
+		ZoneID:      zoneID,
+		CreatedAt:   time.Now().UTC(),
+		CreatedBy:   actor,
+		Reason:      reason,
+		RecordCount: len(live),
+		Records:     snapshotRecords(live),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := writeJSONFile(filepath.Join(dir, snapshot.ID+".json"), snapshot); err != nil {
+		return ZoneSnapshot{}, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	s.prune(dir)
+	return snapshot, nil
+}
+
+// snapshotRecords converts live records into their stored form
+func snapshotRecords(live []cloudflare.DNSRecord) []SnapshotRecord {
+	records := make([]SnapshotRecord, 0, len(live))
+	for _, record := range live {
+		records = append(records, SnapshotRecord{
+			ID:      record.ID,
+			Type:    record.Type,
+			Name:    record.Name,
+			Content: FormatRecordContent(record),
+			Proxied: record.Proxied != nil && *record.Proxied,
+			TTL:     record.TTL,
+			Comment: record.Comment,
+			Tags:    record.Tags,
+		})
+	}
+	return records
+}
+
+// prune removes the oldest snapshots of a zone beyond the retention limit. The caller must
+// hold the lock.
+func (s *SnapshotStore) prune(dir string) {
+	snapshots, err := s.read(dir)
+	if err != nil {
+		return
+	}
+	for _, snapshot := range snapshots[min(len(snapshots), s.retention):] {
+		os.Remove(filepath.Join(dir, snapshot.ID+".json"))
+	}
+}
+
+// read loads the snapshots in a zone directory, newest first
+func (s *SnapshotStore) read(dir string) ([]ZoneSnapshot, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []ZoneSnapshot{}
+	for _, file := range files {
+		var snapshot ZoneSnapshot
+		if err := readJSONFile(file, &snapshot); err != nil || snapshot.ID == "" {
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// List returns the snapshots of a zone without their records, newest first. Only snapshots
+// taken of the zone with the given ID are returned, not those of an earlier zone by the same
+// name.
+func (s *SnapshotStore) List(zone, zoneID string) ([]ZoneSnapshot, error) {
+	dir, err := s.zoneDir(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.read(dir)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []ZoneSnapshot{}
+	for _, snapshot := range all {
+		if snapshot.ZoneID == zoneID {
+			snapshot.Records = nil
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+// Get returns a snapshot of the zone with the given ID, with its records
+func (s *SnapshotStore) Get(zone, zoneID, id string) (ZoneSnapshot, error) {
+	dir, err := s.zoneDir(zone)
+	if err != nil {
+		return ZoneSnapshot{}, err
+	}
+	if !snapshotIDPattern.MatchString(id) {
+		return ZoneSnapshot{}, fiber.NewError(fiber.StatusNotFound, "Snapshot not found")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var snapshot ZoneSnapshot
+	if err := readJSONFile(filepath.Join(dir, id+".json"), &snapshot); err != nil {
+		return ZoneSnapshot{}, err
+	}
+	if snapshot.ID == "" || snapshot.ZoneID != zoneID {
+		return ZoneSnapshot{}, fiber.NewError(fiber.StatusNotFound, "Snapshot not found")
+	}
+	return snapshot, nil
+}
+
+// snapshotBefore takes a snapshot ahead of a change, attributed to the request making it
+func snapshotBefore(snapshots *SnapshotStore, api *cloudflare.API, zoneID, zone string, ac *auditContext, reason string) error {
+	if snapshots == nil {
+		return nil
+	}
+	actor := ""
+	if ac != nil {
+		actor = ac.actor
+	}
+	_, err := snapshots.Take(api, zoneID, zone, actor, reason)
+	return err
+}
+
+// planZoneSync plans the minimal changes that make a zone hold exactly the desired records:
+// the per name and type overwrite plan, plus deletes for live records at names and types
+// the desired set does not have. Keys in keep are never deleted, so records that could not
+// be turned into desired records are left alone.
+func planZoneSync(zone string, desired []desiredRecord, live []cloudflare.DNSRecord, keep map[string]bool) []plannedChange {
+	plan := planGroups(desired, live, ConflictOverwrite)
+
+	planned := map[string]bool{}
+	for _, change := range plan {
+		if change.RecordID != "" {
+			planned[change.RecordID] = true
+		}
+	}
+	for _, d := range desired {
+		keep[recordKey(d.Name, d.Type)] = true
+	}
+	for i := range live {
+		record := &live[i]
+		if !planned[record.ID] && !keep[recordKey(record.Name, record.Type)] {
+			plan = append(plan, deleteChange(record))
+		}
+	}
+
+	validatePlan(zone, plan, live)
+	return plan
+}
+
+// RestoreSnapshot brings a zone back to the records of a snapshot with the fewest changes.
+// With dryRun the changes are reported without being made, which is the diff between the
+// snapshot and the live zone.
+func RestoreSnapshot(api *cloudflare.API, snapshot ZoneSnapshot, dryRun bool) ZoneApplyResult {
+	result := ZoneApplyResult{
+		Domain:  snapshot.Zone,
+		ZoneID:  snapshot.ZoneID,
+		DryRun:  dryRun,
+		Changes: []RecordChange{},
+	}
+	if unicode := DisplayName(snapshot.Zone); unicode != snapshot.Zone {
+		result.UnicodeName = unicode
+	}
+
+	live, _, err := api.ListDNSRecords(context.Background(), cloudflare.ZoneIdentifier(snapshot.ZoneID), cloudflare.ListDNSRecordsParams{})
+	if err != nil {
+		result.Error = err.Error()
+		result.Message = fmt.Sprintf("Failed to fetch existing records: %s", err.Error())
+		return result
+	}
+
+	desired := []desiredRecord{}
+	invalid := []RecordChange{}
+	keep := map[string]bool{}
+	for _, record := range snapshot.Records {
+		payload, err := buildTypedRecord(record.Type, record.Name, record.Content, nil, nil)
+		if err != nil {
+			keep[recordKey(record.Name, record.Type)] = true
+			invalid = append(invalid, RecordChange{Action: ActionInvalid, Type: record.Type, Name: record.Name, Content: record.Content, Error: err.Error()})
+			continue
+		}
+		payload.Comment = record.Comment
+		payload.Tags = record.Tags
+		payload.TTL = record.TTL
+		desired = append(desired, desiredRecord{Type: record.Type, Name: record.Name, Content: record.Content, Proxied: record.Proxied, Payload: payload})
+	}
+
+	plan := planZoneSync(snapshot.Zone, desired, live, keep)
+	if !dryRun {
+		executePlan(api, snapshot.ZoneID, plan)
+	}
+	summarizePlan(&result, plan, invalid, false)
+	return result
+}
+
+// snapshotError writes the response for a failed snapshot operation
+func snapshotError(c *fiber.Ctx, err error) error {
+	if fe, ok := err.(*fiber.Error); ok {
+		return c.Status(fe.Code).JSON(fiber.Map{
+			"success": false,
+			"message": fe.Message,
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"message": "Snapshot error",
+		"error":   err.Error(),
+	})
+}
+
+// ListSnapshotsHandler returns the snapshots of a zone, newest first
+func ListSnapshotsHandler(store *session.Store, snapshots *SnapshotStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		// Snapshots are only listed for the zone the caller's credentials resolve the name to
+		zoneID, err := zoneIDForCaller(api, auditZoneName(c.Params("domain")))
+		if err != nil {
+			return snapshotError(c, err)
+		}
+
+		list, err := snapshots.List(c.Params("domain"), zoneID)
+		if err != nil {
+			return snapshotError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    list,
+		})
+	}
+}
+
+// TakeSnapshotRequest is the body for taking a snapshot by hand
+type TakeSnapshotRequest struct {
+	Reason string `json:"reason"`
+}
+
+// TakeSnapshotHandler takes a snapshot of a zone on request
+func TakeSnapshotHandler(store *session.Store, snapshots *SnapshotStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+		actor, err := SessionEmail(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req := new(TakeSnapshotRequest)
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(req); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": "Invalid request format",
+					"error":   err.Error(),
+				})
+			}
+		}
+		reason := strings.TrimSpace(req.Reason)
+		if reason == "" {
+			reason = "Manual snapshot"
+		}
+
+		zone, err := NormalizeZone(c.Params("domain"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+		zoneID, err := api.ZoneIDByName(zone)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Domain not found",
+				"error":   err.Error(),
+			})
+		}
+
+		snapshot, err := snapshots.Take(api, zoneID, zone, actor, reason)
+		if err != nil {
+			return snapshotError(c, err)
+		}
+		snapshot.Records = nil
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": fmt.Sprintf("Snapshot taken with %d records", snapshot.RecordCount),
+			"data":    snapshot,
+		})
+	}
+}
+
+// GetSnapshotHandler returns a snapshot with its records
+func GetSnapshotHandler(store *session.Store, snapshots *SnapshotStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		zoneID, err := zoneIDForCaller(api, auditZoneName(c.Params("domain")))
+		if err != nil {
+			return snapshotError(c, err)
+		}
+
+		snapshot, err := snapshots.Get(c.Params("domain"), zoneID, c.Params("id"))
+		if err != nil {
+			return snapshotError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    snapshot,
+		})
+	}
+}
+
+// DiffSnapshotHandler compares a snapshot with the live zone, listing the changes a restore
+// would make
+func DiffSnapshotHandler(store *session.Store, snapshots *SnapshotStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		zoneID, err := zoneIDForCaller(api, auditZoneName(c.Params("domain")))
+		if err != nil {
+			return snapshotError(c, err)
+		}
+
+		snapshot, err := snapshots.Get(c.Params("domain"), zoneID, c.Params("id"))
+		if err != nil {
+			return snapshotError(c, err)
+		}
+
+		result := RestoreSnapshot(api, snapshot, true)
+		return c.JSON(fiber.Map{
+			"success": result.Error == "",
+			"message": result.Message,
+			"results": []ZoneApplyResult{result},
+		})
+	}
+}
+
+// RestoreSnapshotRequest is the body for restoring a snapshot
+type RestoreSnapshotRequest struct {
+	DryRun bool `json:"dryRun"`
+}
+
+// RestoreSnapshotHandler restores a zone to a snapshot. The current state is snapshotted
+// first, so a restore can itself be undone.
+func RestoreSnapshotHandler(store *session.Store, snapshots *SnapshotStore, audit *AuditLog, cache *SearchCache) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req := new(RestoreSnapshotRequest)
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(req); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": "Invalid request format",
+					"error":   err.Error(),
+				})
+			}
+		}
+
+		zoneID, err := zoneIDForCaller(api, auditZoneName(c.Params("domain")))
+		if err != nil {
+			return snapshotError(c, err)
+		}
+
+		snapshot, err := snapshots.Get(c.Params("domain"), zoneID, c.Params("id"))
+		if err != nil {
+			return snapshotError(c, err)
+		}
+
+		ac := newAuditContext(c, store, audit, false)
+		if !req.DryRun {
+			reason := fmt.Sprintf("Before restoring snapshot from %s", snapshot.CreatedAt.Format(time.RFC3339))
+			if err := snapshotBefore(snapshots, api, snapshot.ZoneID, snapshot.Zone, ac, reason); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"success": false,
+					"message": "Failed to snapshot the zone before restoring, no changes made",
+					"error":   err.Error(),
+				})
+			}
+		}
+
+		result := RestoreSnapshot(api, snapshot, req.DryRun)
+		ac.recordApply(result, AuditSnapshotRestore, fmt.Sprintf("Restore of snapshot %s taken %s", snapshot.ID, snapshot.CreatedAt.Format(time.RFC3339)))
+		cache.Invalidate(snapshot.ZoneID)
+
+		return c.JSON(fiber.Map{
+			"success": result.Success,
+			"message": result.Message,
+			"results": []ZoneApplyResult{result},
+		})
+	}
+}
@@ -0,0 +1,828 @@
+package handlers
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+
+	"hijicloudflareDNS/validator"
+)
+
+// DefaultTemplateID is the ID of the template seeded into an empty template library
+const DefaultTemplateID = "default"
+
+// templatePreviewZone is the zone that template records are validated against on save
+const templatePreviewZone = "example.com"
+
+// DNSTemplate is a named set of DNS records applied to zones, stored server-side and
+// shared by everyone using the application
+type DNSTemplate struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Records     []string           `json:"records"` // TYPE|NAME|CONTENT|PROXIED|COMMENT|TAGS lines and {{#if}} blocks
+	Variables   []TemplateVariable `json:"variables"`
+	Version     int                `json:"version"`
+	CreatedAt   time.Time          `json:"created_at"`
+	CreatedBy   string             `json:"created_by"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+	UpdatedBy   string             `json:"updated_by"`
+}
+
+// TemplateAssignment records the template a zone is expected to follow, with the variable
+// values it was applied with
+type TemplateAssignment struct {
+	Zone       string            `json:"zone"`
+	TemplateID string            `json:"template_id"`
+	Variables  map[string]string `json:"variables"`
+	AssignedAt time.Time         `json:"assigned_at"`
+	AssignedBy string            `json:"assigned_by"`
+}
+
+// TemplateStore keeps the DNS template library and the zone assignments in JSON files in
+// the data directory
+type TemplateStore struct {
+	mu             sync.RWMutex
+	path           string
+	templates      map[string]DNSTemplate
+	assignmentPath string
+	assignments    map[string]TemplateAssignment
+	versionPath    string
+	versions       map[string][]TemplateVersion
+}
+
+// NewTemplateStore loads the template library from dataDir, seeding the default template
+// when the library does not exist yet
+func NewTemplateStore(dataDir string) (*TemplateStore, error) {
+	s := &TemplateStore{
+		path:           filepath.Join(dataDir, "templates.json"),
+		templates:      make(map[string]DNSTemplate),
+		assignmentPath: filepath.Join(dataDir, "template_assignments.json"),
+		assignments:    make(map[string]TemplateAssignment),
+		versionPath:    filepath.Join(dataDir, "template_versions.json"),
+		versions:       make(map[string][]TemplateVersion),
+	}
+
+	if err := readJSONFile(s.versionPath, &s.versions); err != nil {
+		return nil, fmt.Errorf("failed to load template versions from %s: %w", s.versionPath, err)
+	}
+
+	var assignments []TemplateAssignment
+	if err := readJSONFile(s.assignmentPath, &assignments); err != nil {
+		return nil, fmt.Errorf("failed to load template assignments from %s: %w", s.assignmentPath, err)
+	}
+	for _, a := range assignments {
+		s.assignments[a.Zone] = a
+	}
+
+	var templates []DNSTemplate
+	if err := readJSONFile(s.path, &templates); err != nil {
+		return nil, fmt.Errorf("failed to load templates from %s: %w", s.path, err)
+	}
+	for _, t := range templates {
+		s.templates[t.ID] = t
+	}
+
+	// A missing file leaves templates nil; an emptied library is kept empty
+	if templates == nil {
+		now := time.Now().UTC()
+		s.templates[DefaultTemplateID] = DNSTemplate{
+			ID:   DefaultTemplateID,
+			Name: "Default Template",
+			Records: []string{
+				"A|@|{{ip}}|true",
+				"CNAME|www|@|true",
+				"CNAME|shop|@|true",
+				"CNAME|buy|@|true",
+				"CNAME|product|@|true",
+			},
+			Variables: []TemplateVariable{
+				{Name: "ip", Label: "Origin IP address", Required: true},
+			},
+			Version:   1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		s.versions[DefaultTemplateID] = []TemplateVersion{newTemplateVersion(s.templates[DefaultTemplateID], "", now, "Default template")}
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// List returns all templates sorted by name
+func (s *TemplateStore) List() []DNSTemplate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	templates := make([]DNSTemplate, 0, len(s.templates))
+	for _, t := range s.templates {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return strings.ToLower(templates[i].Name) < strings.ToLower(templates[j].Name)
+	})
+	return templates
+}
+
+// Get returns the template with the given ID
+func (s *TemplateStore) Get(id string) (DNSTemplate, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.templates[id]
+	return t, ok
+}
+
+// Create adds a new template on behalf of actor, starting its history at version 1. The ID
+// of t is kept when it is set and not in use, so imported templates keep their IDs.
+func (s *TemplateStore) Create(t DNSTemplate, actor, note string) (DNSTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, taken := s.templates[t.ID]; t.ID == "" || taken {
+		t.ID = newID()
+	}
+
+	now := time.Now().UTC()
+	t.Version = 1
+	t.CreatedAt, t.CreatedBy = now, actor
+	t.UpdatedAt, t.UpdatedBy = now, actor
+	s.templates[t.ID] = t
+	s.versions[t.ID] = []TemplateVersion{newTemplateVersion(t, actor, now, note)}
+
+	if err := s.save(); err != nil {
+		delete(s.templates, t.ID)
+		delete(s.versions, t.ID)
+		return DNSTemplate{}, err
+	}
+	return t, nil
+}
+
+// Update replaces the name, description, records and variables of an existing template,
+// recording the result as a new version
+func (s *TemplateStore) Update(id string, t DNSTemplate, actor, note string) (DNSTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.templates[id]
+	if !ok {
+		return DNSTemplate{}, fiber.NewError(fiber.StatusNotFound, "Template not found")
+	}
+	previousVersions := s.versions[id]
+
+	updated := previous
+	updated.Name = t.Name
+	updated.Description = t.Description
+	updated.Records = t.Records
+	updated.Variables = t.Variables
+	updated.Version = previous.Version + 1
+	updated.UpdatedAt, updated.UpdatedBy = time.Now().UTC(), actor
+	s.templates[id] = updated
+	s.versions[id] = append(previousVersions, newTemplateVersion(updated, actor, updated.UpdatedAt, note))
+
+	if err := s.save(); err != nil {
+		s.templates[id] = previous
+		s.versions[id] = previousVersions
+		return DNSTemplate{}, err
+	}
+	return updated, nil
+}
+
+// Delete removes a template and its history. A template that zones are still assigned to
+// is kept, so no assignment is left pointing at a missing template.
+func (s *TemplateStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.templates[id]
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Template not found")
+	}
+	var zones []string
+	for _, a := range s.assignments {
+		if a.TemplateID == id {
+			zones = append(zones, a.Zone)
+		}
+	}
+	if len(zones) > 0 {
+		sort.Strings(zones)
+		return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Template is assigned to %d zone(s) (%s); unassign them first", len(zones), strings.Join(zones, ", ")))
+	}
+	previousVersions := s.versions[id]
+	delete(s.templates, id)
+	delete(s.versions, id)
+
+	if err := s.save(); err != nil {
+		s.templates[id] = previous
+		s.versions[id] = previousVersions
+		return err
+	}
+	return nil
+}
+
+// save writes the library and its history to disk. The caller must hold the lock.
+func (s *TemplateStore) save() error {
+	if err := writeJSONFile(s.versionPath, s.versions); err != nil {
+		return fmt.Errorf("failed to save template versions to %s: %w", s.versionPath, err)
+	}
+
+	templates := make([]DNSTemplate, 0, len(s.templates))
+	for _, t := range s.templates {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].ID < templates[j].ID })
+
+	if err := writeJSONFile(s.path, templates); err != nil {
+		return fmt.Errorf("failed to save templates to %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Assign records that a zone follows a template with the given variable values
+func (s *TemplateStore) Assign(zone, templateID string, variables map[string]string, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if variables == nil {
+		variables = map[string]string{}
+	}
+	previous, existed := s.assignments[zone]
+	s.assignments[zone] = TemplateAssignment{
+		Zone:       zone,
+		TemplateID: templateID,
+		Variables:  variables,
+		AssignedAt: time.Now().UTC(),
+		AssignedBy: actor,
+	}
+
+	if err := s.saveAssignments(); err != nil {
+		if existed {
+			s.assignments[zone] = previous
+		} else {
+			delete(s.assignments, zone)
+		}
+		return err
+	}
+	return nil
+}
+
+// Unassign removes the template assignment of a zone
+func (s *TemplateStore) Unassign(zone string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.assignments[zone]
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Zone has no template assigned")
+	}
+	delete(s.assignments, zone)
+
+	if err := s.saveAssignments(); err != nil {
+		s.assignments[zone] = previous
+		return err
+	}
+	return nil
+}
+
+// Assignment returns the template assignment of a zone
+func (s *TemplateStore) Assignment(zone string) (TemplateAssignment, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.assignments[zone]
+	return a, ok
+}
+
+// Assignments returns every template assignment sorted by zone
+func (s *TemplateStore) Assignments() []TemplateAssignment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	assignments := make([]TemplateAssignment, 0, len(s.assignments))
+	for _, a := range s.assignments {
+		assignments = append(assignments, a)
+	}
+	sort.Slice(assignments, func(i, j int) bool { return assignments[i].Zone < assignments[j].Zone })
+	return assignments
+}
+
+// saveAssignments writes the assignments to disk. The caller must hold the lock.
+func (s *TemplateStore) saveAssignments() error {
+	assignments := make([]TemplateAssignment, 0, len(s.assignments))
+	for _, a := range s.assignments {
+		assignments = append(assignments, a)
+	}
+	sort.Slice(assignments, func(i, j int) bool { return assignments[i].Zone < assignments[j].Zone })
+
+	if err := writeJSONFile(s.assignmentPath, assignments); err != nil {
+		return fmt.Errorf("failed to save template assignments to %s: %w", s.assignmentPath, err)
+	}
+	return nil
+}
+
+// TemplateRequest is the body for creating or updating a template
+type TemplateRequest struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Records     []string           `json:"records"`
+	Variables   []TemplateVariable `json:"variables"`
+	Note        string             `json:"note"` // Describes the change in the version history
+}
+
+// normalize trims the request and drops blank record lines
+func (r *TemplateRequest) normalize() {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Description = strings.TrimSpace(r.Description)
+	r.Note = strings.TrimSpace(r.Note)
+
+	records := make([]string, 0, len(r.Records))
+	for _, line := range r.Records {
+		if line = strings.TrimSpace(line); line != "" {
+			records = append(records, line)
+		}
+	}
+	r.Records = records
+
+	variables := make([]TemplateVariable, 0, len(r.Variables))
+	for _, v := range r.Variables {
+		v.Name = strings.TrimSpace(v.Name)
+		v.Label = strings.TrimSpace(v.Label)
+		v.Default = strings.TrimSpace(v.Default)
+		v.Description = strings.TrimSpace(v.Description)
+		if v.Name != "" {
+			variables = append(variables, v)
+		}
+	}
+	r.Variables = variables
+}
+
+// ValidateTemplateRecords checks the variables, blocks and record lines of a template as
+// if it were applied to an empty zone, returning errors and warnings with their line number.
+// Lines using variables without a default are only checked for their format, and records
+// inside optional blocks are not checked against each other since the blocks may exclude
+// one another.
+func ValidateTemplateRecords(records []string, variables []TemplateVariable) ([]string, []string) {
+	errors := validateVariables(variables)
+	warnings := []string{}
+
+	lines, err := parseTemplateLines(records)
+	if err != nil {
+		return append(errors, err.Error()), warnings
+	}
+
+	// Preview values: computed values for the preview zone and the declared defaults
+	values := computedValues(templatePreviewZone)
+	declared := map[string]bool{}
+	for _, v := range variables {
+		declared[v.Name] = true
+		if v.Default != "" {
+			values[v.Name] = v.Default
+		}
+	}
+
+	accepted := []validator.Record{}
+	for _, tl := range lines {
+		prefix := fmt.Sprintf("Line %d", tl.Number)
+
+		resolved := true
+		undeclared := false
+		for _, name := range tl.Variables() {
+			if !declared[name] && !isComputedVariable(name) {
+				errors = append(errors, fmt.Sprintf("%s: variable %s is not declared", prefix, name))
+				undeclared = true
+			}
+			if _, ok := values[name]; !ok {
+				resolved = false
+			}
+		}
+		if undeclared {
+			continue
+		}
+
+		if !resolved {
+			if _, err := ParseRecordLine(tl.Text); err != nil && !placeholderPattern.MatchString(strings.Split(tl.Text, "|")[0]) {
+				errors = append(errors, fmt.Sprintf("%s: %s", prefix, err.Error()))
+			}
+			continue
+		}
+
+		line, err := ParseRecordLine(substituteVariables(tl.Text, values))
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %s", prefix, err.Error()))
+			continue
+		}
+
+		recordName, err := QualifyName(line.Name, templatePreviewZone)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %s", prefix, err.Error()))
+			continue
+		}
+		recordContent, err := qualifyContent(line.Type, line.Content, templatePreviewZone)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %s", prefix, err.Error()))
+			continue
+		}
+		if _, err := buildTypedRecord(line.Type, recordName, recordContent, nil, nil); err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %s", prefix, err.Error()))
+			continue
+		}
+		proxied, err := builtinProxyPolicy.Resolve(nil, templatePreviewZone, line.Type, recordName, recordContent, line.Proxied)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %s", prefix, err.Error()))
+			continue
+		}
+
+		candidate := validator.Record{Type: line.Type, Name: recordName, Content: recordContent, Proxied: proxied}
+		result := validator.Validate(templatePreviewZone, candidate, accepted)
+		if !result.Valid() {
+			errors = append(errors, fmt.Sprintf("%s: %s", prefix, result.Messages()))
+			continue
+		}
+		for _, warning := range result.WarningMessages() {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", prefix, warning))
+		}
+		if !tl.Conditional() {
+			accepted = append(accepted, candidate)
+		}
+	}
+
+	return errors, warnings
+}
+
+// parseTemplateRequest parses and validates a template body, writing the error response
+// itself when the template is rejected
+func parseTemplateRequest(c *fiber.Ctx) (*TemplateRequest, []string, error) {
+	req := new(TemplateRequest)
+	if err := c.BodyParser(req); err != nil {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid request format",
+			"error":   err.Error(),
+		})
+	}
+	req.normalize()
+
+	if req.Name == "" || len(req.Records) == 0 {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Template name and at least one record are required",
+		})
+	}
+
+	errors, warnings := ValidateTemplateRecords(req.Records, req.Variables)
+	if len(errors) > 0 {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Template contains invalid records",
+			"errors":  errors,
+		})
+	}
+	return req, warnings, nil
+}
+
+// ListTemplatesHandler returns the template library
+func ListTemplatesHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := SessionEmail(c, store); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    templates.List(),
+		})
+	}
+}
+
+// GetTemplateHandler returns a single template
+func GetTemplateHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := SessionEmail(c, store); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		t, ok := templates.Get(c.Params("id"))
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Template not found",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    t,
+		})
+	}
+}
+
+// CreateTemplateHandler validates and stores a new template
+func CreateTemplateHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		actor, err := SessionEmail(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req, warnings, err := parseTemplateRequest(c)
+		if req == nil {
+			return err
+		}
+
+		t, err := templates.Create(DNSTemplate{Name: req.Name, Description: req.Description, Records: req.Records, Variables: req.Variables}, actor, req.Note)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to save template",
+				"error":   err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"success":  true,
+			"message":  fmt.Sprintf("Template %s created", t.Name),
+			"data":     t,
+			"warnings": warnings,
+		})
+	}
+}
+
+// UpdateTemplateHandler validates and replaces an existing template
+func UpdateTemplateHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		actor, err := SessionEmail(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req, warnings, err := parseTemplateRequest(c)
+		if req == nil {
+			return err
+		}
+
+		t, err := templates.Update(c.Params("id"), DNSTemplate{Name: req.Name, Description: req.Description, Records: req.Records, Variables: req.Variables}, actor, req.Note)
+		if err != nil {
+			return templateStoreError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"success":  true,
+			"message":  fmt.Sprintf("Template %s updated", t.Name),
+			"data":     t,
+			"warnings": warnings,
+		})
+	}
+}
+
+// DeleteTemplateHandler removes a template from the library
+func DeleteTemplateHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := SessionEmail(c, store); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		if err := templates.Delete(c.Params("id")); err != nil {
+			return templateStoreError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": "Template deleted",
+		})
+	}
+}
+
+// RenderTemplateRequest is the body for previewing a template for a zone
+type RenderTemplateRequest struct {
+	Zone      string            `json:"zone"`
+	Variables map[string]string `json:"variables"`
+}
+
+// RenderTemplateHandler returns the record lines a template produces for a zone with the
+// given variable values, used to fill the DNS editor and to preview a template
+func RenderTemplateHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := SessionEmail(c, store); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		t, ok := templates.Get(c.Params("id"))
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Template not found",
+			})
+		}
+
+		req := new(RenderTemplateRequest)
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request format",
+				"error":   err.Error(),
+			})
+		}
+
+		zone := templatePreviewZone
+		if strings.TrimSpace(req.Zone) != "" {
+			normalized, err := NormalizeZone(req.Zone)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": err.Error(),
+				})
+			}
+			zone = normalized
+		}
+
+		records, err := RenderTemplate(t, zone, req.Variables)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to render template",
+				"error":   err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    records,
+		})
+	}
+}
+
+// ApplyTemplateRequest is the body for applying a template to existing zones
+type ApplyTemplateRequest struct {
+	Domains   string            `json:"domains"`   // Newline-separated domain names
+	Variables map[string]string `json:"variables"` // Values for the template variables
+	Mode      string            `json:"mode"`      // skip (default), overwrite or fail
+	DryRun    bool              `json:"dryRun"`    // Report the changes without making them
+}
+
+// ApplyTemplateHandler applies a template to one or many existing zones, resolving records
+// that already exist according to the conflict mode and reporting the changes per zone
+func ApplyTemplateHandler(store *session.Store, templates *TemplateStore, policy *ProxyPolicy, audit *AuditLog, snapshots *SnapshotStore, cache *SearchCache) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		t, ok := templates.Get(c.Params("id"))
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Template not found",
+			})
+		}
+
+		req := new(ApplyTemplateRequest)
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request format",
+				"error":   err.Error(),
+			})
+		}
+		if req.Mode == "" {
+			req.Mode = ConflictSkip
+		}
+		if !isValidConflictMode(req.Mode) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": fmt.Sprintf("Invalid conflict mode %q, expected skip, overwrite or fail", req.Mode),
+			})
+		}
+		if _, err := resolveVariables(t.Variables, templatePreviewZone, req.Variables); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid template variables",
+				"error":   err.Error(),
+			})
+		}
+
+		domains, invalid := parseDomainsList(req.Domains)
+		if len(domains) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "No valid domains provided",
+				"results": invalid,
+			})
+		}
+
+		results := make([]ZoneApplyResult, 0, len(domains)+len(invalid))
+		for _, r := range invalid {
+			results = append(results, ZoneApplyResult{Domain: r.Domain, Message: r.Message, Error: r.Error, Changes: []RecordChange{}})
+		}
+
+		actor, _ := SessionEmail(c, store)
+		ac := newAuditContext(c, store, audit, true)
+		successCount := 0
+		for _, domain := range domains {
+			result := applyTemplateToDomain(api, policy, snapshots, ac, t, domain, req, "Before applying template "+t.Name)
+			ac.recordApply(result, AuditTemplateApply, fmt.Sprintf("Template %s (%s mode)", t.Name, req.Mode))
+			if !req.DryRun {
+				cache.Invalidate(result.ZoneID)
+			}
+			results = append(results, result)
+			if result.Success {
+				successCount++
+			}
+
+			// Applied zones are checked against the template by the compliance report
+			if result.Success && !req.DryRun {
+				if err := templates.Assign(domain, t.ID, req.Variables, actor); err != nil {
+					result.Message += fmt.Sprintf(" (failed to record template assignment: %s)", err.Error())
+					results[len(results)-1] = result
+				}
+			}
+		}
+
+		verb := "Applied"
+		if req.DryRun {
+			verb = "Previewed"
+		}
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": fmt.Sprintf("%s template %s on %d out of %d domains", verb, t.Name, successCount, len(results)),
+			"results": results,
+		})
+	}
+}
+
+// applyTemplateToDomain renders a template for an existing zone and applies it, taking a
+// snapshot for reason before records are changed
+func applyTemplateToDomain(api *cloudflare.API, policy *ProxyPolicy, snapshots *SnapshotStore, ac *auditContext, t DNSTemplate, domain string, req *ApplyTemplateRequest, reason string) ZoneApplyResult {
+	failed := func(message string, err error) ZoneApplyResult {
+		result := ZoneApplyResult{Domain: domain, DryRun: req.DryRun, Error: err.Error(), Changes: []RecordChange{}}
+		result.Message = fmt.Sprintf("%s: %s", message, err.Error())
+		if unicode := DisplayName(domain); unicode != domain {
+			result.UnicodeName = unicode
+		}
+		return result
+	}
+
+	zoneID, err := api.ZoneIDByName(domain)
+	if err != nil {
+		return failed("Domain not found", err)
+	}
+
+	records, err := RenderTemplate(t, domain, req.Variables)
+	if err != nil {
+		return failed("Failed to render template", err)
+	}
+
+	return ApplyRecordsToZone(api, policy, snapshots, ac, zoneID, domain, records, req.Mode, req.DryRun, reason)
+}
+
+// templateStoreError writes the response for a failed template store operation
+func templateStoreError(c *fiber.Ctx, err error) error {
+	if fe, ok := err.(*fiber.Error); ok {
+		return c.Status(fe.Code).JSON(fiber.Map{
+			"success": false,
+			"message": fe.Message,
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"message": "Failed to save template",
+		"error":   err.Error(),
+	})
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Template records may reference variables as {{name}} and wrap lines in optional blocks:
+//
+//	A|@|{{origin_ip}}|true
+//	{{#if mail_provider=google}}
+//	MX|@|1 smtp.google.com|false
+//	{{/if}}
+//	{{#if verification}}
+//	TXT|@|{{verification}}|false
+//	{{/if}}
+//
+// A block condition is a variable name (enabled when the value is set and not false/0/no),
+// !name, name=value or name!=value. Blocks may be nested and may contain an {{else}} line.
+
+// TemplateVariable is a value prompted for when a template is applied
+type TemplateVariable struct {
+	Name        string `json:"name" yaml:"name"`
+	Label       string `json:"label,omitempty" yaml:"label,omitempty"`
+	Default     string `json:"default,omitempty" yaml:"default,omitempty"`
+	Required    bool   `json:"required,omitempty" yaml:"required,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// Computed template variables, filled in from the zone a template is applied to
+const (
+	VarZone        = "zone"         // ASCII zone name, e.g. xn--bcher-kva.de
+	VarZoneUnicode = "zone_unicode" // Unicode zone name, e.g. bücher.de
+	VarZoneLabel   = "zone_label"   // First label of the zone, e.g. bücher
+)
+
+// ComputedVariables lists the variables that templates can use without declaring them
+var ComputedVariables = []string{VarZone, VarZoneUnicode, VarZoneLabel}
+
+var (
+	variableNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+	placeholderPattern  = regexp.MustCompile(`\{\{\s*([a-zA-Z0-9_]+)\s*\}\}`)
+	blockStartPattern   = regexp.MustCompile(`^\{\{\s*#if\s+(.+?)\s*\}\}$`)
+	blockElsePattern    = regexp.MustCompile(`^\{\{\s*else\s*\}\}$`)
+	blockEndPattern     = regexp.MustCompile(`^\{\{\s*/if\s*\}\}$`)
+)
+
+// templateCondition is the condition of an optional block
+type templateCondition struct {
+	Variable string
+	Operator string // "" (set), "!" (not set), "=" or "!="
+	Value    string
+	Negated  bool // true inside the {{else}} part of the block
+}
+
+// templateLine is a record line of a template with the block conditions enclosing it
+type templateLine struct {
+	Number     int
+	Text       string
+	Conditions []templateCondition
+}
+
+// Conditional reports whether the line is inside an optional block
+func (l templateLine) Conditional() bool {
+	return len(l.Conditions) > 0
+}
+
+// Variables returns the names of the variables referenced by the line
+func (l templateLine) Variables() []string {
+	names := []string{}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(l.Text, -1) {
+		names = append(names, match[1])
+	}
+	for _, condition := range l.Conditions {
+		names = append(names, condition.Variable)
+	}
+	return names
+}
+
+// parseTemplateLines splits template records into record lines and checks that the optional
+// blocks are balanced
+func parseTemplateLines(records []string) ([]templateLine, error) {
+	lines := []templateLine{}
+	stack := []templateCondition{}
+	elseSeen := []bool{}
+
+	for i, text := range records {
+		text = strings.TrimSpace(text)
+		number := i + 1
+
+		switch {
+		case text == "":
+			continue
+
+		case blockStartPattern.MatchString(text):
+			condition, err := parseCondition(blockStartPattern.FindStringSubmatch(text)[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", number, err.Error())
+			}
+			stack = append(stack, condition)
+			elseSeen = append(elseSeen, false)
+
+		case blockElsePattern.MatchString(text):
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: {{else}} without {{#if}}", number)
+			}
+			if elseSeen[len(elseSeen)-1] {
+				return nil, fmt.Errorf("line %d: block already has an {{else}}", number)
+			}
+			stack[len(stack)-1].Negated = true
+			elseSeen[len(elseSeen)-1] = true
+
+		case blockEndPattern.MatchString(text):
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: {{/if}} without {{#if}}", number)
+			}
+			stack = stack[:len(stack)-1]
+			elseSeen = elseSeen[:len(elseSeen)-1]
+
+		case strings.HasPrefix(text, "{{#") || strings.HasPrefix(text, "{{/"):
+			return nil, fmt.Errorf("line %d: unknown block %s, expected {{#if ...}}, {{else}} or {{/if}}", number, text)
+
+		default:
+			conditions := make([]templateCondition, len(stack))
+			copy(conditions, stack)
+			lines = append(lines, templateLine{Number: number, Text: text, Conditions: conditions})
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("%d {{#if}} block(s) not closed with {{/if}}", len(stack))
+	}
+	return lines, nil
+}
+
+// parseCondition parses the expression of an {{#if ...}} line
+func parseCondition(expr string) (templateCondition, error) {
+	var condition templateCondition
+
+	switch {
+	case strings.Contains(expr, "!="):
+		parts := strings.SplitN(expr, "!=", 2)
+		condition = templateCondition{Variable: parts[0], Operator: "!=", Value: parts[1]}
+	case strings.Contains(expr, "="):
+		parts := strings.SplitN(expr, "=", 2)
+		condition = templateCondition{Variable: parts[0], Operator: "=", Value: parts[1]}
+	case strings.HasPrefix(expr, "!"):
+		condition = templateCondition{Variable: expr[1:], Operator: "!"}
+	default:
+		condition = templateCondition{Variable: expr}
+	}
+
+	condition.Variable = strings.TrimSpace(condition.Variable)
+	condition.Value = strings.TrimSpace(condition.Value)
+	if !variableNamePattern.MatchString(condition.Variable) {
+		return templateCondition{}, fmt.Errorf("invalid condition %q", expr)
+	}
+	return condition, nil
+}
+
+// enabled reports whether the condition holds for the given values
+func (c templateCondition) enabled(values map[string]string) bool {
+	value := values[c.Variable]
+
+	var result bool
+	switch c.Operator {
+	case "=":
+		result = strings.EqualFold(value, c.Value)
+	case "!=":
+		result = !strings.EqualFold(value, c.Value)
+	case "!":
+		result = !isTruthy(value)
+	default:
+		result = isTruthy(value)
+	}
+
+	if c.Negated {
+		return !result
+	}
+	return result
+}
+
+// isTruthy reports whether a variable value enables a block
+func isTruthy(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "0", "no", "off":
+		return false
+	}
+	return true
+}
+
+// validateVariables checks the variable declarations of a template
+func validateVariables(variables []TemplateVariable) []string {
+	errors := []string{}
+	seen := map[string]bool{}
+
+	for _, v := range variables {
+		switch {
+		case !variableNamePattern.MatchString(v.Name):
+			errors = append(errors, fmt.Sprintf("Variable %q: names may only contain lower case letters, digits and underscores", v.Name))
+		case isComputedVariable(v.Name):
+			errors = append(errors, fmt.Sprintf("Variable %q: the name is reserved for a computed value", v.Name))
+		case seen[v.Name]:
+			errors = append(errors, fmt.Sprintf("Variable %q is declared more than once", v.Name))
+		case strings.ContainsAny(v.Default, "|\n"):
+			errors = append(errors, fmt.Sprintf("Variable %q: default value may not contain | or line breaks", v.Name))
+		}
+		seen[v.Name] = true
+	}
+	return errors
+}
+
+// isComputedVariable reports whether the name is one of the computed variables
+func isComputedVariable(name string) bool {
+	for _, computed := range ComputedVariables {
+		if name == computed {
+			return true
+		}
+	}
+	return false
+}
+
+// computedValues returns the computed variables for a zone
+func computedValues(zone string) map[string]string {
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+	unicode := DisplayName(zone)
+	return map[string]string{
+		VarZone:        zone,
+		VarZoneUnicode: unicode,
+		VarZoneLabel:   strings.SplitN(unicode, ".", 2)[0],
+	}
+}
+
+// resolveVariables merges computed values, defaults and supplied values for a zone,
+// rejecting values for unknown variables and missing required values
+func resolveVariables(variables []TemplateVariable, zone string, supplied map[string]string) (map[string]string, error) {
+	values := computedValues(zone)
+	declared := map[string]bool{}
+
+	for _, v := range variables {
+		declared[v.Name] = true
+		value, ok := supplied[v.Name]
+		value = strings.TrimSpace(value)
+		if !ok || value == "" {
+			value = v.Default
+		}
+		if strings.ContainsAny(value, "|\n") {
+			return nil, fmt.Errorf("value for %s may not contain | or line breaks", v.Name)
+		}
+		if v.Required && value == "" {
+			return nil, fmt.Errorf("a value is required for %s", variableLabel(v))
+		}
+		values[v.Name] = value
+	}
+
+	for name := range supplied {
+		if !declared[name] && !isComputedVariable(name) {
+			return nil, fmt.Errorf("unknown template variable %s", name)
+		}
+	}
+	return values, nil
+}
+
+// variableLabel returns the label shown for a variable, falling back to its name
+func variableLabel(v TemplateVariable) string {
+	if v.Label != "" {
+		return v.Label
+	}
+	return v.Name
+}
+
+// substituteVariables replaces {{name}} placeholders with their values
+func substituteVariables(text string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		return values[placeholderPattern.FindStringSubmatch(placeholder)[1]]
+	})
+}
+
+// RenderTemplate produces the record lines of a template for a zone: variables are resolved
+// from the supplied values, defaults and computed values, and disabled blocks are dropped
+func RenderTemplate(t DNSTemplate, zone string, supplied map[string]string) ([]string, error) {
+	lines, err := parseTemplateLines(t.Records)
+	if err != nil {
+		return nil, err
+	}
+	values, err := resolveVariables(t.Variables, zone, supplied)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []string{}
+	for _, line := range lines {
+		enabled := true
+		for _, condition := range line.Conditions {
+			if !condition.enabled(values) {
+				enabled = false
+				break
+			}
+		}
+		if enabled {
+			records = append(records, substituteVariables(line.Text, values))
+		}
+	}
+	return records, nil
+}
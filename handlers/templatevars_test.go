@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	mail := DNSTemplate{
+		Records: []string{
+			"A|@|{{ip}}|true",
+			"{{#if mail_provider=google}}",
+			"MX|@|1 smtp.google.com|false",
+			"{{else}}",
+			"{{#if mail_provider}}",
+			"MX|@|10 mx.{{mail_provider}}.net|false",
+			"{{/if}}",
+			"{{/if}}",
+			"{{#if verification}}",
+			"TXT|@|{{verification}}|false",
+			"{{/if}}",
+			"{{#if !staging}}",
+			"CNAME|www|@|true",
+			"{{/if}}",
+			"TXT|_label|{{zone_label}} {{ zone }}|false",
+		},
+		Variables: []TemplateVariable{
+			{Name: "ip", Required: true},
+			{Name: "mail_provider"},
+			{Name: "verification"},
+			{Name: "staging", Default: "no"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template DNSTemplate
+		zone     string
+		values   map[string]string
+		want     []string
+		err      string
+	}{
+		{
+			name:     "blocks off",
+			template: mail,
+			zone:     "example.com",
+			values:   map[string]string{"ip": "203.0.113.10"},
+			want:     []string{"A|@|203.0.113.10|true", "CNAME|www|@|true", "TXT|_label|example example.com|false"},
+		},
+		{
+			name:     "equality block",
+			template: mail,
+			zone:     "example.com",
+			values:   map[string]string{"ip": "203.0.113.10", "mail_provider": "Google", "staging": "true"},
+			want:     []string{"A|@|203.0.113.10|true", "MX|@|1 smtp.google.com|false", "TXT|_label|example example.com|false"},
+		},
+		{
+			name:     "nested block in else",
+			template: mail,
+			zone:     "xn--bcher-kva.de",
+			values:   map[string]string{"ip": "203.0.113.10", "mail_provider": "fastmail", "verification": "token=abc"},
+			want: []string{
+				"A|@|203.0.113.10|true", "MX|@|10 mx.fastmail.net|false", "TXT|@|token=abc|false",
+				"CNAME|www|@|true", "TXT|_label|bücher xn--bcher-kva.de|false",
+			},
+		},
+		{
+			name:     "not equal",
+			template: DNSTemplate{Records: []string{"{{#if env!=prod}}", "TXT|@|test|false", "{{/if}}"}, Variables: []TemplateVariable{{Name: "env"}}},
+			zone:     "example.com",
+			values:   map[string]string{"env": "PROD"},
+			want:     []string{},
+		},
+		{
+			name:     "missing required value",
+			template: mail,
+			zone:     "example.com",
+			values:   map[string]string{},
+			err:      "a value is required for ip",
+		},
+		{
+			name:     "unknown variable",
+			template: mail,
+			zone:     "example.com",
+			values:   map[string]string{"ip": "203.0.113.10", "region": "eu"},
+			err:      "unknown template variable region",
+		},
+		{
+			name:     "value with separator",
+			template: mail,
+			zone:     "example.com",
+			values:   map[string]string{"ip": "203.0.113.10|false"},
+			err:      "may not contain |",
+		},
+		{
+			name:     "unclosed block",
+			template: DNSTemplate{Records: []string{"{{#if a}}", "TXT|@|x|false"}},
+			zone:     "example.com",
+			err:      "not closed",
+		},
+		{
+			name:     "else without if",
+			template: DNSTemplate{Records: []string{"{{else}}"}},
+			zone:     "example.com",
+			err:      "{{else}} without {{#if}}",
+		},
+		{
+			name:     "second else",
+			template: DNSTemplate{Records: []string{"{{#if a}}", "{{else}}", "{{else}}", "{{/if}}"}},
+			zone:     "example.com",
+			err:      "already has an {{else}}",
+		},
+		{
+			name:     "unknown block",
+			template: DNSTemplate{Records: []string{"{{#each a}}"}},
+			zone:     "example.com",
+			err:      "unknown block",
+		},
+		{
+			name:     "invalid condition",
+			template: DNSTemplate{Records: []string{"{{#if Bad-Name}}", "{{/if}}"}},
+			zone:     "example.com",
+			err:      "invalid condition",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderTemplate(tt.template, tt.zone, tt.values)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("records = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
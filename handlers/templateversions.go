@@ -0,0 +1,609 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateVersion is a saved revision of a template
+type TemplateVersion struct {
+	Version     int                `json:"version"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Records     []string           `json:"records"`
+	Variables   []TemplateVariable `json:"variables"`
+	Author      string             `json:"author"`
+	Timestamp   time.Time          `json:"timestamp"`
+	Note        string             `json:"note,omitempty"`
+}
+
+// newTemplateVersion records the current content of a template as a version
+func newTemplateVersion(t DNSTemplate, author string, timestamp time.Time, note string) TemplateVersion {
+	return TemplateVersion{
+		Version:     t.Version,
+		Name:        t.Name,
+		Description: t.Description,
+		Records:     append([]string{}, t.Records...),
+		Variables:   append([]TemplateVariable{}, t.Variables...),
+		Author:      author,
+		Timestamp:   timestamp,
+		Note:        note,
+	}
+}
+
+// Versions returns the history of a template, newest first
+func (s *TemplateStore) Versions(id string) ([]TemplateVersion, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.templates[id]; !ok {
+		return nil, false
+	}
+	history := s.versions[id]
+	versions := make([]TemplateVersion, len(history))
+	for i, v := range history {
+		versions[len(history)-1-i] = v
+	}
+	return versions, true
+}
+
+// Version returns a single version of a template
+func (s *TemplateStore) Version(id string, version int) (TemplateVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.templates[id]; !ok {
+		return TemplateVersion{}, fiber.NewError(fiber.StatusNotFound, "Template not found")
+	}
+	for _, v := range s.versions[id] {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+	return TemplateVersion{}, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("Version %d not found", version))
+}
+
+// Diff operations
+const (
+	DiffEqual   = "equal"
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// DiffLine is a record line in a diff between two template versions
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// VariableDiff is a variable added, removed or changed between two template versions
+type VariableDiff struct {
+	Op   string            `json:"op"`
+	Name string            `json:"name"`
+	From *TemplateVariable `json:"from,omitempty"`
+	To   *TemplateVariable `json:"to,omitempty"`
+}
+
+// TemplateDiff compares two versions of a template
+type TemplateDiff struct {
+	From               int            `json:"from"`
+	To                 int            `json:"to"`
+	NameChanged        bool           `json:"name_changed"`
+	DescriptionChanged bool           `json:"description_changed"`
+	Records            []DiffLine     `json:"records"`
+	Variables          []VariableDiff `json:"variables"`
+	Added              int            `json:"added"`
+	Removed            int            `json:"removed"`
+}
+
+// DiffTemplateVersions returns the changes from one template version to another
+func DiffTemplateVersions(from, to TemplateVersion) TemplateDiff {
+	diff := TemplateDiff{
+		From:               from.Version,
+		To:                 to.Version,
+		NameChanged:        from.Name != to.Name,
+		DescriptionChanged: from.Description != to.Description,
+		Records:            diffLines(from.Records, to.Records),
+		Variables:          diffVariables(from.Variables, to.Variables),
+	}
+	for _, line := range diff.Records {
+		switch line.Op {
+		case DiffAdded:
+			diff.Added++
+		case DiffRemoved:
+			diff.Removed++
+		}
+	}
+	return diff
+}
+
+// diffLines computes a line diff from the longest common subsequence of a and b
+func diffLines(a, b []string) []DiffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := []DiffLine{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, DiffLine{Op: DiffEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, DiffLine{Op: DiffRemoved, Text: a[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: DiffAdded, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, DiffLine{Op: DiffRemoved, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, DiffLine{Op: DiffAdded, Text: b[j]})
+	}
+	return lines
+}
+
+// diffVariables compares variable declarations by name
+func diffVariables(a, b []TemplateVariable) []VariableDiff {
+	previous := map[string]TemplateVariable{}
+	for _, v := range a {
+		previous[v.Name] = v
+	}
+
+	diffs := []VariableDiff{}
+	current := map[string]bool{}
+	for _, v := range b {
+		to := v
+		current[v.Name] = true
+		from, ok := previous[v.Name]
+		switch {
+		case !ok:
+			diffs = append(diffs, VariableDiff{Op: DiffAdded, Name: v.Name, To: &to})
+		case from != v:
+			diffs = append(diffs, VariableDiff{Op: DiffChanged, Name: v.Name, From: &from, To: &to})
+		}
+	}
+	for _, v := range a {
+		if !current[v.Name] {
+			from := v
+			diffs = append(diffs, VariableDiff{Op: DiffRemoved, Name: v.Name, From: &from})
+		}
+	}
+	return diffs
+}
+
+// TemplateDocument is the portable form of a template used for export and import
+type TemplateDocument struct {
+	ID          string             `json:"id,omitempty" yaml:"id,omitempty"`
+	Name        string             `json:"name" yaml:"name"`
+	Description string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Records     []string           `json:"records" yaml:"records"`
+	Variables   []TemplateVariable `json:"variables,omitempty" yaml:"variables,omitempty"`
+}
+
+// TemplateExport is the file format for exported templates
+type TemplateExport struct {
+	ExportedAt time.Time          `json:"exported_at" yaml:"exported_at"`
+	Templates  []TemplateDocument `json:"templates" yaml:"templates"`
+}
+
+// Export formats
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// templateDocument returns the portable form of a template
+func templateDocument(t DNSTemplate) TemplateDocument {
+	return TemplateDocument{ID: t.ID, Name: t.Name, Description: t.Description, Records: t.Records, Variables: t.Variables}
+}
+
+// sendTemplateExport writes templates as a downloadable JSON or YAML file
+func sendTemplateExport(c *fiber.Ctx, filename string, templates []DNSTemplate) error {
+	format := strings.ToLower(c.Query("format", FormatJSON))
+	if format == "yml" {
+		format = FormatYAML
+	}
+	if format != FormatJSON && format != FormatYAML {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Unsupported format, expected json or yaml",
+		})
+	}
+
+	export := TemplateExport{ExportedAt: time.Now().UTC(), Templates: []TemplateDocument{}}
+	for _, t := range templates {
+		export.Templates = append(export.Templates, templateDocument(t))
+	}
+
+	var body []byte
+	var err error
+	if format == FormatYAML {
+		body, err = yaml.Marshal(export)
+		c.Set(fiber.HeaderContentType, "application/yaml")
+	} else {
+		body, err = json.MarshalIndent(export, "", "  ")
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to export templates",
+			"error":   err.Error(),
+		})
+	}
+
+	c.Attachment(filename + "." + format)
+	return c.Send(body)
+}
+
+// parseTemplateImport reads templates from a JSON or YAML body, accepting an export file,
+// a list of templates or a single template
+func parseTemplateImport(body []byte) ([]TemplateDocument, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, fmt.Errorf("the import is empty")
+	}
+
+	// YAML is a superset of JSON, so a single decoder handles both formats
+	var export TemplateExport
+	if err := yaml.Unmarshal(body, &export); err == nil && len(export.Templates) > 0 {
+		return export.Templates, nil
+	}
+	var list []TemplateDocument
+	if err := yaml.Unmarshal(body, &list); err == nil && len(list) > 0 {
+		return list, nil
+	}
+	var single TemplateDocument
+	if err := yaml.Unmarshal(body, &single); err != nil {
+		return nil, fmt.Errorf("the import is not valid JSON or YAML: %w", err)
+	}
+	if single.Name == "" && len(single.Records) == 0 {
+		return nil, fmt.Errorf("the import does not contain any templates")
+	}
+	return []TemplateDocument{single}, nil
+}
+
+// TemplateImportResult reports what happened to one imported template
+type TemplateImportResult struct {
+	Name     string   `json:"name"`
+	ID       string   `json:"id,omitempty"`
+	Action   string   `json:"action"` // create, update, unchanged or invalid
+	Version  int      `json:"version,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// importTemplate validates a template document and stores it, updating the template with the
+// same ID or name when there is one. Unchanged templates do not get a new version.
+func (s *TemplateStore) importTemplate(doc TemplateDocument, actor string) TemplateImportResult {
+	req := TemplateRequest{Name: doc.Name, Description: doc.Description, Records: doc.Records, Variables: doc.Variables}
+	req.normalize()
+	result := TemplateImportResult{Name: req.Name}
+
+	if req.Name == "" || len(req.Records) == 0 {
+		result.Action = ActionInvalid
+		result.Errors = []string{"Template name and at least one record are required"}
+		return result
+	}
+	errors, warnings := ValidateTemplateRecords(req.Records, req.Variables)
+	result.Warnings = warnings
+	if len(errors) > 0 {
+		result.Action = ActionInvalid
+		result.Errors = errors
+		return result
+	}
+
+	existing, found := s.Get(strings.TrimSpace(doc.ID))
+	if !found {
+		for _, t := range s.List() {
+			if strings.EqualFold(t.Name, req.Name) {
+				existing, found = t, true
+				break
+			}
+		}
+	}
+
+	candidate := DNSTemplate{ID: strings.TrimSpace(doc.ID), Name: req.Name, Description: req.Description, Records: req.Records, Variables: req.Variables}
+	var saved DNSTemplate
+	var err error
+	switch {
+	case !found:
+		result.Action = ActionCreate
+		saved, err = s.Create(candidate, actor, "Imported")
+	case existing.Name == candidate.Name && existing.Description == candidate.Description &&
+		reflect.DeepEqual(existing.Records, candidate.Records) && sameVariables(existing.Variables, candidate.Variables):
+		result.Action = ActionUnchanged
+		saved = existing
+	default:
+		result.Action = ActionUpdate
+		saved, err = s.Update(existing.ID, candidate, actor, "Imported")
+	}
+	if err != nil {
+		result.Action = ActionInvalid
+		result.Errors = []string{err.Error()}
+		return result
+	}
+
+	result.ID, result.Version = saved.ID, saved.Version
+	return result
+}
+
+// sameVariables reports whether two variable lists are identical
+func sameVariables(a, b []TemplateVariable) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// templateVersionParam parses a version number from the request
+func templateVersionParam(value string) (int, error) {
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid version %q", value))
+	}
+	return version, nil
+}
+
+// TemplateVersionsHandler returns the history of a template, newest first
+func TemplateVersionsHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := SessionEmail(c, store); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		versions, ok := templates.Versions(c.Params("id"))
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Template not found",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    versions,
+		})
+	}
+}
+
+// TemplateVersionHandler returns a single version of a template
+func TemplateVersionHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := SessionEmail(c, store); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		number, err := templateVersionParam(c.Params("version"))
+		if err != nil {
+			return templateStoreError(c, err)
+		}
+		version, err := templates.Version(c.Params("id"), number)
+		if err != nil {
+			return templateStoreError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    version,
+		})
+	}
+}
+
+// TemplateDiffHandler compares two versions of a template. The from version defaults to the
+// one before to, and to defaults to the current version.
+func TemplateDiffHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := SessionEmail(c, store); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		t, ok := templates.Get(c.Params("id"))
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Template not found",
+			})
+		}
+
+		to := t.Version
+		if value := c.Query("to"); value != "" {
+			number, err := templateVersionParam(value)
+			if err != nil {
+				return templateStoreError(c, err)
+			}
+			to = number
+		}
+		from := max(to-1, 1)
+		if value := c.Query("from"); value != "" {
+			number, err := templateVersionParam(value)
+			if err != nil {
+				return templateStoreError(c, err)
+			}
+			from = number
+		}
+
+		fromVersion, err := templates.Version(t.ID, from)
+		if err != nil {
+			return templateStoreError(c, err)
+		}
+		toVersion, err := templates.Version(t.ID, to)
+		if err != nil {
+			return templateStoreError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    DiffTemplateVersions(fromVersion, toVersion),
+		})
+	}
+}
+
+// RevertTemplateRequest is the body for reverting a template
+type RevertTemplateRequest struct {
+	Version int `json:"version"`
+}
+
+// RevertTemplateHandler restores an earlier version of a template. The restored content is
+// saved as a new version so the history is never rewritten.
+func RevertTemplateHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		actor, err := SessionEmail(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req := new(RevertTemplateRequest)
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request format",
+				"error":   err.Error(),
+			})
+		}
+
+		version, err := templates.Version(c.Params("id"), req.Version)
+		if err != nil {
+			return templateStoreError(c, err)
+		}
+
+		restored := DNSTemplate{Name: version.Name, Description: version.Description, Records: version.Records, Variables: version.Variables}
+		t, err := templates.Update(c.Params("id"), restored, actor, fmt.Sprintf("Reverted to version %d", version.Version))
+		if err != nil {
+			return templateStoreError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": fmt.Sprintf("Template %s reverted to version %d", t.Name, version.Version),
+			"data":    t,
+		})
+	}
+}
+
+// ExportTemplatesHandler downloads the whole template library as JSON or YAML
+func ExportTemplatesHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := SessionEmail(c, store); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		return sendTemplateExport(c, "dns-templates", templates.List())
+	}
+}
+
+// ExportTemplateHandler downloads a single template as JSON or YAML
+func ExportTemplateHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := SessionEmail(c, store); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		t, ok := templates.Get(c.Params("id"))
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Template not found",
+			})
+		}
+
+		return sendTemplateExport(c, "dns-template-"+t.ID, []DNSTemplate{t})
+	}
+}
+
+// ImportTemplatesHandler stores templates from a JSON or YAML export. Each template is
+// validated on its own, so invalid templates do not block the rest of the import.
+func ImportTemplatesHandler(store *session.Store, templates *TemplateStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		actor, err := SessionEmail(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		docs, err := parseTemplateImport(c.Body())
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid template import",
+				"error":   err.Error(),
+			})
+		}
+
+		results := make([]TemplateImportResult, 0, len(docs))
+		imported, failed := 0, 0
+		for _, doc := range docs {
+			result := templates.importTemplate(doc, actor)
+			if result.Action == ActionInvalid {
+				failed++
+			} else {
+				imported++
+			}
+			results = append(results, result)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": failed == 0,
+			"message": fmt.Sprintf("Imported %d template(s), %d failed", imported, failed),
+			"data":    results,
+		})
+	}
+}
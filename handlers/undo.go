@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+// DefaultUndoWindow is how long deleted records can be restored when UNDO_WINDOW is not set
+const DefaultUndoWindow = 30 * time.Minute
+
+// UndoWindowFromEnv reads the undo window from UNDO_WINDOW, such as 30m or 24h
+func UndoWindowFromEnv() (time.Duration, error) {
+	value := os.Getenv("UNDO_WINDOW")
+	if value == "" {
+		return DefaultUndoWindow, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window < time.Minute {
+		return 0, fmt.Errorf("invalid UNDO_WINDOW %q: use a duration of at least 1m such as 30m", value)
+	}
+	return window, nil
+}
+
+// DeletedBatch is a set of records removed by one delete or bulk delete
+type DeletedBatch struct {
+	ID        string           `json:"id"`
+	Zone      string           `json:"zone"`
+	ZoneID    string           `json:"zone_id"`
+	DeletedBy string           `json:"deleted_by"`
+	DeletedAt time.Time        `json:"deleted_at"`
+	ExpiresAt time.Time        `json:"expires_at"`
+	Records   []SnapshotRecord `json:"records"`
+}
+
+// UndoStore keeps deleted records in undo.json in the data directory until the undo
+// window has passed, so a delete can be reverted by recreating them
+type UndoStore struct {
+	mu      sync.Mutex
+	path    string
+	window  time.Duration
+	batches []DeletedBatch
+}
+
+// NewUndoStore loads the deleted records from dataDir
+func NewUndoStore(dataDir string, window time.Duration) (*UndoStore, error) {
+	if window <= 0 {
+		window = DefaultUndoWindow
+	}
+	s := &UndoStore{
+		path:    filepath.Join(dataDir, "undo.json"),
+		window:  window,
+		batches: []DeletedBatch{},
+	}
+	if err := readJSONFile(s.path, &s.batches); err != nil {
+		return nil, fmt.Errorf("failed to load deleted records %s: %w", s.path, err)
+	}
+	return s, nil
+}
+
+// expire drops batches past their undo window. The caller must hold the lock.
+func (s *UndoStore) expire(now time.Time) {
+	kept := s.batches[:0]
+	for _, batch := range s.batches {
+		if now.Before(batch.ExpiresAt) {
+			kept = append(kept, batch)
+		}
+	}
+	s.batches = kept
+}
+
+// Capture keeps records that were just deleted from a zone
+func (s *UndoStore) Capture(zone, zoneID, actor string, records []cloudflare.DNSRecord) (DeletedBatch, error) {
+	now := time.Now().UTC()
+	batch := DeletedBatch{
+		ID:        newID(),
+		Zone:      zone,
+		ZoneID:    zoneID,
+		DeletedBy: actor,
+		DeletedAt: now,
+		ExpiresAt: now.Add(s.window),
+		Records:   snapshotRecords(records),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(now)
+	s.batches = append(s.batches, batch)
+	if err := writeJSONFile(s.path, s.batches); err != nil {
+		s.batches = s.batches[:len(s.batches)-1]
+		return DeletedBatch{}, err
+	}
+	return batch, nil
+}
+
+// List returns the deletes of a zone that can still be undone, newest first
+func (s *UndoStore) List(zone, zoneID string) []DeletedBatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(time.Now())
+	list := []DeletedBatch{}
+	for _, batch := range s.batches {
+		if batch.Zone == zone && batch.ZoneID == zoneID {
+			list = append(list, batch)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].DeletedAt.After(list[j].DeletedAt)
+	})
+	return list
+}
+
+// Take removes a batch so it can be undone once. Records that could not be recreated are
+// handed back with Return.
+func (s *UndoStore) Take(zone, zoneID, id string) (DeletedBatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(time.Now())
+	for i, batch := range s.batches {
+		if batch.ID == id && batch.Zone == zone && batch.ZoneID == zoneID {
+			s.batches = append(s.batches[:i], s.batches[i+1:]...)
+			if err := writeJSONFile(s.path, s.batches); err != nil {
+				s.batches = append(s.batches, batch)
+				return DeletedBatch{}, err
+			}
+			return batch, nil
+		}
+	}
+	return DeletedBatch{}, fiber.NewError(fiber.StatusNotFound, "Deleted records not found or undo window expired")
+}
+
+// Return puts back the records of a batch that were not restored, keeping the original expiry
+func (s *UndoStore) Return(batch DeletedBatch) error {
+	if len(batch.Records) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = append(s.batches, batch)
+	return writeJSONFile(s.path, s.batches)
+}
+
+// captureDeleted keeps deleted records for undo and adds the undo ID and expiry to a delete
+// response. The records are already gone, so a failure is only logged.
+func captureDeleted(undo *UndoStore, zone, zoneID, actor string, deleted []cloudflare.DNSRecord, response fiber.Map) {
+	if len(deleted) == 0 {
+		return
+	}
+	batch, err := undo.Capture(zone, zoneID, actor, deleted)
+	if err != nil {
+		log.Printf("Failed to keep deleted records of %s for undo: %v", zone, err)
+		return
+	}
+	response["undo_id"] = batch.ID
+	response["undo_expires_at"] = batch.ExpiresAt
+}
+
+// UndoDelete recreates the records of a batch with their original type, name, content, TTL,
+// proxied state, comment and tags. The batch is returned with only the records that failed.
+func UndoDelete(api *cloudflare.API, batch DeletedBatch) ([]RecordChange, DeletedBatch) {
+	rc := cloudflare.ZoneIdentifier(batch.ZoneID)
+	changes := make([]RecordChange, 0, len(batch.Records))
+	failed := []SnapshotRecord{}
+
+	for _, record := range batch.Records {
+		change := RecordChange{Action: ActionCreate, Type: record.Type, Name: record.Name, Content: record.Content, Proxied: record.Proxied}
+
+		payload, err := buildTypedRecord(record.Type, record.Name, record.Content, nil, nil)
+		if err == nil {
+			payload.Comment = record.Comment
+			payload.Tags = record.Tags
+			payload.TTL = record.TTL
+
+			var created cloudflare.DNSRecord
+			created, err = api.CreateDNSRecord(context.Background(), rc, payload.createParams(record.Type, record.Name, proxiedFor(record.Type, record.Proxied)))
+			change.RecordID = created.ID
+		}
+
+		if err != nil {
+			change.Error = err.Error()
+			failed = append(failed, record)
+		} else {
+			change.Success = true
+		}
+		changes = append(changes, change)
+	}
+
+	batch.Records = failed
+	return changes, batch
+}
+
+// DeletedRecordsHandler returns the deletes of a zone that can still be undone
+func DeletedRecordsHandler(store *session.Store, undo *UndoStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		zone := auditZoneName(c.Params("domain"))
+		zoneID, err := zoneIDForCaller(api, zone)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    undo.List(zone, zoneID),
+		})
+	}
+}
+
+// UndoDeleteHandler recreates the records removed by a delete or bulk delete
+func UndoDeleteHandler(store *session.Store, undo *UndoStore, audit *AuditLog, cache *SearchCache) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		zone := auditZoneName(c.Params("domain"))
+		zoneID, err := zoneIDForCaller(api, zone)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		batch, err := undo.Take(zone, zoneID, c.Params("id"))
+		if err != nil {
+			if fe, ok := err.(*fiber.Error); ok {
+				return c.Status(fe.Code).JSON(fiber.Map{
+					"success": false,
+					"message": fe.Message,
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to load deleted records",
+				"error":   err.Error(),
+			})
+		}
+
+		changes, remaining := UndoDelete(api, batch)
+		ac := newAuditContext(c, store, audit, len(changes) > 1)
+		for i, change := range changes {
+			record := batch.Records[i]
+			after := &AuditRecord{Type: record.Type, Name: record.Name, Content: record.Content, Proxied: record.Proxied, TTL: record.TTL, Comment: record.Comment, Tags: record.Tags}
+			var changeErr error
+			if !change.Success {
+				changeErr = errors.New(change.Error)
+			}
+			ac.recordChange(AuditRecordUndo, batch.Zone, batch.ZoneID, change.RecordID, nil, after, changeErr)
+		}
+		cache.Invalidate(batch.ZoneID)
+		if err := undo.Return(remaining); err != nil {
+			log.Printf("Failed to keep records that could not be restored: %v", err)
+		}
+
+		restored := len(changes) - len(remaining.Records)
+		return c.JSON(fiber.Map{
+			"success": restored > 0,
+			"message": fmt.Sprintf("Restored %d of %d deleted records", restored, len(changes)),
+			"results": changes,
+		})
+	}
+}
@@ -0,0 +1,502 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+// ZoneDiffRecord is one side of a zone diff entry
+type ZoneDiffRecord struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Content string   `json:"content"`
+	Proxied bool     `json:"proxied"`
+	TTL     int      `json:"ttl"`
+	Comment string   `json:"comment,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// ZoneDiffEntry compares a record of two zones. Name is relative to each zone origin. The
+// status is added for a record only in the right zone, removed for one only in the left
+// zone, changed or equal.
+type ZoneDiffEntry struct {
+	Status string          `json:"status"`
+	Type   string          `json:"type"`
+	Name   string          `json:"name"`
+	Left   *ZoneDiffRecord `json:"left,omitempty"`
+	Right  *ZoneDiffRecord `json:"right,omitempty"`
+	Fields []string        `json:"fields,omitempty"` // What differs in a changed record
+}
+
+// ZoneDiff is the comparison of the records of two zones
+type ZoneDiff struct {
+	Left      string          `json:"left"`
+	Right     string          `json:"right"`
+	Added     int             `json:"added"`
+	Removed   int             `json:"removed"`
+	Changed   int             `json:"changed"`
+	Unchanged int             `json:"unchanged"`
+	Entries   []ZoneDiffEntry `json:"entries"`
+
+	// Live records by ID, used to copy entries between the zones
+	records map[string]cloudflare.DNSRecord
+}
+
+// zoneRewriter moves hostnames inside the from zone in record content to the same names in
+// the to zone. The pattern for TXT content is compiled once for all records of a zone.
+type zoneRewriter struct {
+	from, to string
+	txt      *regexp.Regexp
+}
+
+// newZoneRewriter returns a rewriter from one zone to another, or to "@" for content
+// relative to the zone origin
+func newZoneRewriter(from, to string) zoneRewriter {
+	return zoneRewriter{
+		from: from,
+		to:   to,
+		txt:  regexp.MustCompile(`(?i)(^|[^a-z0-9-])` + regexp.QuoteMeta(from) + `(\.?)`),
+	}
+}
+
+// rewrite replaces a hostname inside the from zone in record content by the same name in
+// the to zone. In TXT content, such as SPF includes and DMARC report addresses, every name
+// inside the from zone is replaced, with or without a trailing dot. Content pointing
+// elsewhere is returned unchanged.
+func (r zoneRewriter) rewrite(recordType, content string) string {
+	if recordType == "TXT" {
+		return r.rewriteText(content)
+	}
+
+	fields := strings.Fields(content)
+	i := hostField(recordType, fields)
+	if i < 0 {
+		return content
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(fields[i], "."))
+	switch {
+	case host == r.from:
+		fields[i] = r.to
+	case strings.HasSuffix(host, "."+r.from):
+		fields[i] = strings.TrimSuffix(host, "."+r.from) + "." + r.to
+	default:
+		return content
+	}
+	return strings.Join(fields, " ")
+}
+
+// rewriteText replaces the names inside the from zone in free-form text. A match must end
+// the name: it is followed by the end of the text or a character that cannot continue a
+// name, after an optional trailing dot.
+func (r zoneRewriter) rewriteText(content string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range r.txt.FindAllStringSubmatchIndex(content, -1) {
+		end := m[1]
+		if end < len(content) && isNameChar(content[end]) {
+			continue
+		}
+		// Keep the character before the name and the trailing dot
+		b.WriteString(content[last:m[3]])
+		b.WriteString(r.to)
+		b.WriteString(content[m[4]:end])
+		last = end
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
+
+// isNameChar reports whether c can be part of a hostname
+func isNameChar(c byte) bool {
+	return c == '-' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// diffRecord converts a live record for a diff entry
+func diffRecord(record cloudflare.DNSRecord) *ZoneDiffRecord {
+	return &ZoneDiffRecord{
+		ID:      record.ID,
+		Name:    record.Name,
+		Content: FormatRecordContent(record),
+		Proxied: record.Proxied != nil && *record.Proxied,
+		TTL:     record.TTL,
+		Comment: record.Comment,
+		Tags:    record.Tags,
+	}
+}
+
+// diffFields lists what differs between two records other than their name and type
+func diffFields(recordType string, left, right *ZoneDiffRecord, leftOrigin, rightOrigin zoneRewriter) []string {
+	fields := []string{}
+	if relativeContent(recordType, left.Content, leftOrigin) != relativeContent(recordType, right.Content, rightOrigin) {
+		fields = append(fields, "content")
+	}
+	if left.Proxied != right.Proxied {
+		fields = append(fields, "proxied")
+	}
+	if left.TTL != right.TTL {
+		fields = append(fields, "ttl")
+	}
+	if left.Comment != right.Comment {
+		fields = append(fields, "comment")
+	}
+	if !sameTags(left.Tags, right.Tags) {
+		fields = append(fields, "tags")
+	}
+	return fields
+}
+
+// relativeContent normalizes record content for comparing zones, with hostnames inside the
+// zone made relative to its origin by a rewriter to "@"
+func relativeContent(recordType, content string, origin zoneRewriter) string {
+	return normalizeContent(recordType, origin.rewrite(recordType, content))
+}
+
+// DiffZones compares the records of two zones by their names relative to each zone origin.
+// Records are paired per name and type: identical content first, then the remaining records
+// in order as changed. Unpaired records are removed (left only) or added (right only).
+func DiffZones(left, right string, leftRecords, rightRecords []cloudflare.DNSRecord) ZoneDiff {
+	diff := ZoneDiff{
+		Left:    left,
+		Right:   right,
+		Entries: []ZoneDiffEntry{},
+		records: map[string]cloudflare.DNSRecord{},
+	}
+
+	leftOrigin, rightOrigin := newZoneRewriter(left, "@"), newZoneRewriter(right, "@")
+	groups := map[string][2][]cloudflare.DNSRecord{}
+	keys := []string{}
+	add := func(side int, zone string, records []cloudflare.DNSRecord) {
+		for _, record := range records {
+			diff.records[record.ID] = record
+			key := recordKey(RelativeName(record.Name, zone), record.Type)
+			group, ok := groups[key]
+			if !ok {
+				keys = append(keys, key)
+			}
+			group[side] = append(group[side], record)
+			groups[key] = group
+		}
+	}
+	add(0, left, leftRecords)
+	add(1, right, rightRecords)
+
+	for _, key := range keys {
+		leftList, rightList := groups[key][0], groups[key][1]
+		matched := make([]bool, len(rightList))
+		unmatched := []cloudflare.DNSRecord{}
+
+		for _, l := range leftList {
+			lc := relativeContent(l.Type, FormatRecordContent(l), leftOrigin)
+			found := -1
+			for j, r := range rightList {
+				if !matched[j] && lc == relativeContent(r.Type, FormatRecordContent(r), rightOrigin) {
+					found = j
+					break
+				}
+			}
+			if found < 0 {
+				unmatched = append(unmatched, l)
+				continue
+			}
+			matched[found] = true
+			diff.Entries = append(diff.Entries, pairEntry(RelativeName(l.Name, left), l, rightList[found], leftOrigin, rightOrigin))
+		}
+
+		remaining := []cloudflare.DNSRecord{}
+		for j, r := range rightList {
+			if !matched[j] {
+				remaining = append(remaining, r)
+			}
+		}
+		for i, l := range unmatched {
+			if i < len(remaining) {
+				diff.Entries = append(diff.Entries, pairEntry(RelativeName(l.Name, left), l, remaining[i], leftOrigin, rightOrigin))
+				continue
+			}
+			diff.Entries = append(diff.Entries, ZoneDiffEntry{Status: DiffRemoved, Type: l.Type, Name: RelativeName(l.Name, left), Left: diffRecord(l)})
+		}
+		for _, r := range remaining[min(len(unmatched), len(remaining)):] {
+			diff.Entries = append(diff.Entries, ZoneDiffEntry{Status: DiffAdded, Type: r.Type, Name: RelativeName(r.Name, right), Right: diffRecord(r)})
+		}
+	}
+
+	// The apex first, then by name and type
+	sort.SliceStable(diff.Entries, func(i, j int) bool {
+		a, b := diff.Entries[i], diff.Entries[j]
+		if (a.Name == "@") != (b.Name == "@") {
+			return a.Name == "@"
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Type < b.Type
+	})
+
+	for _, entry := range diff.Entries {
+		switch entry.Status {
+		case DiffAdded:
+			diff.Added++
+		case DiffRemoved:
+			diff.Removed++
+		case DiffChanged:
+			diff.Changed++
+		case DiffEqual:
+			diff.Unchanged++
+		}
+	}
+	return diff
+}
+
+// pairEntry compares a record of the left zone with its counterpart in the right zone
+func pairEntry(name string, l, r cloudflare.DNSRecord, leftOrigin, rightOrigin zoneRewriter) ZoneDiffEntry {
+	entry := ZoneDiffEntry{Status: DiffEqual, Type: l.Type, Name: name, Left: diffRecord(l), Right: diffRecord(r)}
+	if fields := diffFields(l.Type, entry.Left, entry.Right, leftOrigin, rightOrigin); len(fields) > 0 {
+		entry.Status = DiffChanged
+		entry.Fields = fields
+	}
+	return entry
+}
+
+// translateRecord turns a record of one zone into the same record for another zone, with
+// its name and any hostname inside the zone moved to the new origin
+func translateRecord(record cloudflare.DNSRecord, rw zoneRewriter) (desiredRecord, error) {
+	name, err := QualifyName(RelativeName(record.Name, rw.from), rw.to)
+	if err != nil {
+		return desiredRecord{}, err
+	}
+	content := rw.rewrite(record.Type, FormatRecordContent(record))
+	payload, err := buildTypedRecord(record.Type, name, content, nil, nil)
+	if err != nil {
+		return desiredRecord{}, err
+	}
+	payload.Comment = record.Comment
+	payload.Tags = record.Tags
+	payload.TTL = record.TTL
+
+	return desiredRecord{
+		Type:    record.Type,
+		Name:    name,
+		Content: content,
+		Proxied: record.Proxied != nil && *record.Proxied,
+		Payload: payload,
+	}, nil
+}
+
+// planCopy plans copying selected left records of a diff into the right zone: records missing
+// from the right zone are created and their changed counterparts are updated
+func planCopy(diff ZoneDiff, recordIDs []string) ([]plannedChange, []RecordChange) {
+	entries := map[string]ZoneDiffEntry{}
+	for _, entry := range diff.Entries {
+		if entry.Left != nil {
+			entries[entry.Left.ID] = entry
+		}
+	}
+
+	rw := newZoneRewriter(diff.Left, diff.Right)
+	plan := []plannedChange{}
+	invalid := []RecordChange{}
+	for _, id := range recordIDs {
+		entry, ok := entries[id]
+		if !ok {
+			invalid = append(invalid, RecordChange{Action: ActionInvalid, RecordID: id, Error: fmt.Sprintf("record %s not found in %s", id, diff.Left)})
+			continue
+		}
+
+		d, err := translateRecord(diff.records[id], rw)
+		if err != nil {
+			invalid = append(invalid, RecordChange{Action: ActionInvalid, Type: entry.Type, Name: entry.Left.Name, Content: entry.Left.Content, Error: err.Error()})
+			continue
+		}
+
+		change := plannedChange{
+			RecordChange: RecordChange{Action: ActionCreate, Type: d.Type, Name: d.Name, Content: d.Content, Proxied: d.Proxied},
+			desired:      &d,
+		}
+		if entry.Right != nil {
+			existing := diff.records[entry.Right.ID]
+			change.existing = &existing
+			change.RecordID = existing.ID
+			change.Previous = entry.Right.Content
+			change.Action = ActionUnchanged
+			if entry.Status == DiffChanged {
+				change.Action = ActionUpdate
+			}
+		}
+		plan = append(plan, change)
+	}
+	return plan, invalid
+}
+
+// listZoneRecords resolves a zone and lists its records
+func listZoneRecords(api *cloudflare.API, zone string) (string, string, []cloudflare.DNSRecord, error) {
+	zone, err := NormalizeZone(zone)
+	if err != nil {
+		return "", "", nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	zoneID, err := api.ZoneIDByName(zone)
+	if err != nil {
+		return "", "", nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("Domain %s not found", zone))
+	}
+	records, _, err := api.ListDNSRecords(context.Background(), cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{})
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to fetch records of %s: %w", zone, err)
+	}
+	return zone, zoneID, records, nil
+}
+
+// zoneDiffError writes the response for a failed zone comparison
+func zoneDiffError(c *fiber.Ctx, err error) error {
+	if fe, ok := err.(*fiber.Error); ok {
+		return c.Status(fe.Code).JSON(fiber.Map{
+			"success": false,
+			"message": fe.Message,
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"message": "Failed to compare zones",
+		"error":   err.Error(),
+	})
+}
+
+// ZoneDiffHandler compares the records of two zones (?left=&right=). Unchanged records are
+// only listed with all=true.
+func ZoneDiffHandler(store *session.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		if c.Query("left") == "" || c.Query("right") == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Both left and right zones are required",
+			})
+		}
+		left, _, leftRecords, err := listZoneRecords(api, c.Query("left"))
+		if err != nil {
+			return zoneDiffError(c, err)
+		}
+		right, _, rightRecords, err := listZoneRecords(api, c.Query("right"))
+		if err != nil {
+			return zoneDiffError(c, err)
+		}
+
+		diff := DiffZones(left, right, leftRecords, rightRecords)
+		if !c.QueryBool("all") {
+			entries := []ZoneDiffEntry{}
+			for _, entry := range diff.Entries {
+				if entry.Status != DiffEqual {
+					entries = append(entries, entry)
+				}
+			}
+			diff.Entries = entries
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": fmt.Sprintf("%d added, %d removed, %d changed, %d unchanged", diff.Added, diff.Removed, diff.Changed, diff.Unchanged),
+			"data":    diff,
+		})
+	}
+}
+
+// CopyRecordsRequest is the body for copying records between zones
+type CopyRecordsRequest struct {
+	From      string   `json:"from"`
+	To        string   `json:"to"`
+	RecordIDs []string `json:"record_ids"` // Records of the from zone
+	DryRun    bool     `json:"dryRun"`
+}
+
+// CopyRecordsHandler copies selected records from one zone to another, moving names and
+// hostnames inside the zone to the target origin
+func CopyRecordsHandler(store *session.Store, audit *AuditLog, snapshots *SnapshotStore, cache *SearchCache) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req := new(CopyRecordsRequest)
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request format",
+				"error":   err.Error(),
+			})
+		}
+		if req.From == "" || req.To == "" || len(req.RecordIDs) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Source zone, target zone and records are required",
+			})
+		}
+
+		from, _, fromRecords, err := listZoneRecords(api, req.From)
+		if err != nil {
+			return zoneDiffError(c, err)
+		}
+		to, toID, toRecords, err := listZoneRecords(api, req.To)
+		if err != nil {
+			return zoneDiffError(c, err)
+		}
+		if from == to {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Source and target zones must differ",
+			})
+		}
+
+		result := ZoneApplyResult{
+			Domain:  to,
+			ZoneID:  toID,
+			DryRun:  req.DryRun,
+			Changes: []RecordChange{},
+		}
+		if unicode := DisplayName(to); unicode != to {
+			result.UnicodeName = unicode
+		}
+
+		plan, invalid := planCopy(DiffZones(from, to, fromRecords, toRecords), req.RecordIDs)
+		validatePlan(to, plan, toRecords)
+
+		ac := newAuditContext(c, store, audit, len(req.RecordIDs) > 1)
+		if !req.DryRun {
+			if err := snapshotBefore(snapshots, api, toID, to, ac, fmt.Sprintf("Before copying %d records from %s", len(req.RecordIDs), from)); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"success": false,
+					"message": "Failed to snapshot the zone, no records copied",
+					"error":   err.Error(),
+				})
+			}
+			executePlan(api, toID, plan)
+		}
+		summarizePlan(&result, plan, invalid, false)
+		ac.recordApply(result, AuditRecordCopy, fmt.Sprintf("Copy of %d records from %s", len(req.RecordIDs), from))
+		cache.Invalidate(toID)
+
+		return c.JSON(fiber.Map{
+			"success": result.Success,
+			"message": result.Message,
+			"results": []ZoneApplyResult{result},
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+func TestZoneRewriter(t *testing.T) {
+	rw := newZoneRewriter("example.com", "example.net")
+	tests := []struct {
+		recordType string
+		content    string
+		want       string
+	}{
+		{"CNAME", "example.com", "example.net"},
+		{"CNAME", "WWW.Example.com.", "www.example.net"},
+		{"CNAME", "notexample.com", "notexample.com"},
+		{"CNAME", "example.com.au", "example.com.au"},
+		{"MX", "10 mail.example.com", "10 mail.example.net"},
+		{"MX", "10 mail.example.org", "10 mail.example.org"},
+		{"SRV", "10 5 5060 sip.example.com", "10 5 5060 sip.example.net"},
+		{"HTTPS", `1 . alpn="h2"`, `1 . alpn="h2"`},
+		{"A", "203.0.113.10", "203.0.113.10"},
+		{"TXT", "v=spf1 include:_spf.example.com -all", "v=spf1 include:_spf.example.net -all"},
+		{"TXT", "v=DMARC1; rua=mailto:dmarc@Example.com; ruf=mailto:dmarc@example.com.", "v=DMARC1; rua=mailto:dmarc@example.net; ruf=mailto:dmarc@example.net."},
+		{"TXT", "notexample.com example.community example.com.au", "notexample.com example.community example.com.au"},
+		{"TXT", "example.com,example.com", "example.net,example.net"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.recordType+" "+tt.content, func(t *testing.T) {
+			if got := rw.rewrite(tt.recordType, tt.content); got != tt.want {
+				t.Errorf("rewrite = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffZones(t *testing.T) {
+	priority := uint16(10)
+	proxied := true
+	left := []cloudflare.DNSRecord{
+		{ID: "l1", Type: "A", Name: "example.com", Content: "203.0.113.1"},
+		{ID: "l2", Type: "A", Name: "example.com", Content: "203.0.113.2"},
+		{ID: "l3", Type: "CNAME", Name: "www.example.com", Content: "example.com"},
+		{ID: "l4", Type: "MX", Name: "example.com", Content: "mail.example.com", Priority: &priority},
+		{ID: "l5", Type: "TXT", Name: "old.example.com", Content: "left only"},
+		{ID: "l6", Type: "A", Name: "api.example.com", Content: "203.0.113.5", TTL: 300},
+	}
+	right := []cloudflare.DNSRecord{
+		{ID: "r1", Type: "A", Name: "example.net", Content: "203.0.113.2"},
+		{ID: "r2", Type: "A", Name: "example.net", Content: "203.0.113.3", Proxied: &proxied},
+		{ID: "r3", Type: "CNAME", Name: "www.example.net", Content: "example.net."},
+		{ID: "r4", Type: "MX", Name: "example.net", Content: "mail.example.net", Priority: &priority},
+		{ID: "r5", Type: "TXT", Name: "new.example.net", Content: "right only"},
+		{ID: "r6", Type: "A", Name: "api.example.net", Content: "203.0.113.5", TTL: 1},
+	}
+
+	diff := DiffZones("example.com", "example.net", left, right)
+
+	// Status, type, name, the IDs of both sides and the fields that differ of each entry
+	want := []string{
+		"equal A @ l2 r1 ",
+		"changed A @ l1 r2 content,proxied",
+		"equal MX @ l4 r4 ",
+		"changed A api l6 r6 ttl",
+		"added TXT new  r5 ",
+		"removed TXT old l5  ",
+		"equal CNAME www l3 r3 ",
+	}
+	got := make([]string, len(diff.Entries))
+	for i, entry := range diff.Entries {
+		leftID, rightID := "", ""
+		if entry.Left != nil {
+			leftID = entry.Left.ID
+		}
+		if entry.Right != nil {
+			rightID = entry.Right.ID
+		}
+		got[i] = strings.Join([]string{entry.Status, entry.Type, entry.Name, leftID, rightID, strings.Join(entry.Fields, ",")}, " ")
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	if diff.Added != 1 || diff.Removed != 1 || diff.Changed != 2 || diff.Unchanged != 3 {
+		t.Errorf("counts = %d added, %d removed, %d changed, %d unchanged", diff.Added, diff.Removed, diff.Changed, diff.Unchanged)
+	}
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+)
+
+// zonesPerPage is the page size used to fetch the zone list from Cloudflare
+const zonesPerPage = 50
+
+// zoneListing is a zone as listed by the Cloudflare API, with the activation date that
+// cloudflare.Zone leaves out
+type zoneListing struct {
+	cloudflare.Zone
+	ActivatedOn time.Time `json:"activated_on"`
+}
+
+// listZones fetches every zone of the account
+func listZones(api *cloudflare.API) ([]zoneListing, error) {
+	zones := []zoneListing{}
+	for page := 1; ; page++ {
+		res, err := api.Raw(context.Background(), http.MethodGet, fmt.Sprintf("/zones?page=%d&per_page=%d", page, zonesPerPage), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var batch []zoneListing
+		if err := json.Unmarshal(res.Result, &batch); err != nil {
+			return nil, fmt.Errorf("failed to read zones: %w", err)
+		}
+		zones = append(zones, batch...)
+		if len(batch) == 0 || res.ResultInfo == nil || page >= res.ResultInfo.TotalPages {
+			return zones, nil
+		}
+	}
+}
+
+// domainSortFields are the fields the domain list can be sorted on
+var domainSortFields = map[string]bool{
+	"name": true, "status": true, "plan": true, "account": true, "type": true,
+	"paused": true, "created_on": true, "activated_on": true, "record_count": true,
+}
+
+// DomainQuery holds the filters and sort order of the domain list. Filters that are set
+// must all match.
+type DomainQuery struct {
+	Search     string // Partial match on the ASCII or Unicode name
+	Status     string // active, pending, initializing, moved or deleted
+	Plan       string // Plan name, such as Free Website
+	Account    string // Account ID or name
+	Type       string // full, partial or secondary
+	Paused     *bool
+	NameServer string // Partial match on an assigned or original nameserver
+	MinRecords int    // -1 when unset
+	MaxRecords int    // -1 when unset
+	Sort       string
+	Desc       bool
+	Records    bool // Count the records of the zones on the returned page
+}
+
+// ParseDomainQuery reads the domain list filters from the query string
+func ParseDomainQuery(c *fiber.Ctx) (DomainQuery, error) {
+	q := DomainQuery{
+		Search:     strings.TrimSpace(c.Query("search")),
+		Status:     strings.ToLower(strings.TrimSpace(c.Query("status"))),
+		Plan:       strings.TrimSpace(c.Query("plan")),
+		Account:    strings.TrimSpace(c.Query("account")),
+		Type:       strings.ToLower(strings.TrimSpace(c.Query("type"))),
+		NameServer: strings.ToLower(strings.TrimSpace(c.Query("ns"))),
+		Sort:       c.Query("sort", "name"),
+		Records:    c.QueryBool("records"),
+	}
+
+	if !domainSortFields[q.Sort] {
+		return q, fmt.Errorf("invalid sort field %q", q.Sort)
+	}
+	switch c.Query("order", "asc") {
+	case "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("invalid order %q, expected asc or desc", c.Query("order"))
+	}
+
+	if value := c.Query("paused"); value != "" {
+		paused, err := strconv.ParseBool(value)
+		if err != nil {
+			return q, fmt.Errorf("invalid paused %q, expected true or false", value)
+		}
+		q.Paused = &paused
+	}
+
+	var err error
+	if q.MinRecords, err = parseRecordLimit(c.Query("min_records")); err != nil {
+		return q, err
+	}
+	if q.MaxRecords, err = parseRecordLimit(c.Query("max_records")); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// parseRecordLimit parses a record count filter, returning -1 when it is not set
+func parseRecordLimit(value string) (int, error) {
+	if value == "" {
+		return -1, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("invalid record count %q", value)
+	}
+	return limit, nil
+}
+
+// countsRecords reports whether the query needs the record count of every zone
+func (q DomainQuery) countsRecords() bool {
+	return q.Sort == "record_count" || q.MinRecords >= 0 || q.MaxRecords >= 0
+}
+
+// Matches reports whether a zone passes every filter except the record count
+func (q DomainQuery) Matches(zone zoneListing) bool {
+	if q.Search != "" {
+		name := strings.ToLower(zone.Name)
+		search := strings.ToLower(q.Search)
+		searchASCII := search
+		if ascii, err := recordNameProfile.ToASCII(q.Search); err == nil {
+			searchASCII = strings.ToLower(ascii)
+		}
+		if !strings.Contains(name, search) && !strings.Contains(name, searchASCII) &&
+			!strings.Contains(strings.ToLower(DisplayName(zone.Name)), search) {
+			return false
+		}
+	}
+	if q.Status != "" && zone.Status != q.Status {
+		return false
+	}
+	if q.Plan != "" && !strings.EqualFold(zone.Plan.Name, q.Plan) {
+		return false
+	}
+	if q.Account != "" && zone.Account.ID != q.Account && !strings.EqualFold(zone.Account.Name, q.Account) {
+		return false
+	}
+	if q.Type != "" && zone.Type != q.Type {
+		return false
+	}
+	if q.Paused != nil && zone.Paused != *q.Paused {
+		return false
+	}
+	if q.NameServer != "" {
+		found := false
+		for _, ns := range append(append([]string{}, zone.NameServers...), zone.OriginalNS...) {
+			if strings.Contains(strings.ToLower(ns), q.NameServer) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesRecordCount reports whether a counted domain passes the record count filters.
+// Domains that could not be counted only pass when no record count filter is set.
+func (q DomainQuery) MatchesRecordCount(domain Domain) bool {
+	if q.MinRecords < 0 && q.MaxRecords < 0 {
+		return true
+	}
+	if domain.RecordCount == nil {
+		return false
+	}
+	count := *domain.RecordCount
+	return (q.MinRecords < 0 || count >= q.MinRecords) && (q.MaxRecords < 0 || count <= q.MaxRecords)
+}
+
+// domainFromZone converts a listed zone to a Domain
+func domainFromZone(zone zoneListing) Domain {
+	domain := Domain{
+		ID:          zone.ID,
+		Name:        zone.Name,
+		UnicodeName: DisplayName(zone.Name),
+		Status:      zone.Status,
+		Paused:      zone.Paused,
+		DevMode:     zone.DevMode,
+		NameServers: zone.NameServers,
+		Type:        zone.Type,
+		Plan:        zone.Plan.Name,
+		AccountID:   zone.Account.ID,
+		AccountName: zone.Account.Name,
+		OriginalNS:  zone.OriginalNS,
+	}
+	if !zone.CreatedOn.IsZero() {
+		domain.CreatedOn = zone.CreatedOn.Format("2006-01-02T15:04:05Z")
+	}
+	if !zone.ActivatedOn.IsZero() {
+		domain.ActivatedOn = zone.ActivatedOn.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	return domain
+}
+
+// countDomainRecords fills in the record count of each domain, a few zones at a time and
+// through the search cache. Domains whose records cannot be fetched are left uncounted.
+func countDomainRecords(api *cloudflare.API, cache *SearchCache, domains []Domain) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < searchWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				records, _, err := cache.Records(api, domains[i].ID, false)
+				if err == nil {
+					count := len(records)
+					domains[i].RecordCount = &count
+				}
+			}
+		}()
+	}
+	for i := range domains {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// sortDomains sorts domains on a field, by name within equal values
+func sortDomains(domains []Domain, field string, desc bool) {
+	key := func(d Domain) string {
+		switch field {
+		case "status":
+			return d.Status
+		case "plan":
+			return strings.ToLower(d.Plan)
+		case "account":
+			return strings.ToLower(d.AccountName)
+		case "type":
+			return d.Type
+		case "paused":
+			return strconv.FormatBool(d.Paused)
+		case "created_on":
+			return d.CreatedOn
+		case "activated_on":
+			return d.ActivatedOn
+		}
+		return ""
+	}
+	count := func(d Domain) int {
+		if d.RecordCount == nil {
+			return -1
+		}
+		return *d.RecordCount
+	}
+
+	sort.SliceStable(domains, func(i, j int) bool {
+		a, b := domains[i], domains[j]
+		var cmp int
+		if field == "record_count" {
+			cmp = count(a) - count(b)
+		} else {
+			cmp = strings.Compare(key(a), key(b))
+		}
+		if cmp == 0 {
+			cmp = strings.Compare(a.Name, b.Name)
+			return cmp < 0 // Names stay ascending within equal values
+		}
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
+
+// DomainAccount is an account that zones belong to
+type DomainAccount struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// DomainFilterOptions are the values found in the zone list, offered as filter choices
+type DomainFilterOptions struct {
+	Plans    []string        `json:"plans"`
+	Accounts []DomainAccount `json:"accounts"`
+	Types    []string        `json:"types"`
+}
+
+// domainFilterOptions collects the plans, accounts and types of the zones
+func domainFilterOptions(zones []zoneListing) DomainFilterOptions {
+	options := DomainFilterOptions{Plans: []string{}, Accounts: []DomainAccount{}, Types: []string{}}
+	plans, accounts, types := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, zone := range zones {
+		if zone.Plan.Name != "" && !plans[zone.Plan.Name] {
+			plans[zone.Plan.Name] = true
+			options.Plans = append(options.Plans, zone.Plan.Name)
+		}
+		if zone.Account.ID != "" && !accounts[zone.Account.ID] {
+			accounts[zone.Account.ID] = true
+			options.Accounts = append(options.Accounts, DomainAccount{ID: zone.Account.ID, Name: zone.Account.Name})
+		}
+		if zone.Type != "" && !types[zone.Type] {
+			types[zone.Type] = true
+			options.Types = append(options.Types, zone.Type)
+		}
+	}
+	sort.Strings(options.Plans)
+	sort.Slice(options.Accounts, func(i, j int) bool { return options.Accounts[i].Name < options.Accounts[j].Name })
+	sort.Strings(options.Types)
+	return options
+}
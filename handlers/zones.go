@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+// Zone control actions
+const (
+	ZoneActionDelete     = "delete"
+	ZoneActionPause      = "pause"
+	ZoneActionUnpause    = "unpause"
+	ZoneActionDevModeOn  = "dev_mode_on"
+	ZoneActionDevModeOff = "dev_mode_off"
+)
+
+// isValidZoneAction reports whether action is one of the zone control actions
+func isValidZoneAction(action string) bool {
+	switch action {
+	case ZoneActionDelete, ZoneActionPause, ZoneActionUnpause, ZoneActionDevModeOn, ZoneActionDevModeOff:
+		return true
+	}
+	return false
+}
+
+// ZoneControlRequest is the body for deleting, pausing or toggling development mode of zones
+type ZoneControlRequest struct {
+	Domains string `json:"domains"` // Newline-separated domain names, bulk requests only
+	Action  string `json:"action"`  // Bulk requests only
+	Confirm string `json:"confirm"` // Deletes: the domain name, or "delete N domains" in bulk
+}
+
+// ZoneControlResult is the outcome of a zone control action on one zone
+type ZoneControlResult struct {
+	Domain      string   `json:"domain"`
+	UnicodeName string   `json:"unicode_domain,omitempty"`
+	ZoneID      string   `json:"zone_id,omitempty"`
+	Success     bool     `json:"success"`
+	Message     string   `json:"message"`
+	Error       string   `json:"error,omitempty"`
+	Export      []string `json:"export,omitempty"` // Backup files written before a delete
+}
+
+// bulkDeleteConfirmation is the text to type to delete count zones at once
+func bulkDeleteConfirmation(count int) string {
+	return fmt.Sprintf("delete %d domains", count)
+}
+
+// confirmsDomain reports whether the typed confirmation is the name of the domain, in its
+// ASCII or Unicode form
+func confirmsDomain(confirm, domain string) bool {
+	confirm = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(confirm), "."))
+	return confirm != "" && (confirm == domain || confirm == strings.ToLower(DisplayName(domain)))
+}
+
+// controlZone deletes, pauses, unpauses or toggles development mode of a zone. A zone is
+// exported to the backup directory before it is deleted and is kept when the export fails.
+func controlZone(api *cloudflare.API, backups *BackupManager, domain, action string, ac *auditContext) ZoneControlResult {
+	result := ZoneControlResult{Domain: domain}
+	if unicode := DisplayName(domain); unicode != domain {
+		result.UnicodeName = unicode
+	}
+	failed := func(message string, err error) ZoneControlResult {
+		result.Error = err.Error()
+		result.Message = fmt.Sprintf("%s: %s", message, err.Error())
+		return result
+	}
+
+	zoneID, err := api.ZoneIDByName(domain)
+	if err != nil {
+		return failed("Domain not found", err)
+	}
+	result.ZoneID = zoneID
+
+	ctx := context.Background()
+	entry := AuditEntry{Zone: domain, ZoneID: zoneID}
+	switch action {
+	case ZoneActionDelete:
+		entry.Action = AuditZoneDelete
+		files, err := backups.ExportZone(api, cloudflare.Zone{ID: zoneID, Name: domain}, fmt.Sprintf("Export of %s before deletion", domain))
+		if err != nil {
+			return failed("Failed to export the zone, it was not deleted", err)
+		}
+		result.Export = files
+		entry.Detail = "Exported to " + strings.Join(files, ", ")
+		_, err = api.DeleteZone(ctx, zoneID)
+		if err == nil {
+			result.Message = "Domain deleted, records exported to " + strings.Join(files, ", ")
+		}
+	case ZoneActionPause, ZoneActionUnpause:
+		paused := action == ZoneActionPause
+		entry.Action = AuditZoneUnpause
+		result.Message = "Cloudflare resumed, traffic is proxied again"
+		if paused {
+			entry.Action = AuditZonePause
+			result.Message = "Cloudflare paused, traffic goes directly to the origin"
+		}
+		_, err = api.ZoneSetPaused(ctx, zoneID, paused)
+	case ZoneActionDevModeOn, ZoneActionDevModeOff:
+		value := "off"
+		result.Message = "Development mode turned off"
+		if action == ZoneActionDevModeOn {
+			value = "on"
+			result.Message = "Development mode turned on for 3 hours, the cache is bypassed"
+		}
+		entry.Action = AuditZoneDevMode
+		entry.Detail = "Development mode " + value
+		_, err = api.UpdateZoneSetting(ctx, cloudflare.ZoneIdentifier(zoneID), cloudflare.UpdateZoneSettingParams{Name: "development_mode", Value: value})
+	default:
+		return failed("Invalid action", fmt.Errorf("unknown action %q", action))
+	}
+
+	entry.Success = err == nil
+	entry.Error = errorString(err)
+	ac.record(entry)
+	if err != nil {
+		return failed("Cloudflare rejected the change", err)
+	}
+	result.Success = true
+	return result
+}
+
+// ZoneControlHandler performs one zone control action on the zone in the URL. Deletes need
+// the domain name typed in the confirm field of the body.
+func ZoneControlHandler(store *session.Store, audit *AuditLog, backups *BackupManager, action string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		domain, err := NormalizeZone(c.Params("domain"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+
+		if action == ZoneActionDelete {
+			req := new(ZoneControlRequest)
+			if err := c.BodyParser(req); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": "Invalid request format",
+					"error":   err.Error(),
+				})
+			}
+			if !confirmsDomain(req.Confirm, domain) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": "Type the domain name to confirm the deletion",
+				})
+			}
+		}
+
+		result := controlZone(api, backups, domain, action, newAuditContext(c, store, audit, false))
+		status := fiber.StatusOK
+		if !result.Success {
+			status = fiber.StatusBadGateway
+			if result.ZoneID == "" {
+				status = fiber.StatusNotFound
+			}
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": result.Success,
+			"message": result.Message,
+			"error":   result.Error,
+			"data":    result,
+		})
+	}
+}
+
+// BulkZoneControlHandler performs a zone control action on many domains. Bulk deletes need
+// the confirmation "delete N domains" with N the number of domains.
+func BulkZoneControlHandler(store *session.Store, audit *AuditLog, backups *BackupManager) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		api, err := GetAPIClient(c, store)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "API client error",
+				"error":   err.Error(),
+			})
+		}
+
+		req := new(ZoneControlRequest)
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request format",
+				"error":   err.Error(),
+			})
+		}
+		if !isValidZoneAction(req.Action) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": fmt.Sprintf("Invalid action %q, expected delete, pause, unpause, dev_mode_on or dev_mode_off", req.Action),
+			})
+		}
+
+		domains, invalid := parseDomainsList(req.Domains)
+		if len(domains) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "No valid domains provided",
+				"results": invalid,
+			})
+		}
+		if req.Action == ZoneActionDelete && strings.ToLower(strings.TrimSpace(req.Confirm)) != bulkDeleteConfirmation(len(domains)) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": fmt.Sprintf("Type %q to confirm the deletion", bulkDeleteConfirmation(len(domains))),
+			})
+		}
+
+		results := make([]ZoneControlResult, 0, len(domains)+len(invalid))
+		for _, r := range invalid {
+			results = append(results, ZoneControlResult{Domain: r.Domain, Message: r.Message, Error: r.Error})
+		}
+
+		ac := newAuditContext(c, store, audit, true)
+		successCount := 0
+		for _, domain := range domains {
+			result := controlZone(api, backups, domain, req.Action, ac)
+			if result.Success {
+				successCount++
+			}
+			results = append(results, result)
+		}
+
+		return c.JSON(fiber.Map{
+			"success": successCount > 0,
+			"message": fmt.Sprintf("Completed %s on %d out of %d domains", strings.ReplaceAll(req.Action, "_", " "), successCount, len(results)),
+			"results": results,
+		})
+	}
+}
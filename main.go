@@ -10,6 +10,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/fiber/v2/middleware/session"
 	"github.com/gofiber/template/html/v2"
 
@@ -25,6 +26,36 @@ var embeddedFiles embed.FS
 // Define global session store
 var store *session.Store
 
+// Define global template library
+var templates *handlers.TemplateStore
+
+// Define global library of zone settings profiles
+var profiles *handlers.ProfileStore
+
+// Define global proxy policy for records
+var proxyPolicy *handlers.ProxyPolicy
+
+// Define global audit log
+var audit *handlers.AuditLog
+
+// Define global zone snapshot store
+var snapshots *handlers.SnapshotStore
+
+// Define global store of deleted records that can be restored
+var undo *handlers.UndoStore
+
+// Define global checker of nameserver delegation
+var delegation *handlers.DelegationChecker
+
+// Define global backup scheduler
+var backups *handlers.BackupManager
+
+// Define global cache of zones and records used by cross-zone search
+var searchCache *handlers.SearchCache
+
+// Define global runner of find and replace jobs
+var replaceJobs *handlers.ReplaceJobs
+
 func main() {
 	// Initialize session store with cookie storage and 30 day expiration
 	store = session.New(session.Config{
@@ -34,6 +65,83 @@ func main() {
 		KeyLookup:    "cookie:cloudflare_dns_session",
 	})
 
+	// Load the shared DNS template library from the data directory
+	var err error
+	templates, err = handlers.NewTemplateStore(handlers.DataDir())
+	if err != nil {
+		log.Fatal("Failed to load DNS templates: ", err)
+	}
+
+	// Load the zone settings profiles offered when adding domains
+	profiles, err = handlers.NewProfileStore(handlers.DataDir())
+	if err != nil {
+		log.Fatal("Failed to load settings profiles: ", err)
+	}
+
+	// Load the proxy defaults applied to records that do not say whether they are proxied
+	proxyPolicy, err = handlers.NewProxyPolicy(handlers.DataDir())
+	if err != nil {
+		log.Fatal("Failed to load proxy policy: ", err)
+	}
+
+	// Open the audit log of changes made through the application
+	audit, err = handlers.NewAuditLog(handlers.DataDir())
+	if err != nil {
+		log.Fatal("Failed to load audit log: ", err)
+	}
+
+	// Zone snapshots are taken before bulk changes so they can be restored
+	snapshots = handlers.NewSnapshotStore(handlers.DataDir(), handlers.DefaultSnapshotRetention)
+
+	// Deleted records are kept for the undo window
+	undoWindow, err := handlers.UndoWindowFromEnv()
+	if err != nil {
+		log.Fatal("Invalid undo configuration: ", err)
+	}
+	undo, err = handlers.NewUndoStore(handlers.DataDir(), undoWindow)
+	if err != nil {
+		log.Fatal("Failed to load deleted records: ", err)
+	}
+
+	// Check pending zones against the nameservers at their parent zone
+	delegationResolver, err := handlers.DelegationResolverFromEnv()
+	if err != nil {
+		log.Fatal("Invalid delegation configuration: ", err)
+	}
+	parentPort, err := handlers.ParentNameserverPortFromEnv()
+	if err != nil {
+		log.Fatal("Invalid delegation configuration: ", err)
+	}
+	delegation, err = handlers.NewDelegationChecker(handlers.DataDir(), delegationResolver, parentPort)
+	if err != nil {
+		log.Fatal("Failed to load delegation checks: ", err)
+	}
+
+	// Back up every zone on the configured schedule
+	backupConfig, err := handlers.BackupConfigFromEnv(handlers.DataDir())
+	if err != nil {
+		log.Fatal("Invalid backup configuration: ", err)
+	}
+	backups, err = handlers.NewBackupManager(handlers.DataDir(), backupConfig)
+	if err != nil {
+		log.Fatal("Failed to load backup status: ", err)
+	}
+	backups.Start()
+
+	// Cache zone lists and records between cross-zone searches
+	searchTTL, err := handlers.SearchCacheTTLFromEnv()
+	if err != nil {
+		log.Fatal("Invalid search cache configuration: ", err)
+	}
+	searchCache = handlers.NewSearchCache(searchTTL)
+
+	// Run find and replace jobs in the background under their own rate limit
+	replaceRate, err := handlers.ReplaceRateLimitFromEnv()
+	if err != nil {
+		log.Fatal("Invalid find and replace configuration: ", err)
+	}
+	replaceJobs = handlers.NewReplaceJobs(snapshots, searchCache, replaceRate)
+
 	// Initialize template engine with embedded files
 	viewsFs, err := fs.Sub(embeddedFiles, "templates")
 	if err != nil {
@@ -46,8 +154,13 @@ func main() {
 		Views: engine,
 	})
 
+	// Tag every request with an ID, which the audit log records for each change
+	app.Use(requestid.New())
+
 	// Add logger middleware
-	app.Use(logger.New())
+	app.Use(logger.New(logger.Config{
+		Format: "[${time}] ${locals:requestid} ${status} - ${latency} ${method} ${path}\n",
+	}))
 
 	// Serve static files from embedded filesystem
 	app.Use("/static", func(c *fiber.Ctx) error {
@@ -113,16 +226,99 @@ func setupRoutes(app *fiber.App) {
 
 	// Domain management
 	app.Get("/domains", handlers.RenderDomainsPageHandler(store))
-	app.Get("/api/domains", handlers.DomainsHandler(store))
-	app.Post("/api/domains/add", handlers.AddDomainsHandler(store))
-	app.Post("/api/domains/bulk-dns", handlers.BulkDNSHandler(store))
+	app.Get("/api/domains", handlers.DomainsHandler(store, delegation, searchCache))
+	app.Post("/api/domains/add", handlers.AddDomainsHandler(store, templates, profiles, proxyPolicy, audit))
+	app.Post("/api/domains/bulk-dns", handlers.BulkDNSHandler(store, proxyPolicy, audit, snapshots, searchCache))
+	app.Post("/api/domains/bulk", handlers.BulkZoneControlHandler(store, audit, backups))
+	app.Delete("/api/domains/:domain", handlers.ZoneControlHandler(store, audit, backups, handlers.ZoneActionDelete))
+	app.Post("/api/domains/:domain/pause", handlers.ZoneControlHandler(store, audit, backups, handlers.ZoneActionPause))
+	app.Post("/api/domains/:domain/unpause", handlers.ZoneControlHandler(store, audit, backups, handlers.ZoneActionUnpause))
+	app.Post("/api/domains/:domain/dev-mode/on", handlers.ZoneControlHandler(store, audit, backups, handlers.ZoneActionDevModeOn))
+	app.Post("/api/domains/:domain/dev-mode/off", handlers.ZoneControlHandler(store, audit, backups, handlers.ZoneActionDevModeOff))
+	app.Post("/api/domains/delegation/check", handlers.CheckPendingDelegationsHandler(store, delegation))
+	app.Post("/api/domains/:domain/delegation/check", handlers.CheckDelegationHandler(store, delegation))
+
+	// DNS template library
+	app.Get("/api/templates", handlers.ListTemplatesHandler(store, templates))
+	app.Post("/api/templates", handlers.CreateTemplateHandler(store, templates))
+	app.Get("/api/templates/export", handlers.ExportTemplatesHandler(store, templates))
+	app.Post("/api/templates/import", handlers.ImportTemplatesHandler(store, templates))
+	app.Get("/api/templates/:id", handlers.GetTemplateHandler(store, templates))
+	app.Put("/api/templates/:id", handlers.UpdateTemplateHandler(store, templates))
+	app.Delete("/api/templates/:id", handlers.DeleteTemplateHandler(store, templates))
+	app.Post("/api/templates/:id/render", handlers.RenderTemplateHandler(store, templates))
+	app.Post("/api/templates/:id/apply", handlers.ApplyTemplateHandler(store, templates, proxyPolicy, audit, snapshots, searchCache))
+	app.Get("/api/templates/:id/versions", handlers.TemplateVersionsHandler(store, templates))
+	app.Get("/api/templates/:id/versions/:version", handlers.TemplateVersionHandler(store, templates))
+	app.Get("/api/templates/:id/diff", handlers.TemplateDiffHandler(store, templates))
+	app.Post("/api/templates/:id/revert", handlers.RevertTemplateHandler(store, templates))
+	app.Get("/api/templates/:id/export", handlers.ExportTemplateHandler(store, templates))
+
+	// Template compliance
+	app.Get("/api/compliance", handlers.ComplianceReportHandler(store, templates, proxyPolicy))
+	app.Put("/api/compliance/:domain", handlers.AssignTemplateHandler(store, templates))
+	app.Delete("/api/compliance/:domain", handlers.UnassignTemplateHandler(store, templates))
+	app.Post("/api/compliance/:domain/remediate", handlers.RemediateZoneHandler(store, templates, proxyPolicy, audit, snapshots, searchCache))
 
 	// DNS management
 	app.Get("/dns/:domain", handlers.RenderDNSPageHandler(store))
+	app.Get("/api/dns/diff", handlers.ZoneDiffHandler(store))
+	app.Post("/api/dns/copy", handlers.CopyRecordsHandler(store, audit, snapshots, searchCache))
+	app.Post("/api/dns/clone", handlers.CloneZoneHandler(store, audit, snapshots, searchCache))
 	app.Get("/api/dns/:domain", handlers.GetDNSRecordsHandler(store))
-	app.Post("/api/dns/:domain", handlers.UpdateDNSRecordsHandler(store))
-	app.Post("/api/dns/:domain/create", handlers.CreateDNSRecordHandler(store))
-	app.Delete("/api/dns/:domain/bulk", handlers.BulkDeleteDNSRecordsHandler(store))
-	app.Put("/api/dns/:domain/:id", handlers.EditDNSRecordHandler(store))
-	app.Delete("/api/dns/:domain/:id", handlers.DeleteDNSRecordHandler(store))
+	app.Get("/api/dns/:domain/lint", handlers.LintDNSRecordsHandler(store))
+	app.Post("/api/dns/:domain", handlers.UpdateDNSRecordsHandler(store, proxyPolicy, audit, snapshots, searchCache))
+	app.Post("/api/dns/:domain/create", handlers.CreateDNSRecordHandler(store, proxyPolicy, audit, searchCache))
+	app.Post("/api/dns/:domain/proxy", handlers.ProxyRecordsHandler(store, audit, snapshots, searchCache))
+	app.Delete("/api/dns/:domain/bulk", handlers.BulkDeleteDNSRecordsHandler(store, audit, snapshots, undo, searchCache))
+	app.Get("/api/dns/:domain/deleted", handlers.DeletedRecordsHandler(store, undo))
+	app.Post("/api/dns/:domain/deleted/:id/undo", handlers.UndoDeleteHandler(store, undo, audit, searchCache))
+	app.Put("/api/dns/:domain/:id", handlers.EditDNSRecordHandler(store, proxyPolicy, audit, searchCache))
+	app.Delete("/api/dns/:domain/:id", handlers.DeleteDNSRecordHandler(store, audit, undo, searchCache))
+
+	// Zone settings
+	app.Get("/settings/:domain", handlers.RenderSettingsPageHandler(store))
+	app.Post("/api/settings/apply", handlers.ApplySettingsHandler(store, profiles, audit))
+	app.Get("/api/settings/:domain", handlers.GetZoneSettingsHandler(store))
+	app.Put("/api/settings/:domain", handlers.UpdateZoneSettingsHandler(store, audit))
+	app.Get("/api/profiles", handlers.ListProfilesHandler(store, profiles))
+	app.Post("/api/profiles", handlers.CreateProfileHandler(store, profiles))
+	app.Put("/api/profiles/:id", handlers.UpdateProfileHandler(store, profiles))
+	app.Delete("/api/profiles/:id", handlers.DeleteProfileHandler(store, profiles))
+
+	// Proxy policy
+	app.Get("/api/proxy/policy", handlers.GetProxyPolicyHandler(store, proxyPolicy))
+	app.Put("/api/proxy/policy", handlers.UpdateProxyDefaultsHandler(store, proxyPolicy))
+	app.Put("/api/proxy/policy/:domain", handlers.UpdateProxyDefaultsHandler(store, proxyPolicy))
+	app.Post("/api/proxy/bulk", handlers.BulkProxyHandler(store, audit, snapshots, searchCache))
+
+	// DNSSEC
+	app.Get("/api/dnssec/report", handlers.DNSSECReportHandler(store, delegation))
+	app.Get("/api/dnssec/:domain", handlers.GetDNSSECHandler(store, delegation))
+	app.Post("/api/dnssec/:domain/enable", handlers.DNSSECControlHandler(store, audit, delegation, true))
+	app.Post("/api/dnssec/:domain/disable", handlers.DNSSECControlHandler(store, audit, delegation, false))
+
+	// Cross-zone search
+	app.Get("/search", handlers.RenderSearchPageHandler(store))
+	app.Get("/api/search", handlers.SearchRecordsHandler(store, searchCache))
+	app.Post("/api/replace/preview", handlers.PreviewReplaceHandler(store))
+	app.Post("/api/replace", handlers.StartReplaceHandler(store, audit, replaceJobs))
+	app.Get("/api/replace/:id", handlers.ReplaceJobHandler(store, replaceJobs))
+
+	// Zone snapshots
+	app.Get("/api/snapshots/:domain", handlers.ListSnapshotsHandler(store, snapshots))
+	app.Post("/api/snapshots/:domain", handlers.TakeSnapshotHandler(store, snapshots))
+	app.Get("/api/snapshots/:domain/:id", handlers.GetSnapshotHandler(store, snapshots))
+	app.Get("/api/snapshots/:domain/:id/diff", handlers.DiffSnapshotHandler(store, snapshots))
+	app.Post("/api/snapshots/:domain/:id/restore", handlers.RestoreSnapshotHandler(store, snapshots, audit, searchCache))
+
+	// Zone backups
+	app.Get("/backups", handlers.RenderBackupsPageHandler(store))
+	app.Get("/api/backups", handlers.BackupStatusHandler(store, backups))
+	app.Post("/api/backups/run", handlers.RunBackupHandler(store, backups))
+
+	// Audit log
+	app.Get("/audit", handlers.RenderAuditPageHandler(store))
+	app.Get("/api/audit", handlers.AuditLogHandler(store, audit))
+	app.Get("/api/audit/export", handlers.ExportAuditLogHandler(store, audit))
 }
@@ -58,18 +58,11 @@ function showCopyFeedback(feedbackElement) {
 const CREDENTIAL_STORAGE_KEY = 'cloudflare_dns_credentials_multiple';
 const CREDENTIAL_EXPIRY_DAYS = 30;
 
-// DNS Templates configuration
-const DNS_TEMPLATES_STORAGE_KEY = 'cloudflare_dns_templates';
-const DEFAULT_DNS_TEMPLATE = {
-    name: 'Default Template',
-    records: [
-        'A|@|138.199.137.90|true',
-        'CNAME|www|@|true',
-        'CNAME|shop|@|true',
-        'CNAME|buy|@|true',
-        'CNAME|product|@|true'
-    ]
-};
+// DNS Templates configuration. Templates are stored server-side and shared by the team; the
+// localStorage key is only read to migrate templates saved in the browser by older versions.
+const LEGACY_DNS_TEMPLATES_STORAGE_KEY = 'cloudflare_dns_templates';
+let dnsTemplates = {};
+let editingTemplateId = '';
 
 document.addEventListener('DOMContentLoaded', function() {
     // Initialize the application
@@ -171,60 +164,167 @@ function hasStoredCredentials() {
 
 // DNS Templates Management Functions
 function loadDNSTemplates() {
-    try {
-        const stored = localStorage.getItem(DNS_TEMPLATES_STORAGE_KEY);
-        if (!stored) {
-            // Initialize with default template
-            const defaultTemplates = {
-                'default': DEFAULT_DNS_TEMPLATE
+    return fetch('/api/templates')
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            dnsTemplates = {};
+            data.data.forEach(template => {
+                dnsTemplates[template.id] = template;
+            });
+            return dnsTemplates;
+        })
+        .catch(error => {
+            console.error('Failed to load DNS templates:', error);
+            return dnsTemplates;
+        });
+}
+
+function saveDNSTemplate(templateId, name, description, records, variables, note) {
+    const url = templateId ? `/api/templates/${encodeURIComponent(templateId)}` : '/api/templates';
+    return fetch(url, {
+        method: templateId ? 'PUT' : 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ name, description, records, variables: variables || [], note: note || '' }),
+    }).then(response => response.json());
+}
+
+function deleteDNSTemplate(templateId) {
+    return fetch(`/api/templates/${encodeURIComponent(templateId)}`, {
+        method: 'DELETE',
+    }).then(response => response.json());
+}
+
+function getDNSTemplateRecords(templateId) {
+    return dnsTemplates[templateId] ? dnsTemplates[templateId].records : [];
+}
+
+// Render a template for a zone on the server, resolving variables and optional blocks
+function renderDNSTemplate(templateId, zone, variables) {
+    return fetch(`/api/templates/${encodeURIComponent(templateId)}/render`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ zone, variables }),
+    }).then(response => response.json());
+}
+
+// Parse template variables entered one per line as NAME|DEFAULT|LABEL|REQUIRED
+function parseTemplateVariablesInput(text) {
+    return text.split('\n')
+        .map(line => line.trim())
+        .filter(line => line !== '')
+        .map(line => {
+            const parts = line.split('|').map(part => part.trim());
+            return {
+                name: parts[0],
+                default: parts[1] || '',
+                label: parts[2] || '',
+                required: ['true', '1', 'yes', 'required'].includes((parts[3] || '').toLowerCase())
             };
-            saveDNSTemplates(defaultTemplates);
-            return defaultTemplates;
+        });
+}
+
+// Format template variables for the NAME|DEFAULT|LABEL|REQUIRED textarea
+function formatTemplateVariables(variables) {
+    return (variables || []).map(variable => {
+        const parts = [variable.name, variable.default || '', variable.label || ''];
+        if (variable.required) {
+            parts.push('required');
         }
-        return JSON.parse(stored);
-    } catch (error) {
-        console.error('Failed to load DNS templates:', error);
-        return { 'default': DEFAULT_DNS_TEMPLATE };
-    }
+        return parts.join('|').replace(/\|+$/, '');
+    }).join('\n');
 }
 
-function saveDNSTemplates(templates) {
-    try {
-        localStorage.setItem(DNS_TEMPLATES_STORAGE_KEY, JSON.stringify(templates));
-        return true;
-    } catch (error) {
-        console.error('Failed to save DNS templates:', error);
-        return false;
-    }
+// Show an input for every variable of the selected template
+function renderTemplateVariablesForm(containerId, template) {
+    const container = document.getElementById(containerId);
+    if (!container) return;
+    
+    container.innerHTML = '';
+    const variables = template ? (template.variables || []) : [];
+    container.style.display = variables.length > 0 ? 'block' : 'none';
+    
+    variables.forEach(variable => {
+        const group = document.createElement('div');
+        group.className = 'template-variable';
+        group.innerHTML = `
+            <label>${escapeHtml(variable.label || variable.name)}${variable.required ? ' *' : ''}
+                <code>{{${escapeHtml(variable.name)}}}</code></label>
+            <input type="text" class="form-control" data-variable-name="${escapeHtml(variable.name)}"
+                value="${escapeHtml(variable.default || '')}" placeholder="${escapeHtml(variable.description || '')}">
+        `;
+        container.appendChild(group);
+    });
 }
 
-function addDNSTemplate(name, records) {
-    const templates = loadDNSTemplates();
-    const templateId = name.toLowerCase().replace(/[^a-z0-9]/g, '_');
-    
-    templates[templateId] = {
-        name: name,
-        records: records
-    };
-    
-    return saveDNSTemplates(templates);
+// Collect the variable values entered in a template variables form
+function collectTemplateVariables(containerId) {
+    const variables = {};
+    const container = document.getElementById(containerId);
+    if (!container) return variables;
+    
+    container.querySelectorAll('[data-variable-name]').forEach(input => {
+        variables[input.dataset.variableName] = input.value.trim();
+    });
+    return variables;
 }
 
-function deleteDNSTemplate(templateId) {
-    const templates = loadDNSTemplates();
-    
-    // Don't allow deleting default template
-    if (templateId === 'default') {
-        return false;
-    }
+// Render the selected template for the current zone into the DNS records editor
+function loadTemplateIntoEditor(templateId) {
+    const dnsRecordsTextarea = document.getElementById('dns-records');
+    const domain = document.getElementById('domain-name')?.value;
+    if (!dnsRecordsTextarea) return;
     
-    delete templates[templateId];
-    return saveDNSTemplates(templates);
+    renderDNSTemplate(templateId, domain, collectTemplateVariables('template-variables-form-dns'))
+        .then(data => {
+            if (!data.success) {
+                showNotification(`${data.message}: ${data.error || ''}`, 'error');
+                return;
+            }
+            dnsRecordsTextarea.value = data.data.join('\n');
+            showNotification('Template loaded successfully!', 'success');
+        })
+        .catch(error => {
+            showNotification('Failed to load template: ' + error.message, 'error');
+        });
 }
 
-function getDNSTemplateRecords(templateId) {
-    const templates = loadDNSTemplates();
-    return templates[templateId] ? templates[templateId].records : [];
+// Upload templates saved in this browser by older versions to the shared library. The local
+// copy is removed once every template has been accepted by the server.
+function migrateLocalDNSTemplates() {
+    let stored = null;
+    try {
+        stored = JSON.parse(localStorage.getItem(LEGACY_DNS_TEMPLATES_STORAGE_KEY));
+    } catch (error) {
+        console.error('Failed to read local DNS templates:', error);
+    }
+    if (!stored) {
+        return Promise.resolve(false);
+    }
+
+    const existingNames = new Set(Object.values(dnsTemplates).map(template => template.name));
+    const uploads = Object.keys(stored)
+        .filter(templateId => templateId !== 'default' && !existingNames.has(stored[templateId].name))
+        .map(templateId => saveDNSTemplate('', stored[templateId].name, 'Imported from browser storage', stored[templateId].records));
+
+    return Promise.all(uploads).then(results => {
+        const failed = results.filter(result => !result.success);
+        if (failed.length === 0) {
+            localStorage.removeItem(LEGACY_DNS_TEMPLATES_STORAGE_KEY);
+        } else {
+            showNotification(`${failed.length} template(s) saved in this browser could not be moved to the server: ${failed.map(result => (result.errors || [result.message]).join('; ')).join(' | ')}`, 'warning');
+        }
+        if (results.length > failed.length) {
+            showNotification(`Moved ${results.length - failed.length} template(s) from this browser to the shared template library`, 'success');
+        }
+        return results.length > failed.length;
+    });
 }
 
 // Check and load stored credentials on home page
@@ -453,8 +553,23 @@ function testCurrentCredentials() {
 
 // DNS Templates Setup
 function setupDNSTemplates() {
-    // Load templates and populate select dropdown
-    populateTemplateSelect();
+    if (!document.getElementById('dns-template-select') && !document.getElementById('dns-template-select-dns') && !document.getElementById('apply-template-select')) {
+        return;
+    }
+
+    // Load the shared templates, migrating any left in this browser, and populate the selects
+    loadDNSTemplates()
+        .then(migrateLocalDNSTemplates)
+        .then(migrated => migrated ? loadDNSTemplates() : dnsTemplates)
+        .then(populateTemplateSelect);
+    
+    // Show the variables of the template selected for new domains
+    const templateSelect = document.getElementById('dns-template-select');
+    if (templateSelect) {
+        templateSelect.addEventListener('change', function() {
+            renderTemplateVariablesForm('template-variables-form', dnsTemplates[this.value]);
+        });
+    }
     
     // Setup manage templates button
     const manageTemplatesBtn = document.getElementById('manage-templates-btn');
@@ -466,23 +581,28 @@ function setupDNSTemplates() {
     setupTemplatesModal();
 }
 
-// Populate template select dropdown
+// Populate template select dropdowns on the domains and DNS pages
 function populateTemplateSelect() {
-    const templateSelect = document.getElementById('dns-template-select');
-    if (!templateSelect) return;
-    
-    const templates = loadDNSTemplates();
-    
-    // Clear existing options except "No Template"
-    templateSelect.innerHTML = '<option value="">No Template</option>';
-    
-    // Add templates to select
-    Object.keys(templates).forEach(templateId => {
-        const template = templates[templateId];
-        const option = document.createElement('option');
-        option.value = templateId;
-        option.textContent = template.name;
-        templateSelect.appendChild(option);
+    ['dns-template-select', 'dns-template-select-dns', 'apply-template-select'].forEach(selectId => {
+        const templateSelect = document.getElementById(selectId);
+        if (!templateSelect) return;
+        
+        const selected = templateSelect.value;
+        
+        // Clear existing options except "No Template"
+        templateSelect.innerHTML = '<option value="">No Template</option>';
+        
+        // Add templates to select
+        Object.values(dnsTemplates).forEach(template => {
+            const option = document.createElement('option');
+            option.value = template.id;
+            option.textContent = template.name;
+            templateSelect.appendChild(option);
+        });
+        
+        if (dnsTemplates[selected]) {
+            templateSelect.value = selected;
+        }
     });
 }
 
@@ -491,18 +611,31 @@ function openTemplatesModal() {
     const modal = document.getElementById('dns-templates-modal');
     if (modal) {
         modal.classList.add('active');
-        populateTemplatesList();
+        loadDNSTemplates().then(() => {
+            populateTemplateSelect();
+            populateTemplatesList();
+        });
     }
 }
 
+// Reset the template form back to creating a new template
+function resetTemplateForm() {
+    editingTemplateId = '';
+    document.getElementById('template-name').value = '';
+    document.getElementById('template-description').value = '';
+    document.getElementById('template-variables').value = '';
+    document.getElementById('template-records').value = '';
+    document.getElementById('template-note').value = '';
+    document.getElementById('save-template').innerHTML = '<i class="fas fa-save"></i> Save Template';
+}
+
 // Close templates modal
 function closeTemplatesModal() {
     const modal = document.getElementById('dns-templates-modal');
     if (modal) {
         modal.classList.remove('active');
-        // Clear form
-        document.getElementById('template-name').value = '';
-        document.getElementById('template-records').value = '';
+        resetTemplateForm();
+        closeTemplateHistory();
     }
 }
 
@@ -514,7 +647,25 @@ function setupTemplatesModal() {
     
     if (closeBtn) closeBtn.addEventListener('click', closeTemplatesModal);
     if (cancelBtn) cancelBtn.addEventListener('click', closeTemplatesModal);
-    if (saveBtn) saveBtn.addEventListener('click', saveNewTemplate);
+    if (saveBtn) saveBtn.addEventListener('click', saveTemplate);
+    
+    // Import and export of the template library
+    const exportJsonBtn = document.getElementById('export-templates-json');
+    const exportYamlBtn = document.getElementById('export-templates-yaml');
+    const importBtn = document.getElementById('import-templates-btn');
+    const importFile = document.getElementById('import-templates-file');
+    
+    if (exportJsonBtn) exportJsonBtn.addEventListener('click', () => exportTemplates('', 'json'));
+    if (exportYamlBtn) exportYamlBtn.addEventListener('click', () => exportTemplates('', 'yaml'));
+    if (importBtn && importFile) {
+        importBtn.addEventListener('click', () => importFile.click());
+        importFile.addEventListener('change', function() {
+            if (this.files.length > 0) {
+                importTemplates(this.files[0]);
+            }
+            this.value = '';
+        });
+    }
     
     // Close modal when clicking outside
     const modal = document.getElementById('dns-templates-modal');
@@ -524,161 +675,1628 @@ function setupTemplatesModal() {
                 closeTemplatesModal();
             }
         });
-    }
+    }
+}
+
+// Save the template form, creating a new template or updating the one being edited.
+// Records are validated by the server before the template is stored.
+function saveTemplate() {
+    const name = document.getElementById('template-name').value.trim();
+    const description = document.getElementById('template-description').value.trim();
+    const variables = parseTemplateVariablesInput(document.getElementById('template-variables').value);
+    const recordsText = document.getElementById('template-records').value.trim();
+    const note = document.getElementById('template-note').value.trim();
+    
+    if (!name) {
+        showNotification('Please enter a template name', 'error');
+        return;
+    }
+    
+    if (!recordsText) {
+        showNotification('Please enter DNS records', 'error');
+        return;
+    }
+    
+    const records = recordsText.split('\n').filter(line => line.trim() !== '');
+    const updating = editingTemplateId !== '';
+    
+    saveDNSTemplate(editingTemplateId, name, description, records, variables, note)
+        .then(data => {
+            if (!data.success) {
+                showNotification(data.message || 'Failed to save template', 'error');
+                (data.errors || []).forEach(error => showNotification(error, 'error'));
+                return;
+            }
+            
+            showNotification(updating ? 'Template updated successfully!' : 'Template saved successfully!', 'success');
+            showValidationWarnings(data.warnings);
+            resetTemplateForm();
+            return loadDNSTemplates().then(() => {
+                populateTemplateSelect();
+                populateTemplatesList();
+            });
+        })
+        .catch(error => {
+            showNotification('Failed to save template: ' + error.message, 'error');
+        });
+}
+
+// Populate templates list in modal
+function populateTemplatesList() {
+    const templatesList = document.getElementById('templates-list');
+    if (!templatesList) return;
+    
+    const templates = Object.values(dnsTemplates);
+    templatesList.innerHTML = '';
+    
+    if (templates.length === 0) {
+        templatesList.innerHTML = '<div class="no-templates">No templates found</div>';
+        return;
+    }
+    
+    templates.forEach(template => {
+        const templateItem = document.createElement('div');
+        templateItem.className = 'template-item';
+        
+        const updatedBy = template.updated_by ? ` · updated by ${escapeHtml(template.updated_by)}` : '';
+        templateItem.innerHTML = `
+            <div class="template-info">
+                <div class="template-name">${escapeHtml(template.name)}</div>
+                ${template.description ? `<div class="template-description">${escapeHtml(template.description)}</div>` : ''}
+                <div class="template-records-count">Version ${template.version || 1} · ${template.records.length} lines${(template.variables || []).length ? `, ${template.variables.length} variables` : ''}${updatedBy}</div>
+            </div>
+            <div class="template-actions">
+                <button class="edit-template" data-template-id="${escapeHtml(template.id)}">
+                    <i class="fas fa-edit"></i> Edit
+                </button>
+                <button class="history-template" data-template-id="${escapeHtml(template.id)}">
+                    <i class="fas fa-history"></i> History
+                </button>
+                <button class="export-template" data-template-id="${escapeHtml(template.id)}">
+                    <i class="fas fa-file-export"></i> Export
+                </button>
+                <button class="delete-template" data-template-id="${escapeHtml(template.id)}">
+                    <i class="fas fa-trash"></i> Delete
+                </button>
+            </div>
+        `;
+        
+        templateItem.querySelector('.edit-template').addEventListener('click', () => editTemplate(template.id));
+        templateItem.querySelector('.history-template').addEventListener('click', () => showTemplateHistory(template.id));
+        templateItem.querySelector('.export-template').addEventListener('click', () => exportTemplates(template.id, 'json'));
+        templateItem.querySelector('.delete-template').addEventListener('click', () => deleteTemplate(template.id));
+        templatesList.appendChild(templateItem);
+    });
+}
+
+// Edit template
+function editTemplate(templateId) {
+    const template = dnsTemplates[templateId];
+    if (!template) return;
+    
+    editingTemplateId = templateId;
+    document.getElementById('template-name').value = template.name;
+    document.getElementById('template-description').value = template.description || '';
+    document.getElementById('template-variables').value = formatTemplateVariables(template.variables);
+    document.getElementById('template-records').value = template.records.join('\n');
+    
+    // Change save button to update
+    document.getElementById('save-template').innerHTML = '<i class="fas fa-save"></i> Update Template';
+}
+
+// Delete template
+function deleteTemplate(templateId) {
+    const template = dnsTemplates[templateId];
+    if (!template) return;
+    
+    if (confirm(`Are you sure you want to delete the template "${template.name}"? It is shared with everyone using this application.`)) {
+        deleteDNSTemplate(templateId)
+            .then(data => {
+                if (!data.success) {
+                    showNotification(data.message || 'Failed to delete template', 'error');
+                    return;
+                }
+                
+                showNotification('Template deleted successfully!', 'success');
+                if (editingTemplateId === templateId) {
+                    resetTemplateForm();
+                }
+                return loadDNSTemplates().then(() => {
+                    populateTemplateSelect();
+                    populateTemplatesList();
+                });
+            })
+            .catch(error => {
+                showNotification('Failed to delete template: ' + error.message, 'error');
+            });
+    }
+}
+
+// Download the template library, or a single template, as JSON or YAML
+function exportTemplates(templateId, format) {
+    const path = templateId ? `/api/templates/${encodeURIComponent(templateId)}/export` : '/api/templates/export';
+    window.location.href = `${path}?format=${encodeURIComponent(format)}`;
+}
+
+// Import templates from a JSON or YAML file. Templates with the same ID or name are updated.
+function importTemplates(file) {
+    file.text()
+        .then(text => fetch('/api/templates/import', {
+            method: 'POST',
+            headers: {
+                'Content-Type': file.name.match(/\.ya?ml$/i) ? 'application/yaml' : 'application/json',
+            },
+            body: text,
+        }))
+        .then(response => response.json())
+        .then(data => {
+            if (!data.data) {
+                showNotification(`${data.message}${data.error ? ': ' + data.error : ''}`, 'error');
+                return;
+            }
+            
+            showNotification(data.message, data.success ? 'success' : 'error');
+            data.data.forEach(result => {
+                if (result.action === 'invalid') {
+                    showNotification(`${result.name || 'Unnamed template'}: ${(result.errors || []).join(', ')}`, 'error');
+                }
+            });
+            return loadDNSTemplates().then(() => {
+                populateTemplateSelect();
+                populateTemplatesList();
+            });
+        })
+        .catch(error => {
+            showNotification('Failed to import templates: ' + error.message, 'error');
+        });
+}
+
+// Show the version history of a template
+function showTemplateHistory(templateId) {
+    const template = dnsTemplates[templateId];
+    const panel = document.getElementById('template-history');
+    const list = document.getElementById('template-history-list');
+    if (!template || !panel || !list) return;
+    
+    document.getElementById('template-history-title').textContent = `Version History: ${template.name}`;
+    document.getElementById('template-history-diff').innerHTML = '';
+    list.innerHTML = '<div class="no-templates">Loading...</div>';
+    panel.classList.remove('hidden');
+    
+    fetch(`/api/templates/${encodeURIComponent(templateId)}/versions`)
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            
+            list.innerHTML = '';
+            data.data.forEach(version => {
+                const current = version.version === template.version;
+                const item = document.createElement('div');
+                item.className = 'template-item';
+                item.innerHTML = `
+                    <div class="template-info">
+                        <div class="template-name">Version ${version.version}${current ? ' (current)' : ''}</div>
+                        ${version.note ? `<div class="template-description">${escapeHtml(version.note)}</div>` : ''}
+                        <div class="template-records-count">${new Date(version.timestamp).toLocaleString()}${version.author ? ` · ${escapeHtml(version.author)}` : ''}</div>
+                    </div>
+                    <div class="template-actions">
+                        ${version.version > 1 ? '<button class="diff-template"><i class="fas fa-exchange-alt"></i> Changes</button>' : ''}
+                        ${current ? '' : '<button class="revert-template"><i class="fas fa-undo"></i> Revert</button>'}
+                    </div>
+                `;
+                
+                const diffBtn = item.querySelector('.diff-template');
+                if (diffBtn) diffBtn.addEventListener('click', () => showTemplateDiff(templateId, version.version - 1, version.version));
+                const revertBtn = item.querySelector('.revert-template');
+                if (revertBtn) revertBtn.addEventListener('click', () => revertTemplate(templateId, version.version));
+                list.appendChild(item);
+            });
+        })
+        .catch(error => {
+            list.innerHTML = '';
+            showNotification('Failed to load template history: ' + error.message, 'error');
+        });
+}
+
+// Hide the version history panel
+function closeTemplateHistory() {
+    const panel = document.getElementById('template-history');
+    if (panel) panel.classList.add('hidden');
+}
+
+// Show the changes between two versions of a template
+function showTemplateDiff(templateId, from, to) {
+    const container = document.getElementById('template-history-diff');
+    if (!container) return;
+    
+    fetch(`/api/templates/${encodeURIComponent(templateId)}/diff?from=${from}&to=${to}`)
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            
+            const diff = data.data;
+            const notes = [];
+            if (diff.name_changed) notes.push('name changed');
+            if (diff.description_changed) notes.push('description changed');
+            diff.variables.forEach(v => notes.push(`variable ${v.name} ${v.op}`));
+            
+            const lines = diff.records.map(line => {
+                const marker = line.op === 'added' ? '+' : line.op === 'removed' ? '-' : ' ';
+                return `<div class="diff-line diff-${line.op}">${marker} ${escapeHtml(line.text)}</div>`;
+            }).join('');
+            
+            container.innerHTML = `
+                <h5>Version ${diff.from} → ${diff.to}: ${diff.added} added, ${diff.removed} removed${notes.length ? ', ' + escapeHtml(notes.join(', ')) : ''}</h5>
+                <div class="diff-lines">${lines || '<div class="diff-line">No record changes</div>'}</div>
+            `;
+        })
+        .catch(error => {
+            showNotification('Failed to load changes: ' + error.message, 'error');
+        });
+}
+
+// Restore an earlier version of a template as a new version
+function revertTemplate(templateId, version) {
+    const template = dnsTemplates[templateId];
+    if (!template) return;
+    
+    if (!confirm(`Revert "${template.name}" to version ${version}? This saves the old content as a new version.`)) {
+        return;
+    }
+    
+    fetch(`/api/templates/${encodeURIComponent(templateId)}/revert`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ version }),
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                showNotification(data.message || 'Failed to revert template', 'error');
+                return;
+            }
+            
+            showNotification(data.message, 'success');
+            return loadDNSTemplates().then(() => {
+                populateTemplateSelect();
+                populateTemplatesList();
+                showTemplateHistory(templateId);
+            });
+        })
+        .catch(error => {
+            showNotification('Failed to revert template: ' + error.message, 'error');
+        });
+}
+
+// Zone snapshots on the DNS page
+function setupSnapshots(domain) {
+    const takeBtn = document.getElementById('take-snapshot');
+    if (!takeBtn) return;
+    
+    takeBtn.addEventListener('click', () => takeSnapshot(domain));
+    document.getElementById('refresh-snapshots').addEventListener('click', () => loadSnapshots(domain));
+    loadSnapshots(domain);
+}
+
+// Load the snapshots of a zone
+function loadSnapshots(domain) {
+    const tbody = document.querySelector('#snapshots-table tbody');
+    if (!tbody) return;
+    
+    fetch(`/api/snapshots/${encodeURIComponent(domain)}`)
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            
+            tbody.innerHTML = '';
+            if (data.data.length === 0) {
+                tbody.innerHTML = '<tr><td colspan="5" class="loading-row">No snapshots yet.</td></tr>';
+                return;
+            }
+            
+            data.data.forEach(snapshot => {
+                const row = document.createElement('tr');
+                row.innerHTML = `
+                    <td>${new Date(snapshot.created_at).toLocaleString()}</td>
+                    <td>${escapeHtml(snapshot.created_by || '')}</td>
+                    <td>${escapeHtml(snapshot.reason || '')}</td>
+                    <td>${snapshot.record_count}</td>
+                    <td class="record-actions">
+                        <button class="btn btn-outline btn-sm compare-snapshot"><i class="fas fa-code-compare"></i> Compare</button>
+                        <button class="btn btn-sm restore-snapshot"><i class="fas fa-undo"></i> Restore</button>
+                    </td>
+                `;
+                row.querySelector('.compare-snapshot').addEventListener('click', () => compareSnapshot(domain, snapshot));
+                row.querySelector('.restore-snapshot').addEventListener('click', () => restoreSnapshot(domain, snapshot));
+                tbody.appendChild(row);
+            });
+        })
+        .catch(error => {
+            tbody.innerHTML = '';
+            showNotification('Failed to load snapshots: ' + error.message, 'error');
+        });
+}
+
+// Take a snapshot of a zone by hand
+function takeSnapshot(domain) {
+    const reasonInput = document.getElementById('snapshot-reason');
+    
+    fetch(`/api/snapshots/${encodeURIComponent(domain)}`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ reason: reasonInput.value.trim() }),
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                showNotification(data.message || 'Failed to take snapshot', 'error');
+                return;
+            }
+            reasonInput.value = '';
+            showNotification(data.message, 'success');
+            loadSnapshots(domain);
+        })
+        .catch(error => {
+            showNotification('Failed to take snapshot: ' + error.message, 'error');
+        });
+}
+
+// Show the changes restoring a snapshot would make to the live zone
+function compareSnapshot(domain, snapshot) {
+    fetch(`/api/snapshots/${encodeURIComponent(domain)}/${encodeURIComponent(snapshot.id)}/diff`)
+        .then(response => response.json())
+        .then(data => {
+            if (!data.results) {
+                showNotification(data.message || 'Failed to compare snapshot', 'error');
+                return;
+            }
+            document.getElementById('snapshot-results-title').textContent = `Changes to restore the snapshot from ${new Date(snapshot.created_at).toLocaleString()}`;
+            displayZoneChanges('snapshot-results', 'snapshot-content', data.results);
+        })
+        .catch(error => {
+            showNotification('Failed to compare snapshot: ' + error.message, 'error');
+        });
+}
+
+// Restore a snapshot after confirmation. The current records are snapshotted first.
+function restoreSnapshot(domain, snapshot) {
+    if (!confirm(`Restore ${domain} to the snapshot from ${new Date(snapshot.created_at).toLocaleString()}? Records that differ will be created, updated or deleted. The current records are snapshotted first.`)) {
+        return;
+    }
+    
+    fetch(`/api/snapshots/${encodeURIComponent(domain)}/${encodeURIComponent(snapshot.id)}/restore`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ dryRun: false }),
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.results) {
+                showNotification(`${data.message || 'Failed to restore snapshot'}${data.error ? ': ' + data.error : ''}`, 'error');
+                return;
+            }
+            showNotification(data.message, data.success ? 'success' : 'error');
+            document.getElementById('snapshot-results-title').textContent = 'Snapshot Restore Results';
+            displayZoneChanges('snapshot-results', 'snapshot-content', data.results);
+            loadSnapshots(domain);
+            loadDNSRecords(domain);
+        })
+        .catch(error => {
+            showNotification('Failed to restore snapshot: ' + error.message, 'error');
+        });
+}
+
+// Zone comparison on the DNS page
+const DIFF_STATUS_LABELS = {
+    added: 'Only in right',
+    removed: 'Only in left',
+    changed: 'Changed',
+    equal: 'Equal',
+};
+
+function setupZoneDiff(domain) {
+    const compareBtn = document.getElementById('diff-compare');
+    if (!compareBtn) return;
+    
+    const leftInput = document.getElementById('diff-left');
+    const rightInput = document.getElementById('diff-right');
+    leftInput.value = domain;
+    
+    compareBtn.addEventListener('click', () => {
+        document.getElementById('diff-results').classList.add('hidden');
+        loadZoneDiff();
+    });
+    document.getElementById('diff-swap').addEventListener('click', () => {
+        [leftInput.value, rightInput.value] = [rightInput.value, leftInput.value];
+    });
+    document.getElementById('diff-select-all').addEventListener('change', function() {
+        document.querySelectorAll('#diff-table .diff-select:not(:disabled)').forEach(checkbox => {
+            checkbox.checked = this.checked;
+        });
+    });
+    document.getElementById('diff-preview-copy').addEventListener('click', () => copyDiffRecords(true));
+    document.getElementById('diff-copy').addEventListener('click', () => copyDiffRecords(false));
+}
+
+// Compare the two zones
+function loadZoneDiff() {
+    const left = document.getElementById('diff-left').value.trim();
+    const right = document.getElementById('diff-right').value.trim();
+    if (!left || !right) {
+        showNotification('Enter both zones to compare', 'error');
+        return;
+    }
+    
+    const params = new URLSearchParams({ left, right });
+    if (document.getElementById('diff-show-equal').checked) {
+        params.set('all', 'true');
+    }
+    
+    fetch(`/api/dns/diff?${params}`)
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            displayZoneDiff(data.data);
+        })
+        .catch(error => {
+            showNotification('Failed to compare zones: ' + error.message, 'error');
+        });
+}
+
+// Format one side of a zone diff entry
+function formatDiffRecord(record, fields) {
+    if (!record) return '';
+    const differs = field => fields && fields.includes(field) ? ' class="diff-field"' : '';
+    let html = `<span${differs('content')}>${escapeHtml(record.content)}</span>`;
+    if (record.proxied) html += ` <i class="fas fa-cloud" title="Proxied"${differs('proxied')}></i>`;
+    html += ` <small${differs('ttl')}>TTL ${record.ttl === 1 ? 'auto' : record.ttl}</small>`;
+    if (record.comment) html += `<br><small${differs('comment')}>${escapeHtml(record.comment)}</small>`;
+    return html;
+}
+
+// Render the comparison of two zones
+function displayZoneDiff(diff) {
+    document.getElementById('diff-view').classList.remove('hidden');
+    document.getElementById('diff-select-all').checked = false;
+    document.getElementById('diff-left-title').textContent = diff.left;
+    document.getElementById('diff-right-title').textContent = diff.right;
+    document.getElementById('diff-copy').innerHTML = `<i class="fas fa-copy"></i> Copy Selected to ${escapeHtml(diff.right)}`;
+    document.getElementById('diff-summary').textContent =
+        `${diff.removed} only in ${diff.left}, ${diff.added} only in ${diff.right}, ${diff.changed} changed, ${diff.unchanged} equal`;
+    
+    const tbody = document.querySelector('#diff-table tbody');
+    tbody.innerHTML = '';
+    if (diff.entries.length === 0) {
+        tbody.innerHTML = '<tr><td colspan="6" class="loading-row">The zones have the same records.</td></tr>';
+        return;
+    }
+    
+    diff.entries.forEach(entry => {
+        // Only records of the left zone that differ can be copied to the right zone
+        const copyable = entry.left && entry.status !== 'equal';
+        const row = document.createElement('tr');
+        row.className = `diff-entry diff-${entry.status}`;
+        row.innerHTML = `
+            <td><input type="checkbox" class="diff-select" value="${escapeHtml(entry.left ? entry.left.id : '')}"${copyable ? '' : ' disabled'}></td>
+            <td>${escapeHtml(DIFF_STATUS_LABELS[entry.status] || entry.status)}</td>
+            <td>${escapeHtml(entry.type)}</td>
+            <td>${escapeHtml(entry.name)}</td>
+            <td>${formatDiffRecord(entry.left, entry.fields)}</td>
+            <td>${formatDiffRecord(entry.right, entry.fields)}</td>
+        `;
+        tbody.appendChild(row);
+    });
+}
+
+// Copy the selected records of the left zone to the right zone
+function copyDiffRecords(dryRun) {
+    const from = document.getElementById('diff-left-title').textContent;
+    const to = document.getElementById('diff-right-title').textContent;
+    const recordIds = Array.from(document.querySelectorAll('#diff-table .diff-select:checked')).map(checkbox => checkbox.value);
+    if (recordIds.length === 0) {
+        showNotification('Select the records to copy', 'error');
+        return;
+    }
+    if (!dryRun && !confirm(`Copy ${recordIds.length} record(s) from ${from} to ${to}? Changed records in ${to} are updated.`)) {
+        return;
+    }
+    
+    fetch('/api/dns/copy', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ from, to, record_ids: recordIds, dryRun }),
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.results) {
+                showNotification(`${data.message || 'Failed to copy records'}${data.error ? ': ' + data.error : ''}`, 'error');
+                return;
+            }
+            showNotification(data.message, data.success ? 'success' : 'error');
+            displayZoneChanges('diff-results', 'diff-content', data.results);
+            if (!dryRun) {
+                loadZoneDiff();
+            }
+        })
+        .catch(error => {
+            showNotification('Failed to copy records: ' + error.message, 'error');
+        });
+}
+
+// Cloning the zone on the DNS page onto other zones
+function setupCloneZone(domain) {
+    const form = document.getElementById('clone-zone-form');
+    if (!form) return;
+    
+    form.addEventListener('submit', function(e) {
+        e.preventDefault();
+        cloneZone(domain, false);
+    });
+    document.getElementById('preview-clone').addEventListener('click', () => cloneZone(domain, true));
+}
+
+// Clone the zone, or preview the changes with dryRun
+function cloneZone(domain, dryRun) {
+    const targets = document.getElementById('clone-targets').value.trim();
+    if (!targets) {
+        showNotification('Enter at least one target domain', 'error');
+        return;
+    }
+    const mode = document.getElementById('clone-mode').value;
+    const createZones = document.getElementById('clone-create-zones').checked;
+    if (!dryRun && !confirm(`Clone every record of ${domain} onto the target domains?${mode === 'overwrite' ? ' Existing records with the same name and type will be replaced.' : ''}`)) {
+        return;
+    }
+    
+    fetch('/api/dns/clone', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ source: domain, targets, mode, create_zones: createZones, dryRun }),
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.results || data.results.length === 0) {
+                showNotification(`${data.message || 'Failed to clone zone'}${data.error ? ': ' + data.error : ''}`, 'error');
+                return;
+            }
+            showNotification(data.message, data.success ? 'success' : 'error');
+            displayZoneChanges('clone-results', 'clone-content', data.results);
+        })
+        .catch(error => {
+            showNotification('Failed to clone zone: ' + error.message, 'error');
+        });
+}
+
+// Recently deleted records on the DNS page, which can be restored within the undo window
+function setupDeletedRecords(domain) {
+    const refreshBtn = document.getElementById('refresh-deleted');
+    if (!refreshBtn) return;
+    
+    refreshBtn.addEventListener('click', () => loadDeletedRecords(domain));
+    loadDeletedRecords(domain);
+}
+
+// Load the deletes of a zone that can still be undone
+function loadDeletedRecords(domain) {
+    const tbody = document.querySelector('#deleted-table tbody');
+    if (!tbody) return;
+    
+    fetch(`/api/dns/${encodeURIComponent(domain)}/deleted`)
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            
+            tbody.innerHTML = '';
+            if (data.data.length === 0) {
+                tbody.innerHTML = '<tr><td colspan="5" class="loading-row">No recently deleted records.</td></tr>';
+                return;
+            }
+            
+            data.data.forEach(batch => {
+                const records = batch.records
+                    .map(record => `${escapeHtml(record.type)} ${escapeHtml(record.name)} → ${escapeHtml(record.content)}`)
+                    .join('<br>');
+                const row = document.createElement('tr');
+                row.innerHTML = `
+                    <td>${new Date(batch.deleted_at).toLocaleString()}</td>
+                    <td>${escapeHtml(batch.deleted_by || '')}</td>
+                    <td class="audit-change">${records}</td>
+                    <td>${new Date(batch.expires_at).toLocaleTimeString()}</td>
+                    <td class="record-actions">
+                        <button class="btn btn-sm undo-delete"><i class="fas fa-rotate-left"></i> Undo</button>
+                    </td>
+                `;
+                row.querySelector('.undo-delete').addEventListener('click', () => undoDelete(domain, batch.id));
+                tbody.appendChild(row);
+            });
+        })
+        .catch(error => {
+            tbody.innerHTML = '';
+            showNotification('Failed to load deleted records: ' + error.message, 'error');
+        });
+}
+
+// Show a notification with an Undo button after a delete
+function showUndoNotification(domain, message, undoId) {
+    const notificationEl = document.createElement('div');
+    notificationEl.className = 'notification success';
+    notificationEl.textContent = message + ' ';
+    
+    const undoBtn = document.createElement('button');
+    undoBtn.className = 'btn btn-outline btn-sm';
+    undoBtn.innerHTML = '<i class="fas fa-rotate-left"></i> Undo';
+    undoBtn.addEventListener('click', () => {
+        notificationEl.remove();
+        undoDelete(domain, undoId);
+    });
+    notificationEl.appendChild(undoBtn);
+    
+    document.getElementById('notifications').appendChild(notificationEl);
+    setTimeout(() => notificationEl.remove(), 15000);
+}
+
+// Recreate the records removed by a delete
+function undoDelete(domain, undoId) {
+    fetch(`/api/dns/${encodeURIComponent(domain)}/deleted/${encodeURIComponent(undoId)}/undo`, {
+        method: 'POST',
+    })
+        .then(response => response.json())
+        .then(data => {
+            showNotification(data.message, data.success ? 'success' : 'error');
+            (data.results || []).filter(result => !result.success).forEach(result => {
+                showNotification(`${result.type} ${result.name}: ${result.error}`, 'error');
+            });
+            loadDNSRecords(domain);
+            loadDeletedRecords(domain);
+        })
+        .catch(error => {
+            showNotification('Failed to undo delete: ' + error.message, 'error');
+        });
+}
+
+// Audit log page
+const AUDIT_PAGE_SIZE = 50;
+
+const AUDIT_ACTION_LABELS = {
+    'record.create': 'Record created',
+    'record.update': 'Record updated',
+    'record.delete': 'Record deleted',
+    'record.undo': 'Delete undone',
+    'record.copy': 'Records copied',
+    'record.replace': 'Find and replace',
+    'zone.add': 'Zone added',
+    'zone.clone': 'Zone cloned',
+    'zone.delete': 'Zone deleted',
+    'zone.pause': 'Zone paused',
+    'zone.unpause': 'Zone resumed',
+    'zone.dev_mode': 'Development mode',
+    'zone.settings': 'Zone settings',
+    'zone.dnssec': 'DNSSEC',
+    'template.apply': 'Template applied',
+    'snapshot.restore': 'Snapshot restored',
+};
+
+// Build the audit filter query string from the filter form
+function auditQueryString() {
+    const params = new URLSearchParams();
+    [['q', 'audit-search'], ['zone', 'audit-zone'], ['actor', 'audit-actor'], ['action', 'audit-action'],
+        ['source', 'audit-source'], ['from', 'audit-from'], ['to', 'audit-to']].forEach(([key, id]) => {
+        const value = document.getElementById(id).value.trim();
+        if (value) params.set(key, value);
+    });
+    return params;
+}
+
+// Setup the audit log filters and load the first page
+function setupAuditPage() {
+    const form = document.getElementById('audit-filters');
+    if (!form) return;
+    
+    form.addEventListener('submit', function(e) {
+        e.preventDefault();
+        loadAuditLog(0);
+    });
+    
+    document.getElementById('audit-export').addEventListener('click', () => {
+        window.location.href = `/api/audit/export?${auditQueryString()}`;
+    });
+    
+    loadAuditLog(0);
+}
+
+// Load a page of audit entries matching the filters
+function loadAuditLog(offset) {
+    const params = auditQueryString();
+    params.set('offset', offset);
+    params.set('limit', AUDIT_PAGE_SIZE);
+    
+    fetch(`/api/audit?${params}`)
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            displayAuditLog(data);
+        })
+        .catch(error => {
+            document.getElementById('audit-count').textContent = '';
+            showNotification('Failed to load audit log: ' + error.message, 'error');
+        });
+}
+
+// Format the state of a record in an audit entry
+function formatAuditRecord(record) {
+    if (!record) return '';
+    const proxied = record.proxied ? ' <i class="fas fa-cloud" title="Proxied"></i>' : '';
+    return `${escapeHtml(record.type)} ${escapeHtml(record.name)} → ${escapeHtml(record.content)}${proxied}`;
+}
+
+// Render a page of audit entries
+function displayAuditLog(data) {
+    const tbody = document.querySelector('#audit-table tbody');
+    const pagination = document.getElementById('audit-pagination');
+    
+    document.getElementById('audit-count').textContent = `${data.total} entries`;
+    tbody.innerHTML = '';
+    
+    if (data.data.length === 0) {
+        tbody.innerHTML = '<tr><td colspan="7" class="loading-row">No audit entries match the filters.</td></tr>';
+    }
+    
+    data.data.forEach(entry => {
+        let change = escapeHtml(entry.detail || '');
+        if (entry.before && entry.after) {
+            change = `<div class="audit-before">${formatAuditRecord(entry.before)}</div><div class="audit-after">${formatAuditRecord(entry.after)}</div>`;
+        } else if (entry.before) {
+            change = `<div class="audit-before">${formatAuditRecord(entry.before)}</div>`;
+        } else if (entry.after) {
+            change = `<div class="audit-after">${formatAuditRecord(entry.after)}</div>`;
+        }
+        
+        const zone = entry.zone
+            ? `<a href="/dns/${encodeURIComponent(entry.zone)}">${escapeHtml(entry.zone)}</a>`
+            : '';
+        const result = entry.success
+            ? '<span class="audit-ok"><i class="fas fa-check"></i> OK</span>'
+            : `<span class="audit-failed" title="${escapeHtml(entry.error || '')}"><i class="fas fa-times"></i> Failed</span>`;
+        
+        const row = document.createElement('tr');
+        row.innerHTML = `
+            <td title="${escapeHtml(entry.request_id || '')}">${new Date(entry.timestamp).toLocaleString()}</td>
+            <td>${escapeHtml(entry.actor || '')}</td>
+            <td>${escapeHtml(entry.source)}</td>
+            <td>${escapeHtml(AUDIT_ACTION_LABELS[entry.action] || entry.action)}</td>
+            <td>${zone}</td>
+            <td class="audit-change">${change}</td>
+            <td>${result}</td>
+        `;
+        tbody.appendChild(row);
+    });
+    
+    // Previous / next pages
+    pagination.innerHTML = '';
+    if (data.total <= data.limit) return;
+    
+    const controls = document.createElement('div');
+    controls.className = 'pagination-controls';
+    controls.innerHTML = `<span>${data.offset + 1}–${Math.min(data.offset + data.limit, data.total)} of ${data.total}</span>`;
+    if (data.offset > 0) {
+        const prev = document.createElement('button');
+        prev.className = 'btn btn-outline btn-sm';
+        prev.innerHTML = '<i class="fas fa-chevron-left"></i> Previous';
+        prev.addEventListener('click', () => loadAuditLog(Math.max(0, data.offset - data.limit)));
+        controls.prepend(prev);
+    }
+    if (data.offset + data.limit < data.total) {
+        const next = document.createElement('button');
+        next.className = 'btn btn-outline btn-sm';
+        next.innerHTML = 'Next <i class="fas fa-chevron-right"></i>';
+        next.addEventListener('click', () => loadAuditLog(data.offset + data.limit));
+        controls.appendChild(next);
+    }
+    pagination.appendChild(controls);
+}
+
+// Backups page
+let backupPollTimer = null;
+
+function setupBackupsPage() {
+    const runBtn = document.getElementById('run-backup');
+    if (!runBtn) return;
+    
+    runBtn.addEventListener('click', runBackup);
+    document.getElementById('refresh-backups').addEventListener('click', loadBackups);
+    loadBackups();
+}
+
+// Load the backup configuration and the last backup of every zone
+function loadBackups() {
+    fetch('/api/backups')
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            displayBackups(data.data);
+        })
+        .catch(error => {
+            showNotification('Failed to load backups: ' + error.message, 'error');
+        });
+}
+
+// Start a backup of all zones, then follow it until it finishes
+function runBackup() {
+    const runBtn = document.getElementById('run-backup');
+    runBtn.disabled = true;
+    
+    fetch('/api/backups/run', { method: 'POST' })
+        .then(response => response.json())
+        .then(data => {
+            showNotification(data.message, data.success ? 'success' : 'error');
+            loadBackups();
+        })
+        .catch(error => {
+            runBtn.disabled = false;
+            showNotification('Failed to start backup: ' + error.message, 'error');
+        });
+}
+
+// Render the backup configuration and zone table
+function displayBackups(status) {
+    const formatTime = value => value ? new Date(value).toLocaleString() : 'Never';
+    
+    const schedule = status.scheduled
+        ? `Every ${escapeHtml(status.interval)}, next at ${formatTime(status.next_run)}`
+        : 'Not scheduled (set BACKUP_INTERVAL, CLOUDFLARE_EMAIL and CLOUDFLARE_API_KEY)';
+    const retention = status.git
+        ? 'Kept in git history'
+        : [status.keep > 0 ? `${status.keep} backups per zone` : 'All backups',
+           status.max_age ? `up to ${escapeHtml(status.max_age)} old` : ''].filter(Boolean).join(', ');
+    
+    let lastRun = 'Never';
+    if (status.last_run) {
+        const run = status.last_run;
+        lastRun = `${formatTime(run.finished_at)} (${escapeHtml(run.trigger)}${run.actor ? ' by ' + escapeHtml(run.actor) : ''})`;
+        if (status.owner) lastRun += `: ${run.zones} zones, ${run.failed} failed`;
+        if (run.commit) lastRun += `, commit ${escapeHtml(run.commit)}`;
+        if (run.error) lastRun += ` <span class="audit-failed">${escapeHtml(run.error)}</span>`;
+    }
+    
+    document.getElementById('backup-config').innerHTML = `
+        <dl>
+            ${status.dir ? `<dt>Directory</dt><dd><code>${escapeHtml(status.dir)}</code>${status.git ? ' (git repository)' : ''}</dd>` : ''}
+            <dt>Schedule</dt><dd>${schedule}</dd>
+            <dt>Retention</dt><dd>${retention}</dd>
+            <dt>Last run</dt><dd>${lastRun}</dd>
+        </dl>
+    `;
+    
+    document.getElementById('backup-running').classList.toggle('hidden', !status.running);
+    document.getElementById('run-backup').disabled = status.running;
+    
+    const tbody = document.querySelector('#backups-table tbody');
+    tbody.innerHTML = '';
+    if (status.zones.length === 0) {
+        tbody.innerHTML = '<tr><td colspan="6" class="loading-row">No backups yet.</td></tr>';
+    }
+    
+    status.zones.forEach(zone => {
+        const result = zone.error
+            ? `<span class="audit-failed" title="${escapeHtml(zone.error)}"><i class="fas fa-times"></i> Failed</span>`
+            : '<span class="audit-ok"><i class="fas fa-check"></i> OK</span>';
+        const files = (zone.files || []).map(file => `<code>${escapeHtml(file)}</code>`).join('<br>');
+        
+        const row = document.createElement('tr');
+        row.innerHTML = `
+            <td><a href="/dns/${encodeURIComponent(zone.zone)}">${escapeHtml(zone.zone)}</a></td>
+            <td>${formatTime(zone.last_success)}</td>
+            <td>${formatTime(zone.last_attempt)}</td>
+            <td>${zone.record_count}</td>
+            <td>${files}</td>
+            <td>${result}</td>
+        `;
+        tbody.appendChild(row);
+    });
+    
+    // Refresh until a running backup finishes
+    clearTimeout(backupPollTimer);
+    if (status.running) {
+        backupPollTimer = setTimeout(loadBackups, 3000);
+    }
+}
+
+let lastSearchZones = [];
+let replacePollTimer = null;
+
+// Cross-zone search page
+function setupSearchPage() {
+    const form = document.getElementById('search-form');
+    if (!form) return;
+    
+    form.addEventListener('submit', function(e) {
+        e.preventDefault();
+        searchAllZones(false);
+    });
+    document.getElementById('search-refresh').addEventListener('click', () => searchAllZones(true));
+    setupReplace();
+}
+
+// Search the records of every zone, optionally bypassing the server cache
+function searchAllZones(refresh) {
+    const params = new URLSearchParams();
+    const fields = { q: 'search-q', name: 'search-name', content: 'search-content', type: 'search-type', cidr: 'search-cidr', zone: 'search-zone' };
+    Object.entries(fields).forEach(([key, id]) => {
+        const value = document.getElementById(id).value.trim();
+        if (value) params.set(key, value);
+    });
+    if (refresh) params.set('refresh', 'true');
+    
+    const count = document.getElementById('search-count');
+    count.innerHTML = '<i class="fas fa-spinner fa-spin"></i> Searching all zones...';
+    
+    fetch(`/api/search?${params.toString()}`)
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            displaySearchResults(data.message, data.data);
+        })
+        .catch(error => {
+            count.textContent = 'Search failed';
+            showNotification('Search failed: ' + error.message, 'error');
+        });
+}
+
+// Render the matching records with a link to edit each one in its zone
+function displaySearchResults(message, outcome) {
+    let summary = escapeHtml(message);
+    if (outcome.oldest_data) {
+        summary += ` (data from ${new Date(outcome.oldest_data).toLocaleTimeString()})`;
+    }
+    if (outcome.errors.length > 0) {
+        const failed = outcome.errors.map(e => `${e.zone}: ${e.error}`).join('\n');
+        summary += ` <span class="audit-failed" title="${escapeHtml(failed)}">${outcome.errors.length} zones could not be searched</span>`;
+    }
+    document.getElementById('search-count').innerHTML = summary;
+    
+    lastSearchZones = [...new Set(outcome.results.map(result => result.zone))];
+    
+    const tbody = document.querySelector('#search-table tbody');
+    tbody.innerHTML = '';
+    if (outcome.results.length === 0) {
+        tbody.innerHTML = '<tr><td colspan="6" class="loading-row">No matching records.</td></tr>';
+        return;
+    }
+    
+    outcome.results.forEach(result => {
+        const record = result.record;
+        const proxiedStatus = record.proxied ?
+            '<span class="proxied-status proxied"><i class="fas fa-shield-alt"></i> Proxied</span>' :
+            '<span class="proxied-status direct"><i class="fas fa-globe"></i> Direct</span>';
+        const zone = result.unicode_zone ? `${escapeHtml(result.unicode_zone)} <small>(${escapeHtml(result.zone)})</small>` : escapeHtml(result.zone);
+        const row = document.createElement('tr');
+        row.innerHTML = `
+            <td><a href="/dns/${encodeURIComponent(result.zone)}">${zone}</a></td>
+            <td><span class="record-type-badge type-${escapeHtml(record.type.toLowerCase())}">${escapeHtml(record.type)}</span></td>
+            <td class="record-name">${escapeHtml(record.name)}</td>
+            <td class="record-content" title="${escapeHtml(record.content)}">${escapeHtml(record.content)}</td>
+            <td>${proxiedStatus}</td>
+            <td class="record-actions">
+                <a href="${escapeHtml(result.edit_url)}" class="btn-icon btn-edit" title="Edit Record">
+                    <i class="fas fa-edit"></i>
+                </a>
+            </td>
+        `;
+        tbody.appendChild(row);
+    });
+}
+
+// Find and replace across zones on the search page
+function setupReplace() {
+    const form = document.getElementById('replace-form');
+    if (!form) return;
+    
+    form.addEventListener('submit', function(e) {
+        e.preventDefault();
+        runReplace(false);
+    });
+    document.getElementById('preview-replace').addEventListener('click', () => runReplace(true));
+    document.getElementById('replace-use-results').addEventListener('click', function() {
+        if (lastSearchZones.length === 0) {
+            showNotification('Search first to find the zones with matching records', 'error');
+            return;
+        }
+        document.getElementById('replace-zones').value = lastSearchZones.join('\n');
+    });
+}
+
+// Preview a find and replace, or start it as a background job
+function runReplace(preview) {
+    const body = {
+        zones: document.getElementById('replace-zones').value.trim(),
+        mode: document.getElementById('replace-mode').value,
+        find: document.getElementById('replace-find').value,
+        replace: document.getElementById('replace-with').value,
+        type: document.getElementById('replace-type').value,
+    };
+    if (!body.zones || !body.find) {
+        showNotification('Enter the zones and the content to find', 'error');
+        return;
+    }
+    if (!preview && !confirm('Replace the content of every matching record in these zones? Each zone is snapshotted first.')) {
+        return;
+    }
+    
+    fetch(preview ? '/api/replace/preview' : '/api/replace', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(body),
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            showNotification(data.message, 'success');
+            if (preview) {
+                displayZoneChanges('replace-results', 'replace-content', data.results);
+            } else {
+                document.getElementById('run-replace').disabled = true;
+                followReplaceJob(data.data.id);
+            }
+        })
+        .catch(error => {
+            showNotification('Find and replace failed: ' + error.message, 'error');
+        });
+}
+
+// Poll a find and replace job, showing its progress and the results so far
+function followReplaceJob(id) {
+    fetch(`/api/replace/${encodeURIComponent(id)}`)
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            const job = data.data;
+            const progress = document.getElementById('replace-progress');
+            progress.classList.remove('hidden');
+            
+            if (job.status === 'done') {
+                progress.textContent = `Done: ${job.updated} records updated, ${job.failed} failed in ${job.zones.length} zones`;
+                document.getElementById('run-replace').disabled = false;
+                showNotification(progress.textContent, job.failed === 0 ? 'success' : 'error');
+            } else {
+                progress.innerHTML = `<i class="fas fa-spinner fa-spin"></i> ${job.status === 'queued' ? 'Queued' : `Replacing... ${job.done} of ${job.zones.length} zones`}`;
+                clearTimeout(replacePollTimer);
+                replacePollTimer = setTimeout(() => followReplaceJob(id), 2000);
+            }
+            if (job.results.length > 0) {
+                displayZoneChanges('replace-results', 'replace-content', job.results);
+            }
+        })
+        .catch(error => {
+            document.getElementById('run-replace').disabled = false;
+            showNotification('Failed to follow find and replace: ' + error.message, 'error');
+        });
+}
+
+// Zone settings page
+const SETTING_SWITCHES = {
+    'setting-always-https': 'always_use_https',
+    'setting-https-rewrites': 'automatic_https_rewrites',
+    'setting-ipv6': 'ipv6',
+    'setting-brotli': 'brotli',
+};
+
+function setupSettingsPage(domain) {
+    document.getElementById('zone-settings-form').addEventListener('submit', function(e) {
+        e.preventDefault();
+        saveZoneSettings(domain);
+    });
+    document.getElementById('reload-settings').addEventListener('click', () => loadZoneSettings(domain));
+    document.getElementById('setting-hsts').addEventListener('change', updateHSTSOptions);
+    document.getElementById('apply-settings-form').addEventListener('submit', function(e) {
+        e.preventDefault();
+        applySettingsToDomains();
+    });
+    
+    document.getElementById('profile-select').addEventListener('change', function() {
+        const profile = settingsProfiles.find(p => p.id === this.value);
+        document.getElementById('profile-select-description').textContent = profile ? profile.description : '';
+    });
+    document.getElementById('load-profile').addEventListener('click', function() {
+        const profile = settingsProfiles.find(p => p.id === document.getElementById('profile-select').value);
+        if (!profile) {
+            showNotification('Select a profile to load', 'error');
+            return;
+        }
+        fillSettingsForm(profile.settings);
+        showNotification(`Profile ${profile.name} loaded, save the form to apply it to ${domain}`, 'success');
+    });
+    document.getElementById('update-profile').addEventListener('click', updateSettingsProfile);
+    document.getElementById('delete-profile').addEventListener('click', deleteSettingsProfile);
+    document.getElementById('create-profile-form').addEventListener('submit', function(e) {
+        e.preventDefault();
+        createSettingsProfile();
+    });
+    
+    document.getElementById('enable-dnssec').addEventListener('click', () => setDNSSEC(domain, true));
+    document.getElementById('disable-dnssec').addEventListener('click', () => setDNSSEC(domain, false));
+    document.getElementById('reload-dnssec').addEventListener('click', () => loadDNSSEC(domain));
+    
+    document.getElementById('save-proxy-account').addEventListener('click', () => saveProxyDefaults('/api/proxy/policy', '.proxy-account-default', domain));
+    document.getElementById('save-proxy-zone').addEventListener('click', () => saveProxyDefaults(`/api/proxy/policy/${encodeURIComponent(domain)}`, '.proxy-zone-default', domain));
+    document.getElementById('proxy-zone-on').addEventListener('click', () => setZoneProxy(domain, true));
+    document.getElementById('proxy-zone-off').addEventListener('click', () => setZoneProxy(domain, false));
+    
+    loadZoneSettings(domain);
+    loadSettingsProfiles(['profile-select', 'apply-settings-profile']);
+    loadDNSSEC(domain);
+    loadProxyDefaults(domain);
+}
+
+// Fill the proxy defaults card with the account defaults and those of the zone
+function loadProxyDefaults(domain) {
+    fetch('/api/proxy/policy')
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            const zoneDefaults = (data.data.zones || {})[domain.toLowerCase()] || {};
+            document.querySelectorAll('.proxy-account-default').forEach(select => {
+                select.value = String(!!data.data.defaults[select.dataset.type]);
+            });
+            document.querySelectorAll('.proxy-zone-default').forEach(select => {
+                const type = select.dataset.type;
+                select.value = type in zoneDefaults ? String(zoneDefaults[type]) : '';
+            });
+        })
+        .catch(error => {
+            showNotification('Failed to load proxy defaults: ' + error.message, 'error');
+        });
+}
+
+// Save the proxy defaults chosen in the selects matching selector. Selects left on the
+// account default are not sent.
+function saveProxyDefaults(url, selector, domain) {
+    const defaults = {};
+    document.querySelectorAll(selector).forEach(select => {
+        if (select.value !== '') {
+            defaults[select.dataset.type] = select.value === 'true';
+        }
+    });
+    
+    fetch(url, {
+        method: 'PUT',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ defaults }),
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            showNotification(data.message, 'success');
+            loadProxyDefaults(domain);
+        })
+        .catch(error => {
+            showNotification('Failed to save proxy defaults: ' + error.message, 'error');
+        });
+}
+
+// Turn the proxy on or off for every record of the zone that can be proxied
+function setZoneProxy(domain, proxied) {
+    const question = proxied ?
+        `Proxy every A, AAAA and CNAME record of ${domain} through Cloudflare?` :
+        `Turn the proxy off for every record of ${domain}? The origin addresses become visible in DNS.`;
+    if (!confirm(question)) return;
+    
+    const button = document.getElementById(proxied ? 'proxy-zone-on' : 'proxy-zone-off');
+    button.disabled = true;
+    
+    fetch(`/api/dns/${encodeURIComponent(domain)}/proxy`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ proxied }),
+    })
+        .then(response => response.json())
+        .then(data => {
+            showNotification(data.message, data.success ? 'success' : 'error');
+            if (data.results) {
+                displayZoneChanges('proxy-zone-results', 'proxy-zone-content', data.results);
+            }
+        })
+        .catch(error => {
+            showNotification('Failed to change the proxy status: ' + error.message, 'error');
+        })
+        .finally(() => {
+            button.disabled = false;
+        });
+}
+
+// DNSSEC status, DS record and parent check of a zone
+const DNSSEC_PROBLEMS = {
+    missing_ds: 'DS missing at the registrar',
+    mismatch_ds: 'DS at the registrar does not match',
+    stale_ds: 'DS left at the registrar',
+};
+
+function loadDNSSEC(domain) {
+    const statusEl = document.getElementById('dnssec-status');
+    statusEl.textContent = 'Loading...';
+    
+    fetch(`/api/dnssec/${encodeURIComponent(domain)}`)
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            displayDNSSEC(data.data, data.message);
+        })
+        .catch(error => {
+            statusEl.textContent = 'Failed to load the DNSSEC status';
+            showNotification('Failed to load DNSSEC status: ' + error.message, 'error');
+        });
+}
+
+function displayDNSSEC(status, message) {
+    const enabled = status.status === 'active' || status.status === 'pending';
+    document.getElementById('enable-dnssec').disabled = enabled;
+    document.getElementById('disable-dnssec').disabled = status.status === 'disabled' || status.status === 'pending-disabled';
+    
+    let parent = status.ds_at_parent ? 'DS record found' : 'No matching DS record';
+    if (status.parent_error) {
+        parent = `<span class="audit-failed">${escapeHtml(status.parent_error)}</span>`;
+    } else if (status.parent_ds.length > 0) {
+        parent += '<ul class="record-changes">' + status.parent_ds.map(ds => `
+            <li><code>${ds.key_tag} ${ds.algorithm} ${ds.digest_type} ${escapeHtml(ds.digest)}</code></li>
+        `).join('') + '</ul>';
+    }
+    
+    const dsHtml = !enabled && status.status !== 'pending-disabled' ? '' : `
+        <dt>Key tag</dt><dd><code>${status.key_tag}</code></dd>
+        <dt>Algorithm</dt><dd><code>${escapeHtml(status.algorithm)}</code></dd>
+        <dt>Digest type</dt><dd><code>${escapeHtml(status.digest_type)}</code></dd>
+        <dt>Digest</dt><dd><code>${escapeHtml(status.digest)}</code></dd>
+        <dt>DS record</dt><dd><code>${escapeHtml(status.ds)}</code></dd>
+    `;
+    
+    document.getElementById('dnssec-status').innerHTML = `
+        <div class="result-summary ${status.problem ? 'dnssec-problem' : ''}">${escapeHtml(message)}</div>
+        <dl>
+            <dt>Status</dt><dd><span class="domain-status dnssec-${escapeHtml(status.status)}">${escapeHtml(status.status)}</span></dd>
+            ${dsHtml}
+            <dt>Parent zone</dt><dd>${parent}</dd>
+        </dl>
+    `;
+}
+
+function setDNSSEC(domain, enable) {
+    if (!enable && !confirm(`Disable DNSSEC on ${domain}? Remove the DS record at the registrar first, or resolvers that validate DNSSEC will fail to resolve the domain.`)) {
+        return;
+    }
+    
+    const button = document.getElementById(enable ? 'enable-dnssec' : 'disable-dnssec');
+    const originalHtml = button.innerHTML;
+    button.disabled = true;
+    button.innerHTML = '<i class="fas fa-spinner fa-spin"></i> Saving...';
+    
+    fetch(`/api/dnssec/${encodeURIComponent(domain)}/${enable ? 'enable' : 'disable'}`, {
+        method: 'POST'
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            showNotification(data.message, data.data && data.data.problem ? 'warning' : 'success');
+            button.innerHTML = originalHtml;
+            if (data.data) {
+                displayDNSSEC(data.data, data.message);
+            } else {
+                loadDNSSEC(domain);
+            }
+        })
+        .catch(error => {
+            button.disabled = false;
+            button.innerHTML = originalHtml;
+            showNotification('Failed to change DNSSEC: ' + error.message, 'error');
+        });
+}
+
+// Show the HSTS options only when HSTS is turned on
+function updateHSTSOptions() {
+    const enabled = document.getElementById('setting-hsts').value === 'on';
+    document.getElementById('hsts-options').style.display = enabled ? '' : 'none';
+}
+
+// Fill the settings form with the current settings of the zone
+function loadZoneSettings(domain) {
+    fetch(`/api/settings/${encodeURIComponent(domain)}`)
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            fillSettingsForm(data.data);
+        })
+        .catch(error => {
+            showNotification('Failed to load zone settings: ' + error.message, 'error');
+        });
+}
+
+// Set the settings form to the given settings; settings that are not set are left unchanged
+function fillSettingsForm(settings) {
+    document.getElementById('setting-ssl').value = settings.ssl || '';
+    document.getElementById('setting-min-tls').value = settings.min_tls_version || '';
+    Object.entries(SETTING_SWITCHES).forEach(([id, key]) => {
+        document.getElementById(id).value = key in settings ? (settings[key] ? 'on' : 'off') : '';
+    });
+    
+    const hsts = settings.hsts;
+    document.getElementById('setting-hsts').value = hsts ? (hsts.enabled ? 'on' : 'off') : '';
+    if (hsts && hsts.enabled) {
+        document.getElementById('setting-hsts-max-age').value = hsts.max_age;
+        document.getElementById('setting-hsts-subdomains').checked = hsts.include_subdomains;
+        document.getElementById('setting-hsts-preload').checked = hsts.preload;
+        document.getElementById('setting-hsts-nosniff').checked = hsts.nosniff;
+    }
+    updateHSTSOptions();
+}
+
+// Read the settings form, leaving out the settings left unchanged
+function collectZoneSettings() {
+    const settings = {};
+    const ssl = document.getElementById('setting-ssl').value;
+    if (ssl) settings.ssl = ssl;
+    const minTLS = document.getElementById('setting-min-tls').value;
+    if (minTLS) settings.min_tls_version = minTLS;
+    Object.entries(SETTING_SWITCHES).forEach(([id, key]) => {
+        const value = document.getElementById(id).value;
+        if (value) settings[key] = value === 'on';
+    });
+    
+    const hsts = document.getElementById('setting-hsts').value;
+    if (hsts === 'off') {
+        settings.hsts = { enabled: false, max_age: 0, include_subdomains: false, preload: false, nosniff: false };
+    } else if (hsts === 'on') {
+        settings.hsts = {
+            enabled: true,
+            max_age: parseInt(document.getElementById('setting-hsts-max-age').value, 10) || 0,
+            include_subdomains: document.getElementById('setting-hsts-subdomains').checked,
+            preload: document.getElementById('setting-hsts-preload').checked,
+            nosniff: document.getElementById('setting-hsts-nosniff').checked,
+        };
+    }
+    return settings;
+}
+
+function saveZoneSettings(domain) {
+    const settings = collectZoneSettings();
+    if (Object.keys(settings).length === 0) {
+        showNotification('Choose at least one setting to save', 'error');
+        return;
+    }
+    
+    fetch(`/api/settings/${encodeURIComponent(domain)}`, {
+        method: 'PUT',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(settings),
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.data) {
+                throw new Error(data.error || data.message);
+            }
+            showNotification(data.message, data.success ? 'success' : 'error');
+            displaySettingsResults([data.data]);
+            loadZoneSettings(domain);
+        })
+        .catch(error => {
+            showNotification('Failed to save zone settings: ' + error.message, 'error');
+        });
+}
+
+function applySettingsToDomains() {
+    const settings = collectZoneSettings();
+    const profile = document.getElementById('apply-settings-profile').value;
+    const domains = document.getElementById('apply-settings-domains').value.trim();
+    if (!profile && Object.keys(settings).length === 0) {
+        showNotification('Choose at least one setting to apply', 'error');
+        return;
+    }
+    if (!domains) {
+        showNotification('Enter the domains to apply the settings to', 'error');
+        return;
+    }
+    
+    fetch('/api/settings/apply', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ domains, settings, profile }),
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.results) {
+                throw new Error(data.error || data.message);
+            }
+            showNotification(data.message, data.success ? 'success' : 'error');
+            displaySettingsResults(data.results);
+        })
+        .catch(error => {
+            showNotification('Failed to apply settings: ' + error.message, 'error');
+        });
+}
+
+// List the outcome of each written setting
+function settingChangesHtml(changes) {
+    return (changes || []).map(change => `
+        <div class="result-message">
+            <i class="fas ${change.success ? 'fa-check' : 'fa-times'}"></i>
+            <code>${escapeHtml(change.setting)}</code> = ${escapeHtml(change.value)}
+            ${change.error ? `: ${escapeHtml(change.error)}` : ''}
+        </div>
+    `).join('');
+}
+
+// Settings profiles, shared by the add domains form and the zone settings page
+let settingsProfiles = [];
+
+// Fill the given selects with the settings profiles, keeping their first option
+function loadSettingsProfiles(selectIds) {
+    const selects = selectIds.map(id => document.getElementById(id)).filter(Boolean);
+    if (selects.length === 0) return Promise.resolve();
+    
+    return fetch('/api/profiles')
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            settingsProfiles = data.data;
+            selects.forEach(select => {
+                const selected = select.value;
+                select.length = 1;
+                settingsProfiles.forEach(profile => {
+                    const option = document.createElement('option');
+                    option.value = profile.id;
+                    option.textContent = profile.name;
+                    select.appendChild(option);
+                });
+                select.value = settingsProfiles.some(p => p.id === selected) ? selected : '';
+                select.dispatchEvent(new Event('change'));
+            });
+        })
+        .catch(error => {
+            showNotification('Failed to load settings profiles: ' + error.message, 'error');
+        });
+}
+
+// Send a settings profile to the server, creating it when id is empty
+function saveSettingsProfile(id, body) {
+    fetch(id ? `/api/profiles/${encodeURIComponent(id)}` : '/api/profiles', {
+        method: id ? 'PUT' : 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(body),
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            showNotification(data.message, 'success');
+            return loadSettingsProfiles(['profile-select', 'apply-settings-profile']).then(() => {
+                const select = document.getElementById('profile-select');
+                select.value = data.data.id;
+                select.dispatchEvent(new Event('change'));
+            });
+        })
+        .catch(error => {
+            showNotification('Failed to save profile: ' + error.message, 'error');
+        });
 }
 
-// Save new template
-function saveNewTemplate() {
-    const nameInput = document.getElementById('template-name');
-    const recordsInput = document.getElementById('template-records');
-    
-    const name = nameInput.value.trim();
-    const recordsText = recordsInput.value.trim();
-    
-    if (!name) {
-        showNotification('Please enter a template name', 'error');
+function createSettingsProfile() {
+    saveSettingsProfile('', {
+        name: document.getElementById('profile-name').value.trim(),
+        description: document.getElementById('profile-description').value.trim(),
+        settings: collectZoneSettings(),
+    });
+    document.getElementById('create-profile-form').reset();
+}
+
+function updateSettingsProfile() {
+    const profile = settingsProfiles.find(p => p.id === document.getElementById('profile-select').value);
+    if (!profile) {
+        showNotification('Select a profile to save the form to', 'error');
         return;
     }
-    
-    if (!recordsText) {
-        showNotification('Please enter DNS records', 'error');
+    if (!confirm(`Replace the settings of profile ${profile.name} with the settings chosen in the form?`)) {
         return;
     }
-    
-    // Parse and validate records
-    const records = recordsText.split('\n').filter(line => line.trim() !== '');
-    let hasErrors = false;
-    
-    records.forEach(record => {
-        const parts = record.split('|');
-        if (parts.length < 3 || parts.length > 4) {
-            showNotification(`Invalid record format: ${record}. Use TYPE|NAME|CONTENT or TYPE|NAME|CONTENT|PROXIED format.`, 'error');
-            hasErrors = true;
-        }
-    });
-    
-    if (hasErrors) return;
-    
-    // Save template
-    const saved = addDNSTemplate(name, records);
-    if (saved) {
-        showNotification('Template saved successfully!', 'success');
-        populateTemplateSelect();
-        populateTemplatesList();
-        // Clear form
-        nameInput.value = '';
-        recordsInput.value = '';
-    } else {
-        showNotification('Failed to save template', 'error');
-    }
+    saveSettingsProfile(profile.id, { name: profile.name, description: profile.description, settings: collectZoneSettings() });
 }
 
-// Populate templates list in modal
-function populateTemplatesList() {
-    const templatesList = document.getElementById('templates-list');
-    if (!templatesList) return;
-    
-    const templates = loadDNSTemplates();
-    templatesList.innerHTML = '';
-    
-    if (Object.keys(templates).length === 0) {
-        templatesList.innerHTML = '<div class="no-templates">No templates found</div>';
+function deleteSettingsProfile() {
+    const profile = settingsProfiles.find(p => p.id === document.getElementById('profile-select').value);
+    if (!profile) {
+        showNotification('Select a profile to delete', 'error');
         return;
     }
-    
-    Object.keys(templates).forEach(templateId => {
-        const template = templates[templateId];
-        const templateItem = document.createElement('div');
-        templateItem.className = 'template-item';
-        
-        templateItem.innerHTML = `
-            <div class="template-info">
-                <div class="template-name">${template.name}</div>
-                <div class="template-records-count">${template.records.length} DNS records</div>
-            </div>
-            <div class="template-actions">
-                ${templateId !== 'default' ? `
-                    <button class="edit-template" onclick="editTemplate('${templateId}')">
-                        <i class="fas fa-edit"></i> Edit
-                    </button>
-                    <button class="delete-template" onclick="deleteTemplate('${templateId}')">
-                        <i class="fas fa-trash"></i> Delete
-                    </button>
-                ` : '<span style="color: #999; font-size: 12px;">Default template</span>'}
-            </div>
-        `;
-        
-        templatesList.appendChild(templateItem);
-    });
-}
-
-// Edit template
-function editTemplate(templateId) {
-    const templates = loadDNSTemplates();
-    const template = templates[templateId];
-    
-    if (!template) return;
-    
-    document.getElementById('template-name').value = template.name;
-    document.getElementById('template-records').value = template.records.join('\n');
-    
-    // Change save button to update
-    const saveBtn = document.getElementById('save-template');
-    saveBtn.textContent = 'Update Template';
-    saveBtn.onclick = () => updateTemplate(templateId);
-}
-
-// Update template
-function updateTemplate(templateId) {
-    const nameInput = document.getElementById('template-name');
-    const recordsInput = document.getElementById('template-records');
-    
-    const name = nameInput.value.trim();
-    const recordsText = recordsInput.value.trim();
-    
-    if (!name || !recordsText) {
-        showNotification('Please fill all fields', 'error');
+    if (!confirm(`Delete profile ${profile.name}? Zones already configured with it keep their settings.`)) {
         return;
     }
     
-    const records = recordsText.split('\n').filter(line => line.trim() !== '');
-    
-    // Update template
-    const templates = loadDNSTemplates();
-    templates[templateId] = {
-        name: name,
-        records: records
-    };
-    
-    const saved = saveDNSTemplates(templates);
-    if (saved) {
-        showNotification('Template updated successfully!', 'success');
-        populateTemplateSelect();
-        populateTemplatesList();
-        
-        // Reset form
-        nameInput.value = '';
-        recordsInput.value = '';
-        const saveBtn = document.getElementById('save-template');
-        saveBtn.textContent = 'Save Template';
-        saveBtn.onclick = saveNewTemplate;
-    } else {
-        showNotification('Failed to update template', 'error');
-    }
+    fetch(`/api/profiles/${encodeURIComponent(profile.id)}`, { method: 'DELETE' })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            showNotification(data.message, 'success');
+            loadSettingsProfiles(['profile-select', 'apply-settings-profile']);
+        })
+        .catch(error => {
+            showNotification('Failed to delete profile: ' + error.message, 'error');
+        });
 }
 
-// Delete template
-function deleteTemplate(templateId) {
-    if (confirm('Are you sure you want to delete this template?')) {
-        const deleted = deleteDNSTemplate(templateId);
-        if (deleted) {
-            showNotification('Template deleted successfully!', 'success');
-            populateTemplateSelect();
-            populateTemplatesList();
-        } else {
-            showNotification('Failed to delete template', 'error');
-        }
-    }
+// Render the outcome of each setting per domain
+function displaySettingsResults(results) {
+    const resultsSection = document.getElementById('apply-settings-results');
+    const resultsContent = document.getElementById('apply-settings-content');
+    
+    resultsContent.innerHTML = '';
+    results.forEach(result => {
+        const resultItem = document.createElement('div');
+        resultItem.className = `result-item domain-result ${result.success ? 'success' : 'error'}`;
+        const settingsHtml = settingChangesHtml(result.settings);
+        resultItem.innerHTML = `
+            <i class="fas ${result.success ? 'fa-check-circle' : 'fa-times-circle'} result-icon"></i>
+            <div class="result-details">
+                <strong>${formatDomainName(result.domain, result.unicode_domain)}</strong>
+                <div class="result-message">${escapeHtml(result.message)}</div>
+                ${settingsHtml}
+            </div>
+        `;
+        resultsContent.appendChild(resultItem);
+    });
+    resultsSection.classList.remove('hidden');
 }
 
 // Main app initialization
@@ -689,6 +2307,9 @@ function initApp() {
     setupDNSForm();
     setupAddDomainsForm();
     setupBulkDNSForm();
+    setupApplyTemplateForm();
+    setupComplianceReport();
+    setupDNSSECReport();
     setupDNSTemplates();
     setupModals();
     
@@ -697,14 +2318,36 @@ function initApp() {
     if (path.startsWith('/dns/')) {
         // We're on the DNS management page for a specific domain
         const domain = path.replace('/dns/', '');
-        loadDNSRecords(domain);
+        const params = new URLSearchParams(window.location.search);
+        pendingEditRecordId = params.get('edit') || '';
+        loadDNSRecords(domain, 1, params.get('search') || '');
+        setupSnapshots(decodeURIComponent(domain));
+        setupDeletedRecords(decodeURIComponent(domain));
+        setupZoneDiff(decodeURIComponent(domain));
+        setupCloneZone(decodeURIComponent(domain));
+        setupRecordProxy(decodeURIComponent(domain));
+    } else if (path.startsWith('/settings/')) {
+        // We're on the zone settings page of a domain
+        setupSettingsPage(decodeURIComponent(path.replace('/settings/', '')));
     } else if (path === '/domains') {
         // We're on the domains page
         // Setup search functionality
         setupDomainSearchWithPagination();
+        setupZoneControls();
+        setupDelegationChecks();
+        setupDomainSearchAndFilters();
         
         // Load domains for table with pagination (20 per page)
         loadDomains(1, '', false);
+    } else if (path === '/audit') {
+        // We're on the audit log page
+        setupAuditPage();
+    } else if (path === '/backups') {
+        // We're on the backups page
+        setupBackupsPage();
+    } else if (path === '/search') {
+        // We're on the cross-zone search page
+        setupSearchPage();
     } else if (path === '/') {
         // We're on the home page, check for stored credentials
         checkAndLoadStoredCredentials();
@@ -887,6 +2530,8 @@ function setupAPIForm() {
 function setupAddDomainsForm() {
     const addDomainsForm = document.getElementById('add-domains-form');
     if (!addDomainsForm) return;
+    
+    loadSettingsProfiles(['settings-profile-select']);
 
     addDomainsForm.addEventListener('submit', function(e) {
         e.preventDefault();
@@ -913,16 +2558,10 @@ function setupAddDomainsForm() {
         
         if (hasErrors) return;
         
-        // Get selected DNS template
+        // Get selected DNS template; its records are resolved by the server
         const templateSelect = document.getElementById('dns-template-select');
         const selectedTemplate = templateSelect ? templateSelect.value : '';
         
-        // Get template records if a template is selected
-        let templateRecords = [];
-        if (selectedTemplate) {
-            templateRecords = getDNSTemplateRecords(selectedTemplate);
-        }
-        
         // Disable form and show loading state
         const submitBtn = addDomainsForm.querySelector('button[type="submit"]');
         const originalText = submitBtn.textContent;
@@ -938,7 +2577,8 @@ function setupAddDomainsForm() {
             body: JSON.stringify({ 
                 domains: domainsText,
                 template: selectedTemplate,
-                templateRecords: templateRecords
+                variables: collectTemplateVariables('template-variables-form'),
+                profile: document.getElementById('settings-profile-select')?.value || ''
             }),
         })
         .then(response => response.json())
@@ -973,10 +2613,19 @@ function setupAddDomainsForm() {
 
 // Validate domain format (basic validation)
 function isValidDomainFormat(domain) {
-    const domainRegex = /^[a-zA-Z0-9][a-zA-Z0-9-]{0,61}[a-zA-Z0-9]?\.([a-zA-Z]{2,}\.?)+$/;
+    // Accept Unicode (internationalized) labels; the server performs full IDNA validation
+    const domainRegex = /^[\p{L}\p{N}](?:[\p{L}\p{M}\p{N}-]{0,61}[\p{L}\p{M}\p{N}])?(\.[\p{L}\p{M}\p{N}](?:[\p{L}\p{M}\p{N}-]{0,61}[\p{L}\p{M}\p{N}])?)+\.?$/u;
     return domain.length >= 3 && domain.length <= 253 && domainRegex.test(domain);
 }
 
+// Format a domain for display, showing the Unicode form with the ASCII form alongside
+function formatDomainName(asciiName, unicodeName) {
+    if (unicodeName && unicodeName !== asciiName) {
+        return `${escapeHtml(unicodeName)} <small class="domain-ascii">(${escapeHtml(asciiName)})</small>`;
+    }
+    return escapeHtml(asciiName);
+}
+
 // Display add domains results
 function displayAddDomainsResults(results) {
     const resultsSection = document.getElementById('add-domains-results');
@@ -1038,9 +2687,10 @@ function displayAddDomainsResults(results) {
         resultItem.innerHTML = `
             ${icon}
             <div class="result-details">
-                <strong>${result.domain}</strong>
+                <strong>${formatDomainName(result.domain, result.unicode_domain)}</strong>
                 <div class="result-message">${result.message}</div>
                 ${result.error ? `<div class="error-details">${result.error}</div>` : ''}
+                ${result.profile_name ? `<div class="result-message">Profile ${escapeHtml(result.profile_name)}:</div>${settingChangesHtml(result.settings)}` : ''}
                 ${nameserversHtml}
             </div>
         `;
@@ -1129,6 +2779,9 @@ function setupBulkDNSForm() {
                 }, 2000);
             } else {
                 showNotification(`Error: ${data.message || 'Failed to add DNS records'}`, 'error');
+                if (data.results) {
+                    displayBulkDNSResults(data.results);
+                }
             }
         })
         .catch(error => {
@@ -1188,36 +2841,381 @@ function displayBulkDNSResults(results) {
         
         resultItem.className = className;
         
-        // Create content with errors if available
-        let errorsHtml = '';
-        if (result.record_errors && result.record_errors.length > 0) {
-            errorsHtml = `
-                <div class="dns-errors">
-                    <strong>Record Errors:</strong>
-                    <ul class="error-list">
-                        ${result.record_errors.map(error => `<li>${error}</li>`).join('')}
-                    </ul>
-                </div>
-            `;
+        // Create content with errors if available
+        let errorsHtml = '';
+        if (result.record_errors && result.record_errors.length > 0) {
+            errorsHtml = `
+                <div class="dns-errors">
+                    <strong>Record Errors:</strong>
+                    <ul class="error-list">
+                        ${result.record_errors.map(error => `<li>${error}</li>`).join('')}
+                    </ul>
+                </div>
+            `;
+        }
+        
+        resultItem.innerHTML = `
+            ${icon}
+            <div class="result-details">
+                <strong>${formatDomainName(result.domain, result.unicode_domain)}</strong>
+                <div class="result-message">${result.message}</div>
+                ${result.error ? `<div class="error-details">${result.error}</div>` : ''}
+                ${errorsHtml}
+            </div>
+        `;
+        
+        resultsContent.appendChild(resultItem);
+    });
+    
+    // Show the results section
+    resultsSection.classList.remove('hidden');
+}
+
+// Apply Template Form Setup
+function setupApplyTemplateForm() {
+    const applyForm = document.getElementById('apply-template-form');
+    if (!applyForm) return;
+    
+    const templateSelect = document.getElementById('apply-template-select');
+    templateSelect.addEventListener('change', function() {
+        renderTemplateVariablesForm('apply-template-variables-form', dnsTemplates[this.value]);
+    });
+    
+    const previewBtn = document.getElementById('preview-apply-template');
+    previewBtn.addEventListener('click', () => applyTemplateToDomains(true, previewBtn));
+    
+    applyForm.addEventListener('submit', function(e) {
+        e.preventDefault();
+        
+        const mode = document.getElementById('apply-template-mode').value;
+        if (mode === 'overwrite' && !confirm('Overwrite replaces existing records that differ from the template. Continue?')) {
+            return;
+        }
+        applyTemplateToDomains(false, applyForm.querySelector('button[type="submit"]'));
+    });
+}
+
+// Apply the selected template to the listed domains, or preview the changes with dryRun
+function applyTemplateToDomains(dryRun, button) {
+    const domainsText = document.getElementById('apply-template-domains').value.trim();
+    const templateId = document.getElementById('apply-template-select').value;
+    
+    if (!domainsText) {
+        showNotification('Please enter at least one domain', 'error');
+        return;
+    }
+    if (!templateId) {
+        showNotification('Please select a template', 'error');
+        return;
+    }
+    
+    const originalHtml = button.innerHTML;
+    button.disabled = true;
+    button.innerHTML = `<i class="fas fa-spinner fa-spin"></i> ${dryRun ? 'Previewing...' : 'Applying...'}`;
+    
+    fetch(`/api/templates/${encodeURIComponent(templateId)}/apply`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+            domains: domainsText,
+            variables: collectTemplateVariables('apply-template-variables-form'),
+            mode: document.getElementById('apply-template-mode').value,
+            dryRun: dryRun
+        }),
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            showNotification(data.message, 'success');
+            displayZoneChanges('apply-template-results', 'apply-template-content', data.results);
+        } else {
+            showNotification(`Error: ${data.message}${data.error ? ': ' + data.error : ''}`, 'error');
+        }
+    })
+    .catch(error => {
+        showNotification(`Error: ${error.message || 'Something went wrong'}`, 'error');
+    })
+    .finally(() => {
+        button.disabled = false;
+        button.innerHTML = originalHtml;
+    });
+}
+
+// Display the per-zone record changes made, or planned, by applying records to zones
+function displayZoneChanges(sectionId, contentId, results) {
+    const resultsSection = document.getElementById(sectionId);
+    const resultsContent = document.getElementById(contentId);
+    
+    if (!resultsSection || !resultsContent) return;
+    
+    resultsContent.innerHTML = '';
+    
+    const successCount = results.filter(r => r.success).length;
+    const dryRun = results.some(r => r.dry_run);
+    
+    const summaryEl = document.createElement('div');
+    summaryEl.className = 'result-summary';
+    summaryEl.innerHTML = `<strong>${dryRun ? 'Preview' : 'Summary'}:</strong> ${successCount} of ${results.length} domains ${dryRun ? 'can be updated without errors' : 'updated successfully'}.`;
+    resultsContent.appendChild(summaryEl);
+    
+    const actionIcons = {
+        create: 'fa-plus',
+        update: 'fa-pen',
+        delete: 'fa-trash',
+        unchanged: 'fa-equals',
+        skip: 'fa-forward',
+        conflict: 'fa-exclamation-triangle',
+        invalid: 'fa-times'
+    };
+    
+    results.forEach(result => {
+        const resultItem = document.createElement('div');
+        resultItem.className = `result-item dns-result ${result.success ? 'success' : 'error'}`;
+        
+        const changes = (result.changes || []).filter(change => change.action !== 'unchanged');
+        const changesHtml = changes.length === 0 ? '' : `
+            <ul class="record-changes">
+                ${changes.map(change => `
+                    <li class="record-change ${escapeHtml(change.action)}${change.success ? '' : ' failed'}">
+                        <i class="fas ${actionIcons[change.action] || 'fa-circle'}"></i>
+                        <strong>${escapeHtml(change.action)}</strong>
+                        ${escapeHtml(change.type)} ${escapeHtml(change.name)} → ${escapeHtml(change.content)}
+                        ${change.previous && change.previous !== change.content ? `<span class="record-change-previous">(was ${escapeHtml(change.previous)})</span>` : ''}
+                        ${change.error ? `<div class="error-details">${escapeHtml(change.error)}</div>` : ''}
+                        ${(change.warnings || []).map(warning => `<div class="warning-details">⚠️ ${escapeHtml(warning)}</div>`).join('')}
+                    </li>
+                `).join('')}
+            </ul>
+        `;
+        
+        resultItem.innerHTML = `
+            <i class="fas ${result.success ? 'fa-check-circle' : 'fa-times-circle'} result-icon"></i>
+            <div class="result-details">
+                <strong>${formatDomainName(result.domain, result.unicode_domain)}</strong>
+                <div class="result-message">${escapeHtml(result.message)}</div>
+                ${changesHtml}
+            </div>
+        `;
+        resultsContent.appendChild(resultItem);
+    });
+    
+    resultsSection.classList.remove('hidden');
+}
+
+// Template Compliance Setup
+function setupComplianceReport() {
+    const runBtn = document.getElementById('run-compliance-report');
+    if (!runBtn) return;
+    
+    runBtn.addEventListener('click', runComplianceReport);
+}
+
+function setupDNSSECReport() {
+    const runBtn = document.getElementById('run-dnssec-report');
+    if (!runBtn) return;
+    
+    runBtn.addEventListener('click', runDNSSECReport);
+}
+
+// Run the DNSSEC report for every domain
+function runDNSSECReport() {
+    const runBtn = document.getElementById('run-dnssec-report');
+    const originalHtml = runBtn.innerHTML;
+    runBtn.disabled = true;
+    runBtn.innerHTML = '<i class="fas fa-spinner fa-spin"></i> Checking domains...';
+    
+    fetch('/api/dnssec/report')
+        .then(response => response.json())
+        .then(data => {
+            if (data.success) {
+                const problems = data.results.filter(r => r.problem).length;
+                showNotification(data.message, problems > 0 ? 'warning' : 'success');
+                displayDNSSECReport(data.results);
+            } else {
+                showNotification(`Error: ${data.message}`, 'error');
+            }
+        })
+        .catch(error => {
+            showNotification(`Error: ${error.message || 'Something went wrong'}`, 'error');
+        })
+        .finally(() => {
+            runBtn.disabled = false;
+            runBtn.innerHTML = originalHtml;
+        });
+}
+
+// Display the domains whose DNSSEC needs attention, then the others
+function displayDNSSECReport(results) {
+    const resultsSection = document.getElementById('dnssec-results');
+    const resultsContent = document.getElementById('dnssec-content');
+    if (!resultsSection || !resultsContent) return;
+    
+    const problems = results.filter(r => r.problem).length;
+    const enabled = results.filter(r => r.status === 'active' || r.status === 'pending').length;
+    resultsContent.innerHTML = `<div class="result-summary"><strong>Summary:</strong> DNSSEC is enabled on ${enabled} of ${results.length} domains, ${problems} need a change at the registrar.</div>`;
+    
+    results.forEach(result => {
+        const ok = !result.problem && !result.error && !result.parent_error;
+        const resultItem = document.createElement('div');
+        resultItem.className = `result-item dns-result ${ok ? 'success' : 'error'}`;
+        
+        const dsHtml = result.problem === 'missing_ds' || result.problem === 'mismatch_ds'
+            ? `<div class="warning-details">DS to add: <code>${result.key_tag} ${escapeHtml(result.algorithm)} ${escapeHtml(result.digest_type)} ${escapeHtml(result.digest)}</code></div>`
+            : '';
+        
+        resultItem.innerHTML = `
+            <i class="fas ${ok ? 'fa-check-circle' : 'fa-exclamation-circle'} result-icon"></i>
+            <div class="result-details">
+                <strong>${formatDomainName(result.zone, result.unicode_name)}</strong>
+                <span class="domain-status dnssec-${escapeHtml(result.status)}">${escapeHtml(result.status)}</span>
+                ${result.problem ? `<span class="template-records-count">${escapeHtml(DNSSEC_PROBLEMS[result.problem] || result.problem)}</span>` : ''}
+                <div class="result-message">${escapeHtml(result.error || result.message)}</div>
+                ${dsHtml}
+                <a href="/settings/${encodeURIComponent(result.zone)}" class="btn btn-sm btn-secondary">
+                    <i class="fas fa-key"></i> DNSSEC Settings
+                </a>
+            </div>
+        `;
+        resultsContent.appendChild(resultItem);
+    });
+    
+    resultsSection.classList.remove('hidden');
+}
+
+// Run the compliance report for every domain with an assigned template
+function runComplianceReport() {
+    const runBtn = document.getElementById('run-compliance-report');
+    const originalHtml = runBtn.innerHTML;
+    runBtn.disabled = true;
+    runBtn.innerHTML = '<i class="fas fa-spinner fa-spin"></i> Checking domains...';
+    
+    fetch('/api/compliance')
+        .then(response => response.json())
+        .then(data => {
+            if (data.success) {
+                showNotification(data.message, data.compliant ? 'success' : 'warning');
+                displayComplianceReport(data.results);
+            } else {
+                showNotification(`Error: ${data.message}`, 'error');
+            }
+        })
+        .catch(error => {
+            showNotification(`Error: ${error.message || 'Something went wrong'}`, 'error');
+        })
+        .finally(() => {
+            runBtn.disabled = false;
+            runBtn.innerHTML = originalHtml;
+        });
+}
+
+// Display the compliance report with the drift of each domain
+function displayComplianceReport(reports) {
+    const resultsSection = document.getElementById('compliance-results');
+    const resultsContent = document.getElementById('compliance-content');
+    if (!resultsSection || !resultsContent) return;
+    
+    resultsContent.innerHTML = '';
+    
+    if (reports.length === 0) {
+        resultsContent.innerHTML = '<div class="result-summary">No domains have a template assigned yet. Templates are assigned when domains are added with a template or a template is applied to them.</div>';
+        resultsSection.classList.remove('hidden');
+        return;
+    }
+    
+    const compliantCount = reports.filter(r => r.compliant).length;
+    const summaryEl = document.createElement('div');
+    summaryEl.className = 'result-summary';
+    summaryEl.innerHTML = `<strong>Summary:</strong> ${compliantCount} of ${reports.length} domains comply with their template.`;
+    resultsContent.appendChild(summaryEl);
+    
+    const kindIcons = {
+        missing: 'fa-plus',
+        extra: 'fa-minus',
+        changed: 'fa-pen',
+        invalid: 'fa-times'
+    };
+    
+    reports.forEach(report => {
+        const resultItem = document.createElement('div');
+        resultItem.className = `result-item dns-result ${report.compliant ? 'success' : 'error'}`;
+        
+        let status = 'Compliant';
+        if (report.error) {
+            status = escapeHtml(report.error);
+        } else if (!report.compliant) {
+            status = `${report.missing} missing, ${report.extra} extra, ${report.changed} changed${report.invalid ? `, ${report.invalid} invalid` : ''}`;
         }
         
+        const driftHtml = report.drift.length === 0 ? '' : `
+            <ul class="record-changes">
+                ${report.drift.map(drift => `
+                    <li class="record-change drift-${escapeHtml(drift.kind)}">
+                        <i class="fas ${kindIcons[drift.kind] || 'fa-circle'}"></i>
+                        <strong>${escapeHtml(drift.kind)}</strong>
+                        ${escapeHtml(drift.type)} ${escapeHtml(drift.name)}
+                        ${drift.expected ? `expected ${escapeHtml(drift.expected)}` : ''}
+                        ${drift.actual ? `<span class="record-change-previous">(found ${escapeHtml(drift.actual)})</span>` : ''}
+                        ${drift.detail ? `<div class="warning-details">${escapeHtml(drift.detail)}</div>` : ''}
+                    </li>
+                `).join('')}
+            </ul>
+        `;
+        
         resultItem.innerHTML = `
-            ${icon}
+            <i class="fas ${report.compliant ? 'fa-check-circle' : 'fa-exclamation-circle'} result-icon"></i>
             <div class="result-details">
-                <strong>${result.domain}</strong>
-                <div class="result-message">${result.message}</div>
-                ${result.error ? `<div class="error-details">${result.error}</div>` : ''}
-                ${errorsHtml}
+                <strong>${formatDomainName(report.domain, report.unicode_domain)}</strong>
+                <span class="template-records-count">${escapeHtml(report.template_name || report.template_id)}</span>
+                <div class="result-message">${status}</div>
+                ${driftHtml}
+                ${report.compliant || report.error ? '' : `
+                    <button type="button" class="btn btn-sm btn-accent remediate-btn">
+                        <i class="fas fa-magic"></i> Remediate
+                    </button>
+                `}
             </div>
         `;
         
+        const remediateBtn = resultItem.querySelector('.remediate-btn');
+        if (remediateBtn) {
+            remediateBtn.addEventListener('click', () => remediateZone(report.domain, remediateBtn));
+        }
         resultsContent.appendChild(resultItem);
     });
     
-    // Show the results section
     resultsSection.classList.remove('hidden');
 }
 
+// Re-apply the assigned template to a domain, overwriting the records that drifted
+function remediateZone(domain, button) {
+    if (!confirm(`Re-apply the template to ${domain}? Missing records are created, changed records are overwritten and extra records at the template's names are deleted.`)) {
+        return;
+    }
+    
+    button.disabled = true;
+    button.innerHTML = '<i class="fas fa-spinner fa-spin"></i> Remediating...';
+    
+    fetch(`/api/compliance/${encodeURIComponent(domain)}/remediate`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ dryRun: false }),
+    })
+    .then(response => response.json())
+    .then(data => {
+        showNotification(`${domain}: ${data.message}`, data.success ? 'success' : 'error');
+        runComplianceReport();
+    })
+    .catch(error => {
+        showNotification(`Error: ${error.message || 'Something went wrong'}`, 'error');
+        button.disabled = false;
+        button.innerHTML = '<i class="fas fa-magic"></i> Remediate';
+    });
+}
+
 // Domain Selection Setup - Modal with Pagination
 function setupDomainSelect() {
     const openModalBtn = document.getElementById('open-domain-modal');
@@ -1377,7 +3375,7 @@ function setupDomainSelect() {
             row.className = 'records-row';
             
             row.innerHTML = `
-                <td class="record-name">${escapeHtml(domainName)}</td>
+                <td class="record-name">${formatDomainName(domainName, domain.unicode_name)}</td>
                 <td class="record-type">
                     <span class="status-badge status-${domainStatus.toLowerCase()}">${domainStatus.toUpperCase()}</span>
                 </td>
@@ -1501,6 +3499,51 @@ function setupDomainSelect() {
 // Global variables for domains management
 let allDomains = [];
 let filteredDomains = [];
+
+// Server-side filters of the domains table, by element ID and query parameter
+const DOMAIN_FILTERS = {
+    'status-filter': 'status',
+    'plan-filter': 'plan',
+    'account-filter': 'account',
+    'type-filter': 'type',
+    'paused-filter': 'paused',
+    'ns-filter': 'ns',
+    'min-records-filter': 'min_records',
+    'max-records-filter': 'max_records',
+};
+let domainSort = { field: 'name', order: 'asc' };
+
+// Add the filters and sort order of the domains table to a domain list query
+function appendDomainListParams(queryParams) {
+    Object.entries(DOMAIN_FILTERS).forEach(([id, param]) => {
+        const value = document.getElementById(id)?.value.trim();
+        if (value) queryParams.append(param, value);
+    });
+    queryParams.append('sort', domainSort.field);
+    queryParams.append('order', domainSort.order);
+    queryParams.append('records', 'true');
+}
+
+// Offer the plans, accounts and types found in the zone list as filter choices
+function updateDomainFilterOptions(filters) {
+    if (!filters) return;
+    const fill = (id, options) => {
+        const select = document.getElementById(id);
+        if (!select) return;
+        const selected = select.value;
+        select.length = 1;
+        options.forEach(([value, label]) => {
+            const option = document.createElement('option');
+            option.value = value;
+            option.textContent = label;
+            select.appendChild(option);
+        });
+        select.value = selected;
+    };
+    fill('plan-filter', filters.plans.map(plan => [plan, plan]));
+    fill('account-filter', filters.accounts.map(account => [account.id, account.name || account.id]));
+    fill('type-filter', filters.types.map(type => [type, type.charAt(0).toUpperCase() + type.slice(1)]));
+}
 let currentDomainSortField = null;
 let currentDomainSortDirection = 'asc';
 
@@ -1519,7 +3562,7 @@ function loadDomains(page = 1, search = '', loadAll = false) {
     if (domainsTable) {
         domainsTable.innerHTML = `
             <tr>
-                <td colspan="4" class="loading-row">
+                <td colspan="8" class="loading-row">
                     <i class="fas fa-spinner fa-spin"></i> Loading domains...
                 </td>
             </tr>
@@ -1535,6 +3578,9 @@ function loadDomains(page = 1, search = '', loadAll = false) {
     if (search) {
         queryParams.append('search', search);
     }
+    if (domainsTable && !loadAll) {
+        appendDomainListParams(queryParams);
+    }
     
     // Fetch domains
     fetch(`/api/domains?${queryParams.toString()}`, {
@@ -1571,7 +3617,7 @@ function loadDomains(page = 1, search = '', loadAll = false) {
                 filteredDomains = [...allDomains];
                 displayDomains();
                 updateDomainsCount();
-                setupDomainSearchAndFilters();
+                updateDomainFilterOptions(data.filters);
                 
                 // Display pagination controls
                 displayPaginationControls(pagination, page, search);
@@ -1585,7 +3631,7 @@ function loadDomains(page = 1, search = '', loadAll = false) {
             if (domainsTable) {
                 domainsTable.innerHTML = `
                     <tr>
-                        <td colspan="4" class="loading-row" style="color: var(--error-color);">
+                        <td colspan="8" class="loading-row" style="color: var(--error-color);">
                             <i class="fas fa-exclamation-triangle"></i> ${errorMsg}
                             <br><small>Check browser console for more details</small>
                         </td>
@@ -1618,7 +3664,7 @@ function displayDomains() {
     if (!filteredDomains || filteredDomains.length === 0) {
         domainsTable.innerHTML = `
             <tr>
-                <td colspan="4" class="loading-row">
+                <td colspan="8" class="loading-row">
                     <i class="fas fa-search"></i> No domains found
                 </td>
             </tr>
@@ -1637,33 +3683,352 @@ function displayDomains() {
     filteredDomains.forEach(domain => {
         const statusClass = `status-${domain.status.toLowerCase()}`;
         const createdDate = domain.created_on ? new Date(domain.created_on).toLocaleDateString() : 'Unknown';
+        const activatedDate = domain.activated_on ? new Date(domain.activated_on).toLocaleDateString() : '';
+        const metaDetails = [domain.type, domain.account_name].filter(Boolean).join(' · ');
+        const nameserverDetails = [
+            `Nameservers: ${(domain.name_servers || []).join(', ') || 'none'}`,
+            `Original nameservers: ${(domain.original_name_servers || []).join(', ') || 'none'}`,
+        ].join('\n');
         
         const row = document.createElement('tr');
         row.dataset.domainName = domain.name;
         
+        const pausedBadge = domain.paused ? '<span class="domain-status status-paused">Paused</span>' : '';
+        const devModeBadge = domain.development_mode > 0 ? '<span class="domain-status status-dev-mode" title="Cache bypassed">Dev mode</span>' : '';
+        
         row.innerHTML = `
-            <td class="domain-name">${escapeHtml(domain.name)}</td>
+            <td>
+                <input type="checkbox" class="domain-checkbox" value="${escapeHtml(domain.name)}">
+            </td>
+            <td class="domain-name">
+                ${formatDomainName(domain.name, domain.unicode_name)}
+                <div class="domain-meta" title="${escapeHtml(nameserverDetails)}">${escapeHtml(metaDetails)}</div>
+            </td>
             <td>
                 <span class="domain-status ${statusClass}">${domain.status}</span>
+                ${pausedBadge}
+                ${devModeBadge}
+            </td>
+            <td>${delegationCell(domain)}</td>
+            <td>${escapeHtml(domain.plan || '')}</td>
+            <td>${domain.record_count === null || domain.record_count === undefined ? '-' : domain.record_count}</td>
+            <td class="domain-created">
+                ${createdDate}
+                ${activatedDate ? `<div class="domain-meta">Activated ${activatedDate}</div>` : ''}
             </td>
-            <td class="domain-created">${createdDate}</td>
             <td class="domain-actions">
                 <a href="/dns/${domain.name}" class="btn btn-sm" title="Manage DNS">
                     <i class="fas fa-cog"></i> Manage DNS
                 </a>
+                <a href="/settings/${domain.name}" class="btn-icon" title="Zone Settings">
+                    <i class="fas fa-sliders"></i>
+                </a>
+                <button class="btn-icon zone-action" data-action="${domain.paused ? 'unpause' : 'pause'}" data-domain="${escapeHtml(domain.name)}" title="${domain.paused ? 'Resume Cloudflare' : 'Pause Cloudflare'}">
+                    <i class="fas ${domain.paused ? 'fa-play' : 'fa-pause'}"></i>
+                </button>
+                <button class="btn-icon zone-action" data-action="${domain.development_mode > 0 ? 'dev_mode_off' : 'dev_mode_on'}" data-domain="${escapeHtml(domain.name)}" title="${domain.development_mode > 0 ? 'Turn development mode off' : 'Turn development mode on'}">
+                    <i class="fas fa-code"></i>
+                </button>
+                <button class="btn-icon btn-delete zone-action" data-action="delete" data-domain="${escapeHtml(domain.name)}" title="Delete Domain">
+                    <i class="fas fa-trash"></i>
+                </button>
             </td>
         `;
         
         domainsTable.appendChild(row);
     });
+    
+    // Selections do not survive a reload of the table
+    const selectAll = document.getElementById('select-all-domains');
+    if (selectAll) {
+        selectAll.checked = false;
+        updateZoneBulkActions();
+    }
+}
+
+// Labels of the nameserver delegation statuses
+const DELEGATION_LABELS = {
+    delegated: 'Delegated',
+    partial: 'Partly delegated',
+    not_delegated: 'Not delegated',
+    error: 'Check failed',
+};
+
+// Render the delegation column of a domain: the last check and a button to check again
+function delegationCell(domain) {
+    const check = domain.delegation;
+    const button = `<button class="btn-icon delegation-check" data-domain="${escapeHtml(domain.name)}" title="Check nameserver delegation">
+        <i class="fas fa-rotate"></i>
+    </button>`;
+    if (!check) {
+        return domain.status === 'pending' ? `<span class="delegation-unchecked">Not checked</span> ${button}` : '';
+    }
+    
+    const details = [
+        `Cloudflare: ${check.assigned_ns.join(', ') || 'none'}`,
+        `Registrar: ${check.parent_ns.join(', ') || 'none'}`,
+        `Checked ${new Date(check.checked_at).toLocaleString()}`,
+    ];
+    if (check.error) details.push(check.error);
+    if (check.activation_error) details.push(`Activation check failed: ${check.activation_error}`);
+    return `<span class="domain-status delegation-${check.status}" title="${escapeHtml(details.join('\n'))}">${DELEGATION_LABELS[check.status] || check.status}</span> ${button}`;
+}
+
+function setupDelegationChecks() {
+    const tableBody = document.querySelector('#domains-table tbody');
+    if (!tableBody) return;
+    
+    tableBody.addEventListener('click', function(e) {
+        const button = e.target.closest('.delegation-check');
+        if (button) {
+            checkDelegation(button.dataset.domain, button);
+        }
+    });
+    document.getElementById('check-pending-delegations').addEventListener('click', checkPendingDelegations);
+}
+
+// Compare the nameservers of a domain at its registrar with the ones Cloudflare assigned
+function checkDelegation(domain, button) {
+    button.disabled = true;
+    button.querySelector('i').classList.add('fa-spin');
+    
+    fetch(`/api/domains/${encodeURIComponent(domain)}/delegation/check`, { method: 'POST' })
+        .then(response => response.json())
+        .then(data => {
+            showNotification(`${domain}: ${data.message}`, data.data && data.data.status === 'delegated' ? 'success' : 'error');
+            if (data.data) {
+                const row = allDomains.find(d => d.name === domain);
+                if (row) row.delegation = data.data;
+                displayDomains();
+            }
+        })
+        .catch(error => {
+            showNotification(`Failed to check ${domain}: ${error.message}`, 'error');
+            button.disabled = false;
+            button.querySelector('i').classList.remove('fa-spin');
+        });
+}
+
+// Check the delegation of every pending domain of the account
+function checkPendingDelegations() {
+    const checkBtn = document.getElementById('check-pending-delegations');
+    checkBtn.disabled = true;
+    
+    fetch('/api/domains/delegation/check', { method: 'POST' })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error || data.message);
+            }
+            showNotification(data.message, 'success');
+            data.results.forEach(check => {
+                const row = allDomains.find(d => d.name === check.zone);
+                if (row) row.delegation = check;
+            });
+            displayDomains();
+        })
+        .catch(error => {
+            showNotification('Failed to check pending domains: ' + error.message, 'error');
+        })
+        .finally(() => {
+            checkBtn.disabled = false;
+        });
+}
+
+// Labels of the zone control actions, used in confirmations and notifications
+const ZONE_ACTION_LABELS = {
+    pause: 'Pause Cloudflare',
+    unpause: 'Resume Cloudflare',
+    dev_mode_on: 'Turn development mode on',
+    dev_mode_off: 'Turn development mode off',
+    proxy_on: 'Proxy every record that can be proxied',
+    proxy_off: 'Turn the proxy off for every record',
+    delete: 'Delete',
+};
+
+// API paths of the zone control actions on a single domain
+const ZONE_ACTION_PATHS = {
+    pause: 'pause',
+    unpause: 'unpause',
+    dev_mode_on: 'dev-mode/on',
+    dev_mode_off: 'dev-mode/off',
+};
+
+// Row actions and bulk actions for deleting, pausing and development mode of domains
+function setupZoneControls() {
+    const tableBody = document.querySelector('#domains-table tbody');
+    if (!tableBody) return;
+    
+    tableBody.addEventListener('click', function(e) {
+        const button = e.target.closest('.zone-action');
+        if (button) {
+            controlZone(button.dataset.domain, button.dataset.action);
+        }
+    });
+    tableBody.addEventListener('change', function(e) {
+        if (e.target.classList.contains('domain-checkbox')) {
+            updateZoneBulkActions();
+        }
+    });
+    
+    document.getElementById('select-all-domains').addEventListener('change', function() {
+        document.querySelectorAll('.domain-checkbox').forEach(checkbox => {
+            checkbox.checked = this.checked;
+        });
+        updateZoneBulkActions();
+    });
+    document.getElementById('apply-bulk-zone-action').addEventListener('click', bulkControlZones);
+}
+
+// Selected domain names in the domains table
+function getSelectedDomains() {
+    return Array.from(document.querySelectorAll('.domain-checkbox:checked')).map(checkbox => checkbox.value);
+}
+
+// Show the bulk action controls while domains are selected
+function updateZoneBulkActions() {
+    const count = getSelectedDomains().length;
+    const display = count > 0 ? 'inline-block' : 'none';
+    document.getElementById('bulk-zone-action').style.display = display;
+    const applyBtn = document.getElementById('apply-bulk-zone-action');
+    applyBtn.style.display = display;
+    applyBtn.innerHTML = `<i class="fas fa-bolt"></i> Apply to ${count} Selected`;
+}
+
+// Delete, pause, resume or toggle development mode of one domain. Deleting asks for the
+// domain name to be typed; the zone is exported to the backup directory first.
+function controlZone(domain, action) {
+    let request;
+    if (action === 'delete') {
+        const typed = prompt(`Deleting ${domain} removes the zone and all of its records from Cloudflare. The records are exported to the backup directory first.\n\nType the domain name to confirm:`);
+        if (typed === null) return;
+        request = fetch(`/api/domains/${encodeURIComponent(domain)}`, {
+            method: 'DELETE',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ confirm: typed }),
+        });
+    } else {
+        if (!confirm(`${ZONE_ACTION_LABELS[action]} for ${domain}?`)) return;
+        request = fetch(`/api/domains/${encodeURIComponent(domain)}/${ZONE_ACTION_PATHS[action]}`, { method: 'POST' });
+    }
+    
+    request
+        .then(response => response.json())
+        .then(data => {
+            showNotification(`${domain}: ${data.message}`, data.success ? 'success' : 'error');
+            if (data.success) {
+                loadDomains();
+            }
+        })
+        .catch(error => {
+            showNotification(`Failed to update ${domain}: ${error.message}`, 'error');
+        });
+}
+
+// Apply the selected bulk action to every selected domain
+function bulkControlZones() {
+    const action = document.getElementById('bulk-zone-action').value;
+    const domains = getSelectedDomains();
+    if (!action) {
+        showNotification('Choose a bulk action', 'error');
+        return;
+    }
+    
+    let confirmText = '';
+    if (action === 'delete') {
+        const expected = `delete ${domains.length} domains`;
+        const typed = prompt(`This deletes ${domains.length} domains and all of their records from Cloudflare. Each zone is exported to the backup directory first.\n\nType "${expected}" to confirm:`);
+        if (typed === null) return;
+        confirmText = typed;
+    } else if (!confirm(`${ZONE_ACTION_LABELS[action]} for ${domains.length} domains?`)) {
+        return;
+    }
+    
+    const applyBtn = document.getElementById('apply-bulk-zone-action');
+    applyBtn.disabled = true;
+    
+    if (action === 'proxy_on' || action === 'proxy_off') {
+        bulkProxyZones(domains, action === 'proxy_on').finally(() => {
+            applyBtn.disabled = false;
+        });
+        return;
+    }
+    
+    fetch('/api/domains/bulk', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ domains: domains.join('\n'), action, confirm: confirmText }),
+    })
+        .then(response => response.json())
+        .then(data => {
+            showNotification(data.message, data.success ? 'success' : 'error');
+            if (data.results) {
+                displayZoneControlResults(data.results);
+                loadDomains();
+            }
+        })
+        .catch(error => {
+            showNotification('Bulk action failed: ' + error.message, 'error');
+        })
+        .finally(() => {
+            applyBtn.disabled = false;
+        });
+}
+
+// Turn the proxy on or off for every record of the given domains
+function bulkProxyZones(domains, proxied) {
+    return fetch('/api/proxy/bulk', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ domains: domains.join('\n'), proxied: proxied }),
+    })
+        .then(response => response.json())
+        .then(data => {
+            showNotification(data.message, data.success ? 'success' : 'error');
+            if (data.results) {
+                displayZoneChanges('zone-control-results', 'zone-control-content', data.results);
+            }
+        })
+        .catch(error => {
+            showNotification('Bulk proxy change failed: ' + error.message, 'error');
+        });
+}
+
+// Render the outcome of a bulk action per domain
+function displayZoneControlResults(results) {
+    const resultsSection = document.getElementById('zone-control-results');
+    const resultsContent = document.getElementById('zone-control-content');
+    
+    resultsContent.innerHTML = '';
+    results.forEach(result => {
+        const resultItem = document.createElement('div');
+        resultItem.className = `result-item domain-result ${result.success ? 'success' : 'error'}`;
+        const exportHtml = (result.export || []).map(file => `<code>${escapeHtml(file)}</code>`).join(' ');
+        resultItem.innerHTML = `
+            <i class="fas ${result.success ? 'fa-check-circle' : 'fa-times-circle'} result-icon"></i>
+            <div class="result-details">
+                <strong>${formatDomainName(result.domain, result.unicode_domain)}</strong>
+                <div class="result-message">${escapeHtml(result.message)}</div>
+                ${exportHtml ? `<div class="result-message">Export: ${exportHtml}</div>` : ''}
+            </div>
+        `;
+        resultsContent.appendChild(resultItem);
+    });
+    resultsSection.classList.remove('hidden');
 }
 
 // Setup search and filter functionality for domains
 function setupDomainSearchAndFilters() {
     const searchInput = document.getElementById('search-domains');
-    const statusFilter = document.getElementById('status-filter');
     const resetFiltersBtn = document.getElementById('reset-domain-filters');
     const refreshBtn = document.getElementById('refresh-domains');
+    const reload = () => loadDomains(1, searchInput ? searchInput.value.trim() : '');
     
     if (searchInput) {
         searchInput.addEventListener('input', applyDomainFilters);
@@ -1675,15 +4040,31 @@ function setupDomainSearchAndFilters() {
         });
     }
     
-    if (statusFilter) {
-        statusFilter.addEventListener('change', applyDomainFilters);
-    }
+    // The other filters and the sort order are applied by the server
+    Object.keys(DOMAIN_FILTERS).forEach(id => {
+        const filter = document.getElementById(id);
+        if (filter) filter.addEventListener('change', reload);
+    });
+    
+    document.querySelectorAll('#domains-table th.sortable').forEach(header => {
+        header.addEventListener('click', function() {
+            const field = this.dataset.sort;
+            domainSort.order = domainSort.field === field && domainSort.order === 'asc' ? 'desc' : 'asc';
+            domainSort.field = field;
+            document.querySelectorAll('#domains-table th.sortable').forEach(h => h.classList.remove('sorted-asc', 'sorted-desc'));
+            this.classList.add(`sorted-${domainSort.order}`);
+            reload();
+        });
+    });
     
     if (resetFiltersBtn) {
         resetFiltersBtn.addEventListener('click', function() {
             if (searchInput) searchInput.value = '';
-            if (statusFilter) statusFilter.value = '';
-            applyDomainFilters();
+            Object.keys(DOMAIN_FILTERS).forEach(id => {
+                const filter = document.getElementById(id);
+                if (filter) filter.value = '';
+            });
+            reload();
         });
     }
     
@@ -1696,26 +4077,17 @@ function setupDomainSearchAndFilters() {
     }
 }
 
-// Apply search and filter logic for domains
+// Narrow the current page by the search term while the server search is pending
 function applyDomainFilters() {
     const searchTerm = document.getElementById('search-domains')?.value.toLowerCase().trim() || '';
-    const statusFilter = document.getElementById('status-filter')?.value || '';
     
     filteredDomains = allDomains.filter(domain => {
-        // Search filter
-        const matchesSearch = !searchTerm ||
+        return !searchTerm ||
             domain.name.toLowerCase().includes(searchTerm) ||
+            (domain.unicode_name || '').toLowerCase().includes(searchTerm) ||
             domain.status.toLowerCase().includes(searchTerm);
-        
-        // Status filter
-        const matchesStatus = !statusFilter || domain.status.toLowerCase() === statusFilter.toLowerCase();
-        
-        return matchesSearch && matchesStatus;
     });
     
-    // Sort domains alphabetically by name
-    filteredDomains.sort((a, b) => a.name.localeCompare(b.name));
-    
     displayDomains();
     updateDomainsCount();
 }
@@ -1751,24 +4123,30 @@ function setupDNSForm() {
         loadDNSRecords(domain);
     }
     
-    // Setup DNS template selector for DNS page
+    // Setup DNS template selector for DNS page. Templates are rendered by the server for this
+    // zone; templates with variables show a form for the values first.
     const dnsTemplateSelect = document.getElementById('dns-template-select-dns');
     if (dnsTemplateSelect) {
         dnsTemplateSelect.addEventListener('change', function() {
             const templateId = this.value;
-            const dnsRecordsTextarea = document.getElementById('dns-records');
+            const template = dnsTemplates[templateId];
+            renderTemplateVariablesForm('template-variables-form-dns', template);
             
-            if (!templateId || !dnsRecordsTextarea) {
+            if (!template) {
                 return;
             }
-            
-            // Get template records
-            const templateRecords = getDNSTemplateRecords(templateId);
-            if (templateRecords && templateRecords.length > 0) {
-                // Fill textarea with template records
-                dnsRecordsTextarea.value = templateRecords.join('\n');
-                showNotification('Template loaded successfully!', 'success');
+            if ((template.variables || []).length === 0) {
+                loadTemplateIntoEditor(templateId);
+                return;
             }
+            
+            const form = document.getElementById('template-variables-form-dns');
+            const loadBtn = document.createElement('button');
+            loadBtn.type = 'button';
+            loadBtn.className = 'btn btn-secondary';
+            loadBtn.innerHTML = '<i class="fas fa-file-import"></i> Load Template';
+            loadBtn.addEventListener('click', () => loadTemplateIntoEditor(templateId));
+            form.appendChild(loadBtn);
         });
     }
     
@@ -1843,6 +4221,7 @@ function setupDNSForm() {
                 
                 // Reload DNS records
                 loadDNSRecords(domain);
+                loadSnapshots(domain);
                 
                 // Don't clear the form - preserve textarea values as requested
                 // document.getElementById('dns-records').value = '';
@@ -1865,6 +4244,7 @@ function setupDNSForm() {
 // Load DNS Records
 // Global variables for DNS records management
 let allDNSRecords = [];
+let pendingEditRecordId = ''; // Record to open for editing once loaded, from an edit link
 let filteredDNSRecords = [];
 let currentSortField = null;
 let currentSortDirection = 'asc';
@@ -1905,6 +4285,7 @@ function loadDNSRecords(domain, page = 1, search = '') {
                 
                 // Display pagination controls
                 displayDNSPaginationControls(data.pagination || {}, page, search);
+                openPendingEdit();
             } else {
                 throw new Error(data.message || 'Failed to load DNS records');
             }
@@ -1921,6 +4302,19 @@ function loadDNSRecords(domain, page = 1, search = '') {
         });
 }
 
+// Open the edit dialog for the record named in an edit link, such as one from cross-zone search
+function openPendingEdit() {
+    if (!pendingEditRecordId) return;
+    
+    const record = allDNSRecords.find(r => r.id === pendingEditRecordId);
+    pendingEditRecordId = '';
+    if (!record) {
+        showNotification('The record to edit was not found, it may have been changed or deleted', 'error');
+        return;
+    }
+    editRecord(record.id, record.type, record.name, record.content, record.proxied, record.comment || '', (record.tags || []).join(', '));
+}
+
 // Enhanced DNS Records Display with search and filter support
 function displayDNSRecords() {
     const tableBody = document.querySelector('#dns-records-table tbody');
@@ -1955,11 +4349,15 @@ function displayDNSRecords() {
                 <td>
                     <span class="record-type-badge ${typeClass}">${record.type}</span>
                 </td>
-                <td class="record-name" title="${escapeHtml(record.name)}" style="max-width: 200px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap;">${escapeHtml(record.name)}</td>
+                <td class="record-name" title="${escapeHtml(record.name)}" style="max-width: 200px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap;">
+                    ${escapeHtml(record.name)}
+                    ${record.comment ? `<div class="record-comment" title="${escapeHtml(record.comment)}"><i class="fas fa-comment"></i> ${escapeHtml(record.comment)}</div>` : ''}
+                    ${(record.tags || []).map(tag => `<span class="record-tag">${escapeHtml(tag)}</span>`).join('')}
+                </td>
                 <td class="record-content" title="${escapeHtml(record.content)}" style="max-width: 300px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap;">${escapeHtml(record.content)}</td>
                 <td>${proxiedStatus}</td>
                 <td class="record-actions">
-                    <button class="btn-icon btn-edit" data-record-id="${escapeHtml(record.id)}" data-record-type="${escapeHtml(record.type)}" data-record-name="${escapeHtml(record.name)}" data-record-content="${escapeHtml(record.content)}" data-record-proxied="${record.proxied}" title="Edit Record">
+                    <button class="btn-icon btn-edit" data-record-id="${escapeHtml(record.id)}" data-record-type="${escapeHtml(record.type)}" data-record-name="${escapeHtml(record.name)}" data-record-content="${escapeHtml(record.content)}" data-record-proxied="${record.proxied}" data-record-comment="${escapeHtml(record.comment || '')}" data-record-tags="${escapeHtml((record.tags || []).join(', '))}" title="Edit Record">
                         <i class="fas fa-edit"></i>
                     </button>
                     <button class="btn-icon btn-delete" data-record-id="${escapeHtml(record.id)}" data-record-type="${escapeHtml(record.type)}" data-record-name="${escapeHtml(record.name)}" data-record-content="${escapeHtml(record.content)}" title="Delete Record">
@@ -1983,8 +4381,10 @@ function displayDNSRecords() {
             const recordName = target.dataset.recordName;
             const recordContent = target.dataset.recordContent;
             const recordProxied = target.dataset.recordProxied === 'true';
+            const recordComment = target.dataset.recordComment;
+            const recordTags = target.dataset.recordTags;
             
-            editRecord(recordId, recordType, recordName, recordContent, recordProxied);
+            editRecord(recordId, recordType, recordName, recordContent, recordProxied, recordComment, recordTags);
         } else if (target.classList.contains('btn-delete')) {
             const recordId = target.dataset.recordId;
             const recordType = target.dataset.recordType;
@@ -2146,6 +4546,13 @@ function updateBulkActionsVisibility() {
             bulkDeleteBtn.style.display = 'none';
         }
     }
+    
+    ['bulk-proxy-on', 'bulk-proxy-off'].forEach(id => {
+        const btn = document.getElementById(id);
+        if (btn) {
+            btn.style.display = selectedRecords.length > 0 ? 'inline-block' : 'none';
+        }
+    });
 }
 
 // Update select all checkbox state
@@ -2214,8 +4621,13 @@ function bulkDeleteRecords(recordIds) {
         
         // Always reload DNS records to refresh the UI
         loadDNSRecords(domain);
+        loadSnapshots(domain);
+        
+        loadDeletedRecords(domain);
         
-        if (actualSuccessCount > 0) {
+        if (actualSuccessCount > 0 && data.undo_id) {
+            showUndoNotification(domain, `Successfully deleted ${actualSuccessCount} record(s)`, data.undo_id);
+        } else if (actualSuccessCount > 0) {
             showNotification(`Successfully deleted ${actualSuccessCount} record(s)`, 'success');
         } else if (data.total_count > 0) {
             // Records might have been deleted already or don't exist
@@ -2262,10 +4674,92 @@ function clearAllSelections() {
     updateBulkActionsVisibility();
 }
 
+// Record types Cloudflare can proxy
+const PROXIABLE_TYPES = ['A', 'AAAA', 'CNAME'];
+
+// Proxy defaults of the account and zones, loaded on the DNS page
+let proxyPolicy = null;
+
+// Proxy defaults for new records and proxy on/off for selected records on the DNS page
+function setupRecordProxy(domain) {
+    document.getElementById('bulk-proxy-on')?.addEventListener('click', () => setSelectedRecordsProxy(domain, true));
+    document.getElementById('bulk-proxy-off')?.addEventListener('click', () => setSelectedRecordsProxy(domain, false));
+    document.getElementById('add-record-type')?.addEventListener('change', () => applyProxyDefault(domain));
+    
+    fetch('/api/proxy/policy')
+        .then(response => response.json())
+        .then(data => {
+            if (data.success) {
+                proxyPolicy = data.data;
+            }
+        })
+        .catch(error => console.error('Failed to load proxy policy:', error));
+}
+
+// Whether new records of a type are proxied in a zone
+function proxyDefault(domain, type) {
+    if (!PROXIABLE_TYPES.includes(type)) return false;
+    if (!proxyPolicy) return true;
+    
+    const zoneDefaults = (proxyPolicy.zones || {})[domain.toLowerCase()] || {};
+    if (type in zoneDefaults) return zoneDefaults[type];
+    return !!(proxyPolicy.defaults || {})[type];
+}
+
+// Set the proxied checkbox of the add record form to the default of the chosen type
+function applyProxyDefault(domain) {
+    const type = document.getElementById('add-record-type').value;
+    const checkbox = document.getElementById('add-record-proxied');
+    if (!checkbox) return;
+    
+    checkbox.checked = proxyDefault(domain, type);
+    checkbox.disabled = !PROXIABLE_TYPES.includes(type);
+}
+
+// Turn the proxy on or off for the selected records
+function setSelectedRecordsProxy(domain, proxied) {
+    const recordIds = getSelectedRecords();
+    if (recordIds.length === 0) {
+        showNotification('Please select records first', 'error');
+        return;
+    }
+    
+    const buttons = ['bulk-proxy-on', 'bulk-proxy-off'].map(id => document.getElementById(id));
+    buttons.forEach(btn => btn.disabled = true);
+    
+    fetch(`/api/dns/${encodeURIComponent(domain)}/proxy`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ record_ids: recordIds, proxied: proxied }),
+    })
+        .then(response => response.json())
+        .then(data => {
+            const result = (data.results || [])[0];
+            const skipped = result ? (result.changes || []).filter(change => change.action === 'skip' || !change.success) : [];
+            showNotification(data.message || 'Failed to change the proxy status', data.success ? 'success' : 'error');
+            if (skipped.length > 0) {
+                const change = skipped[0];
+                showNotification(`${skipped.length} record(s) left unchanged: ${change.error || (change.warnings || [])[0] || ''}`, 'warning');
+            }
+            loadDNSRecords(domain);
+            loadSnapshots(domain);
+        })
+        .catch(error => {
+            showNotification(`Error: ${error.message || 'Something went wrong'}`, 'error');
+        })
+        .finally(() => {
+            buttons.forEach(btn => btn.disabled = false);
+            clearAllSelections();
+        });
+}
+
 // Setup search and filter functionality
 function setupSearchAndFilters() {
     const searchInput = document.getElementById('search-records');
     const typeFilter = document.getElementById('type-filter');
+    const tagFilter = document.getElementById('tag-filter');
     const proxiedFilter = document.getElementById('proxied-filter');
     const resetFiltersBtn = document.getElementById('reset-filters');
     
@@ -2283,6 +4777,10 @@ function setupSearchAndFilters() {
         typeFilter.addEventListener('change', applyFilters);
     }
     
+    if (tagFilter) {
+        tagFilter.addEventListener('input', applyFilters);
+    }
+    
     if (proxiedFilter) {
         proxiedFilter.addEventListener('change', applyFilters);
     }
@@ -2291,6 +4789,7 @@ function setupSearchAndFilters() {
         resetFiltersBtn.addEventListener('click', function() {
             if (searchInput) searchInput.value = '';
             if (typeFilter) typeFilter.value = '';
+            if (tagFilter) tagFilter.value = '';
             if (proxiedFilter) proxiedFilter.value = '';
             applyFilters();
         });
@@ -2304,24 +4803,33 @@ function setupSearchAndFilters() {
 function applyFilters() {
     const searchTerm = document.getElementById('search-records')?.value.toLowerCase().trim() || '';
     const typeFilter = document.getElementById('type-filter')?.value || '';
+    const tagFilter = document.getElementById('tag-filter')?.value.toLowerCase().trim() || '';
     const proxiedFilter = document.getElementById('proxied-filter')?.value || '';
     
     filteredDNSRecords = allDNSRecords.filter(record => {
+        const recordTags = (record.tags || []).map(tag => tag.toLowerCase());
+        
         // Search filter
         const matchesSearch = !searchTerm ||
             record.type.toLowerCase().includes(searchTerm) ||
             record.name.toLowerCase().includes(searchTerm) ||
-            record.content.toLowerCase().includes(searchTerm);
+            record.content.toLowerCase().includes(searchTerm) ||
+            (record.comment || '').toLowerCase().includes(searchTerm) ||
+            recordTags.some(tag => tag.includes(searchTerm));
         
         // Type filter
         const matchesType = !typeFilter || record.type === typeFilter;
         
+        // Tag filter (matches "name" or "name:value")
+        const matchesTag = !tagFilter ||
+            recordTags.some(tag => tag === tagFilter || tag.split(':')[0] === tagFilter);
+        
         // Proxied filter
         const matchesProxied = !proxiedFilter ||
             (proxiedFilter === 'true' && record.proxied) ||
             (proxiedFilter === 'false' && !record.proxied);
         
-        return matchesSearch && matchesType && matchesProxied;
+        return matchesSearch && matchesType && matchesTag && matchesProxied;
     });
     
     // Reapply current sorting
@@ -2416,6 +4924,11 @@ function confirmDeleteRecord(recordId, recordType, recordName, recordContent) {
     }
 }
 
+// Utility function to split a comma-separated tags input into a list
+function parseTagsInput(text) {
+    return text.split(',').map(tag => tag.trim()).filter(tag => tag !== '');
+}
+
 // Utility function to escape HTML
 function escapeHtml(text) {
     const div = document.createElement('div');
@@ -2443,7 +4956,7 @@ function closeModals() {
 }
 
 // Edit record function
-function editRecord(recordId, recordType, recordName, recordContent, proxied) {
+function editRecord(recordId, recordType, recordName, recordContent, proxied, comment = '', tags = '') {
     const domain = document.getElementById('domain-name').value;
     
     // Fill edit form
@@ -2452,6 +4965,8 @@ function editRecord(recordId, recordType, recordName, recordContent, proxied) {
     document.getElementById('edit-record-name').value = recordName;
     document.getElementById('edit-record-content').value = recordContent;
     document.getElementById('edit-record-proxied').checked = proxied;
+    document.getElementById('edit-record-comment').value = comment;
+    document.getElementById('edit-record-tags').value = tags;
     
     // Show edit modal
     document.getElementById('edit-record-modal').classList.add('active');
@@ -2464,7 +4979,9 @@ function saveEditedRecord() {
     const recordType = document.getElementById('edit-record-type').value;
     const recordName = document.getElementById('edit-record-name').value;
     let recordContent = document.getElementById('edit-record-content').value;
-    const recordProxied = document.getElementById('edit-record-proxied').checked;
+    const recordProxied = PROXIABLE_TYPES.includes(recordType) && document.getElementById('edit-record-proxied').checked;
+    const recordComment = document.getElementById('edit-record-comment').value.trim();
+    const recordTags = parseTagsInput(document.getElementById('edit-record-tags').value);
     
     // Validate inputs
     if (!recordType || !recordName || !recordContent) {
@@ -2493,13 +5010,16 @@ function saveEditedRecord() {
             type: recordType,
             name: recordName,
             content: recordContent,
-            proxied: recordProxied
+            proxied: recordProxied,
+            comment: recordComment,
+            tags: recordTags
         }),
     })
     .then(response => response.json())
     .then(data => {
         if (data.success) {
             showNotification(data.message || 'Record updated successfully', 'success');
+            showValidationWarnings(data.warnings);
             closeModals();
             
             // Reload records to show the updated data
@@ -2536,11 +5056,16 @@ function deleteRecord() {
     .then(response => response.json())
     .then(data => {
         if (data.success) {
-            showNotification(data.message || 'Record deleted successfully', 'success');
+            if (data.undo_id) {
+                showUndoNotification(domain, data.message || 'Record deleted successfully', data.undo_id);
+            } else {
+                showNotification(data.message || 'Record deleted successfully', 'success');
+            }
             closeModals();
             
             // Reload records to show the updated data
             loadDNSRecords(domain);
+            loadDeletedRecords(domain);
         } else {
             showNotification(`Error: ${data.message || 'Failed to delete record'}`, 'error');
         }
@@ -2613,6 +5138,7 @@ function displayResultsLog(results) {
                 <strong>${result.line || ''}</strong>
                 <div>${result.message || ''}</div>
                 ${result.error ? `<div class="error-details">${result.error}</div>` : ''}
+                ${(result.warnings || []).map(warning => `<div class="warning-details"><i class="fas fa-exclamation-triangle"></i> ${escapeHtml(warning)}</div>`).join('')}
             </div>
         `;
         
@@ -2887,6 +5413,13 @@ function clearAllSavedCredentials() {
     }
 }
 
+// Show validator warnings returned alongside a successful write
+function showValidationWarnings(warnings) {
+    (warnings || []).forEach(warning => {
+        showNotification(`⚠️ ${warning.message || warning}`, 'warning');
+    });
+}
+
 // Add Record Modal Functions
 function openAddRecordModal() {
     const modal = document.getElementById('add-record-modal');
@@ -2895,7 +5428,9 @@ function openAddRecordModal() {
         document.getElementById('add-record-type').value = 'A';
         document.getElementById('add-record-name').value = '';
         document.getElementById('add-record-content').value = '';
-        document.getElementById('add-record-proxied').checked = true;
+        applyProxyDefault(getCurrentDomain());
+        document.getElementById('add-record-comment').value = '';
+        document.getElementById('add-record-tags').value = '';
         
         // Show the modal
         modal.classList.add('active');
@@ -2912,7 +5447,9 @@ function createNewRecord() {
     const type = document.getElementById('add-record-type').value;
     const name = document.getElementById('add-record-name').value.trim();
     const content = document.getElementById('add-record-content').value.trim();
-    const proxied = document.getElementById('add-record-proxied').checked;
+    const proxied = PROXIABLE_TYPES.includes(type) && document.getElementById('add-record-proxied').checked;
+    const comment = document.getElementById('add-record-comment').value.trim();
+    const tags = parseTagsInput(document.getElementById('add-record-tags').value);
     
     // Validate form
     if (!type || !name || !content) {
@@ -2936,13 +5473,16 @@ function createNewRecord() {
             type: type,
             name: name,
             content: content,
-            proxied: proxied
+            proxied: proxied,
+            comment: comment,
+            tags: tags
         }),
     })
     .then(response => response.json())
     .then(data => {
         if (data.success) {
             showNotification(data.message || 'DNS record created successfully', 'success');
+            showValidationWarnings(data.warnings);
             
             // Close modal and reload records
             closeModals();
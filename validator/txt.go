@@ -0,0 +1,88 @@
+package validator
+
+import (
+	"strings"
+)
+
+// checkTXT validates TXT content length and, for SPF records, the lookup count
+func checkTXT(result *Result, content string) {
+	if len(content) > MaxTXTContentLength {
+		result.add(SeverityError, CodeTXTTooLong, "content", "TXT content is %d characters; the maximum is %d", len(content), MaxTXTContentLength)
+	}
+
+	for _, s := range txtStrings(content) {
+		if len(s) > maxTXTStringLength {
+			result.add(SeverityWarning, CodeTXTStringSplit, "content", "TXT string of %d characters exceeds %d and will be split into multiple strings", len(s), maxTXTStringLength)
+			break
+		}
+	}
+
+	if isSPF(content) {
+		if lookups := countSPFLookups(unquoteTXT(content)); lookups > MaxSPFLookups {
+			result.add(SeverityError, CodeSPFTooManyLookups, "content", "SPF record requires %d DNS lookups; the limit is %d", lookups, MaxSPFLookups)
+		}
+	}
+}
+
+// txtStrings splits TXT content into its character-strings. Unquoted content is a
+// single string; quoted content may hold several "..." "..." strings.
+func txtStrings(content string) []string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "\"") {
+		return []string{content}
+	}
+
+	var strs []string
+	var current strings.Builder
+	inQuotes := false
+	escaped := false
+	for _, r := range content {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			if inQuotes {
+				strs = append(strs, current.String())
+				current.Reset()
+			}
+			inQuotes = !inQuotes
+		case inQuotes:
+			current.WriteRune(r)
+		}
+	}
+	if inQuotes {
+		strs = append(strs, current.String())
+	}
+	return strs
+}
+
+// unquoteTXT joins the character-strings of TXT content into its logical value
+func unquoteTXT(content string) string {
+	return strings.Join(txtStrings(content), "")
+}
+
+// isSPF reports whether TXT content is an SPF policy
+func isSPF(content string) bool {
+	value := strings.ToLower(unquoteTXT(content))
+	return value == "v=spf1" || strings.HasPrefix(value, "v=spf1 ")
+}
+
+// countSPFLookups counts the SPF terms that trigger DNS lookups (RFC 7208 section 4.6.4)
+func countSPFLookups(policy string) int {
+	lookups := 0
+	for _, term := range strings.Fields(strings.ToLower(policy)) {
+		term = strings.TrimLeft(term, "+-~?")
+		mechanism := term
+		if i := strings.IndexAny(term, ":/="); i >= 0 {
+			mechanism = term[:i]
+		}
+		switch mechanism {
+		case "include", "a", "mx", "ptr", "exists", "redirect":
+			lookups++
+		}
+	}
+	return lookups
+}
@@ -0,0 +1,324 @@
+// Package validator checks DNS records before they are sent to Cloudflare and
+// reports structured errors (which block the write) and warnings (which do not).
+package validator
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Severity describes how serious a validation issue is
+type Severity string
+
+const (
+	// SeverityError blocks the record from being written
+	SeverityError Severity = "error"
+	// SeverityWarning is reported to the user but does not block the write
+	SeverityWarning Severity = "warning"
+)
+
+// Issue codes returned by the validator
+const (
+	CodeInvalidName       = "invalid_name"
+	CodeInvalidIPv4       = "invalid_ipv4"
+	CodeInvalidIPv6       = "invalid_ipv6"
+	CodeInvalidTarget     = "invalid_target"
+	CodeEmptyContent      = "empty_content"
+	CodeCNAMEApex         = "cname_at_apex"
+	CodeCNAMEConflict     = "cname_conflict"
+	CodeCNAMESelf         = "cname_self_reference"
+	CodeProxyUnsupported  = "proxy_unsupported"
+	CodeProxyPrivateIP    = "proxy_private_ip"
+	CodeTXTTooLong        = "txt_too_long"
+	CodeTXTStringSplit    = "txt_string_split"
+	CodeSPFTooManyLookups = "spf_too_many_lookups"
+	CodeSPFMultiple       = "spf_multiple_records"
+	CodeDuplicateRecord   = "duplicate_record"
+)
+
+// Limits enforced by the validator
+const (
+	// MaxTXTContentLength is the longest TXT content Cloudflare accepts
+	MaxTXTContentLength = 2048
+	// MaxSPFLookups is the RFC 7208 limit on DNS-querying SPF terms
+	MaxSPFLookups = 10
+
+	maxTXTStringLength = 255
+	maxNameLength      = 253
+	maxLabelLength     = 63
+)
+
+// Issue is a single validation finding for a record
+type Issue struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Field    string   `json:"field,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// Record is the minimal view of a DNS record the validator works on. Names are
+// fully qualified (without trailing dot) and content is in the textual format
+// used by the bulk editor, e.g. "10 mail.example.com" for MX.
+type Record struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	Proxied bool   `json:"proxied"`
+}
+
+// Result collects the errors and warnings found for a record
+type Result struct {
+	Errors   []Issue `json:"errors"`
+	Warnings []Issue `json:"warnings"`
+}
+
+// Valid reports whether the record can be written (warnings are allowed)
+func (r Result) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Messages returns all error messages joined for display in single-line results
+func (r Result) Messages() string {
+	messages := make([]string, 0, len(r.Errors))
+	for _, issue := range r.Errors {
+		messages = append(messages, issue.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// WarningMessages returns the warning messages as a list of strings
+func (r Result) WarningMessages() []string {
+	messages := make([]string, 0, len(r.Warnings))
+	for _, issue := range r.Warnings {
+		messages = append(messages, issue.Message)
+	}
+	return messages
+}
+
+func (r *Result) add(severity Severity, code, field, format string, args ...interface{}) {
+	issue := Issue{Severity: severity, Code: code, Field: field, Message: fmt.Sprintf(format, args...)}
+	if severity == SeverityError {
+		r.Errors = append(r.Errors, issue)
+	} else {
+		r.Warnings = append(r.Warnings, issue)
+	}
+}
+
+// Validate checks a single record destined for the zone against the records that will
+// exist alongside it. Callers remove from existing any records the write replaces
+// (see ExcludeID and ExcludeNameType).
+func Validate(zone string, record Record, existing []Record) Result {
+	result := Result{Errors: []Issue{}, Warnings: []Issue{}}
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	name := strings.ToLower(strings.TrimSuffix(record.Name, "."))
+	content := strings.TrimSpace(record.Content)
+
+	// Name checks
+	if err := checkHostname(name, true); err != nil {
+		result.add(SeverityError, CodeInvalidName, "name", "Invalid record name %q: %s", record.Name, err.Error())
+	} else if name != zone && !strings.HasSuffix(name, "."+zone) {
+		result.add(SeverityError, CodeInvalidName, "name", "Record name %q is outside of zone %s", record.Name, zone)
+	}
+
+	if content == "" {
+		result.add(SeverityError, CodeEmptyContent, "content", "Record content is required")
+		return result
+	}
+
+	// Type-specific content checks
+	switch record.Type {
+	case "A":
+		ip := net.ParseIP(content)
+		if ip == nil || ip.To4() == nil || strings.Contains(content, ":") {
+			result.add(SeverityError, CodeInvalidIPv4, "content", "A record content %q is not a valid IPv4 address", content)
+		} else if record.Proxied && IsNonRoutable(ip) {
+			result.add(SeverityWarning, CodeProxyPrivateIP, "proxied", "Proxied A record points to non-routable address %s; Cloudflare cannot reach it", content)
+		}
+	case "AAAA":
+		ip := net.ParseIP(content)
+		if ip == nil || !strings.Contains(content, ":") {
+			result.add(SeverityError, CodeInvalidIPv6, "content", "AAAA record content %q is not a valid IPv6 address", content)
+		} else if record.Proxied && IsNonRoutable(ip) {
+			result.add(SeverityWarning, CodeProxyPrivateIP, "proxied", "Proxied AAAA record points to non-routable address %s; Cloudflare cannot reach it", content)
+		}
+	case "CNAME":
+		target := strings.ToLower(strings.TrimSuffix(content, "."))
+		if err := checkHostname(target, false); err != nil {
+			result.add(SeverityError, CodeInvalidTarget, "content", "CNAME target %q is not a valid hostname: %s", content, err.Error())
+		} else if target == name {
+			result.add(SeverityError, CodeCNAMESelf, "content", "CNAME %s points to itself", record.Name)
+		}
+		if name == zone {
+			result.add(SeverityWarning, CodeCNAMEApex, "name", "CNAME at the zone apex %s is flattened by Cloudflare and returned as A/AAAA records", zone)
+		}
+	case "NS", "PTR":
+		if err := checkHostname(strings.TrimSuffix(content, "."), false); err != nil {
+			result.add(SeverityError, CodeInvalidTarget, "content", "%s target %q is not a valid hostname: %s", record.Type, content, err.Error())
+		}
+	case "MX":
+		fields := strings.Fields(content)
+		target := fields[len(fields)-1]
+		if target != "." {
+			if err := checkHostname(strings.TrimSuffix(target, "."), false); err != nil {
+				result.add(SeverityError, CodeInvalidTarget, "content", "MX target %q is not a valid hostname: %s", target, err.Error())
+			}
+		}
+	case "SRV":
+		fields := strings.Fields(content)
+		target := fields[len(fields)-1]
+		if target != "." {
+			if err := checkHostname(strings.TrimSuffix(target, "."), false); err != nil {
+				result.add(SeverityError, CodeInvalidTarget, "content", "SRV target %q is not a valid hostname: %s", target, err.Error())
+			}
+		}
+	case "TXT":
+		checkTXT(&result, content)
+	}
+
+	// Proxy eligibility
+	if record.Proxied && !IsProxiableType(record.Type) {
+		result.add(SeverityWarning, CodeProxyUnsupported, "proxied", "%s records cannot be proxied through Cloudflare and will be DNS only", record.Type)
+	}
+
+	// Checks against the rest of the zone
+	spfCount := 0
+	if isSPF(content) && record.Type == "TXT" {
+		spfCount++
+	}
+	for _, other := range existing {
+		otherName := strings.ToLower(strings.TrimSuffix(other.Name, "."))
+		if otherName != name {
+			continue
+		}
+
+		if other.Type == record.Type && sameContent(record.Type, other.Content, content) {
+			result.add(SeverityError, CodeDuplicateRecord, "content", "An identical %s record for %s already exists", record.Type, record.Name)
+			continue
+		}
+
+		if record.Type == "CNAME" || other.Type == "CNAME" {
+			if record.Type == "CNAME" && other.Type == "CNAME" {
+				result.add(SeverityError, CodeCNAMEConflict, "name", "%s already has a CNAME record; only one CNAME is allowed per name", record.Name)
+			} else if record.Type == "CNAME" {
+				result.add(SeverityError, CodeCNAMEConflict, "name", "CNAME %s conflicts with the existing %s record at the same name", record.Name, other.Type)
+			} else {
+				result.add(SeverityError, CodeCNAMEConflict, "name", "%s record %s conflicts with the existing CNAME at the same name", record.Type, record.Name)
+			}
+		}
+
+		if record.Type == "TXT" && other.Type == "TXT" && isSPF(other.Content) {
+			spfCount++
+		}
+	}
+	if spfCount > 1 {
+		result.add(SeverityError, CodeSPFMultiple, "content", "%s would have %d SPF records; only one v=spf1 record is allowed per name", record.Name, spfCount)
+	}
+
+	return result
+}
+
+// ValidateZone lints every record of an existing zone against the others and returns
+// the results keyed by record ID, omitting records without findings
+func ValidateZone(zone string, records []Record) map[string]Result {
+	results := make(map[string]Result)
+	for i, record := range records {
+		others := make([]Record, 0, len(records)-1)
+		others = append(others, records[:i]...)
+		others = append(others, records[i+1:]...)
+
+		result := Validate(zone, record, others)
+		if len(result.Errors) > 0 || len(result.Warnings) > 0 {
+			results[record.ID] = result
+		}
+	}
+	return results
+}
+
+// ExcludeID returns the records without the one with the given ID, used when a
+// record is edited in place
+func ExcludeID(records []Record, id string) []Record {
+	filtered := make([]Record, 0, len(records))
+	for _, record := range records {
+		if record.ID != id {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+// ExcludeNameType returns the records without those matching the name and type,
+// used when a write replaces every record of that name and type
+func ExcludeNameType(records []Record, name, recordType string) []Record {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	filtered := make([]Record, 0, len(records))
+	for _, record := range records {
+		if record.Type == recordType && strings.ToLower(strings.TrimSuffix(record.Name, ".")) == name {
+			continue
+		}
+		filtered = append(filtered, record)
+	}
+	return filtered
+}
+
+// IsProxiableType reports whether Cloudflare can proxy records of the type
+func IsProxiableType(recordType string) bool {
+	return recordType == "A" || recordType == "AAAA" || recordType == "CNAME"
+}
+
+// checkHostname validates the labels of a hostname. Underscore-prefixed labels are
+// always allowed (SRV, DKIM, DMARC) and a leading wildcard label when allowWildcard is set.
+func checkHostname(name string, allowWildcard bool) error {
+	if name == "" {
+		return fmt.Errorf("name is empty")
+	}
+	if len(name) > maxNameLength {
+		return fmt.Errorf("name is longer than %d characters", maxNameLength)
+	}
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if label == "" {
+			return fmt.Errorf("name contains an empty label")
+		}
+		if len(label) > maxLabelLength {
+			return fmt.Errorf("label %q is longer than %d characters", label, maxLabelLength)
+		}
+		if label == "*" {
+			if !allowWildcard || i != 0 {
+				return fmt.Errorf("wildcard is only allowed as the first label")
+			}
+			continue
+		}
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return fmt.Errorf("label %q cannot start or end with a hyphen", label)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return fmt.Errorf("label %q contains invalid character %q", label, r)
+			}
+		}
+	}
+	return nil
+}
+
+// IsNonRoutable reports whether an address cannot be reached from Cloudflare's edge
+func IsNonRoutable(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast()
+}
+
+// sameContent compares record contents, ignoring case and trailing dots for hostname types
+func sameContent(recordType, a, b string) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if recordType == "TXT" {
+		return unquoteTXT(a) == unquoteTXT(b)
+	}
+	if recordType == "A" || recordType == "AAAA" {
+		ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+		if ipA != nil && ipB != nil {
+			return ipA.Equal(ipB)
+		}
+	}
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
@@ -0,0 +1,200 @@
+package validator
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// codes returns the issue codes of a result, errors first
+func codes(r Result) []string {
+	var all []string
+	for _, issue := range append(append([]Issue{}, r.Errors...), r.Warnings...) {
+		all = append(all, issue.Code)
+	}
+	return all
+}
+
+func hasCode(r Result, code string) bool {
+	for _, c := range codes(r) {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidate(t *testing.T) {
+	existing := []Record{
+		{ID: "1", Type: "A", Name: "www.example.com", Content: "203.0.113.10"},
+		{ID: "2", Type: "CNAME", Name: "shop.example.com", Content: "shops.example.net"},
+		{ID: "3", Type: "TXT", Name: "mail.example.com", Content: "v=spf1 include:_spf.example.net ~all"},
+	}
+
+	tests := []struct {
+		name   string
+		record Record
+		valid  bool
+		code   string // Expected error or warning code, if any
+	}{
+		{"valid A", Record{Type: "A", Name: "api.example.com", Content: "203.0.113.11"}, true, ""},
+		{"invalid IPv4", Record{Type: "A", Name: "api.example.com", Content: "203.0.113"}, false, CodeInvalidIPv4},
+		{"IPv6 in A", Record{Type: "A", Name: "api.example.com", Content: "2001:db8::1"}, false, CodeInvalidIPv4},
+		{"invalid IPv6", Record{Type: "AAAA", Name: "api.example.com", Content: "203.0.113.1"}, false, CodeInvalidIPv6},
+		{"proxied private IP", Record{Type: "A", Name: "db.example.com", Content: "10.0.0.1", Proxied: true}, true, CodeProxyPrivateIP},
+		{"proxied MX", Record{Type: "MX", Name: "example.com", Content: "10 mail.example.com", Proxied: true}, true, CodeProxyUnsupported},
+		{"empty content", Record{Type: "TXT", Name: "example.com", Content: " "}, false, CodeEmptyContent},
+		{"name outside zone", Record{Type: "A", Name: "www.example.net", Content: "203.0.113.1"}, false, CodeInvalidName},
+		{"wildcard name", Record{Type: "A", Name: "*.dev.example.com", Content: "203.0.113.1"}, true, ""},
+		{"wildcard not first", Record{Type: "A", Name: "dev.*.example.com", Content: "203.0.113.1"}, false, CodeInvalidName},
+		{"invalid label", Record{Type: "A", Name: "-bad.example.com", Content: "203.0.113.1"}, false, CodeInvalidName},
+		{"CNAME at apex", Record{Type: "CNAME", Name: "example.com", Content: "target.example.net"}, true, CodeCNAMEApex},
+		{"CNAME to itself", Record{Type: "CNAME", Name: "self.example.com", Content: "self.example.com."}, false, CodeCNAMESelf},
+		{"CNAME next to A", Record{Type: "CNAME", Name: "www.example.com", Content: "target.example.net"}, false, CodeCNAMEConflict},
+		{"A next to CNAME", Record{Type: "A", Name: "shop.example.com", Content: "203.0.113.1"}, false, CodeCNAMEConflict},
+		{"second CNAME", Record{Type: "CNAME", Name: "shop.example.com", Content: "other.example.net"}, false, CodeCNAMEConflict},
+		{"invalid MX target", Record{Type: "MX", Name: "example.com", Content: "10 mail_server!"}, false, CodeInvalidTarget},
+		{"null MX", Record{Type: "MX", Name: "example.com", Content: "0 ."}, true, ""},
+		{"invalid SRV target", Record{Type: "SRV", Name: "_sip._tcp.example.com", Content: "10 5 5060 bad..host"}, false, CodeInvalidTarget},
+		{"duplicate A", Record{Type: "A", Name: "WWW.example.com.", Content: "203.0.113.10"}, false, CodeDuplicateRecord},
+		{"duplicate TXT quoted", Record{Type: "TXT", Name: "mail.example.com", Content: `"v=spf1 include:_spf.example.net ~all"`}, false, CodeDuplicateRecord},
+		{"second SPF", Record{Type: "TXT", Name: "mail.example.com", Content: "v=spf1 -all"}, false, CodeSPFMultiple},
+		{"SPF on other name", Record{Type: "TXT", Name: "example.com", Content: "v=spf1 -all"}, true, ""},
+		{"TXT too long", Record{Type: "TXT", Name: "example.com", Content: strings.Repeat("a", MaxTXTContentLength+1)}, false, CodeTXTTooLong},
+		{"TXT string split", Record{Type: "TXT", Name: "example.com", Content: strings.Repeat("a", 300)}, true, CodeTXTStringSplit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Validate("example.com", tt.record, existing)
+			if result.Valid() != tt.valid {
+				t.Errorf("Valid() = %v, want %v (issues %v)", result.Valid(), tt.valid, codes(result))
+			}
+			if tt.code != "" && !hasCode(result, tt.code) {
+				t.Errorf("missing %s, got %v", tt.code, codes(result))
+			}
+			if tt.code == "" && len(codes(result)) > 0 {
+				t.Errorf("unexpected issues %v", codes(result))
+			}
+		})
+	}
+}
+
+func TestCountSPFLookups(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   int
+	}{
+		{"v=spf1 -all", 0},
+		{"v=spf1 ip4:203.0.113.0/24 ip6:2001:db8::/32 -all", 0},
+		{"v=spf1 a mx -all", 2},
+		{"v=spf1 a:mail.example.com mx/24 ptr exists:%{i}.example.com -all", 4},
+		{"v=spf1 include:_spf.google.com ~include:spf.example.net redirect=_spf.example.com", 3},
+		{"V=SPF1 +INCLUDE:a.example.com ?A", 2},
+		{"v=spf1 exp=explain.example.com all", 0},
+	}
+	for _, tt := range tests {
+		if got := countSPFLookups(tt.policy); got != tt.want {
+			t.Errorf("countSPFLookups(%q) = %d, want %d", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestSPFTooManyLookups(t *testing.T) {
+	includes := strings.Repeat("include:a.example.net ", MaxSPFLookups)
+	if result := Validate("example.com", Record{Type: "TXT", Name: "example.com", Content: "v=spf1 " + includes + "-all"}, nil); !result.Valid() {
+		t.Errorf("%d lookups should be allowed, got %v", MaxSPFLookups, codes(result))
+	}
+	result := Validate("example.com", Record{Type: "TXT", Name: "example.com", Content: "v=spf1 " + includes + "mx -all"}, nil)
+	if !hasCode(result, CodeSPFTooManyLookups) {
+		t.Errorf("expected %s, got %v", CodeSPFTooManyLookups, codes(result))
+	}
+}
+
+func TestTXTStrings(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"plain text", []string{"plain text"}},
+		{`"one"`, []string{"one"}},
+		{`"one" "two"`, []string{"one", "two"}},
+		{`"with \"quote\""`, []string{`with "quote"`}},
+		{`"unterminated`, []string{"unterminated"}},
+	}
+	for _, tt := range tests {
+		got := txtStrings(tt.content)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("txtStrings(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestExcludeID(t *testing.T) {
+	records := []Record{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+	got := ExcludeID(records, "2")
+	if len(got) != 2 || got[0].ID != "1" || got[1].ID != "3" {
+		t.Errorf("ExcludeID = %v", got)
+	}
+	if got := ExcludeID(records, "missing"); len(got) != 3 {
+		t.Errorf("ExcludeID with an unknown ID removed records: %v", got)
+	}
+}
+
+func TestExcludeNameType(t *testing.T) {
+	records := []Record{
+		{ID: "1", Type: "A", Name: "www.example.com"},
+		{ID: "2", Type: "A", Name: "WWW.example.com."},
+		{ID: "3", Type: "AAAA", Name: "www.example.com"},
+		{ID: "4", Type: "A", Name: "api.example.com"},
+	}
+	got := ExcludeNameType(records, "www.example.com.", "A")
+	if len(got) != 2 || got[0].ID != "3" || got[1].ID != "4" {
+		t.Errorf("ExcludeNameType = %v", got)
+	}
+}
+
+func TestEditInPlaceIsNotDuplicate(t *testing.T) {
+	existing := []Record{{ID: "1", Type: "A", Name: "www.example.com", Content: "203.0.113.10"}}
+	record := Record{ID: "1", Type: "A", Name: "www.example.com", Content: "203.0.113.10"}
+	if result := Validate("example.com", record, ExcludeID(existing, "1")); !result.Valid() {
+		t.Errorf("editing a record without changes should be valid, got %v", codes(result))
+	}
+}
+
+func TestValidateZone(t *testing.T) {
+	records := []Record{
+		{ID: "1", Type: "A", Name: "www.example.com", Content: "203.0.113.10"},
+		{ID: "2", Type: "CNAME", Name: "www.example.com", Content: "target.example.net"},
+		{ID: "3", Type: "A", Name: "api.example.com", Content: "203.0.113.11"},
+	}
+	results := ValidateZone("example.com", records)
+	if len(results) != 2 {
+		t.Fatalf("expected findings for 2 records, got %v", results)
+	}
+	if _, ok := results["3"]; ok {
+		t.Errorf("record without findings was reported")
+	}
+	if !hasCode(results["2"], CodeCNAMEConflict) {
+		t.Errorf("expected a CNAME conflict, got %v", codes(results["2"]))
+	}
+}
+
+func TestIsNonRoutable(t *testing.T) {
+	tests := map[string]bool{
+		"10.1.2.3":    true,
+		"192.168.1.1": true,
+		"127.0.0.1":   true,
+		"169.254.1.1": true,
+		"0.0.0.0":     true,
+		"fd00::1":     true,
+		"::1":         true,
+		"203.0.113.1": false,
+		"2001:db8::1": false,
+	}
+	for address, want := range tests {
+		if got := IsNonRoutable(net.ParseIP(address)); got != want {
+			t.Errorf("IsNonRoutable(%s) = %v, want %v", address, got, want)
+		}
+	}
+}